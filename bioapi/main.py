@@ -1,5 +1,5 @@
 import logging
-from fastapi import FastAPI, HTTPException, UploadFile, File
+from fastapi import FastAPI, HTTPException, UploadFile, File, Request
 from fastapi.middleware.cors import CORSMiddleware
 from pydantic import BaseModel
 import uvicorn
@@ -17,7 +17,17 @@ from molecular_docking import get_docking_engine
 from molecular_dynamics import get_md_engine
 from lead_optimization import get_lead_optimizer
 
-logging.basicConfig(level=logging.INFO)
+from request_logging import (
+    REQUEST_ID_HEADER,
+    TRACEPARENT_HEADER,
+    parse_trace_id,
+    request_id_var,
+    resolve_request_id,
+    setup_logging,
+    trace_id_var,
+)
+
+setup_logging()
 logger = logging.getLogger(__name__)
 
 app = FastAPI(title="ProtChain BioAPI", version="1.0.0")
@@ -36,6 +46,27 @@ app.add_middleware(
     allow_headers=["*"],
 )
 
+@app.middleware("http")
+async def add_version_header(request: Request, call_next):
+    """Report the BioAPI version so callers can record which build produced a result"""
+    response = await call_next(request)
+    response.headers["X-BioAPI-Version"] = app.version
+    return response
+
+@app.middleware("http")
+async def request_id_middleware(request: Request, call_next):
+    """Tag the logs of a request with the caller's request and trace IDs and echo the request ID back"""
+    request_id = resolve_request_id(request.headers.get(REQUEST_ID_HEADER, ""))
+    token = request_id_var.set(request_id)
+    trace_token = trace_id_var.set(parse_trace_id(request.headers.get(TRACEPARENT_HEADER, "")))
+    try:
+        response = await call_next(request)
+    finally:
+        trace_id_var.reset(trace_token)
+        request_id_var.reset(token)
+    response.headers[REQUEST_ID_HEADER] = request_id
+    return response
+
 # Initialize analysis modules
 structure_prep = StructurePreparation()
 binding_detector = RealBindingSiteDetection()
@@ -60,7 +91,60 @@ async def root():
 
 @app.get("/health")
 async def health_check():
-    return {"status": "healthy", "service": "bioapi"}
+    return {"status": "healthy", "service": "bioapi", "capabilities": WORKER_CAPABILITIES}
+
+# Worker registration. When PROTCHAIN_API_URL and BIOAPI_WORKER_TOKEN are
+# set, this instance registers itself with the ProtChain API and keeps the
+# registration alive with heartbeats.
+WORKER_CAPABILITIES = [
+    c.strip()
+    for c in os.getenv("BIOAPI_CAPABILITIES", "screening,vina,openmm").split(",")
+    if c.strip()
+]
+
+def _worker_registration_loop():
+    import time
+    import requests
+
+    api_url = os.getenv("PROTCHAIN_API_URL", "").rstrip("/")
+    token = os.getenv("BIOAPI_WORKER_TOKEN", "")
+    advertise_url = os.getenv("BIOAPI_ADVERTISE_URL", "")
+    if not (api_url and token and advertise_url):
+        return
+
+    endpoint = f"{api_url}/api/v1/bioapi/workers"
+    headers = {"Authorization": f"Bearer {token}"}
+    worker_id = None
+    interval = 30
+    while True:
+        try:
+            if worker_id is None:
+                resp = requests.post(
+                    endpoint,
+                    json={"url": advertise_url, "capabilities": WORKER_CAPABILITIES},
+                    headers=headers,
+                    timeout=10,
+                )
+                resp.raise_for_status()
+                data = resp.json()["data"]
+                worker_id = data["id"]
+                interval = max(5, data.get("ttl_seconds", 90) // 3)
+                logger.info(f"Registered with ProtChain API as worker {worker_id}")
+            else:
+                resp = requests.post(f"{endpoint}/{worker_id}/heartbeat", headers=headers, timeout=10)
+                if resp.status_code == 404:
+                    # The registration lapsed; register again right away
+                    worker_id = None
+                    continue
+                resp.raise_for_status()
+        except Exception as e:
+            logger.warning(f"Worker registration failed: {e}")
+        time.sleep(interval)
+
+@app.on_event("startup")
+async def start_worker_registration():
+    import threading
+    threading.Thread(target=_worker_registration_loop, daemon=True).start()
 
 # Structure analysis endpoints
 @app.post("/api/v1/workflows/{workflow_id}/structure")
@@ -504,4 +588,4 @@ async def lead_optimization(request: LeadOptimizationRequest):
 
 if __name__ == "__main__":
     port = int(os.getenv("PORT", 8000))
-    uvicorn.run(app, host="0.0.0.0", port=port)
+    uvicorn.run(app, host="0.0.0.0", port=port, log_config=None)
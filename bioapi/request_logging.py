@@ -0,0 +1,87 @@
+"""
+Structured logging with request IDs.
+
+The ProtChain API sends an X-Request-ID header with every call. It is kept
+in a context variable for the duration of the request and added to every
+log record, so a request can be followed from the API's logs into BioAPI's.
+The trace ID of the W3C traceparent header is logged the same way, linking
+the records to the API's OpenTelemetry trace.
+"""
+
+import json
+import logging
+import os
+import re
+import uuid
+from contextvars import ContextVar
+from datetime import datetime, timezone
+
+REQUEST_ID_HEADER = "X-Request-ID"
+TRACEPARENT_HEADER = "traceparent"
+
+request_id_var: ContextVar[str] = ContextVar("request_id", default="")
+trace_id_var: ContextVar[str] = ContextVar("trace_id", default="")
+
+_VALID_REQUEST_ID = re.compile(r"^[A-Za-z0-9._:-]{1,128}$")
+_TRACEPARENT = re.compile(r"^[0-9a-f]{2}-([0-9a-f]{32})-[0-9a-f]{16}-[0-9a-f]{2}$")
+
+
+def resolve_request_id(header_value: str) -> str:
+    """Adopt a well-formed incoming request ID, or generate a new one."""
+    if header_value and _VALID_REQUEST_ID.match(header_value):
+        return header_value
+    return uuid.uuid4().hex
+
+
+def parse_trace_id(traceparent: str) -> str:
+    """Return the trace ID of a traceparent header, or "" if it is malformed."""
+    match = _TRACEPARENT.match(traceparent.strip().lower()) if traceparent else None
+    if not match or match.group(1) == "0" * 32:
+        return ""
+    return match.group(1)
+
+
+class RequestIDFilter(logging.Filter):
+    """Attach the current request and trace IDs to each record."""
+
+    def filter(self, record: logging.LogRecord) -> bool:
+        record.request_id = request_id_var.get()
+        record.trace_id = trace_id_var.get()
+        return True
+
+
+class JSONFormatter(logging.Formatter):
+    """Format records as one JSON object per line, matching the API's logs."""
+
+    def format(self, record: logging.LogRecord) -> str:
+        entry = {
+            "time": datetime.fromtimestamp(record.created, tz=timezone.utc).isoformat(),
+            "level": record.levelname,
+            "logger": record.name,
+            "msg": record.getMessage(),
+        }
+        request_id = getattr(record, "request_id", "")
+        if request_id:
+            entry["request_id"] = request_id
+        trace_id = getattr(record, "trace_id", "")
+        if trace_id:
+            entry["trace_id"] = trace_id
+        if record.exc_info:
+            entry["exc_info"] = self.formatException(record.exc_info)
+        return json.dumps(entry, default=str)
+
+
+def setup_logging() -> None:
+    """Send all logs, uvicorn's included, through the JSON formatter."""
+    handler = logging.StreamHandler()
+    handler.setFormatter(JSONFormatter())
+    handler.addFilter(RequestIDFilter())
+
+    root = logging.getLogger()
+    root.handlers = [handler]
+    root.setLevel(os.getenv("LOG_LEVEL", "INFO").upper())
+
+    for name in ("uvicorn", "uvicorn.error", "uvicorn.access"):
+        uv = logging.getLogger(name)
+        uv.handlers = []
+        uv.propagate = True
@@ -0,0 +1,154 @@
+// Package apikeys issues and verifies long-lived API keys. A key is shown to
+// its creator once; only its SHA-256 digest and a short display prefix are
+// stored. Personal keys act as the user who created them. Service keys
+// belong to an organization and also act as their creator, but only on
+// that organization's workflows, jobs and routes; they stop working if
+// the creator is no longer an admin of that organization.
+package apikeys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Prefix marks a bearer token as an API key rather than a JWT.
+const Prefix = "pck_"
+
+// displayLength is how much of the key is stored in clear so users can
+// tell their keys apart.
+const displayLength = 12
+
+// lastUsedInterval throttles last_used_at writes so a busy key does not
+// update its row on every request.
+const lastUsedInterval = time.Minute
+
+// Scopes an API key can carry.
+const (
+	ScopeProfileRead    = "profile:read"
+	ScopeProfileWrite   = "profile:write"
+	ScopeWorkflowsRead  = "workflows:read"
+	ScopeWorkflowsWrite = "workflows:write"
+	ScopeJobsRead       = "jobs:read"
+	ScopeJobsWrite      = "jobs:write"
+	ScopeScreeningRun   = "screening:run"
+	ScopeTeamsRead      = "teams:read"
+	ScopeTeamsWrite     = "teams:write"
+)
+
+// Scopes lists every scope a key may be granted.
+var Scopes = []string{
+	ScopeProfileRead,
+	ScopeProfileWrite,
+	ScopeWorkflowsRead,
+	ScopeWorkflowsWrite,
+	ScopeJobsRead,
+	ScopeJobsWrite,
+	ScopeScreeningRun,
+	ScopeTeamsRead,
+	ScopeTeamsWrite,
+}
+
+// ErrInvalid means the key is unknown, revoked or expired.
+var ErrInvalid = errors.New("invalid API key")
+
+// Key is an authenticated API key.
+type Key struct {
+	ID             int
+	UserID         int
+	Email          string
+	OrganizationID *int
+	Scopes         []string
+}
+
+// HasScope reports whether the key was granted scope.
+func (k *Key) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidScope reports whether scope is one of Scopes.
+func ValidScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsKey reports whether a bearer token looks like an API key.
+func IsKey(token string) bool {
+	return strings.HasPrefix(token, Prefix)
+}
+
+// Generate returns a new random key, its display prefix and the digest to
+// store.
+func Generate() (raw, display, hash string, err error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+	raw = Prefix + hex.EncodeToString(b)
+	return raw, raw[:displayLength], Hash(raw), nil
+}
+
+// Hash returns the hex SHA-256 digest of a raw key.
+func Hash(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// Authenticate looks up a raw key and returns it if it is live. It records
+// the time of use as a side effect.
+func Authenticate(ctx context.Context, db *sql.DB, raw string) (*Key, error) {
+	var (
+		k          Key
+		orgID      sql.NullInt64
+		expiresAt  sql.NullTime
+		lastUsedAt sql.NullTime
+	)
+	err := db.QueryRowContext(ctx, `
+		SELECT k.id, k.user_id, u.email, k.organization_id, k.scopes, k.expires_at, k.last_used_at
+		FROM api_keys k
+		JOIN users u ON u.id = k.user_id
+		WHERE k.key_hash = $1 AND k.revoked_at IS NULL
+		  AND (k.organization_id IS NULL OR EXISTS (
+			SELECT 1 FROM organization_members om
+			WHERE om.organization_id = k.organization_id AND om.user_id = k.user_id
+			  AND om.role IN ('admin', 'owner')))
+	`, Hash(raw)).Scan(&k.ID, &k.UserID, &k.Email, &orgID, pq.Array(&k.Scopes), &expiresAt, &lastUsedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if expiresAt.Valid && !now.Before(expiresAt.Time) {
+		return nil, ErrInvalid
+	}
+	if orgID.Valid {
+		id := int(orgID.Int64)
+		k.OrganizationID = &id
+	}
+
+	if !lastUsedAt.Valid || now.Sub(lastUsedAt.Time) >= lastUsedInterval {
+		if _, err := db.ExecContext(ctx, `UPDATE api_keys SET last_used_at = $1 WHERE id = $2`, now, k.ID); err != nil {
+			return nil, err
+		}
+	}
+	return &k, nil
+}
@@ -0,0 +1,49 @@
+package apikeys
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	raw, display, hash, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsKey(raw) || len(raw) != len(Prefix)+48 {
+		t.Errorf("raw key %q", raw)
+	}
+	if len(display) != displayLength || !strings.HasPrefix(raw, display) {
+		t.Errorf("display prefix %q of %q", display, raw)
+	}
+	// Only the digest is stored, so it must not reveal the key
+	if hash != Hash(raw) || len(hash) != 64 || strings.Contains(hash, raw[len(Prefix):]) {
+		t.Errorf("hash %q of %q", hash, raw)
+	}
+
+	other, _, _, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == raw {
+		t.Error("Generate returned the same key twice")
+	}
+	if IsKey("eyJhbGciOiJIUzI1NiJ9.e30.sig") {
+		t.Error("a JWT is taken for an API key")
+	}
+}
+
+func TestScopes(t *testing.T) {
+	k := &Key{Scopes: []string{ScopeWorkflowsRead, ScopeJobsWrite}}
+	if !k.HasScope(ScopeJobsWrite) || k.HasScope(ScopeJobsRead) {
+		t.Errorf("HasScope on %v", k.Scopes)
+	}
+	for _, s := range Scopes {
+		if !ValidScope(s) {
+			t.Errorf("ValidScope(%s) = false", s)
+		}
+	}
+	if ValidScope("admin") || ValidScope("") {
+		t.Error("ValidScope accepted an unknown scope")
+	}
+}
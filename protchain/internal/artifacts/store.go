@@ -0,0 +1,106 @@
+// Package artifacts stores workflow files (structures, compound libraries,
+// docking poses) by the SHA-256 of their content. Identical files are
+// stored once no matter how many workflows reference them.
+package artifacts
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+
+	"protchain/internal/config"
+)
+
+var (
+	ErrNotFound   = errors.New("artifact not found")
+	ErrInvalidKey = errors.New("artifact key must be a lowercase hex SHA-256 digest")
+	ErrTooLarge   = errors.New("artifact exceeds the maximum upload size")
+)
+
+var digestPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Store is a content-addressed blob store. Keys are hex SHA-256 digests of
+// the content; callers should use Save rather than Put so the key is
+// always computed from the bytes actually written.
+type Store interface {
+	// Put stores size bytes from r under key. Storing a key that already
+	// exists is a no-op.
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Get opens the content stored under key.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Exists reports whether key is stored.
+	Exists(ctx context.Context, key string) (bool, error)
+	// Delete removes key. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// New builds the store selected by cfg.ArtifactBackend.
+func New(cfg *config.Config) (Store, error) {
+	switch cfg.ArtifactBackend {
+	case "", "local":
+		return NewLocalStore(cfg.ArtifactDir)
+	case "s3":
+		return NewS3Store(S3Options{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+		})
+	default:
+		return nil, fmt.Errorf("unknown artifact backend %q", cfg.ArtifactBackend)
+	}
+}
+
+// Save hashes r, rejecting content over maxBytes (0 means no limit), and
+// stores it under its digest. It returns the digest and size.
+func Save(ctx context.Context, store Store, r io.Reader, maxBytes int64) (string, int64, error) {
+	// Spool to disk: the digest is only known once the whole stream has
+	// been read, and uploads can be far larger than we want in memory.
+	tmp, err := os.CreateTemp("", "artifact-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	src := r
+	if maxBytes > 0 {
+		src = io.LimitReader(r, maxBytes+1)
+	}
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), src)
+	if err != nil {
+		return "", 0, err
+	}
+	if maxBytes > 0 && size > maxBytes {
+		return "", 0, ErrTooLarge
+	}
+	digest := hex.EncodeToString(h.Sum(nil))
+
+	exists, err := store.Exists(ctx, digest)
+	if err != nil {
+		return "", 0, err
+	}
+	if !exists {
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return "", 0, err
+		}
+		if err := store.Put(ctx, digest, tmp, size); err != nil {
+			return "", 0, err
+		}
+	}
+	return digest, size, nil
+}
+
+func validKey(key string) error {
+	if !digestPattern.MatchString(key) {
+		return ErrInvalidKey
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package artifacts
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// countingStore records calls so tests can check Save skips existing keys.
+type countingStore struct {
+	Store
+	puts int
+}
+
+func (s *countingStore) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	s.puts++
+	return s.Store.Put(ctx, key, r, size)
+}
+
+func newLocal(t *testing.T) *LocalStore {
+	t.Helper()
+	s, err := NewLocalStore(filepath.Join(t.TempDir(), "artifacts"))
+	if err != nil {
+		t.Fatalf("NewLocalStore: %v", err)
+	}
+	return s
+}
+
+func TestSave(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		maxBytes int64
+		digest   string
+		err      error
+	}{
+		{
+			name:    "empty",
+			content: "",
+			digest:  "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		},
+		{
+			name:    "no limit",
+			content: "abc",
+			digest:  "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+		},
+		{
+			name:     "exactly at limit",
+			content:  "abc",
+			maxBytes: 3,
+			digest:   "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+		},
+		{
+			name:     "over limit",
+			content:  "abcd",
+			maxBytes: 3,
+			err:      ErrTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := newLocal(t)
+
+			digest, size, err := Save(ctx, store, strings.NewReader(tt.content), tt.maxBytes)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Save error = %v, want %v", err, tt.err)
+			}
+			if tt.err != nil {
+				return
+			}
+			if digest != tt.digest {
+				t.Errorf("digest = %s, want %s", digest, tt.digest)
+			}
+			if size != int64(len(tt.content)) {
+				t.Errorf("size = %d, want %d", size, len(tt.content))
+			}
+
+			rc, err := store.Get(ctx, digest)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			defer rc.Close()
+			got, err := io.ReadAll(rc)
+			if err != nil {
+				t.Fatalf("reading artifact: %v", err)
+			}
+			if string(got) != tt.content {
+				t.Errorf("stored content = %q, want %q", got, tt.content)
+			}
+		})
+	}
+}
+
+func TestSaveTooLargeStoresNothing(t *testing.T) {
+	ctx := context.Background()
+	store := &countingStore{Store: newLocal(t)}
+
+	if _, _, err := Save(ctx, store, strings.NewReader("abcd"), 3); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("Save error = %v, want ErrTooLarge", err)
+	}
+	if store.puts != 0 {
+		t.Errorf("Put called %d times for an oversized upload", store.puts)
+	}
+}
+
+func TestSaveDeduplicates(t *testing.T) {
+	ctx := context.Background()
+	store := &countingStore{Store: newLocal(t)}
+
+	first, _, err := Save(ctx, store, strings.NewReader("ATOM      1  N   MET A   1\n"), 0)
+	if err != nil {
+		t.Fatalf("first Save: %v", err)
+	}
+	second, _, err := Save(ctx, store, strings.NewReader("ATOM      1  N   MET A   1\n"), 0)
+	if err != nil {
+		t.Fatalf("second Save: %v", err)
+	}
+	if first != second {
+		t.Errorf("identical content saved under %s and %s", first, second)
+	}
+	if store.puts != 1 {
+		t.Errorf("Put called %d times, want 1", store.puts)
+	}
+
+	other, _, err := Save(ctx, store, strings.NewReader("HETATM"), 0)
+	if err != nil {
+		t.Fatalf("third Save: %v", err)
+	}
+	if other == first {
+		t.Error("different content saved under the same digest")
+	}
+	if store.puts != 2 {
+		t.Errorf("Put called %d times, want 2", store.puts)
+	}
+}
+
+func TestLocalStore(t *testing.T) {
+	ctx := context.Background()
+	store := newLocal(t)
+	const key = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+
+	if ok, err := store.Exists(ctx, key); err != nil || ok {
+		t.Fatalf("Exists before Put = %v, %v; want false, nil", ok, err)
+	}
+	if _, err := store.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get before Put error = %v, want ErrNotFound", err)
+	}
+
+	if err := store.Put(ctx, key, strings.NewReader("abc"), 3); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(store.root, "ba", key)); err != nil {
+		t.Errorf("blob not sharded by digest prefix: %v", err)
+	}
+	if ok, err := store.Exists(ctx, key); err != nil || !ok {
+		t.Fatalf("Exists after Put = %v, %v; want true, nil", ok, err)
+	}
+
+	// A second Put of an existing key keeps the original content.
+	if err := store.Put(ctx, key, strings.NewReader("xyz"), 3); err != nil {
+		t.Fatalf("second Put: %v", err)
+	}
+	rc, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	got, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(got) != "abc" {
+		t.Errorf("content after second Put = %q, want %q", got, "abc")
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if ok, _ := store.Exists(ctx, key); ok {
+		t.Error("key still exists after Delete")
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Errorf("Delete of missing key: %v", err)
+	}
+
+	leftovers, err := filepath.Glob(filepath.Join(store.root, "ba", ".upload-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leftovers) > 0 {
+		t.Errorf("temporary upload files left behind: %v", leftovers)
+	}
+}
+
+func TestLocalStoreRejectsInvalidKeys(t *testing.T) {
+	ctx := context.Background()
+	store := newLocal(t)
+
+	for _, key := range []string{
+		"",
+		"abc",
+		"BA7816BF8F01CFEA414140DE5DAE2223B00361A396177A9CB410FF61F20015AD",
+		"../../../../etc/passwd",
+		"ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad/..",
+	} {
+		if err := store.Put(ctx, key, strings.NewReader("x"), 1); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q) error = %v, want ErrInvalidKey", key, err)
+		}
+		if _, err := store.Get(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Get(%q) error = %v, want ErrInvalidKey", key, err)
+		}
+		if _, err := store.Exists(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Exists(%q) error = %v, want ErrInvalidKey", key, err)
+		}
+		if err := store.Delete(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Delete(%q) error = %v, want ErrInvalidKey", key, err)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Package audit records who changed what in activity_log. Entries are
+// written in the same transaction as the change wherever one exists, so an
+// action is never committed without its audit entry.
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Actions recorded in activity_log.
+const (
+	WorkflowCreated             = "workflow.created"
+	WorkflowUpdated             = "workflow.updated"
+	WorkflowDeleted             = "workflow.deleted"
+	WorkflowShared              = "workflow.shared"
+	WorkflowPermissionChanged   = "workflow.permission_changed"
+	WorkflowBlockchainCommitted = "workflow.blockchain_committed"
+	WorkflowBundlePublished     = "workflow.bundle_published"
+	WorkflowHitsAnchored        = "workflow.hits_anchored"
+	WorkflowRegistered          = "workflow.registered"
+	WorkflowArtifactUploaded    = "workflow.artifact_uploaded"
+
+	OrganizationCreated       = "organization.created"
+	OrganizationUpdated       = "organization.updated"
+	OrganizationDeleted       = "organization.deleted"
+	OrganizationMemberInvited = "organization.member_invited"
+	OrganizationMemberRemoved = "organization.member_removed"
+
+	InvitationAccepted = "invitation.accepted"
+	InvitationDeclined = "invitation.declined"
+	InvitationRevoked  = "invitation.revoked"
+	InvitationResent   = "invitation.resent"
+
+	TeamCreated       = "team.created"
+	TeamUpdated       = "team.updated"
+	TeamDeleted       = "team.deleted"
+	TeamMemberAdded   = "team.member_added"
+	TeamMemberRemoved = "team.member_removed"
+	TeamMemberInvited = "team.member_invited"
+
+	TemplateCreated = "template.created"
+	TemplateUpdated = "template.updated"
+	TemplateDeleted = "template.deleted"
+
+	APIKeyCreated = "api_key.created"
+	APIKeyRevoked = "api_key.revoked"
+)
+
+// Target types an entry can point at.
+const (
+	TargetWorkflow     = "workflow"
+	TargetPermission   = "workflow_permission"
+	TargetOrganization = "organization"
+	TargetTeam         = "team"
+	TargetUser         = "user"
+	TargetInvitation   = "invitation"
+	TargetAPIKey       = "api_key"
+	TargetTemplate     = "workflow_template"
+	TargetArtifact     = "artifact"
+)
+
+// Execer is satisfied by *sql.DB and *sql.Tx.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Entry is one audited action. When WorkflowID is set and OrganizationID or
+// TeamID are not, they are filled in from the workflow's team so the entry
+// also shows up in the organization's trail.
+type Entry struct {
+	ActorID        int
+	Action         string
+	OrganizationID *int
+	TeamID         *int
+	WorkflowID     *int
+	TargetType     string
+	TargetID       *int
+	Before         map[string]interface{}
+	After          map[string]interface{}
+	Details        string
+	RequestID      string
+	APIKeyID       *int
+}
+
+// Record writes e to activity_log.
+func Record(ctx context.Context, q Execer, e Entry) error {
+	before, err := marshal(e.Before)
+	if err != nil {
+		return err
+	}
+	after, err := marshal(e.After)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.ExecContext(ctx, `
+		INSERT INTO activity_log (user_id, organization_id, team_id, workflow_id, action, target_type, target_id,
+		                          before_state, after_state, details, request_id, api_key_id, created_at)
+		SELECT $1::int, COALESCE($2::int, t.organization_id), COALESCE($3::int, t.id), $4::int, $5::text, $6::text, $7::int,
+		       $8::jsonb, $9::jsonb, $10::text, $11::text, $12::int, $13::timestamptz
+		FROM (SELECT 1) AS one
+		LEFT JOIN workflows w ON w.id = $4::int
+		LEFT JOIN teams t ON t.id = COALESCE($3::int, NULLIF(w.team_id, 0))
+	`, e.ActorID, e.OrganizationID, e.TeamID, e.WorkflowID, e.Action, nullString(e.TargetType), e.TargetID,
+		before, after, nullString(e.Details), nullString(e.RequestID), e.APIKeyID, time.Now())
+	return err
+}
+
+// Diff reduces two snapshots to the fields that changed, so an update entry
+// records only what it touched. Values are compared by their JSON encoding.
+func Diff(before, after map[string]interface{}) (map[string]interface{}, map[string]interface{}) {
+	b := make(map[string]interface{})
+	a := make(map[string]interface{})
+	for k, av := range after {
+		bv, ok := before[k]
+		if ok && sameJSON(av, bv) {
+			continue
+		}
+		if ok {
+			b[k] = bv
+		}
+		a[k] = av
+	}
+	for k, bv := range before {
+		if _, ok := after[k]; !ok {
+			b[k] = bv
+		}
+	}
+	return b, a
+}
+
+func sameJSON(x, y interface{}) bool {
+	xb, err1 := json.Marshal(x)
+	yb, err2 := json.Marshal(y)
+	return err1 == nil && err2 == nil && string(xb) == string(yb)
+}
+
+func marshal(v map[string]interface{}) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,74 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+// recorder is an Execer that keeps the arguments of its last statement.
+type recorder struct {
+	args []interface{}
+}
+
+func (r *recorder) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	r.args = args
+	return nil, nil
+}
+
+func TestRecord(t *testing.T) {
+	workflowID := 9
+	var r recorder
+	err := Record(context.Background(), &r, Entry{
+		ActorID:    3,
+		Action:     WorkflowUpdated,
+		WorkflowID: &workflowID,
+		TargetType: TargetWorkflow,
+		TargetID:   &workflowID,
+		After:      map[string]interface{}{"name": "screen"},
+		RequestID:  "req-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.args) != 13 {
+		t.Fatalf("Record passed %d arguments", len(r.args))
+	}
+	if r.args[0] != 3 || r.args[4] != WorkflowUpdated || r.args[3] != &workflowID {
+		t.Errorf("actor, action, workflow = %v, %v, %v", r.args[0], r.args[4], r.args[3])
+	}
+	// A missing snapshot is NULL rather than the JSON null
+	if before := r.args[7].([]byte); before != nil {
+		t.Errorf("before_state = %s, want NULL", before)
+	}
+	if after := string(r.args[8].([]byte)); after != `{"name":"screen"}` {
+		t.Errorf("after_state = %s", after)
+	}
+	if details := r.args[9].(sql.NullString); details.Valid {
+		t.Errorf("empty details stored as %q", details.String)
+	}
+	if id := r.args[10].(sql.NullString); id.String != "req-1" || !id.Valid {
+		t.Errorf("request_id = %+v", id)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	before, after := Diff(
+		map[string]interface{}{"name": "a", "description": "same", "team_id": 4, "status": "draft"},
+		map[string]interface{}{"name": "b", "description": "same", "team_id": 4.0, "public": true},
+	)
+	// team_id compares equal through JSON although the types differ
+	wantBefore := map[string]interface{}{"name": "a", "status": "draft"}
+	wantAfter := map[string]interface{}{"name": "b", "public": true}
+	if !reflect.DeepEqual(before, wantBefore) {
+		t.Errorf("before = %v, want %v", before, wantBefore)
+	}
+	if !reflect.DeepEqual(after, wantAfter) {
+		t.Errorf("after = %v, want %v", after, wantAfter)
+	}
+
+	if before, after := Diff(map[string]interface{}{"name": "a"}, map[string]interface{}{"name": "a"}); len(before) != 0 || len(after) != 0 {
+		t.Errorf("unchanged snapshots diff to %v, %v", before, after)
+	}
+}
@@ -0,0 +1,133 @@
+// Package authz resolves what a user may do with a workflow. Access comes
+// from owning it, from workflow_permissions grants made to the user, to a
+// team they belong to or to an organization they belong to, and from
+// membership of the team the workflow is filed under.
+package authz
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"protchain/internal/models"
+)
+
+var (
+	// ErrNotFound means the workflow does not exist or the user has no
+	// access to it at all. The two are deliberately indistinguishable.
+	ErrNotFound = errors.New("workflow not found")
+	// ErrForbidden means the user can see the workflow but lacks the
+	// permission required.
+	ErrForbidden = errors.New("insufficient permission")
+)
+
+var ranks = map[string]int{
+	models.PermissionView:  1,
+	models.PermissionEdit:  2,
+	models.PermissionAdmin: 3,
+	models.PermissionOwner: 4,
+}
+
+// Allows reports whether holding level have satisfies need.
+func Allows(have, need string) bool {
+	return have != "" && ranks[have] >= ranks[need]
+}
+
+// LevelForRank maps a rank produced by GrantsQuery back to its level name.
+func LevelForRank(rank int) string {
+	for level, r := range ranks {
+		if r == rank {
+			return level
+		}
+	}
+	return ""
+}
+
+// GrantsQuery yields (workflow_id, rank) for every non-owner grant held by
+// the user bound to $1. Take MAX(rank) per workflow for the effective
+// level:
+//   - explicit grants to the user, their teams or their organizations
+//   - members of the workflow's team get view (edit for team admins)
+//   - admins of the organization that owns the workflow's team get admin
+const GrantsQuery = `
+	SELECT wp.workflow_id, CASE wp.permission_level
+			WHEN 'admin' THEN 3 WHEN 'edit' THEN 2 WHEN 'view' THEN 1 ELSE 0 END AS rank
+	FROM workflow_permissions wp
+	WHERE wp.user_id = $1
+	   OR wp.team_id IN (SELECT team_id FROM team_members WHERE user_id = $1)
+	   OR wp.organization_id IN (SELECT organization_id FROM organization_members WHERE user_id = $1)
+	UNION ALL
+	SELECT w.id, CASE WHEN tm.role IN ('admin', 'owner') THEN 2 ELSE 1 END
+	FROM workflows w
+	JOIN team_members tm ON tm.team_id = w.team_id AND tm.user_id = $1
+	UNION ALL
+	SELECT w.id, 3
+	FROM workflows w
+	JOIN teams t ON t.id = w.team_id
+	JOIN organization_members om ON om.organization_id = t.organization_id
+	WHERE om.user_id = $1 AND om.role IN ('admin', 'owner')`
+
+type Service struct {
+	db *sql.DB
+}
+
+func New(db *sql.DB) *Service {
+	return &Service{db: db}
+}
+
+// WorkflowPermission returns the user's effective level on a workflow, or
+// ErrNotFound if they have none.
+func (s *Service) WorkflowPermission(ctx context.Context, userID, workflowID int) (string, error) {
+	var ownerID int
+	err := s.db.QueryRowContext(ctx, `SELECT user_id FROM workflows WHERE id = $1`, workflowID).Scan(&ownerID)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	if ownerID == userID {
+		return models.PermissionOwner, nil
+	}
+
+	var rank sql.NullInt64
+	err = s.db.QueryRowContext(ctx, `
+		SELECT MAX(g.rank) FROM (`+GrantsQuery+`) g
+		WHERE g.workflow_id = $2
+	`, userID, workflowID).Scan(&rank)
+	if err != nil {
+		return "", err
+	}
+	level := LevelForRank(int(rank.Int64))
+	if level == "" {
+		return "", ErrNotFound
+	}
+	return level, nil
+}
+
+// InOrganization reports whether the workflow is filed under a team of
+// organization orgID.
+func (s *Service) InOrganization(ctx context.Context, workflowID, orgID int) (bool, error) {
+	var ok bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM workflows w
+			JOIN teams t ON t.id = w.team_id
+			WHERE w.id = $1 AND t.organization_id = $2
+		)
+	`, workflowID, orgID).Scan(&ok)
+	return ok, err
+}
+
+// Require checks that the user holds at least need on the workflow and
+// returns the level they actually hold.
+func (s *Service) Require(ctx context.Context, userID, workflowID int, need string) (string, error) {
+	level, err := s.WorkflowPermission(ctx, userID, workflowID)
+	if err != nil {
+		return "", err
+	}
+	if !Allows(level, need) {
+		return level, ErrForbidden
+	}
+	return level, nil
+}
@@ -0,0 +1,214 @@
+package authz_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"protchain/internal/authz"
+	"protchain/internal/database/databasetest"
+	"protchain/internal/models"
+)
+
+// insert runs an INSERT ... RETURNING id and returns the id.
+func insert(t *testing.T, db *sql.DB, query string, args ...interface{}) int {
+	t.Helper()
+	var id int
+	if err := db.QueryRow(query+` RETURNING id`, args...).Scan(&id); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return id
+}
+
+// fixture is an organization with a team and a workflow filed under it,
+// a second organization with its own team and workflow, and a personal
+// workflow, with users holding each kind of access.
+type fixture struct {
+	orgA, orgB              int
+	teamA, teamB            int
+	teamWorkflow, personal  int
+	otherOrgWorkflow        int
+	owner, teamMember       int
+	teamAdmin, teamOwner    int
+	orgMember, orgAdmin     int
+	orgOwner, granted       int
+	outsider, otherOrgAdmin int
+}
+
+func newFixture(t *testing.T, db *sql.DB) *fixture {
+	f := &fixture{}
+	n := 0
+	user := func() int {
+		n++
+		return insert(t, db, `INSERT INTO users (email, password_hash) VALUES ($1, 'x')`, fmt.Sprintf("user%d@example.com", n))
+	}
+	orgMember := func(org, user int, role string) {
+		insert(t, db, `INSERT INTO organization_members (organization_id, user_id, role) VALUES ($1, $2, $3)`, org, user, role)
+	}
+	teamMember := func(team, user int, role string) {
+		insert(t, db, `INSERT INTO team_members (team_id, user_id, role) VALUES ($1, $2, $3)`, team, user, role)
+	}
+
+	f.owner, f.teamMember, f.teamAdmin, f.teamOwner = user(), user(), user(), user()
+	f.orgMember, f.orgAdmin, f.orgOwner, f.granted = user(), user(), user(), user()
+	f.outsider, f.otherOrgAdmin = user(), user()
+
+	f.orgA = insert(t, db, `INSERT INTO organizations (name) VALUES ('A')`)
+	f.orgB = insert(t, db, `INSERT INTO organizations (name) VALUES ('B')`)
+	f.teamA = insert(t, db, `INSERT INTO teams (organization_id, name) VALUES ($1, 'a')`, f.orgA)
+	f.teamB = insert(t, db, `INSERT INTO teams (organization_id, name) VALUES ($1, 'b')`, f.orgB)
+
+	for _, u := range []int{f.owner, f.teamMember, f.teamAdmin, f.teamOwner, f.orgMember} {
+		orgMember(f.orgA, u, models.RoleMember)
+	}
+	orgMember(f.orgA, f.orgAdmin, models.RoleAdmin)
+	orgMember(f.orgA, f.orgOwner, models.RoleOwner)
+	orgMember(f.orgB, f.otherOrgAdmin, models.RoleAdmin)
+	teamMember(f.teamA, f.teamMember, models.RoleMember)
+	teamMember(f.teamA, f.teamAdmin, models.RoleAdmin)
+	teamMember(f.teamA, f.teamOwner, models.RoleOwner)
+
+	f.teamWorkflow = insert(t, db, `INSERT INTO workflows (user_id, team_id, name) VALUES ($1, $2, 'team')`, f.owner, f.teamA)
+	f.personal = insert(t, db, `INSERT INTO workflows (user_id, name) VALUES ($1, 'personal')`, f.owner)
+	f.otherOrgWorkflow = insert(t, db, `INSERT INTO workflows (user_id, team_id, name) VALUES ($1, $2, 'other')`, f.otherOrgAdmin, f.teamB)
+
+	grant := func(workflow int, column string, grantee int, level string) {
+		insert(t, db, `INSERT INTO workflow_permissions (workflow_id, `+column+`, permission_level, granted_by) VALUES ($1, $2, $3, $4)`,
+			workflow, grantee, level, f.owner)
+	}
+	grant(f.personal, "user_id", f.granted, models.PermissionEdit)
+	grant(f.personal, "team_id", f.teamA, models.PermissionView)
+	grant(f.otherOrgWorkflow, "organization_id", f.orgA, models.PermissionView)
+	// An explicit grant above what team membership gives wins
+	grant(f.teamWorkflow, "user_id", f.teamMember, models.PermissionAdmin)
+	return f
+}
+
+func TestWorkflowPermission(t *testing.T) {
+	db := databasetest.Open(t)
+	f := newFixture(t, db)
+	az := authz.New(db)
+
+	tests := []struct {
+		name     string
+		user     int
+		workflow int
+		// want is the effective level, or "" for no access
+		want string
+	}{
+		{"owner", f.owner, f.teamWorkflow, models.PermissionOwner},
+		{"team member with a higher grant", f.teamMember, f.teamWorkflow, models.PermissionAdmin},
+		{"team admin", f.teamAdmin, f.teamWorkflow, models.PermissionEdit},
+		{"team owner", f.teamOwner, f.teamWorkflow, models.PermissionEdit},
+		{"organization member outside the team", f.orgMember, f.teamWorkflow, ""},
+		{"organization admin", f.orgAdmin, f.teamWorkflow, models.PermissionAdmin},
+		{"organization owner", f.orgOwner, f.teamWorkflow, models.PermissionAdmin},
+		{"admin of another organization", f.otherOrgAdmin, f.teamWorkflow, ""},
+		{"outsider", f.outsider, f.teamWorkflow, ""},
+
+		{"user grant", f.granted, f.personal, models.PermissionEdit},
+		{"team grant", f.teamAdmin, f.personal, models.PermissionView},
+		{"team grant to a non-member", f.orgMember, f.personal, ""},
+		{"organization admin on a personal workflow", f.orgAdmin, f.personal, ""},
+
+		{"organization grant", f.orgMember, f.otherOrgWorkflow, models.PermissionView},
+		{"organization grant to an admin", f.orgAdmin, f.otherOrgWorkflow, models.PermissionView},
+		{"owner of the other organization's workflow", f.otherOrgAdmin, f.otherOrgWorkflow, models.PermissionOwner},
+		{"outsider on the other organization's workflow", f.outsider, f.otherOrgWorkflow, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			level, err := az.WorkflowPermission(context.Background(), tt.user, tt.workflow)
+			if tt.want == "" {
+				if !errors.Is(err, authz.ErrNotFound) {
+					t.Errorf("WorkflowPermission = %q, %v; want ErrNotFound", level, err)
+				}
+				return
+			}
+			if err != nil || level != tt.want {
+				t.Errorf("WorkflowPermission = %q, %v; want %q", level, err, tt.want)
+			}
+		})
+	}
+
+	if _, err := az.WorkflowPermission(context.Background(), f.owner, f.otherOrgWorkflow+100); !errors.Is(err, authz.ErrNotFound) {
+		t.Errorf("missing workflow: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestRequire(t *testing.T) {
+	db := databasetest.Open(t)
+	f := newFixture(t, db)
+	az := authz.New(db)
+
+	tests := []struct {
+		name string
+		user int
+		need string
+		want error
+	}{
+		{"team admin may view", f.teamAdmin, models.PermissionView, nil},
+		{"team admin may edit", f.teamAdmin, models.PermissionEdit, nil},
+		{"team admin may not administer", f.teamAdmin, models.PermissionAdmin, authz.ErrForbidden},
+		{"organization admin may administer", f.orgAdmin, models.PermissionAdmin, nil},
+		{"organization admin is not owner", f.orgAdmin, models.PermissionOwner, authz.ErrForbidden},
+		{"outsider", f.outsider, models.PermissionView, authz.ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := az.Require(context.Background(), tt.user, f.teamWorkflow, tt.need); !errors.Is(err, tt.want) {
+				t.Errorf("Require(%s) = %v, want %v", tt.need, err, tt.want)
+			}
+		})
+	}
+}
+
+// TestInOrganization covers the check that confines organization service
+// keys to workflows filed under their organization's teams.
+func TestInOrganization(t *testing.T) {
+	db := databasetest.Open(t)
+	f := newFixture(t, db)
+	az := authz.New(db)
+
+	tests := []struct {
+		name     string
+		workflow int
+		org      int
+		want     bool
+	}{
+		{"team workflow, its organization", f.teamWorkflow, f.orgA, true},
+		{"team workflow, another organization", f.teamWorkflow, f.orgB, false},
+		{"personal workflow of a member", f.personal, f.orgA, false},
+		// A grant to the organization does not file the workflow under it
+		{"workflow granted to the organization", f.otherOrgWorkflow, f.orgA, false},
+		{"other workflow, its organization", f.otherOrgWorkflow, f.orgB, true},
+		{"missing workflow", f.otherOrgWorkflow + 100, f.orgA, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := az.InOrganization(context.Background(), tt.workflow, tt.org)
+			if err != nil || got != tt.want {
+				t.Errorf("InOrganization = %v, %v; want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllows(t *testing.T) {
+	levels := []string{models.PermissionView, models.PermissionEdit, models.PermissionAdmin, models.PermissionOwner}
+	for i, have := range levels {
+		for j, need := range levels {
+			if got := authz.Allows(have, need); got != (i >= j) {
+				t.Errorf("Allows(%s, %s) = %v", have, need, got)
+			}
+		}
+		if authz.Allows("", have) {
+			t.Errorf("no access allows %s", have)
+		}
+		if authz.LevelForRank(i+1) != have {
+			t.Errorf("LevelForRank(%d) = %q, want %s", i+1, authz.LevelForRank(i+1), have)
+		}
+	}
+}
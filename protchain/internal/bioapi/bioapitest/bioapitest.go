@@ -0,0 +1,222 @@
+// Package bioapitest provides an in-process fake of BioAPI for tests of
+// code that uses the bioapi client.
+package bioapitest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"protchain/internal/bioapi"
+)
+
+// Version is reported in the version header of every fake response.
+const Version = "fake-1.0.0"
+
+// Request is a call received by the fake.
+type Request struct {
+	Endpoint string
+	Path     string
+	Header   http.Header
+	Body     []byte
+}
+
+// Server serves canned responses for every BioAPI endpoint. Responses can
+// be replaced per endpoint with Handle, Respond or Fail.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	handlers map[string]http.HandlerFunc
+	requests []Request
+}
+
+// NewServer starts a fake that answers every endpoint successfully. Close
+// it when done.
+func NewServer() *Server {
+	s := &Server{handlers: make(map[string]http.HandlerFunc)}
+	for name, data := range defaults {
+		s.Respond(name, http.StatusOK, data)
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Client returns a client for the fake with retries and the circuit
+// breaker configured by cfg. BaseURL is always the fake's.
+func (s *Server) Client(cfg bioapi.Config) *bioapi.Client {
+	cfg.BaseURL = s.URL
+	return bioapi.New(cfg)
+}
+
+// Handle serves an endpoint, by name, with h.
+func (s *Server) Handle(endpoint string, h http.HandlerFunc) {
+	s.mu.Lock()
+	s.handlers[endpoint] = h
+	s.mu.Unlock()
+}
+
+// Respond makes an endpoint answer with status and body encoded as JSON.
+func (s *Server) Respond(endpoint string, status int, body interface{}) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		panic(err)
+	}
+	s.Handle(endpoint, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(data)
+	})
+}
+
+// Fail makes the next n calls to an endpoint answer with status and a
+// FastAPI style error, after which it answers as before.
+func (s *Server) Fail(endpoint string, status, n int) {
+	s.mu.Lock()
+	next := s.handlers[endpoint]
+	s.mu.Unlock()
+
+	var mu sync.Mutex
+	s.Handle(endpoint, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		failing := n > 0
+		n--
+		mu.Unlock()
+		if !failing {
+			next(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"detail": http.StatusText(status)})
+	})
+}
+
+// Requests returns the calls received by an endpoint, oldest first.
+func (s *Server) Requests(endpoint string) []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []Request
+	for _, r := range s.requests {
+		if r.Endpoint == endpoint {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	name := route(r.Method, r.URL.Path)
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Endpoint: name, Path: r.URL.Path, Header: r.Header.Clone(), Body: body})
+	h := s.handlers[name]
+	s.mu.Unlock()
+
+	if h == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set(bioapi.VersionHeader, Version)
+	r.Body = io.NopCloser(strings.NewReader(string(body)))
+	h(w, r)
+}
+
+// route finds the endpoint serving a request path, or "".
+func route(method, path string) string {
+	for _, ep := range bioapi.Endpoints {
+		if ep.Method != method {
+			continue
+		}
+		prefix, suffix, wildcard := strings.Cut(ep.Path, "%s")
+		if !wildcard {
+			if path == ep.Path {
+				return ep.Name
+			}
+			continue
+		}
+		if strings.HasPrefix(path, prefix) && strings.HasSuffix(path, suffix) &&
+			len(path) > len(prefix)+len(suffix) && !strings.Contains(path[len(prefix):len(path)-len(suffix)], "/") {
+			return ep.Name
+		}
+	}
+	return ""
+}
+
+func success(data interface{}) map[string]interface{} {
+	return map[string]interface{}{"success": true, "data": data, "error": nil}
+}
+
+var site = map[string]interface{}{
+	"site_id":            1,
+	"center":             map[string]float64{"x": 10.5, "y": -4.25, "z": 22},
+	"volume":             540.0,
+	"druggability_score": 0.82,
+	"hydrophobicity":     0.61,
+	"enclosure_score":    0.74,
+	"nearby_residues": []map[string]interface{}{
+		{"chain": "A", "residue_number": 45, "residue_name": "LEU", "distance": 3.2},
+	},
+}
+
+var compound = map[string]interface{}{
+	"name": "aspirin", "smiles": "CC(=O)OC1=CC=CC=C1C(=O)O", "score": -7.4,
+}
+
+// defaults are the canned responses, keyed by endpoint name.
+var defaults = map[string]interface{}{
+	bioapi.EndpointHealth.Name: map[string]string{"status": "healthy", "service": "bioapi"},
+	bioapi.EndpointStructure.Name: success(map[string]interface{}{
+		"workflow_id": "1", "pdb_id": "1ABC", "status": "completed", "method": "real_protein_analysis",
+		"details": map[string]interface{}{"descriptors": map[string]interface{}{"num_atoms": 2048, "num_residues": 256}},
+	}),
+	bioapi.EndpointWorkflowBindings.Name: success(map[string]interface{}{
+		"workflow_id": "1", "pdb_id": "1ABC", "binding_sites": []interface{}{site},
+		"method": "real_geometric_cavity_detection", "status": "completed",
+	}),
+	bioapi.EndpointBindingAnalysis.Name: success(map[string]interface{}{
+		"pdb_id": "1ABC", "binding_sites": []interface{}{site},
+		"method": "real_geometric_cavity_detection", "status": "completed",
+	}),
+	bioapi.EndpointDetectBindingSites.Name: map[string]interface{}{
+		"pdb_id": "1ABC", "binding_sites": []interface{}{site},
+		"method": "geometric_cavity_detection", "total_sites": 1,
+	},
+	bioapi.EndpointAIDruggability.Name: success(map[string]interface{}{
+		"predictions": []interface{}{map[string]interface{}{
+			"site_id": 1, "ml_druggability_score": 0.79, "original_score": 0.82, "confidence": 0.9,
+		}},
+		"pdb_id": "1ABC", "model": "GradientBoostingRegressor", "feature_count": 8,
+	}),
+	bioapi.EndpointLiteratureSearch.Name: success(map[string]interface{}{
+		"pdb_id": "1ABC", "pubmed": []interface{}{}, "uniprot": map[string]interface{}{},
+		"rcsb": map[string]interface{}{}, "total_papers": 0,
+	}),
+	bioapi.EndpointUploadStructure.Name: success(map[string]interface{}{
+		"filename": "upload.pdb", "status": "completed", "method": "real_protein_analysis",
+		"details": map[string]interface{}{"descriptors": map[string]interface{}{"num_atoms": 2048}},
+	}),
+	bioapi.EndpointParseCompounds.Name: success(map[string]interface{}{
+		"compounds": []interface{}{compound}, "warnings": []string{}, "count": 1,
+	}),
+	bioapi.EndpointVirtualScreening.Name: success(map[string]interface{}{
+		"status": "success", "method": "physics_based_scoring", "top_compounds": []interface{}{compound},
+		"compounds_screened": 1, "hits_found": 1,
+	}),
+	bioapi.EndpointVinaDocking.Name: success(map[string]interface{}{
+		"status": "success", "method": "autodock_vina", "top_compounds": []interface{}{compound},
+		"compounds_screened": 1, "compounds_docked": 1, "hits_found": 1,
+	}),
+	bioapi.EndpointMolecularDynamics.Name: success(map[string]interface{}{
+		"status": "success", "method": "openmm", "compounds_simulated": 1, "stable_compounds": 1,
+		"compound_results": []interface{}{compound},
+	}),
+	bioapi.EndpointLeadOptimization.Name: success(map[string]interface{}{
+		"status": "completed", "method": "rdkit_lead_optimization_v2", "compounds_analyzed": 1,
+		"advance_count": 1, "optimized_compounds": []interface{}{compound},
+	}),
+}
@@ -0,0 +1,170 @@
+package bioapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// CacheConfig configures a Cache.
+type CacheConfig struct {
+	// TTL is how long a response is reused
+	TTL time.Duration
+	// MaxEntryBytes skips caching larger responses. Zero means no limit.
+	MaxEntryBytes int
+	// MaxTotalBytes bounds the whole cache; the least recently used
+	// entries are evicted beyond it. Zero means no limit.
+	MaxTotalBytes int64
+	// SweepInterval is how often expired and excess entries are removed
+	SweepInterval time.Duration
+}
+
+// Cache stores responses of cacheable endpoints in bioapi_cache, shared by
+// every API replica. Entries are keyed by a hash of the request and the
+// BioAPI version that answered it, so an upgrade never serves stale
+// results.
+type Cache struct {
+	db  *sql.DB
+	cfg CacheConfig
+}
+
+func NewCache(db *sql.DB, cfg CacheConfig) *Cache {
+	if cfg.SweepInterval <= 0 {
+		cfg.SweepInterval = 5 * time.Minute
+	}
+	return &Cache{db: db, cfg: cfg}
+}
+
+type noCacheKey struct{}
+
+// WithoutCache returns a context whose calls skip the cache lookup, as
+// for a request sent with Cache-Control: no-cache. The fresh response
+// still replaces the cached one.
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+func bypassCache(ctx context.Context) bool {
+	v, _ := ctx.Value(noCacheKey{}).(bool)
+	return v
+}
+
+// cacheKey hashes the request path and the canonical form of its JSON
+// body. The workflow_id field only labels BioAPI's logs and is left out,
+// so identical analyses for different workflows share an entry; the
+// workflow ID in a path still separates them.
+func cacheKey(path, version string, body []byte) (string, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return "", err
+	}
+	if obj, ok := v.(map[string]interface{}); ok {
+		delete(obj, "workflow_id")
+	}
+	// Marshal sorts object keys, which makes the encoding canonical
+	canonical, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n", path, version)
+	h.Write(canonical)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// get returns the live entry for key and counts the hit.
+func (c *Cache) get(ctx context.Context, key string) ([]byte, bool, error) {
+	var body []byte
+	err := c.db.QueryRowContext(ctx, `
+		UPDATE bioapi_cache SET hits = hits + 1, last_used_at = NOW()
+		WHERE key = $1 AND expires_at > NOW()
+		RETURNING body
+	`, key).Scan(&body)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return body, true, nil
+}
+
+// put stores a successful response unless it is over the entry limit.
+func (c *Cache) put(ctx context.Context, key string, ep Endpoint, resp *Response) error {
+	if c.cfg.MaxEntryBytes > 0 && len(resp.Body) > c.cfg.MaxEntryBytes {
+		return nil
+	}
+	_, err := c.db.ExecContext(ctx, `
+		INSERT INTO bioapi_cache (key, endpoint, version, body, size, created_at, last_used_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW(), NOW() + $6 * INTERVAL '1 second')
+		ON CONFLICT (key) DO UPDATE SET body = EXCLUDED.body, size = EXCLUDED.size,
+			created_at = NOW(), last_used_at = NOW(), expires_at = EXCLUDED.expires_at
+	`, key, ep.Name, resp.Version, resp.Body, len(resp.Body), c.cfg.TTL.Seconds())
+	return err
+}
+
+// Run removes expired entries and trims the cache to its size limit until
+// ctx is cancelled.
+func (c *Cache) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.cfg.SweepInterval)
+	defer ticker.Stop()
+	for {
+		if err := c.sweep(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("bioapi: cache sweep failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Cache) sweep(ctx context.Context) error {
+	if _, err := c.db.ExecContext(ctx, `DELETE FROM bioapi_cache WHERE expires_at <= NOW()`); err != nil {
+		return fmt.Errorf("failed to expire entries: %w", err)
+	}
+	if c.cfg.MaxTotalBytes <= 0 {
+		return nil
+	}
+	res, err := c.db.ExecContext(ctx, `
+		DELETE FROM bioapi_cache WHERE key IN (
+			SELECT key FROM (
+				SELECT key, SUM(size) OVER (ORDER BY last_used_at DESC, key) AS total
+				FROM bioapi_cache
+			) ranked
+			WHERE total > $1
+		)
+	`, c.cfg.MaxTotalBytes)
+	if err != nil {
+		return fmt.Errorf("failed to evict entries: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		slog.Info("bioapi: evicted cache entries over the size limit", "count", n)
+	}
+	return nil
+}
+
+// storable reports whether a response may be cached: a 2xx that does not
+// report success=false in its envelope.
+func storable(resp *Response) bool {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return false
+	}
+	var env struct {
+		Success *bool `json:"success"`
+	}
+	if err := json.Unmarshal(resp.Body, &env); err != nil {
+		return false
+	}
+	return env.Success == nil || *env.Success
+}
@@ -0,0 +1,200 @@
+package bioapi
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeCache is a database/sql driver holding bioapi_cache in a map. It
+// understands the lookup and the insert; entries never expire.
+type fakeCache struct {
+	t *testing.T
+
+	mu       sync.Mutex
+	entries  map[string][]byte
+	versions map[string]string
+}
+
+func newFakeCache(t *testing.T) (*sql.DB, *fakeCache) {
+	f := &fakeCache{t: t, entries: make(map[string][]byte), versions: make(map[string]string)}
+	db := sql.OpenDB(f)
+	t.Cleanup(func() { db.Close() })
+	return db, f
+}
+
+func (f *fakeCache) Connect(context.Context) (driver.Conn, error) { return fakeCacheConn{f}, nil }
+func (f *fakeCache) Driver() driver.Driver                        { return fakeCacheDriver{f} }
+
+type fakeCacheDriver struct{ f *fakeCache }
+
+func (d fakeCacheDriver) Open(string) (driver.Conn, error) { return fakeCacheConn(d), nil }
+
+type fakeCacheConn struct{ f *fakeCache }
+
+func (c fakeCacheConn) Prepare(string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("fakecache: prepared statements are not supported")
+}
+
+func (c fakeCacheConn) Close() error { return nil }
+
+func (c fakeCacheConn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("fakecache: transactions are not supported")
+}
+
+func (c fakeCacheConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if !strings.Contains(query, "UPDATE bioapi_cache SET hits = hits + 1") {
+		c.f.t.Errorf("fakecache: unexpected query:\n%s", query)
+		return nil, fmt.Errorf("fakecache: unexpected query")
+	}
+	c.f.mu.Lock()
+	defer c.f.mu.Unlock()
+	rows := &fakeCacheRows{}
+	if body, ok := c.f.entries[args[0].Value.(string)]; ok {
+		rows.body = body
+	}
+	return rows, nil
+}
+
+func (c fakeCacheConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if !strings.Contains(query, "INSERT INTO bioapi_cache") {
+		c.f.t.Errorf("fakecache: unexpected exec:\n%s", query)
+		return nil, fmt.Errorf("fakecache: unexpected exec")
+	}
+	c.f.mu.Lock()
+	defer c.f.mu.Unlock()
+	key := args[0].Value.(string)
+	c.f.entries[key] = args[3].Value.([]byte)
+	c.f.versions[key] = args[2].Value.(string)
+	return driver.RowsAffected(1), nil
+}
+
+type fakeCacheRows struct {
+	body []byte
+	done bool
+}
+
+func (r *fakeCacheRows) Columns() []string { return []string{"body"} }
+func (r *fakeCacheRows) Close() error      { return nil }
+
+func (r *fakeCacheRows) Next(dest []driver.Value) error {
+	if r.body == nil || r.done {
+		return io.EOF
+	}
+	dest[0] = r.body
+	r.done = true
+	return nil
+}
+
+// TestCacheVersionChange checks that a response cached from one BioAPI
+// version is not served once the workers report another.
+func TestCacheVersionChange(t *testing.T) {
+	var version atomic.Value
+	version.Store("2.0.0")
+	var scored atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(VersionHeader, version.Load().(string))
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case EndpointHealth.Path:
+			fmt.Fprint(w, `{"status":"healthy","service":"bioapi"}`)
+		case EndpointAIDruggability.Path:
+			scored.Add(1)
+			fmt.Fprintf(w, `{"success":true,"data":{"predictions":[],"model":"model-%s"},"error":null}`, version.Load())
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	db, cache := newFakeCache(t)
+	c := New(Config{BaseURL: srv.URL, Cache: NewCache(db, CacheConfig{TTL: time.Hour})})
+	req := AIDruggabilityRequest{BindingSites: []json.RawMessage{json.RawMessage(`{"site_id":1}`)}}
+	ctx := context.Background()
+
+	score := func(wantCached bool, wantModel string, wantCalls int32) {
+		t.Helper()
+		out, resp, err := c.AIDruggability(ctx, req)
+		if err != nil {
+			t.Fatalf("AIDruggability: %v", err)
+		}
+		if resp.Cached != wantCached || out.Model != wantModel {
+			t.Errorf("cached = %v, model = %s; want %v, %s", resp.Cached, out.Model, wantCached, wantModel)
+		}
+		if got := scored.Load(); got != wantCalls {
+			t.Errorf("BioAPI scored %d times, want %d", got, wantCalls)
+		}
+	}
+
+	score(false, "model-2.0.0", 1)
+	score(true, "model-2.0.0", 1)
+
+	// The upgrade is noticed on the next call that reaches a worker
+	version.Store("2.1.0")
+	if _, err := c.Health(ctx); err != nil {
+		t.Fatalf("Health: %v", err)
+	}
+	if v := c.pool.Version(); v != "2.1.0" {
+		t.Fatalf("pool version = %q after the upgrade", v)
+	}
+	score(false, "model-2.1.0", 2)
+	score(true, "model-2.1.0", 2)
+
+	versions := make(map[string]bool)
+	for _, v := range cache.versions {
+		versions[v] = true
+	}
+	if len(cache.entries) != 2 || !versions["2.0.0"] || !versions["2.1.0"] {
+		t.Errorf("cached entries by version = %v, want one for each", cache.versions)
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	const path = "/api/v1/structure/binding-sites/ai-score"
+	key := func(path, version, body string) string {
+		t.Helper()
+		k, err := cacheKey(path, version, []byte(body))
+		if err != nil {
+			t.Fatalf("cacheKey(%s): %v", body, err)
+		}
+		return k
+	}
+	base := key(path, "2.0.0", `{"binding_sites":[{"site_id":1}],"pdb_id":"1ABC"}`)
+
+	same := []struct{ name, path, version, body string }{
+		{"reordered fields", path, "2.0.0", `{"pdb_id":"1ABC","binding_sites":[{"site_id":1}]}`},
+		{"whitespace", path, "2.0.0", `{ "binding_sites": [ {"site_id": 1} ], "pdb_id": "1ABC" }`},
+		{"workflow label", path, "2.0.0", `{"binding_sites":[{"site_id":1}],"pdb_id":"1ABC","workflow_id":"7"}`},
+	}
+	for _, tt := range same {
+		if key(tt.path, tt.version, tt.body) != base {
+			t.Errorf("%s changed the key", tt.name)
+		}
+	}
+
+	different := []struct{ name, path, version, body string }{
+		{"version", path, "2.1.0", `{"binding_sites":[{"site_id":1}],"pdb_id":"1ABC"}`},
+		{"path", "/api/v1/binding/direct-binding-analysis", "2.0.0", `{"binding_sites":[{"site_id":1}],"pdb_id":"1ABC"}`},
+		{"body", path, "2.0.0", `{"binding_sites":[{"site_id":2}],"pdb_id":"1ABC"}`},
+		{"number precision", path, "2.0.0", `{"binding_sites":[{"site_id":1.0000000000000001}],"pdb_id":"1ABC"}`},
+	}
+	for _, tt := range different {
+		if key(tt.path, tt.version, tt.body) == base {
+			t.Errorf("a different %s gave the same key", tt.name)
+		}
+	}
+
+	if _, err := cacheKey(path, "2.0.0", []byte(`{`)); err == nil {
+		t.Error("cacheKey accepted malformed JSON")
+	}
+}
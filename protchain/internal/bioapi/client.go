@@ -0,0 +1,554 @@
+// Package bioapi is a typed client for the BioAPI analysis service. Calls
+// are spread over a pool of BioAPI workers. Each endpoint has its own
+// timeout; idempotent calls are retried with jittered backoff, and workers
+// that keep failing are drained until they recover.
+package bioapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"protchain/internal/logging"
+	"protchain/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "protchain/internal/bioapi"
+
+// VersionHeader is the response header BioAPI uses to report its version.
+const VersionHeader = "X-BioAPI-Version"
+
+// Error is a non-2xx response, or a response reporting success=false.
+type Error struct {
+	Endpoint   string
+	StatusCode int
+	// Detail is BioAPI's error message, or the raw body if it sent none
+	Detail string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("bioapi: %s returned status %d: %s", e.Endpoint, e.StatusCode, e.Detail)
+}
+
+// Response is a raw BioAPI response.
+type Response struct {
+	StatusCode int
+	Version    string
+	Body       []byte
+	// Cached is set when the response came from the result cache
+	Cached bool
+}
+
+// Endpoint describes a BioAPI route. Path may contain a %s for the
+// workflow ID.
+type Endpoint struct {
+	Name   string
+	Method string
+	Path   string
+	// Timeout bounds each attempt; zero leaves it to the caller's context
+	Timeout time.Duration
+	// Idempotent calls are cheap and safe to repeat, so they are retried
+	Idempotent bool
+	// Capability a worker must advertise to serve the endpoint, if any
+	Capability string
+	// Cacheable endpoints are deterministic, so their responses are reused
+	// for identical requests to the same BioAPI version
+	Cacheable bool
+}
+
+var (
+	EndpointHealth             = Endpoint{"health", http.MethodGet, "/health", 5 * time.Second, true, "", false}
+	EndpointStructure          = Endpoint{"structure", http.MethodPost, "/api/v1/workflows/%s/structure", 2 * time.Minute, true, "", true}
+	EndpointWorkflowBindings   = Endpoint{"workflow-binding-sites", http.MethodPost, "/api/v1/workflows/%s/binding-sites", 5 * time.Minute, true, "", false}
+	EndpointBindingAnalysis    = Endpoint{"binding-analysis", http.MethodPost, "/api/v1/binding/direct-binding-analysis", 5 * time.Minute, true, "", true}
+	EndpointDetectBindingSites = Endpoint{"detect-binding-sites", http.MethodPost, "/api/v1/structure/binding-sites/detect", 5 * time.Minute, true, "", false}
+	EndpointAIDruggability     = Endpoint{"ai-druggability", http.MethodPost, "/api/v1/structure/binding-sites/ai-score", 30 * time.Second, true, "", true}
+	EndpointLiteratureSearch   = Endpoint{"literature-search", http.MethodPost, "/api/v1/literature/search", time.Minute, true, "", false}
+	EndpointUploadStructure    = Endpoint{"upload-structure", http.MethodPost, "/api/v1/upload/structure", 2 * time.Minute, true, "", false}
+	EndpointParseCompounds     = Endpoint{"parse-compounds", http.MethodPost, "/api/v1/compounds/parse", 2 * time.Minute, true, "", false}
+
+	// Long-running computations are neither retried nor given their own
+	// timeout; the job manager bounds and requeues them.
+	EndpointVirtualScreening  = Endpoint{"virtual-screening", http.MethodPost, "/api/v1/screening/virtual-screening", 0, false, CapabilityScreening, false}
+	EndpointVinaDocking       = Endpoint{"vina-docking", http.MethodPost, "/api/v1/screening/vina-docking", 0, false, CapabilityVina, true}
+	EndpointMolecularDynamics = Endpoint{"molecular-dynamics", http.MethodPost, "/api/v1/simulation/molecular-dynamics", 0, false, CapabilityOpenMM, false}
+	EndpointLeadOptimization  = Endpoint{"lead-optimization", http.MethodPost, "/api/v1/optimization/lead-optimization", 0, false, "", false}
+)
+
+// Endpoints lists every endpoint the client knows.
+var Endpoints = []Endpoint{
+	EndpointHealth, EndpointStructure, EndpointWorkflowBindings, EndpointBindingAnalysis,
+	EndpointDetectBindingSites, EndpointAIDruggability, EndpointLiteratureSearch,
+	EndpointUploadStructure, EndpointParseCompounds, EndpointVirtualScreening,
+	EndpointVinaDocking, EndpointMolecularDynamics, EndpointLeadOptimization,
+}
+
+// Config configures a Client.
+type Config struct {
+	// Pool routes calls to workers. Without one, every call goes to
+	// BaseURL.
+	Pool    *Pool
+	BaseURL string
+	// MaxRetries is the number of extra attempts for idempotent calls
+	MaxRetries   int
+	RetryBackoff time.Duration
+	// HTTPClient defaults to a client without an overall timeout
+	HTTPClient *http.Client
+	// Cache reuses responses of cacheable endpoints. Nil disables it.
+	Cache *Cache
+}
+
+type Client struct {
+	pool       *Pool
+	cache      *Cache
+	http       *http.Client
+	maxRetries int
+	backoff    time.Duration
+}
+
+func New(cfg Config) *Client {
+	c := &Client{
+		pool:       cfg.Pool,
+		cache:      cfg.Cache,
+		http:       cfg.HTTPClient,
+		maxRetries: cfg.MaxRetries,
+		backoff:    cfg.RetryBackoff,
+	}
+	if c.pool == nil {
+		c.pool = NewPool(PoolConfig{Static: []WorkerSpec{{ID: "default", URL: cfg.BaseURL, Capabilities: []string{CapabilityAll}}}})
+	}
+	if c.http == nil {
+		c.http = &http.Client{}
+	}
+	if c.maxRetries < 0 {
+		c.maxRetries = 0
+	}
+	if c.backoff <= 0 {
+		c.backoff = 250 * time.Millisecond
+	}
+	return c
+}
+
+// Health calls BioAPI's health check.
+func (c *Client) Health(ctx context.Context) (*Health, error) {
+	resp, err := c.do(ctx, EndpointHealth, EndpointHealth.Path, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	var out Health
+	if err := decode(EndpointHealth, resp.Body, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ProcessStructure prepares the structure of a workflow.
+func (c *Client) ProcessStructure(ctx context.Context, workflowID string, req StructureRequest) (*StructureResult, *Response, error) {
+	var out StructureResult
+	resp, err := c.call(ctx, EndpointStructure, workflowID, req, &out)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &out, resp, nil
+}
+
+// WorkflowBindingSites detects the pockets of a workflow's structure.
+func (c *Client) WorkflowBindingSites(ctx context.Context, workflowID string, req BindingAnalysisRequest) (*BindingSitesResult, *Response, error) {
+	var out BindingSitesResult
+	resp, err := c.call(ctx, EndpointWorkflowBindings, workflowID, req, &out)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &out, resp, nil
+}
+
+// BindingAnalysis detects pockets outside of a workflow.
+func (c *Client) BindingAnalysis(ctx context.Context, req BindingAnalysisRequest) (*BindingSitesResult, *Response, error) {
+	var out BindingSitesResult
+	resp, err := c.call(ctx, EndpointBindingAnalysis, "", req, &out)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &out, resp, nil
+}
+
+// DetectBindingSites is the lightweight detection endpoint. It reports no
+// pockets instead of failing when none are found.
+func (c *Client) DetectBindingSites(ctx context.Context, req BindingAnalysisRequest) (*BindingSitesResult, *Response, error) {
+	resp, err := c.post(ctx, EndpointDetectBindingSites, "", req)
+	if err != nil {
+		return nil, resp, err
+	}
+	var out BindingSitesResult
+	if err := decode(EndpointDetectBindingSites, resp.Body, &out); err != nil {
+		return nil, resp, err
+	}
+	return &out, resp, nil
+}
+
+// AIDruggability scores pockets with BioAPI's druggability model.
+func (c *Client) AIDruggability(ctx context.Context, req AIDruggabilityRequest) (*AIDruggabilityResult, *Response, error) {
+	var out AIDruggabilityResult
+	resp, err := c.call(ctx, EndpointAIDruggability, "", req, &out)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &out, resp, nil
+}
+
+// LiteratureSearch searches PubMed, UniProt and RCSB for a protein.
+func (c *Client) LiteratureSearch(ctx context.Context, req LiteratureSearchRequest) (*LiteratureSearchResult, *Response, error) {
+	var out LiteratureSearchResult
+	resp, err := c.call(ctx, EndpointLiteratureSearch, "", req, &out)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &out, resp, nil
+}
+
+// UploadStructure prepares an uploaded PDB file.
+func (c *Client) UploadStructure(ctx context.Context, filename string, data []byte) (*StructureResult, *Response, error) {
+	var out StructureResult
+	resp, err := c.upload(ctx, EndpointUploadStructure, filename, data, &out)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &out, resp, nil
+}
+
+// ParseCompounds parses a CSV or SDF compound file, chosen by filename
+// extension.
+func (c *Client) ParseCompounds(ctx context.Context, filename string, data []byte) (*CompoundParseResult, *Response, error) {
+	var out CompoundParseResult
+	resp, err := c.upload(ctx, EndpointParseCompounds, filename, data, &out)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &out, resp, nil
+}
+
+// VirtualScreening scores a compound library against a pocket.
+func (c *Client) VirtualScreening(ctx context.Context, req ScreeningRequest) (*ScreeningResult, *Response, error) {
+	var out ScreeningResult
+	resp, err := c.call(ctx, EndpointVirtualScreening, "", req, &out)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &out, resp, nil
+}
+
+// VinaDocking docks compounds into a pocket with AutoDock Vina.
+func (c *Client) VinaDocking(ctx context.Context, req ScreeningRequest) (*ScreeningResult, *Response, error) {
+	var out ScreeningResult
+	resp, err := c.call(ctx, EndpointVinaDocking, "", req, &out)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &out, resp, nil
+}
+
+// MolecularDynamics runs stability simulations of docked compounds.
+func (c *Client) MolecularDynamics(ctx context.Context, req MDSimulationRequest) (*MDSimulationResult, *Response, error) {
+	var out MDSimulationResult
+	resp, err := c.call(ctx, EndpointMolecularDynamics, "", req, &out)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &out, resp, nil
+}
+
+// LeadOptimization analyses compounds for optimization.
+func (c *Client) LeadOptimization(ctx context.Context, req LeadOptimizationRequest) (*LeadOptimizationResult, *Response, error) {
+	var out LeadOptimizationResult
+	resp, err := c.call(ctx, EndpointLeadOptimization, "", req, &out)
+	if err != nil {
+		return nil, resp, err
+	}
+	return &out, resp, nil
+}
+
+// Capacity returns how many workers can take a call to ep right now.
+func (c *Client) Capacity(ep Endpoint) int {
+	return c.pool.Capacity(ep.Capability)
+}
+
+// Post sends an already encoded JSON payload to ep and returns the raw
+// response. The response is also returned with an *Error so its version
+// can be recorded.
+func (c *Client) Post(ctx context.Context, ep Endpoint, payload []byte) (*Response, error) {
+	return c.do(ctx, ep, ep.Path, "application/json", payload)
+}
+
+// call posts in to ep and decodes the data of the response envelope into
+// out. The response is returned whenever BioAPI answered.
+func (c *Client) call(ctx context.Context, ep Endpoint, workflowID string, in, out interface{}) (*Response, error) {
+	resp, err := c.post(ctx, ep, workflowID, in)
+	if err != nil {
+		return resp, err
+	}
+	return resp, decodeEnvelope(ep, resp, out)
+}
+
+func (c *Client) post(ctx context.Context, ep Endpoint, workflowID string, in interface{}) (*Response, error) {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return nil, fmt.Errorf("bioapi: encoding %s request: %w", ep.Name, err)
+	}
+	path := ep.Path
+	if strings.Contains(path, "%s") {
+		path = fmt.Sprintf(path, workflowID)
+	}
+	return c.do(ctx, ep, path, "application/json", body)
+}
+
+func (c *Client) upload(ctx context.Context, ep Endpoint, filename string, data []byte, out interface{}) (*Response, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(data); err != nil {
+		return nil, err
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	resp, err := c.do(ctx, ep, ep.Path, mw.FormDataContentType(), body.Bytes())
+	if err != nil {
+		return resp, err
+	}
+	return resp, decodeEnvelope(ep, resp, out)
+}
+
+// do sends a request and counts it if it fails.
+func (c *Client) do(ctx context.Context, ep Endpoint, path, contentType string, body []byte) (*Response, error) {
+	resp, err := c.cached(ctx, ep, path, contentType, body)
+	if err != nil {
+		callErrors.Inc(ep.Name)
+	}
+	return resp, err
+}
+
+// cached answers cacheable JSON requests from the cache when it can, and
+// otherwise sends them and caches the response.
+func (c *Client) cached(ctx context.Context, ep Endpoint, path, contentType string, body []byte) (*Response, error) {
+	if c.cache == nil || !ep.Cacheable || contentType != "application/json" {
+		return c.send(ctx, ep, path, contentType, body)
+	}
+
+	if version := c.pool.Version(); version != "" && !bypassCache(ctx) {
+		if key, err := cacheKey(path, version, body); err == nil {
+			data, ok, err := c.cache.get(ctx, key)
+			if err != nil {
+				logging.FromContext(ctx).Warn("bioapi: cache lookup failed", "endpoint", ep.Name, "error", err)
+			}
+			if ok {
+				cacheLookups.Inc(ep.Name, "hit")
+				return &Response{StatusCode: http.StatusOK, Version: version, Body: data, Cached: true}, nil
+			}
+			cacheLookups.Inc(ep.Name, "miss")
+		}
+	}
+
+	resp, err := c.send(ctx, ep, path, contentType, body)
+	if err != nil || resp.Version == "" || !storable(resp) {
+		return resp, err
+	}
+	// Key by the version that actually answered
+	if key, kerr := cacheKey(path, resp.Version, body); kerr == nil {
+		if perr := c.cache.put(ctx, key, ep, resp); perr != nil {
+			logging.FromContext(ctx).Warn("bioapi: failed to cache response", "endpoint", ep.Name, "error", perr)
+		}
+	}
+	return resp, nil
+}
+
+// send sends a request to a worker, retrying idempotent endpoints on
+// another worker after transport errors and overload responses.
+func (c *Client) send(ctx context.Context, ep Endpoint, path, contentType string, body []byte) (*Response, error) {
+	attempts := 1
+	if ep.Idempotent {
+		attempts += c.maxRetries
+	}
+
+	var resp *Response
+	var err error
+	var last *worker
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			// Full jitter keeps retries from many callers apart
+			delay := time.Duration(rand.Int63n(int64(c.backoff) << (attempt - 1)))
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+
+		w, perr := c.pool.acquire(ep.Capability, last)
+		if perr != nil {
+			if err != nil || resp != nil {
+				// Report the failure of the previous attempt instead
+				break
+			}
+			return nil, perr
+		}
+		last = w
+		resp, err = c.attempt(ctx, w.spec.URL, ep, path, contentType, body)
+		if err != nil && ctx.Err() != nil {
+			// The caller gave up; that says nothing about the worker
+			c.pool.release(w, outcomeNone)
+			return nil, err
+		}
+		if err != nil || unavailable(resp.StatusCode) {
+			c.pool.release(w, outcomeFailure)
+		} else {
+			c.pool.release(w, outcomeSuccess)
+			c.pool.observe(resp.Version)
+		}
+
+		if err == nil && !retryable(resp.StatusCode) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp, &Error{Endpoint: ep.Name, StatusCode: resp.StatusCode, Detail: detail(resp.Body)}
+	}
+	return resp, nil
+}
+
+func (c *Client) attempt(ctx context.Context, baseURL string, ep Endpoint, path, contentType string, body []byte) (*Response, error) {
+	if ep.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ep.Timeout)
+		defer cancel()
+	}
+
+	ctx, span := tracing.Tracer(tracerName).Start(ctx, "bioapi "+ep.Name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(ep.Method),
+			semconv.URLFull(baseURL+path),
+			attribute.String("bioapi.endpoint", ep.Name),
+		),
+	)
+	defer span.End()
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, ep.Method, baseURL+path, reader)
+	if err != nil {
+		return nil, traceError(span, fmt.Errorf("bioapi: building %s request: %w", ep.Name, err))
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if id := logging.RequestID(ctx); id != "" {
+		req.Header.Set(logging.RequestIDHeader, id)
+	}
+	// BioAPI continues the trace from the traceparent header
+	tracing.Inject(ctx, req.Header)
+
+	start := time.Now()
+	res, err := c.http.Do(req)
+	if err != nil {
+		requestsTotal.Inc(ep.Name, "error")
+		return nil, traceError(span, fmt.Errorf("bioapi: %s request failed: %w", ep.Name, err))
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	requestDuration.Observe(time.Since(start).Seconds(), ep.Name)
+	if err != nil {
+		requestsTotal.Inc(ep.Name, "error")
+		return nil, traceError(span, fmt.Errorf("bioapi: reading %s response: %w", ep.Name, err))
+	}
+	requestsTotal.Inc(ep.Name, strconv.Itoa(res.StatusCode))
+
+	version := res.Header.Get(VersionHeader)
+	span.SetAttributes(semconv.HTTPResponseStatusCode(res.StatusCode), attribute.String("bioapi.version", version))
+	if res.StatusCode >= 400 {
+		span.SetStatus(codes.Error, fmt.Sprintf("HTTP %d", res.StatusCode))
+	}
+	return &Response{StatusCode: res.StatusCode, Version: version, Body: data}, nil
+}
+
+// traceError marks span failed with err and returns err.
+func traceError(span trace.Span, err error) error {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	return err
+}
+
+// unavailable reports whether a status means the worker is unhealthy,
+// as opposed to an analysis failing.
+func unavailable(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
+
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || unavailable(status)
+}
+
+// detail extracts the message of an error response. FastAPI reports it
+// under "detail", which is a list for validation errors.
+func detail(body []byte) string {
+	var out struct {
+		Detail json.RawMessage `json:"detail"`
+		Error  string          `json:"error"`
+	}
+	if err := json.Unmarshal(body, &out); err == nil {
+		var s string
+		if json.Unmarshal(out.Detail, &s) == nil && s != "" {
+			return s
+		}
+		if len(out.Detail) > 0 {
+			return string(out.Detail)
+		}
+		if out.Error != "" {
+			return out.Error
+		}
+	}
+	return strings.TrimSpace(string(body))
+}
+
+func decodeEnvelope(ep Endpoint, resp *Response, out interface{}) error {
+	var env envelope
+	if err := decode(ep, resp.Body, &env); err != nil {
+		return err
+	}
+	if !env.Success {
+		msg := "analysis reported failure"
+		if env.Error != nil && *env.Error != "" {
+			msg = *env.Error
+		}
+		return &Error{Endpoint: ep.Name, StatusCode: resp.StatusCode, Detail: msg}
+	}
+	return decode(ep, env.Data, out)
+}
+
+func decode(ep Endpoint, data []byte, out interface{}) error {
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("bioapi: invalid %s response: %w", ep.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+package bioapi_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"protchain/internal/bioapi"
+	"protchain/internal/bioapi/bioapitest"
+)
+
+var druggability = bioapi.AIDruggabilityRequest{
+	BindingSites: []json.RawMessage{json.RawMessage(`{"site_id":1}`)},
+}
+
+// poolFor returns a pool of the fake alone with the given breaker.
+func poolFor(srv *bioapitest.Server, threshold int, cooldown time.Duration) *bioapi.Pool {
+	return bioapi.NewPool(bioapi.PoolConfig{
+		Static:           []bioapi.WorkerSpec{{ID: "fake", URL: srv.URL, Capabilities: []string{bioapi.CapabilityAll}}},
+		BreakerThreshold: threshold,
+		BreakerCooldown:  cooldown,
+	})
+}
+
+func statusCode(err error) int {
+	var apiErr *bioapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint bioapi.Endpoint
+		status   int
+		failures int
+		// calls is how many requests the fake should see
+		calls      int
+		wantStatus int
+	}{
+		{"recovers within the retries", bioapi.EndpointAIDruggability, http.StatusServiceUnavailable, 2, 3, 0},
+		{"gives up after the retries", bioapi.EndpointAIDruggability, http.StatusBadGateway, 5, 3, http.StatusBadGateway},
+		{"retries overload", bioapi.EndpointAIDruggability, http.StatusTooManyRequests, 1, 2, 0},
+		{"client errors are final", bioapi.EndpointAIDruggability, http.StatusUnprocessableEntity, 1, 1, http.StatusUnprocessableEntity},
+		{"server errors are final", bioapi.EndpointAIDruggability, http.StatusInternalServerError, 1, 1, http.StatusInternalServerError},
+		{"long-running calls are not retried", bioapi.EndpointVirtualScreening, http.StatusServiceUnavailable, 1, 1, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := bioapitest.NewServer()
+			defer srv.Close()
+			srv.Fail(tt.endpoint.Name, tt.status, tt.failures)
+			c := srv.Client(bioapi.Config{MaxRetries: 2, RetryBackoff: time.Millisecond})
+
+			var err error
+			if tt.endpoint == bioapi.EndpointVirtualScreening {
+				_, _, err = c.VirtualScreening(context.Background(), bioapi.ScreeningRequest{})
+			} else {
+				_, _, err = c.AIDruggability(context.Background(), druggability)
+			}
+			if tt.wantStatus == 0 && err != nil {
+				t.Fatalf("call failed: %v", err)
+			}
+			if tt.wantStatus != 0 && statusCode(err) != tt.wantStatus {
+				t.Fatalf("err = %v, want status %d", err, tt.wantStatus)
+			}
+			if got := len(srv.Requests(tt.endpoint.Name)); got != tt.calls {
+				t.Errorf("fake saw %d requests, want %d", got, tt.calls)
+			}
+		})
+	}
+}
+
+func TestRetryReturnsResponseVersion(t *testing.T) {
+	srv := bioapitest.NewServer()
+	defer srv.Close()
+	srv.Fail(bioapi.EndpointAIDruggability.Name, http.StatusServiceUnavailable, 1)
+	c := srv.Client(bioapi.Config{MaxRetries: 1, RetryBackoff: time.Millisecond})
+
+	result, resp, err := c.AIDruggability(context.Background(), druggability)
+	if err != nil {
+		t.Fatalf("AIDruggability: %v", err)
+	}
+	if resp.Version != bioapitest.Version || len(result.Predictions) != 1 {
+		t.Errorf("version %q with %d predictions, want %q with 1", resp.Version, len(result.Predictions), bioapitest.Version)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	const cooldown = 50 * time.Millisecond
+	ep := bioapi.EndpointAIDruggability.Name
+
+	srv := bioapitest.NewServer()
+	defer srv.Close()
+	pool := poolFor(srv, 2, cooldown)
+	c := srv.Client(bioapi.Config{Pool: pool, RetryBackoff: time.Millisecond})
+	call := func() error {
+		_, _, err := c.AIDruggability(context.Background(), druggability)
+		return err
+	}
+
+	// Two consecutive failures open the breaker
+	srv.Fail(ep, http.StatusServiceUnavailable, 3)
+	for i := 0; i < 2; i++ {
+		if err := call(); statusCode(err) != http.StatusServiceUnavailable {
+			t.Fatalf("call %d: err = %v, want a 503", i, err)
+		}
+	}
+	if err := call(); !errors.Is(err, bioapi.ErrUnavailable) {
+		t.Fatalf("open breaker: err = %v, want ErrUnavailable", err)
+	}
+	if got := len(srv.Requests(ep)); got != 2 {
+		t.Errorf("open breaker let a call through: fake saw %d requests", got)
+	}
+	if ws := pool.Workers(); !ws[0].Drained || pool.Capacity("") != 0 {
+		t.Errorf("worker = %+v with capacity %d, want drained", ws[0], pool.Capacity(""))
+	}
+
+	// After the cooldown a failed probe opens it again at once
+	time.Sleep(cooldown)
+	if err := call(); statusCode(err) != http.StatusServiceUnavailable {
+		t.Fatalf("failed probe: err = %v, want a 503", err)
+	}
+	if err := call(); !errors.Is(err, bioapi.ErrUnavailable) {
+		t.Fatalf("after a failed probe: err = %v, want ErrUnavailable", err)
+	}
+
+	// A successful probe closes it
+	time.Sleep(cooldown)
+	if err := call(); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if ws := pool.Workers(); ws[0].Drained {
+		t.Error("worker still drained after a successful probe")
+	}
+	for i := 0; i < 3; i++ {
+		if err := call(); err != nil {
+			t.Fatalf("closed breaker: call %d: %v", i, err)
+		}
+	}
+	if got := len(srv.Requests(ep)); got != 7 {
+		t.Errorf("fake saw %d requests, want 7", got)
+	}
+}
+
+func TestBreakerHalfOpenAdmitsOneCall(t *testing.T) {
+	const cooldown = 20 * time.Millisecond
+	ep := bioapi.EndpointAIDruggability.Name
+
+	srv := bioapitest.NewServer()
+	defer srv.Close()
+	c := srv.Client(bioapi.Config{Pool: poolFor(srv, 1, cooldown)})
+
+	srv.Fail(ep, http.StatusServiceUnavailable, 1)
+	if _, _, err := c.AIDruggability(context.Background(), druggability); err == nil {
+		t.Fatal("first call succeeded")
+	}
+	time.Sleep(cooldown)
+
+	// Hold the probe in the fake while another call arrives
+	started, release := make(chan struct{}), make(chan struct{})
+	srv.Handle(ep, func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	probe := make(chan error, 1)
+	go func() {
+		_, _, err := c.AIDruggability(context.Background(), druggability)
+		probe <- err
+	}()
+	<-started
+
+	if _, _, err := c.AIDruggability(context.Background(), druggability); !errors.Is(err, bioapi.ErrUnavailable) {
+		t.Errorf("call during the probe: err = %v, want ErrUnavailable", err)
+	}
+	close(release)
+	if err := <-probe; statusCode(err) != http.StatusServiceUnavailable {
+		t.Errorf("probe: err = %v, want a 503", err)
+	}
+}
+
+func TestEndpointTimeout(t *testing.T) {
+	srv := bioapitest.NewServer()
+	defer srv.Close()
+	ep := bioapi.EndpointAIDruggability
+	ep.Timeout = 20 * time.Millisecond
+	srv.Handle(ep.Name, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+	pool := poolFor(srv, 2, time.Minute)
+	c := srv.Client(bioapi.Config{Pool: pool, MaxRetries: 1, RetryBackoff: time.Millisecond})
+
+	start := time.Now()
+	_, err := c.Post(context.Background(), ep, []byte(`{"pdb_id":"1ABC"}`))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want a deadline error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("call took %v despite a %v timeout", elapsed, ep.Timeout)
+	}
+	// Each attempt timed out on its own, and both count against the worker
+	if got := len(srv.Requests(ep.Name)); got != 2 {
+		t.Errorf("fake saw %d requests, want 2", got)
+	}
+	if pool.Capacity("") != 0 {
+		t.Error("timed out worker was not drained")
+	}
+}
+
+func TestContextCancellation(t *testing.T) {
+	ep := bioapi.EndpointAIDruggability.Name
+
+	t.Run("during a request", func(t *testing.T) {
+		srv := bioapitest.NewServer()
+		defer srv.Close()
+		started := make(chan struct{})
+		srv.Handle(ep, func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-r.Context().Done()
+		})
+		pool := poolFor(srv, 1, time.Minute)
+		c := srv.Client(bioapi.Config{Pool: pool, MaxRetries: 2, RetryBackoff: time.Millisecond})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-started
+			cancel()
+		}()
+		if _, _, err := c.AIDruggability(ctx, druggability); !errors.Is(err, context.Canceled) {
+			t.Fatalf("err = %v, want context.Canceled", err)
+		}
+		if got := len(srv.Requests(ep)); got != 1 {
+			t.Errorf("cancelled call was retried: fake saw %d requests", got)
+		}
+		// The caller giving up is not the worker's fault
+		if pool.Capacity("") != 1 {
+			t.Error("worker was drained after a cancelled call")
+		}
+	})
+
+	t.Run("during backoff", func(t *testing.T) {
+		srv := bioapitest.NewServer()
+		defer srv.Close()
+		srv.Fail(ep, http.StatusServiceUnavailable, 1)
+		c := srv.Client(bioapi.Config{MaxRetries: 2, RetryBackoff: time.Hour})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		if _, _, err := c.AIDruggability(ctx, druggability); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("backoff ignored the context: call took %v", elapsed)
+		}
+		if got := len(srv.Requests(ep)); got != 1 {
+			t.Errorf("fake saw %d requests, want 1", got)
+		}
+	})
+
+	t.Run("already cancelled", func(t *testing.T) {
+		srv := bioapitest.NewServer()
+		defer srv.Close()
+		c := srv.Client(bioapi.Config{})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, _, err := c.AIDruggability(ctx, druggability); !errors.Is(err, context.Canceled) {
+			t.Fatalf("err = %v, want context.Canceled", err)
+		}
+	})
+}
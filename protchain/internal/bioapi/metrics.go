@@ -0,0 +1,17 @@
+package bioapi
+
+import "protchain/internal/metrics"
+
+var (
+	// Attempts are measured individually, so a retried call shows up once
+	// per worker it was sent to
+	requestDuration = metrics.NewHistogramVec("protchain_bioapi_request_duration_seconds",
+		"Latency of BioAPI requests by endpoint.",
+		[]float64{.1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600, 1800}, "endpoint")
+	requestsTotal = metrics.NewCounterVec("protchain_bioapi_requests_total",
+		"BioAPI requests by endpoint and HTTP status; transport failures have status \"error\".", "endpoint", "status")
+	callErrors = metrics.NewCounterVec("protchain_bioapi_call_errors_total",
+		"BioAPI calls that failed after any retries, by endpoint.", "endpoint")
+	cacheLookups = metrics.NewCounterVec("protchain_bioapi_cache_lookups_total",
+		"Result cache lookups by endpoint and result (hit or miss).", "endpoint", "result")
+)
@@ -0,0 +1,444 @@
+package bioapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Capabilities a worker can advertise. Endpoints that need one are only
+// routed to workers that advertise it.
+const (
+	CapabilityScreening = "screening"
+	CapabilityVina      = "vina"
+	CapabilityOpenMM    = "openmm"
+	// CapabilityAll is advertised by a worker that serves every endpoint
+	CapabilityAll = "*"
+)
+
+var (
+	// ErrNoWorker is returned when no worker advertises the capability an
+	// endpoint needs.
+	ErrNoWorker = errors.New("bioapi: no worker offers the required capability")
+	// ErrUnavailable is returned without calling BioAPI when every capable
+	// worker is unhealthy or drained.
+	ErrUnavailable = errors.New("bioapi: no healthy worker available")
+)
+
+// WorkerSpec describes a BioAPI instance to route to.
+type WorkerSpec struct {
+	ID           string
+	URL          string
+	Capabilities []string
+}
+
+// WorkerStatus is a snapshot of a worker in the pool.
+type WorkerStatus struct {
+	ID           string     `json:"id"`
+	URL          string     `json:"url"`
+	Capabilities []string   `json:"capabilities"`
+	Static       bool       `json:"static"`
+	Healthy      bool       `json:"healthy"`
+	Drained      bool       `json:"drained"`
+	Outstanding  int        `json:"outstanding"`
+	LastProbeAt  *time.Time `json:"last_probe_at,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+}
+
+// PoolConfig configures a Pool.
+type PoolConfig struct {
+	Static []WorkerSpec
+	// BreakerThreshold consecutive failures drain a worker for
+	// BreakerCooldown, after which a single call probes it again. Zero
+	// disables draining.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	// ProbeInterval is how often each worker's /health is checked. Zero
+	// disables active health checks.
+	ProbeInterval time.Duration
+	ProbeTimeout  time.Duration
+	// Registered loads the dynamically registered workers on every probe
+	// round. Nil means static workers only.
+	Registered func(ctx context.Context) ([]WorkerSpec, error)
+}
+
+type worker struct {
+	spec   WorkerSpec
+	static bool
+
+	// Guarded by Pool.mu
+	healthy     bool
+	failures    int
+	openUntil   time.Time
+	probing     bool
+	outstanding int
+	lastProbe   time.Time
+	lastError   string
+}
+
+// Pool routes calls to BioAPI workers by least outstanding requests. It
+// drains workers that fail repeatedly or fail their health check.
+type Pool struct {
+	cfg  PoolConfig
+	http *http.Client
+
+	mu      sync.Mutex
+	workers map[string]*worker // keyed by URL
+	next    int
+	version string
+}
+
+func NewPool(cfg PoolConfig) *Pool {
+	if cfg.ProbeTimeout <= 0 {
+		cfg.ProbeTimeout = 5 * time.Second
+	}
+	p := &Pool{
+		cfg:     cfg,
+		http:    &http.Client{Timeout: cfg.ProbeTimeout},
+		workers: make(map[string]*worker),
+	}
+	for _, spec := range cfg.Static {
+		spec.URL = strings.TrimRight(spec.URL, "/")
+		p.workers[spec.URL] = &worker{spec: spec, static: true, healthy: true}
+	}
+	return p
+}
+
+// ParseWorkers parses a static worker list of the form
+// "http://bio1:8000=vina;openmm,http://bio2:8000". A worker listed without
+// capabilities serves every endpoint.
+func ParseWorkers(s string) ([]WorkerSpec, error) {
+	var specs []WorkerSpec
+	for i, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		url, caps, _ := strings.Cut(entry, "=")
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			return nil, fmt.Errorf("worker %q: URL must start with http:// or https://", entry)
+		}
+		spec := WorkerSpec{ID: fmt.Sprintf("static-%d", i+1), URL: url, Capabilities: []string{CapabilityAll}}
+		if caps != "" {
+			spec.Capabilities = nil
+			for _, c := range strings.Split(caps, ";") {
+				if c = strings.TrimSpace(c); c != "" {
+					spec.Capabilities = append(spec.Capabilities, c)
+				}
+			}
+		}
+		specs = append(specs, spec)
+	}
+	if len(specs) == 0 {
+		return nil, errors.New("no workers listed")
+	}
+	return specs, nil
+}
+
+// Add registers a worker, or updates its capabilities. Static workers
+// are left as configured.
+func (p *Pool) Add(spec WorkerSpec) {
+	spec.URL = strings.TrimRight(spec.URL, "/")
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if w, ok := p.workers[spec.URL]; ok {
+		if !w.static {
+			w.spec = spec
+		}
+		return
+	}
+	p.workers[spec.URL] = &worker{spec: spec, healthy: true}
+	slog.Info("bioapi: worker added", "url", spec.URL, "capabilities", spec.Capabilities)
+}
+
+// Remove drops a registered worker. Calls already routed to it finish.
+func (p *Pool) Remove(url string) {
+	url = strings.TrimRight(url, "/")
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if w, ok := p.workers[url]; ok && !w.static {
+		delete(p.workers, url)
+		slog.Info("bioapi: worker removed", "url", url)
+	}
+}
+
+// Workers returns a snapshot of every worker, ordered by URL.
+func (p *Pool) Workers() []WorkerStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	out := make([]WorkerStatus, 0, len(p.workers))
+	for _, w := range p.sorted() {
+		s := WorkerStatus{
+			ID:           w.spec.ID,
+			URL:          w.spec.URL,
+			Capabilities: w.spec.Capabilities,
+			Static:       w.static,
+			Healthy:      w.healthy,
+			Drained:      !w.healthy || p.open(w, now),
+			Outstanding:  w.outstanding,
+			LastError:    w.lastError,
+		}
+		if !w.lastProbe.IsZero() {
+			t := w.lastProbe
+			s.LastProbeAt = &t
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// Capacity returns how many workers offering capability can take a call
+// right now.
+func (p *Pool) Capacity(capability string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	n := 0
+	for _, w := range p.workers {
+		if w.offers(capability) && p.available(w, now) {
+			n++
+		}
+	}
+	return n
+}
+
+// Run refreshes the registered workers and probes every worker's health
+// until ctx is cancelled. It returns at once if health checks are off.
+func (p *Pool) Run(ctx context.Context) {
+	if p.cfg.ProbeInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(p.cfg.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		p.refresh(ctx)
+		p.probeAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refresh replaces the registered workers with the current registrations.
+func (p *Pool) refresh(ctx context.Context) {
+	if p.cfg.Registered == nil {
+		return
+	}
+	specs, err := p.cfg.Registered(ctx)
+	if err != nil {
+		slog.Error("bioapi: failed to load registered workers", "error", err)
+		return
+	}
+	current := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		spec.URL = strings.TrimRight(spec.URL, "/")
+		current[spec.URL] = true
+		p.Add(spec)
+	}
+	p.mu.Lock()
+	var gone []string
+	for url, w := range p.workers {
+		if !w.static && !current[url] {
+			gone = append(gone, url)
+		}
+	}
+	p.mu.Unlock()
+	for _, url := range gone {
+		p.Remove(url)
+	}
+}
+
+func (p *Pool) probeAll(ctx context.Context) {
+	p.mu.Lock()
+	workers := p.sorted()
+	urls := make([]string, len(workers))
+	for i, w := range workers {
+		urls[i] = w.spec.URL
+	}
+	p.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for i, w := range workers {
+		wg.Add(1)
+		go func(w *worker, url string) {
+			defer wg.Done()
+			err := p.probe(ctx, url)
+			if ctx.Err() != nil {
+				return
+			}
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			w.lastProbe = time.Now()
+			if err != nil {
+				if w.healthy {
+					slog.Warn("bioapi: draining worker: health check failed", "url", w.spec.URL, "error", err)
+				}
+				w.healthy = false
+				w.lastError = err.Error()
+				return
+			}
+			if !w.healthy || p.open(w, w.lastProbe) {
+				slog.Info("bioapi: worker is healthy", "url", w.spec.URL)
+			}
+			// A passing health check also closes a drained worker's breaker
+			w.healthy = true
+			w.failures = 0
+			w.lastError = ""
+		}(w, urls[i])
+	}
+	wg.Wait()
+}
+
+func (p *Pool) probe(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url+EndpointHealth.Path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	var h Health
+	if err := json.NewDecoder(resp.Body).Decode(&h); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	if h.Status != "healthy" {
+		return fmt.Errorf("status %q", h.Status)
+	}
+	p.observe(resp.Header.Get(VersionHeader))
+	return nil
+}
+
+// Version returns the BioAPI version most recently reported by a worker,
+// or "" before any has answered.
+func (p *Pool) Version() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.version
+}
+
+func (p *Pool) observe(version string) {
+	if version == "" {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.version = version
+}
+
+// acquire picks the available worker with the fewest outstanding calls
+// that offers capability, preferring one other than avoid. The worker must
+// be handed back with release.
+func (p *Pool) acquire(capability string, avoid *worker) (*worker, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	workers := p.sorted()
+	var capable bool
+	var best *worker
+	for i := range workers {
+		// Rotate the starting point so ties are spread evenly
+		w := workers[(p.next+i)%len(workers)]
+		if !w.offers(capability) {
+			continue
+		}
+		capable = true
+		if !p.available(w, now) {
+			continue
+		}
+		if best == nil || (best == avoid && w != avoid) || (w != avoid && w.outstanding < best.outstanding) {
+			best = w
+		}
+	}
+	p.next++
+	if best == nil {
+		if capable {
+			return nil, ErrUnavailable
+		}
+		return nil, ErrNoWorker
+	}
+	if p.cfg.BreakerThreshold > 0 && best.failures >= p.cfg.BreakerThreshold {
+		best.probing = true
+	}
+	best.outstanding++
+	return best, nil
+}
+
+type outcome int
+
+const (
+	outcomeSuccess outcome = iota
+	outcomeFailure
+	// outcomeNone ends a call that says nothing about the worker, such as
+	// one the caller cancelled
+	outcomeNone
+)
+
+func (p *Pool) release(w *worker, o outcome) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	w.outstanding--
+	w.probing = false
+	switch o {
+	case outcomeSuccess:
+		w.failures = 0
+	case outcomeFailure:
+		w.failures++
+		if p.cfg.BreakerThreshold > 0 && w.failures >= p.cfg.BreakerThreshold {
+			if w.failures == p.cfg.BreakerThreshold {
+				slog.Warn("bioapi: draining worker after consecutive failures", "url", w.spec.URL, "failures", w.failures)
+			}
+			w.openUntil = time.Now().Add(p.cfg.BreakerCooldown)
+		}
+	}
+}
+
+func (p *Pool) available(w *worker, now time.Time) bool {
+	if !w.healthy {
+		return false
+	}
+	if p.cfg.BreakerThreshold <= 0 || w.failures < p.cfg.BreakerThreshold {
+		return true
+	}
+	return !now.Before(w.openUntil) && !w.probing
+}
+
+func (p *Pool) open(w *worker, now time.Time) bool {
+	return p.cfg.BreakerThreshold > 0 && w.failures >= p.cfg.BreakerThreshold && now.Before(w.openUntil)
+}
+
+func (p *Pool) sorted() []*worker {
+	out := make([]*worker, 0, len(p.workers))
+	for _, w := range p.workers {
+		out = append(out, w)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].spec.URL < out[j].spec.URL })
+	return out
+}
+
+func (w *worker) offers(capability string) bool {
+	if capability == "" {
+		return true
+	}
+	for _, c := range w.spec.Capabilities {
+		if c == capability || c == CapabilityAll {
+			return true
+		}
+	}
+	return false
+}
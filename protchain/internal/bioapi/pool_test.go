@@ -0,0 +1,266 @@
+package bioapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testPool returns a pool of static workers at fake URLs, keyed by ID.
+// Calls are never sent to them; tests drive acquire and release directly.
+func testPool(cfg PoolConfig, specs ...WorkerSpec) (*Pool, map[string]*worker) {
+	for i := range specs {
+		specs[i].URL = "http://" + specs[i].ID
+	}
+	cfg.Static = specs
+	p := NewPool(cfg)
+	byID := make(map[string]*worker)
+	for _, w := range p.workers {
+		byID[w.spec.ID] = w
+	}
+	return p, byID
+}
+
+func spec(id string, capabilities ...string) WorkerSpec {
+	return WorkerSpec{ID: id, Capabilities: capabilities}
+}
+
+func TestAcquireCapability(t *testing.T) {
+	tests := []struct {
+		capability string
+		// want lists the workers that may serve the capability
+		want []string
+	}{
+		{CapabilityVina, []string{"vina", "all"}},
+		{CapabilityOpenMM, []string{"md", "all"}},
+		{"", []string{"vina", "md", "all"}},
+		{"quantum", []string{"all"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.capability, func(t *testing.T) {
+			p, _ := testPool(PoolConfig{}, spec("vina", CapabilityVina), spec("md", CapabilityOpenMM), spec("all", CapabilityAll))
+			got := make(map[string]bool)
+			// Held calls push later ones onto the other capable workers
+			for i := 0; i < 2*len(tt.want); i++ {
+				w, err := p.acquire(tt.capability, nil)
+				if err != nil {
+					t.Fatalf("acquire: %v", err)
+				}
+				got[w.spec.ID] = true
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("routed to %v, want %v", got, tt.want)
+			}
+			for _, id := range tt.want {
+				if !got[id] {
+					t.Errorf("never routed to %s: %v", id, got)
+				}
+			}
+		})
+	}
+
+	p, _ := testPool(PoolConfig{}, spec("vina", CapabilityVina))
+	if _, err := p.acquire(CapabilityOpenMM, nil); !errors.Is(err, ErrNoWorker) {
+		t.Errorf("acquire without a capable worker = %v, want ErrNoWorker", err)
+	}
+}
+
+func TestAcquireLeastOutstanding(t *testing.T) {
+	p, workers := testPool(PoolConfig{}, spec("a", CapabilityAll), spec("b", CapabilityAll), spec("c", CapabilityAll))
+	workers["a"].outstanding = 2
+	workers["b"].outstanding = 1
+	w, err := p.acquire("", nil)
+	if err != nil || w.spec.ID != "c" {
+		t.Fatalf("acquire = %v, %v; want the idle worker c", w, err)
+	}
+	w, _ = p.acquire("", nil)
+	if w.spec.ID != "b" && w.spec.ID != "c" {
+		t.Errorf("acquire = %s, want b or c, one call each", w.spec.ID)
+	}
+	if got := workers["a"].outstanding + workers["b"].outstanding + workers["c"].outstanding; got != 5 {
+		t.Errorf("%d outstanding calls, want 5", got)
+	}
+}
+
+// TestAcquireAvoid checks that a retry goes to another worker when there
+// is one, even if the previous one is less busy.
+func TestAcquireAvoid(t *testing.T) {
+	p, workers := testPool(PoolConfig{}, spec("a", CapabilityAll), spec("b", CapabilityAll))
+	workers["b"].outstanding = 3
+	for i := 0; i < 4; i++ {
+		w, err := p.acquire("", workers["a"])
+		if err != nil || w.spec.ID != "b" {
+			t.Fatalf("acquire avoiding a = %v, %v; want b", w, err)
+		}
+		p.release(w, outcomeSuccess)
+	}
+
+	// With nowhere else to go the retry stays on the same worker
+	p, workers = testPool(PoolConfig{}, spec("a", CapabilityAll), spec("b", CapabilityVina))
+	if w, err := p.acquire(CapabilityOpenMM, workers["a"]); err != nil || w.spec.ID != "a" {
+		t.Errorf("acquire avoiding the only capable worker = %v, %v; want a", w, err)
+	}
+}
+
+// TestBreakerDrainsWorker fails a worker until it is drained, checks that
+// calls avoid it during the cooldown, and that one probe call afterwards
+// brings it back.
+func TestBreakerDrainsWorker(t *testing.T) {
+	const cooldown = 50 * time.Millisecond
+	p, workers := testPool(PoolConfig{BreakerThreshold: 2, BreakerCooldown: cooldown}, spec("a", CapabilityAll), spec("b", CapabilityAll))
+	a := workers["a"]
+
+	// One failure is tolerated; a success resets the count
+	for _, o := range []outcome{outcomeFailure, outcomeSuccess, outcomeFailure} {
+		p.release(a, o)
+	}
+	a.outstanding = 0
+	if p.Capacity("") != 2 {
+		t.Fatalf("capacity = %d before the threshold, want 2", p.Capacity(""))
+	}
+
+	a.outstanding++
+	p.release(a, outcomeFailure)
+	if got := p.Capacity(""); got != 1 {
+		t.Fatalf("capacity = %d with a drained, want 1", got)
+	}
+	if s := p.Workers()[0]; s.ID != "a" || !s.Drained || !s.Healthy {
+		t.Errorf("status of a = %+v, want drained but healthy", s)
+	}
+	for i := 0; i < 5; i++ {
+		w, err := p.acquire("", nil)
+		if err != nil || w != workers["b"] {
+			t.Fatalf("acquire during cooldown = %v, %v; want b", w, err)
+		}
+		p.release(w, outcomeSuccess)
+	}
+
+	// After the cooldown a single call probes a
+	time.Sleep(cooldown)
+	var probe *worker
+	for i := 0; i < 2 && probe == nil; i++ {
+		w, _ := p.acquire("", nil)
+		if w == a {
+			probe = w
+		} else {
+			p.release(w, outcomeSuccess)
+		}
+	}
+	if probe == nil {
+		t.Fatal("no call probed a after the cooldown")
+	}
+	if got := p.Capacity(""); got != 1 {
+		t.Errorf("capacity = %d while a is probed, want 1", got)
+	}
+	p.release(probe, outcomeSuccess)
+	if got := p.Capacity(""); got != 2 {
+		t.Errorf("capacity = %d after a successful probe, want 2", got)
+	}
+
+	// A failed probe drains the worker for another cooldown
+	a.failures = 2
+	w, _ := p.acquire("", workers["b"])
+	if w != a {
+		t.Fatalf("acquire avoiding b = %v, want a", w)
+	}
+	p.release(w, outcomeFailure)
+	if got := p.Capacity(""); got != 1 {
+		t.Errorf("capacity = %d after a failed probe, want 1", got)
+	}
+}
+
+func TestAllWorkersDrained(t *testing.T) {
+	p, workers := testPool(PoolConfig{BreakerThreshold: 1, BreakerCooldown: time.Hour}, spec("a", CapabilityVina))
+	workers["a"].outstanding++
+	p.release(workers["a"], outcomeFailure)
+	if _, err := p.acquire(CapabilityVina, nil); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("acquire with every capable worker drained = %v, want ErrUnavailable", err)
+	}
+}
+
+// healthServer answers /health with status, reporting version.
+func healthServer(status int, version string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != EndpointHealth.Path {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set(VersionHeader, version)
+		w.WriteHeader(status)
+		fmt.Fprint(w, `{"status":"healthy","service":"bioapi"}`)
+	}))
+}
+
+func TestProbe(t *testing.T) {
+	up := healthServer(http.StatusOK, "2.0.0")
+	defer up.Close()
+	down := healthServer(http.StatusServiceUnavailable, "2.0.0")
+	defer down.Close()
+
+	p := NewPool(PoolConfig{
+		Static: []WorkerSpec{
+			{ID: "up", URL: up.URL, Capabilities: []string{CapabilityAll}},
+			{ID: "down", URL: down.URL, Capabilities: []string{CapabilityAll}},
+		},
+		BreakerThreshold: 1,
+		BreakerCooldown:  time.Hour,
+	})
+	// Drain the healthy worker's breaker; a passing health check closes it
+	// well before the cooldown ends
+	for _, w := range p.workers {
+		if w.spec.ID == "up" {
+			w.outstanding++
+			p.release(w, outcomeFailure)
+		}
+	}
+	if got := p.Capacity(""); got != 1 {
+		t.Fatalf("capacity = %d before probing, want 1", got)
+	}
+
+	p.probeAll(context.Background())
+	if got := p.Capacity(""); got != 1 {
+		t.Errorf("capacity = %d after probing, want 1", got)
+	}
+	if v := p.Version(); v != "2.0.0" {
+		t.Errorf("version = %q, want the one reported by /health", v)
+	}
+	status := make(map[string]WorkerStatus)
+	for _, s := range p.Workers() {
+		status[s.ID] = s
+	}
+	if s := status["up"]; !s.Healthy || s.Drained || s.LastProbeAt == nil {
+		t.Errorf("worker up = %+v", s)
+	}
+	if s := status["down"]; s.Healthy || !s.Drained || s.LastError != "status 503" {
+		t.Errorf("worker down = %+v", s)
+	}
+	if w, err := p.acquire("", nil); err != nil || w.spec.ID != "up" {
+		t.Errorf("acquire = %v, %v; want up", w, err)
+	}
+}
+
+func TestParseWorkers(t *testing.T) {
+	specs, err := ParseWorkers(" http://bio1:8000=vina;openmm , https://bio2:8000,http://bio3:8000=screening;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []WorkerSpec{
+		{ID: "static-1", URL: "http://bio1:8000", Capabilities: []string{CapabilityVina, CapabilityOpenMM}},
+		{ID: "static-2", URL: "https://bio2:8000", Capabilities: []string{CapabilityAll}},
+		{ID: "static-3", URL: "http://bio3:8000", Capabilities: []string{CapabilityScreening}},
+	}
+	if !reflect.DeepEqual(specs, want) {
+		t.Errorf("ParseWorkers = %+v, want %+v", specs, want)
+	}
+
+	for _, s := range []string{"", " , ", "bio1:8000", "ftp://bio1=vina"} {
+		if _, err := ParseWorkers(s); err == nil {
+			t.Errorf("ParseWorkers(%q) succeeded", s)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package bioapi
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrWorkerNotFound is returned for an unknown registration.
+var ErrWorkerNotFound = errors.New("bioapi: worker not registered")
+
+// Registry stores self-registered workers in bioapi_workers so that every
+// API replica routes to them. A registration lapses when its worker stops
+// sending heartbeats for the TTL.
+type Registry struct {
+	db  *sql.DB
+	ttl time.Duration
+}
+
+func NewRegistry(db *sql.DB, ttl time.Duration) *Registry {
+	return &Registry{db: db, ttl: ttl}
+}
+
+// TTL is how long a registration lasts without a heartbeat.
+func (r *Registry) TTL() time.Duration { return r.ttl }
+
+// Register records a worker, or renews it if its URL is already known.
+func (r *Registry) Register(ctx context.Context, url string, capabilities []string) (WorkerSpec, error) {
+	if capabilities == nil {
+		capabilities = []string{}
+	}
+	var id int
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO bioapi_workers (url, capabilities, registered_at, last_heartbeat_at)
+		VALUES ($1, $2, NOW(), NOW())
+		ON CONFLICT (url) DO UPDATE SET capabilities = EXCLUDED.capabilities, last_heartbeat_at = NOW()
+		RETURNING id
+	`, url, pq.Array(capabilities)).Scan(&id)
+	if err != nil {
+		return WorkerSpec{}, fmt.Errorf("failed to register worker: %w", err)
+	}
+	return WorkerSpec{ID: strconv.Itoa(id), URL: url, Capabilities: capabilities}, nil
+}
+
+// Heartbeat renews a registration.
+func (r *Registry) Heartbeat(ctx context.Context, id int) (WorkerSpec, error) {
+	spec := WorkerSpec{ID: strconv.Itoa(id)}
+	err := r.db.QueryRowContext(ctx, `
+		UPDATE bioapi_workers SET last_heartbeat_at = NOW() WHERE id = $1
+		RETURNING url, capabilities
+	`, id).Scan(&spec.URL, pq.Array(&spec.Capabilities))
+	if err == sql.ErrNoRows {
+		return WorkerSpec{}, ErrWorkerNotFound
+	}
+	if err != nil {
+		return WorkerSpec{}, fmt.Errorf("failed to renew worker %d: %w", id, err)
+	}
+	return spec, nil
+}
+
+// Deregister removes a registration and returns the worker's URL.
+func (r *Registry) Deregister(ctx context.Context, id int) (string, error) {
+	var url string
+	err := r.db.QueryRowContext(ctx, `DELETE FROM bioapi_workers WHERE id = $1 RETURNING url`, id).Scan(&url)
+	if err == sql.ErrNoRows {
+		return "", ErrWorkerNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to deregister worker %d: %w", id, err)
+	}
+	return url, nil
+}
+
+// Load returns the live registrations and deletes lapsed ones. It is
+// meant as PoolConfig.Registered.
+func (r *Registry) Load(ctx context.Context) ([]WorkerSpec, error) {
+	if _, err := r.db.ExecContext(ctx, `
+		DELETE FROM bioapi_workers WHERE last_heartbeat_at < NOW() - $1 * INTERVAL '1 second'
+	`, r.ttl.Seconds()); err != nil {
+		return nil, fmt.Errorf("failed to expire workers: %w", err)
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT id, url, capabilities FROM bioapi_workers ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var specs []WorkerSpec
+	for rows.Next() {
+		var id int
+		var spec WorkerSpec
+		if err := rows.Scan(&id, &spec.URL, pq.Array(&spec.Capabilities)); err != nil {
+			return nil, err
+		}
+		spec.ID = strconv.Itoa(id)
+		specs = append(specs, spec)
+	}
+	return specs, rows.Err()
+}
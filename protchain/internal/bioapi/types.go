@@ -0,0 +1,207 @@
+package bioapi
+
+import "encoding/json"
+
+// Vec3 is a point or box size in Å.
+type Vec3 struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	Z float64 `json:"z"`
+}
+
+// StructureRequest asks BioAPI to fetch and prepare a structure. Without
+// StructureData the structure is downloaded from RCSB by PDBID.
+type StructureRequest struct {
+	PDBID         string  `json:"pdb_id"`
+	StructureData *string `json:"structure_data"`
+}
+
+// StructureResult is the data of a structure preparation response.
+type StructureResult struct {
+	WorkflowID string `json:"workflow_id,omitempty"`
+	PDBID      string `json:"pdb_id,omitempty"`
+	Filename   string `json:"filename,omitempty"`
+	Details    struct {
+		Descriptors json.RawMessage `json:"descriptors"`
+	} `json:"details"`
+	Status string `json:"status"`
+	Method string `json:"method"`
+}
+
+// BindingAnalysisRequest asks BioAPI to detect pockets on a structure.
+type BindingAnalysisRequest struct {
+	PDBID         string  `json:"pdb_id"`
+	StructureData *string `json:"structure_data"`
+}
+
+// BindingSiteResidue is a residue lining a pocket.
+type BindingSiteResidue struct {
+	Chain         string  `json:"chain"`
+	ResidueNumber int     `json:"residue_number"`
+	ResidueName   string  `json:"residue_name"`
+	Distance      float64 `json:"distance"`
+}
+
+// BindingSite is a pocket as BioAPI reports it, best ranked first.
+type BindingSite struct {
+	SiteID            int                  `json:"site_id"`
+	Center            Vec3                 `json:"center"`
+	Size              *Vec3                `json:"size"`
+	Volume            float64              `json:"volume"`
+	DruggabilityScore float64              `json:"druggability_score"`
+	Hydrophobicity    *float64             `json:"hydrophobicity"`
+	EnclosureScore    *float64             `json:"enclosure_score"`
+	NearbyResidues    []BindingSiteResidue `json:"nearby_residues"`
+}
+
+// BindingSitesResult is the data of a binding site analysis response. The
+// detect endpoint returns it without the response envelope.
+type BindingSitesResult struct {
+	WorkflowID   string        `json:"workflow_id,omitempty"`
+	PDBID        string        `json:"pdb_id"`
+	BindingSites []BindingSite `json:"binding_sites"`
+	Method       string        `json:"method"`
+	Status       string        `json:"status,omitempty"`
+	TotalSites   int           `json:"total_sites,omitempty"`
+}
+
+// AIDruggabilityRequest asks for ML druggability scores of pockets. Sites
+// are passed through as given, since the model reads whichever feature
+// fields are present.
+type AIDruggabilityRequest struct {
+	BindingSites []json.RawMessage `json:"binding_sites" binding:"required,min=1"`
+	PDBID        *string           `json:"pdb_id"`
+}
+
+// DruggabilityPrediction is the ML score of one pocket. Error is set
+// instead of the scores when the site could not be scored.
+type DruggabilityPrediction struct {
+	SiteID              json.RawMessage    `json:"site_id"`
+	MLDruggabilityScore float64            `json:"ml_druggability_score"`
+	OriginalScore       float64            `json:"original_score"`
+	Confidence          float64            `json:"confidence"`
+	FeatureValues       map[string]float64 `json:"feature_values,omitempty"`
+	FeatureImportance   map[string]float64 `json:"feature_importance,omitempty"`
+	Error               string             `json:"error,omitempty"`
+}
+
+// AIDruggabilityResult is the data of an AI druggability response.
+type AIDruggabilityResult struct {
+	Predictions  []DruggabilityPrediction `json:"predictions"`
+	PDBID        *string                  `json:"pdb_id"`
+	Model        string                   `json:"model"`
+	FeatureCount int                      `json:"feature_count"`
+}
+
+// LiteratureSearchRequest asks for research context on a protein.
+type LiteratureSearchRequest struct {
+	PDBID       string  `json:"pdb_id" binding:"required"`
+	ProteinName *string `json:"protein_name"`
+}
+
+// LiteratureSearchResult is the data of a literature search response. The
+// per-source results are passed through unchanged.
+type LiteratureSearchResult struct {
+	PDBID       string          `json:"pdb_id"`
+	PubMed      json.RawMessage `json:"pubmed"`
+	UniProt     json.RawMessage `json:"uniprot"`
+	RCSB        json.RawMessage `json:"rcsb"`
+	TotalPapers int             `json:"total_papers"`
+}
+
+// CompoundParseResult is the data of a compound file parse response.
+type CompoundParseResult struct {
+	Compounds []json.RawMessage `json:"compounds"`
+	Warnings  []string          `json:"warnings"`
+	Count     int               `json:"count"`
+}
+
+// ScreeningRequest is the body of virtual screening and Vina docking
+// requests. Docking requires PDBContent.
+type ScreeningRequest struct {
+	WorkflowID      *string           `json:"workflow_id,omitempty"`
+	BindingSite     json.RawMessage   `json:"binding_site"`
+	PDBContent      *string           `json:"pdb_content,omitempty"`
+	CompoundLibrary string            `json:"compound_library,omitempty"`
+	MaxCompounds    int               `json:"max_compounds,omitempty"`
+	CustomCompounds []json.RawMessage `json:"custom_compounds,omitempty"`
+}
+
+// ScreeningResult is the data of a virtual screening or docking response.
+type ScreeningResult struct {
+	Status            string            `json:"status"`
+	Method            string            `json:"method"`
+	TopCompounds      []json.RawMessage `json:"top_compounds"`
+	CompoundsScreened int               `json:"compounds_screened"`
+	CompoundsDocked   int               `json:"compounds_docked,omitempty"`
+	HitsFound         int               `json:"hits_found"`
+	BindingSiteUsed   json.RawMessage   `json:"binding_site_used"`
+	TotalDockingTime  float64           `json:"total_docking_time_seconds,omitempty"`
+	ScoringComponents []string          `json:"scoring_components,omitempty"`
+}
+
+// MDSimulationRequest is the body of a molecular dynamics request.
+type MDSimulationRequest struct {
+	WorkflowID   *string           `json:"workflow_id,omitempty"`
+	BindingSite  json.RawMessage   `json:"binding_site"`
+	PDBContent   string            `json:"pdb_content"`
+	TopCompounds []json.RawMessage `json:"top_compounds"`
+	Temperature  float64           `json:"temperature,omitempty"`
+	NSteps       int               `json:"n_steps,omitempty"`
+	MaxCompounds int               `json:"max_compounds,omitempty"`
+}
+
+// MDSimulationResult is the data of a molecular dynamics response.
+type MDSimulationResult struct {
+	Status                  string            `json:"status"`
+	Method                  string            `json:"method"`
+	TemperatureKelvin       float64           `json:"temperature_kelvin"`
+	SimulationSteps         int               `json:"simulation_steps"`
+	SimulationTimeNS        float64           `json:"simulation_time_ns"`
+	CompoundsSimulated      int               `json:"compounds_simulated"`
+	CompoundsFailed         int               `json:"compounds_failed"`
+	StableCompounds         int               `json:"stable_compounds"`
+	CompoundResults         []json.RawMessage `json:"compound_results"`
+	TotalComputationSeconds float64           `json:"total_computation_time_seconds"`
+}
+
+// LeadOptimizationRequest is the body of a lead optimization request. The
+// analyses all default to enabled.
+type LeadOptimizationRequest struct {
+	WorkflowID          *string           `json:"workflow_id,omitempty"`
+	Compounds           []json.RawMessage `json:"compounds"`
+	MaxCompounds        int               `json:"max_compounds,omitempty"`
+	EnableMMP           *bool             `json:"enable_mmp,omitempty"`
+	EnableRGroup        *bool             `json:"enable_rgroup,omitempty"`
+	EnableBioisosteres  *bool             `json:"enable_bioisosteres,omitempty"`
+	EnablePareto        *bool             `json:"enable_pareto,omitempty"`
+	EnableAnalogs       *bool             `json:"enable_analogs,omitempty"`
+	EnablePharmacophore *bool             `json:"enable_pharmacophore,omitempty"`
+}
+
+// LeadOptimizationResult is the data of a lead optimization response.
+type LeadOptimizationResult struct {
+	Status                  string            `json:"status"`
+	Method                  string            `json:"method"`
+	CompoundsAnalyzed       int               `json:"compounds_analyzed"`
+	CompoundsFailed         int               `json:"compounds_failed"`
+	AdvanceCount            int               `json:"advance_count"`
+	OptimizeCount           int               `json:"optimize_count"`
+	DeprioritizeCount       int               `json:"deprioritize_count"`
+	OptimizedCompounds      []json.RawMessage `json:"optimized_compounds"`
+	TotalComputationSeconds float64           `json:"total_computation_time_seconds"`
+}
+
+// Health is BioAPI's health check response.
+type Health struct {
+	Status       string   `json:"status"`
+	Service      string   `json:"service"`
+	Capabilities []string `json:"capabilities"`
+}
+
+// envelope is the AnalysisResponse wrapper most endpoints return.
+type envelope struct {
+	Success bool            `json:"success"`
+	Data    json.RawMessage `json:"data"`
+	Error   *string         `json:"error"`
+}
@@ -0,0 +1,292 @@
+// Package chain commits screening results to the DrugScreeningVerifier
+// contract over Ethereum JSON-RPC, signing transactions with a key held by
+// the server, and reads them back for verification.
+package chain
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrReverted is returned when a transaction was mined but failed.
+	ErrReverted = errors.New("transaction reverted")
+	// ErrReadOnly is returned when sending without a signing key.
+	ErrReadOnly = errors.New("no signing key configured")
+	// ErrNoEvent is returned for a successful transaction that did not
+	// emit ResultRecorded from the verifier contract.
+	ErrNoEvent = errors.New("no ResultRecorded event")
+
+	recordScreeningResultSelector = selector("recordScreeningResult(bytes32,bytes32,string)")
+	resultRecordedTopic           = Keccak256([]byte("ResultRecorded(uint256,bytes32,address)"))
+)
+
+// Config configures a Client.
+type Config struct {
+	RPCURL   string
+	Contract string
+	// SigningKey is the hex-encoded secp256k1 private key of the account
+	// that sends transactions. Without it the client can only read.
+	SigningKey    string
+	Confirmations int
+	PollInterval  time.Duration
+	Timeout       time.Duration
+}
+
+// Receipt is the outcome of a mined recordScreeningResult transaction.
+type Receipt struct {
+	TxHash      string
+	BlockNumber uint64
+	BlockHash   string
+	GasUsed     uint64
+	GasPrice    *big.Int
+	// NumericID, ResultID and Researcher come from the ResultRecorded
+	// event
+	NumericID  *big.Int
+	ResultID   string
+	Researcher string
+}
+
+type Client struct {
+	rpc           *rpcClient
+	signer        *signer
+	contract      Address
+	confirmations uint64
+	poll          time.Duration
+
+	// mu serializes nonce allocation between concurrent commits
+	mu      sync.Mutex
+	chainID *big.Int
+}
+
+func New(cfg Config) (*Client, error) {
+	contract, err := ParseAddress(cfg.Contract)
+	if err != nil {
+		return nil, fmt.Errorf("contract: %w", err)
+	}
+	c := &Client{
+		rpc:           newRPCClient(cfg.RPCURL, cfg.Timeout),
+		contract:      contract,
+		confirmations: 1,
+		poll:          cfg.PollInterval,
+	}
+	if cfg.SigningKey != "" {
+		if c.signer, err = newSigner(cfg.SigningKey); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Confirmations > 1 {
+		c.confirmations = uint64(cfg.Confirmations)
+	}
+	if c.poll <= 0 {
+		c.poll = 2 * time.Second
+	}
+	return c, nil
+}
+
+// CanSign reports whether the client has a signing key.
+func (c *Client) CanSign() bool { return c.signer != nil }
+
+// From returns the address transactions are sent from, or "" for a
+// read-only client.
+func (c *Client) From() string {
+	if c.signer == nil {
+		return ""
+	}
+	return c.signer.from.Hex()
+}
+
+// Contract returns the verifier contract address.
+func (c *Client) Contract() string { return c.contract.Hex() }
+
+// ChainID returns the chain ID reported by the node, cached after the
+// first call.
+func (c *Client) ChainID(ctx context.Context) (*big.Int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.chainIDLocked(ctx)
+}
+
+func (c *Client) chainIDLocked(ctx context.Context) (*big.Int, error) {
+	if c.chainID != nil {
+		return c.chainID, nil
+	}
+	var id quantity
+	if err := c.rpc.call(ctx, &id, "eth_chainId"); err != nil {
+		return nil, err
+	}
+	c.chainID = new(big.Int).Set(id.big())
+	return c.chainID, nil
+}
+
+// RecordScreeningResult signs and broadcasts a recordScreeningResult call
+// and returns the transaction hash without waiting for it to be mined.
+func (c *Client) RecordScreeningResult(ctx context.Context, resultHash, moleculeDataHash [32]byte, moleculeID string) (string, error) {
+	if c.signer == nil {
+		return "", ErrReadOnly
+	}
+	data := encodeRecordScreeningResult(resultHash, moleculeDataHash, moleculeID)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	chainID, err := c.chainIDLocked(ctx)
+	if err != nil {
+		return "", err
+	}
+	from := c.signer.from.Hex()
+
+	var nonce, gasPrice, gas quantity
+	if err := c.rpc.call(ctx, &nonce, "eth_getTransactionCount", from, "pending"); err != nil {
+		return "", err
+	}
+	if err := c.rpc.call(ctx, &gasPrice, "eth_gasPrice"); err != nil {
+		return "", err
+	}
+	call := map[string]string{"from": from, "to": c.contract.Hex(), "data": "0x" + hex.EncodeToString(data)}
+	if err := c.rpc.call(ctx, &gas, "eth_estimateGas", call); err != nil {
+		return "", fmt.Errorf("estimating gas: %w", err)
+	}
+
+	raw, hash, err := c.signer.sign(legacyTx{
+		Nonce:    nonce.uint64(),
+		GasPrice: gasPrice.big(),
+		// Leave headroom over the estimate
+		Gas:   gas.uint64() * 6 / 5,
+		To:    c.contract,
+		Value: new(big.Int),
+		Data:  data,
+	}, chainID)
+	if err != nil {
+		return "", err
+	}
+
+	var sent string
+	if err := c.rpc.call(ctx, &sent, "eth_sendRawTransaction", "0x"+hex.EncodeToString(raw)); err != nil {
+		return "", err
+	}
+	txHash := "0x" + hex.EncodeToString(hash[:])
+	if !strings.EqualFold(sent, txHash) {
+		return "", fmt.Errorf("node returned transaction hash %s, expected %s", sent, txHash)
+	}
+	return txHash, nil
+}
+
+// WaitForReceipt polls until txHash is mined and has the configured number
+// of confirmations, or ctx is done. It returns ErrReverted, along with the
+// receipt, if the transaction failed.
+func (c *Client) WaitForReceipt(ctx context.Context, txHash string) (*Receipt, error) {
+	ticker := time.NewTicker(c.poll)
+	defer ticker.Stop()
+
+	for {
+		r, err := c.Receipt(ctx, txHash)
+		if err != nil {
+			return nil, err
+		}
+		if r != nil {
+			var head quantity
+			if err := c.rpc.call(ctx, &head, "eth_blockNumber"); err != nil {
+				return nil, err
+			}
+			if head.uint64() >= r.BlockNumber && head.uint64()-r.BlockNumber+1 >= c.confirmations {
+				if r.NumericID == nil {
+					return r, ErrReverted
+				}
+				return r, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Receipt fetches a transaction receipt, returning nil if it is not mined
+// yet. NumericID is nil if the transaction failed.
+func (c *Client) Receipt(ctx context.Context, txHash string) (*Receipt, error) {
+	var raw *struct {
+		BlockNumber       quantity `json:"blockNumber"`
+		BlockHash         string   `json:"blockHash"`
+		GasUsed           quantity `json:"gasUsed"`
+		EffectiveGasPrice quantity `json:"effectiveGasPrice"`
+		Status            quantity `json:"status"`
+		Logs              []struct {
+			Address string   `json:"address"`
+			Topics  []string `json:"topics"`
+		} `json:"logs"`
+	}
+	if err := c.rpc.call(ctx, &raw, "eth_getTransactionReceipt", txHash); err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, nil
+	}
+
+	r := &Receipt{
+		TxHash:      txHash,
+		BlockNumber: raw.BlockNumber.uint64(),
+		BlockHash:   raw.BlockHash,
+		GasUsed:     raw.GasUsed.uint64(),
+		GasPrice:    raw.EffectiveGasPrice.big(),
+	}
+	if raw.Status.uint64() != 1 {
+		return r, nil
+	}
+	want := "0x" + hex.EncodeToString(resultRecordedTopic[:])
+	for _, l := range raw.Logs {
+		if !strings.EqualFold(l.Address, c.contract.Hex()) || len(l.Topics) < 3 || !strings.EqualFold(l.Topics[0], want) {
+			continue
+		}
+		id, ok := new(big.Int).SetString(strings.TrimPrefix(l.Topics[1], "0x"), 16)
+		if !ok {
+			return nil, fmt.Errorf("invalid numericId topic %q", l.Topics[1])
+		}
+		r.NumericID = id
+		r.ResultID = l.Topics[2]
+		if len(l.Topics) > 3 {
+			r.Researcher = topicAddress(l.Topics[3])
+		}
+		break
+	}
+	if r.NumericID == nil {
+		return nil, fmt.Errorf("transaction %s: %w", txHash, ErrNoEvent)
+	}
+	return r, nil
+}
+
+func selector(signature string) [4]byte {
+	var s [4]byte
+	h := Keccak256([]byte(signature))
+	copy(s[:], h[:4])
+	return s
+}
+
+// encodeRecordScreeningResult ABI-encodes the call data for
+// recordScreeningResult(bytes32,bytes32,string).
+func encodeRecordScreeningResult(resultHash, moleculeDataHash [32]byte, moleculeID string) []byte {
+	word := func(n int) []byte {
+		w := make([]byte, 32)
+		new(big.Int).SetInt64(int64(n)).FillBytes(w)
+		return w
+	}
+
+	data := append([]byte{}, recordScreeningResultSelector[:]...)
+	data = append(data, resultHash[:]...)
+	data = append(data, moleculeDataHash[:]...)
+	// The string is dynamic: its offset follows the three head words
+	data = append(data, word(3*32)...)
+	data = append(data, word(len(moleculeID))...)
+	padded := make([]byte, (len(moleculeID)+31)/32*32)
+	copy(padded, moleculeID)
+	return append(data, padded...)
+}
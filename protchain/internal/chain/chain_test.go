@@ -0,0 +1,71 @@
+package chain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestEncodeRecordScreeningResult(t *testing.T) {
+	var resultHash, moleculeDataHash [32]byte
+	copy(resultHash[:], unhex(t, "5c1d00000000000000000000000000000000000000000000000000000000beef"))
+	copy(moleculeDataHash[:], unhex(t, "abababababababababababababababababababababababababababababababab"))
+
+	// Laid out by hand from the Solidity ABI specification. Reproduce with
+	//   cast calldata 'recordScreeningResult(bytes32,bytes32,string)' \
+	//     0x5c1d...beef 0xabab...abab <moleculeId>
+	head := []string{
+		"a8988cb5",
+		"5c1d00000000000000000000000000000000000000000000000000000000beef",
+		"abababababababababababababababababababababababababababababababab",
+		"0000000000000000000000000000000000000000000000000000000000000060",
+	}
+	tests := []struct {
+		name       string
+		moleculeID string
+		tail       []string
+	}{
+		{"short id", "CHEMBL25", []string{
+			"0000000000000000000000000000000000000000000000000000000000000008",
+			"4348454d424c3235000000000000000000000000000000000000000000000000",
+		}},
+		{"empty id", "", []string{
+			"0000000000000000000000000000000000000000000000000000000000000000",
+		}},
+		{"one full word", strings.Repeat("x", 32), []string{
+			"0000000000000000000000000000000000000000000000000000000000000020",
+			"7878787878787878787878787878787878787878787878787878787878787878",
+		}},
+		{"spills into a second word", strings.Repeat("x", 33), []string{
+			"0000000000000000000000000000000000000000000000000000000000000021",
+			"7878787878787878787878787878787878787878787878787878787878787878",
+			"7800000000000000000000000000000000000000000000000000000000000000",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := encodeRecordScreeningResult(resultHash, moleculeDataHash, tt.moleculeID)
+			want := unhex(t, append(append([]string{}, head...), tt.tail...)...)
+			if !bytes.Equal(got, want) {
+				t.Errorf("calldata =\n%s\nwant\n%s", words(got), words(want))
+			}
+		})
+	}
+}
+
+// words formats calldata as its selector and one ABI word per line.
+func words(b []byte) string {
+	if len(b) < 4 {
+		return hex.EncodeToString(b)
+	}
+	lines := []string{hex.EncodeToString(b[:4])}
+	for i := 4; i < len(b); i += 32 {
+		end := i + 32
+		if end > len(b) {
+			end = len(b)
+		}
+		lines = append(lines, hex.EncodeToString(b[i:end]))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,130 @@
+package chain
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+var getScreeningResultSelector = selector("getScreeningResult(uint256)")
+
+// ScreeningResult is a result as stored by the verifier contract. Hashes
+// are 0x-prefixed hex.
+type ScreeningResult struct {
+	ResultID         string
+	Researcher       string
+	Timestamp        time.Time
+	MoleculeID       string
+	MoleculeDataHash string
+	ResultHash       string
+	Verified         bool
+}
+
+// GetScreeningResult reads a result by its numeric ID at the latest block.
+func (c *Client) GetScreeningResult(ctx context.Context, numericID *big.Int) (*ScreeningResult, error) {
+	data := append([]byte{}, getScreeningResultSelector[:]...)
+	word := make([]byte, 32)
+	numericID.FillBytes(word)
+	data = append(data, word...)
+
+	var out string
+	call := map[string]string{"to": c.contract.Hex(), "data": "0x" + hex.EncodeToString(data)}
+	if err := c.rpc.call(ctx, &out, "eth_call", call, "latest"); err != nil {
+		return nil, err
+	}
+	ret, err := hex.DecodeString(strings.TrimPrefix(out, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("getScreeningResult: %w", err)
+	}
+	return decodeScreeningResult(ret)
+}
+
+// BlockTime returns the timestamp of a block.
+func (c *Client) BlockTime(ctx context.Context, number uint64) (time.Time, error) {
+	var block *struct {
+		Timestamp quantity `json:"timestamp"`
+	}
+	if err := c.rpc.call(ctx, &block, "eth_getBlockByNumber", encodeQuantity(new(big.Int).SetUint64(number)), false); err != nil {
+		return time.Time{}, err
+	}
+	if block == nil {
+		return time.Time{}, fmt.Errorf("block %d not found", number)
+	}
+	return time.Unix(block.Timestamp.big().Int64(), 0).UTC(), nil
+}
+
+// decodeScreeningResult decodes the ABI-encoded ScreeningResult tuple
+// (bytes32 resultId, address researcher, uint256 timestamp, string
+// moleculeId, bytes32 moleculeDataHash, bytes32 resultHash, bool verified).
+// The tuple holds a string, so it is returned by offset.
+func decodeScreeningResult(ret []byte) (*ScreeningResult, error) {
+	word := func(b []byte, i int) ([]byte, error) {
+		if len(b) < (i+1)*32 {
+			return nil, fmt.Errorf("getScreeningResult: short return data")
+		}
+		return b[i*32 : (i+1)*32], nil
+	}
+	offset := func(b []byte, i int) (int, error) {
+		w, err := word(b, i)
+		if err != nil {
+			return 0, err
+		}
+		n := new(big.Int).SetBytes(w)
+		if !n.IsInt64() || n.Int64() > int64(len(b)) {
+			return 0, fmt.Errorf("getScreeningResult: offset out of range")
+		}
+		return int(n.Int64()), nil
+	}
+
+	start, err := offset(ret, 0)
+	if err != nil {
+		return nil, err
+	}
+	tuple := ret[start:]
+
+	var fields [7][]byte
+	for i := range fields {
+		if fields[i], err = word(tuple, i); err != nil {
+			return nil, err
+		}
+	}
+	strStart, err := offset(tuple, 3)
+	if err != nil {
+		return nil, err
+	}
+	lenWord, err := word(tuple[strStart:], 0)
+	if err != nil {
+		return nil, err
+	}
+	n := new(big.Int).SetBytes(lenWord)
+	if !n.IsInt64() || int64(len(tuple)-strStart-32) < n.Int64() {
+		return nil, fmt.Errorf("getScreeningResult: string out of range")
+	}
+	str := tuple[strStart+32 : strStart+32+int(n.Int64())]
+
+	var researcher Address
+	copy(researcher[:], fields[1][12:])
+	return &ScreeningResult{
+		ResultID:         "0x" + hex.EncodeToString(fields[0]),
+		Researcher:       researcher.Hex(),
+		Timestamp:        time.Unix(new(big.Int).SetBytes(fields[2]).Int64(), 0).UTC(),
+		MoleculeID:       string(str),
+		MoleculeDataHash: "0x" + hex.EncodeToString(fields[4]),
+		ResultHash:       "0x" + hex.EncodeToString(fields[5]),
+		Verified:         fields[6][31] == 1,
+	}, nil
+}
+
+// topicAddress extracts an address from an indexed event topic.
+func topicAddress(topic string) string {
+	b, err := hex.DecodeString(strings.TrimPrefix(topic, "0x"))
+	if err != nil || len(b) != 32 {
+		return ""
+	}
+	var a Address
+	copy(a[:], b[12:])
+	return a.Hex()
+}
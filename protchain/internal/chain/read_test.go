@@ -0,0 +1,128 @@
+package chain
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// screeningResultReturn is the eth_call return data of
+// getScreeningResult for a verified CHEMBL25 result. The function returns
+// a struct with a string member, so the tuple is dynamic and the data
+// starts with its offset.
+var screeningResultReturn = []string{
+	"0000000000000000000000000000000000000000000000000000000000000020", // offset of the tuple
+	"7f9a1c0e5b3d2a4f6e8c0b1d3f5a7c9e2b4d6f8a0c1e3b5d7f9a2c4e6b8d0f1a", // resultId
+	"0000000000000000000000009d8a62f656a8d1615c1294fd71e9cfb3e4855a4f", // researcher
+	"000000000000000000000000000000000000000000000000000000006553f100", // timestamp
+	"00000000000000000000000000000000000000000000000000000000000000e0", // offset of moleculeId in the tuple
+	"abababababababababababababababababababababababababababababababab", // moleculeDataHash
+	"5c1d00000000000000000000000000000000000000000000000000000000beef", // resultHash
+	"0000000000000000000000000000000000000000000000000000000000000001", // verified
+	"0000000000000000000000000000000000000000000000000000000000000008", // moleculeId length
+	"4348454d424c3235000000000000000000000000000000000000000000000000", // "CHEMBL25"
+}
+
+var wantScreeningResult = ScreeningResult{
+	ResultID:         "0x7f9a1c0e5b3d2a4f6e8c0b1d3f5a7c9e2b4d6f8a0c1e3b5d7f9a2c4e6b8d0f1a",
+	Researcher:       "0x9d8a62f656a8d1615c1294fd71e9cfb3e4855a4f",
+	Timestamp:        time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC),
+	MoleculeID:       "CHEMBL25",
+	MoleculeDataHash: "0xabababababababababababababababababababababababababababababababab",
+	ResultHash:       "0x5c1d00000000000000000000000000000000000000000000000000000000beef",
+	Verified:         true,
+}
+
+func TestDecodeScreeningResult(t *testing.T) {
+	got, err := decodeScreeningResult(unhex(t, screeningResultReturn...))
+	if err != nil {
+		t.Fatalf("decodeScreeningResult: %v", err)
+	}
+	if *got != wantScreeningResult {
+		t.Errorf("decoded\n%+v\nwant\n%+v", *got, wantScreeningResult)
+	}
+}
+
+func TestDecodeScreeningResultMalformed(t *testing.T) {
+	valid := unhex(t, screeningResultReturn...)
+	patch := func(word int, value string) []byte {
+		b := append([]byte{}, valid...)
+		copy(b[word*32:], unhex(t, value))
+		return b
+	}
+
+	tests := map[string][]byte{
+		"empty":                 nil,
+		"head only":             valid[:32],
+		"truncated tuple":       valid[:6*32],
+		"missing string data":   valid[:8*32],
+		"tuple offset too big":  patch(0, "0000000000000000000000000000000000000000000000000000000000001000"),
+		"string offset too big": patch(4, "0000000000000000000000000000000000000000000000000000000000001000"),
+		"string too long":       patch(8, "0000000000000000000000000000000000000000000000000000000000000021"),
+		"huge offset":           patch(0, "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"),
+	}
+	for name, data := range tests {
+		if _, err := decodeScreeningResult(data); err == nil {
+			t.Errorf("%s: decodeScreeningResult succeeded", name)
+		}
+	}
+}
+
+func TestGetScreeningResult(t *testing.T) {
+	const contract = "0x5fbdb2315678afecb367f032d93f642f64180aa3"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     int64             `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decoding request: %v", err)
+			return
+		}
+		if req.Method != "eth_call" || len(req.Params) != 2 {
+			t.Errorf("request = %s with %d params, want eth_call with 2", req.Method, len(req.Params))
+		}
+		var call map[string]string
+		json.Unmarshal(req.Params[0], &call)
+		// getScreeningResult(uint256) with numeric ID 42
+		wantData := "0x9e118750000000000000000000000000000000000000000000000000000000000000002a"
+		if call["to"] != contract || call["data"] != wantData {
+			t.Errorf("eth_call = %v, want to %s with data %s", call, contract, wantData)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      req.ID,
+			"result":  "0x" + strings.Join(screeningResultReturn, ""),
+		})
+	}))
+	defer srv.Close()
+
+	c, err := New(Config{RPCURL: srv.URL, Contract: contract, Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	got, err := c.GetScreeningResult(context.Background(), big.NewInt(42))
+	if err != nil {
+		t.Fatalf("GetScreeningResult: %v", err)
+	}
+	if *got != wantScreeningResult {
+		t.Errorf("result\n%+v\nwant\n%+v", *got, wantScreeningResult)
+	}
+}
+
+func TestTopicAddress(t *testing.T) {
+	topic := "0x0000000000000000000000009d8a62f656a8d1615c1294fd71e9cfb3e4855a4f"
+	if got := topicAddress(topic); got != "0x9d8a62f656a8d1615c1294fd71e9cfb3e4855a4f" {
+		t.Errorf("topicAddress = %s", got)
+	}
+	if got := topicAddress("0x" + hex.EncodeToString([]byte("short"))); got != "" {
+		t.Errorf("topicAddress of a short topic = %q, want empty", got)
+	}
+}
@@ -0,0 +1,106 @@
+package chain
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// RPCError is an error object returned by the node.
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("json-rpc error %d: %s", e.Code, e.Message)
+}
+
+type rpcClient struct {
+	url  string
+	http *http.Client
+	seq  atomic.Int64
+}
+
+func newRPCClient(url string, timeout time.Duration) *rpcClient {
+	return &rpcClient{url: url, http: &http.Client{Timeout: timeout}}
+}
+
+// call invokes method and decodes the result into out.
+func (r *rpcClient) call(ctx context.Context, out interface{}, method string, params ...interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      r.seq.Add(1),
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: node returned HTTP %d", method, resp.StatusCode)
+	}
+
+	var msg struct {
+		Result json.RawMessage `json:"result"`
+		Error  *RPCError       `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+		return fmt.Errorf("%s: decoding response: %w", method, err)
+	}
+	if msg.Error != nil {
+		return msg.Error
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(msg.Result, out)
+}
+
+// quantity is a hex-encoded JSON-RPC integer.
+type quantity big.Int
+
+func (q *quantity) UnmarshalJSON(data []byte) error {
+	s, err := strconv.Unquote(string(data))
+	if err != nil {
+		return fmt.Errorf("invalid quantity %s", data)
+	}
+	if !strings.HasPrefix(s, "0x") {
+		return fmt.Errorf("quantity %q lacks 0x prefix", s)
+	}
+	if _, ok := (*big.Int)(q).SetString(s[2:], 16); !ok {
+		return fmt.Errorf("invalid quantity %q", s)
+	}
+	return nil
+}
+
+func (q *quantity) big() *big.Int { return (*big.Int)(q) }
+
+func (q *quantity) uint64() uint64 { return (*big.Int)(q).Uint64() }
+
+func encodeQuantity(v *big.Int) string {
+	return "0x" + v.Text(16)
+}
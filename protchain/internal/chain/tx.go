@@ -0,0 +1,122 @@
+package chain
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"golang.org/x/crypto/sha3"
+)
+
+// Address is a 20-byte account address.
+type Address [20]byte
+
+// ParseAddress parses a 0x-prefixed hex address.
+func ParseAddress(s string) (Address, error) {
+	var a Address
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil || len(b) != len(a) {
+		return a, fmt.Errorf("invalid address %q", s)
+	}
+	copy(a[:], b)
+	return a, nil
+}
+
+func (a Address) Hex() string { return "0x" + hex.EncodeToString(a[:]) }
+
+// Keccak256 returns the Ethereum Keccak-256 digest of the concatenated data.
+func Keccak256(data ...[]byte) [32]byte {
+	h := sha3.NewLegacyKeccak256()
+	for _, d := range data {
+		h.Write(d)
+	}
+	var out [32]byte
+	h.Sum(out[:0])
+	return out
+}
+
+// signer holds the key transactions are signed with.
+type signer struct {
+	key  *secp256k1.PrivateKey
+	from Address
+}
+
+func newSigner(hexKey string) (*signer, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(hexKey), "0x"))
+	if err != nil || len(b) != 32 {
+		return nil, fmt.Errorf("signing key must be 32 hex-encoded bytes")
+	}
+	key := secp256k1.PrivKeyFromBytes(b)
+	pub := key.PubKey().SerializeUncompressed()
+
+	s := &signer{key: key}
+	digest := Keccak256(pub[1:])
+	copy(s.from[:], digest[12:])
+	return s, nil
+}
+
+// legacyTx is a pre-EIP-1559 transaction, signed with EIP-155 replay
+// protection. Every node and dev chain accepts it.
+type legacyTx struct {
+	Nonce    uint64
+	GasPrice *big.Int
+	Gas      uint64
+	To       Address
+	Value    *big.Int
+	Data     []byte
+}
+
+// sign returns the raw signed transaction and its hash.
+func (s *signer) sign(tx legacyTx, chainID *big.Int) ([]byte, [32]byte, error) {
+	fields := []interface{}{tx.Nonce, tx.GasPrice, tx.Gas, tx.To[:], tx.Value, tx.Data}
+
+	sigHash := Keccak256(rlpList(append(fields, chainID, uint64(0), uint64(0))...))
+	// SignCompact yields [27+recovery id || R || S] with a low S value
+	sig := ecdsa.SignCompact(s.key, sigHash[:], false)
+	recID := int64(sig[0] - 27)
+
+	v := new(big.Int).Mul(chainID, big.NewInt(2))
+	v.Add(v, big.NewInt(35+recID))
+	r := new(big.Int).SetBytes(sig[1:33])
+	sv := new(big.Int).SetBytes(sig[33:65])
+
+	raw := rlpList(append(fields, v, r, sv)...)
+	return raw, Keccak256(raw), nil
+}
+
+// rlpList encodes items as an RLP list. Items are uint64, *big.Int or
+// []byte.
+func rlpList(items ...interface{}) []byte {
+	var payload []byte
+	for _, item := range items {
+		switch v := item.(type) {
+		case uint64:
+			payload = append(payload, rlpBytes(new(big.Int).SetUint64(v).Bytes())...)
+		case *big.Int:
+			payload = append(payload, rlpBytes(v.Bytes())...)
+		case []byte:
+			payload = append(payload, rlpBytes(v)...)
+		default:
+			panic(fmt.Sprintf("rlp: unsupported type %T", item))
+		}
+	}
+	return append(rlpHeader(0xc0, len(payload)), payload...)
+}
+
+func rlpBytes(b []byte) []byte {
+	if len(b) == 1 && b[0] < 0x80 {
+		return b
+	}
+	return append(rlpHeader(0x80, len(b)), b...)
+}
+
+func rlpHeader(offset byte, n int) []byte {
+	if n < 56 {
+		return []byte{offset + byte(n)}
+	}
+	size := new(big.Int).SetInt64(int64(n)).Bytes()
+	return append([]byte{offset + 55 + byte(len(size))}, size...)
+}
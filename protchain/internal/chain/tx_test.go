@@ -0,0 +1,137 @@
+package chain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// unhex decodes hex split across any number of strings, so long vectors
+// can be written one field or ABI word per line.
+func unhex(t *testing.T, parts ...string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.TrimPrefix(strings.Join(parts, ""), "0x"))
+	if err != nil {
+		t.Fatalf("bad hex in test vector: %v", err)
+	}
+	return b
+}
+
+func TestKeccak256(t *testing.T) {
+	got := Keccak256()
+	if want := "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470"; hex.EncodeToString(got[:]) != want {
+		t.Errorf("Keccak256() = %x, want %s", got, want)
+	}
+	// Input is hashed as one concatenated message
+	if Keccak256([]byte("ab"), []byte("c")) != Keccak256([]byte("abc")) {
+		t.Error("Keccak256 of split input differs from the joined input")
+	}
+}
+
+func TestSelector(t *testing.T) {
+	// Selectors published in the ERC-20 standard and the Solidity ABI
+	// specification examples
+	tests := map[string]string{
+		"transfer(address,uint256)": "a9059cbb",
+		"baz(uint32,bool)":          "cdcd77c0",
+		"bar(bytes3[2])":            "fce353f6",
+		"sam(bytes,bool,uint256[])": "a5643bf2",
+	}
+	for sig, want := range tests {
+		if got := selector(sig); hex.EncodeToString(got[:]) != want {
+			t.Errorf("selector(%q) = %x, want %s", sig, got, want)
+		}
+	}
+}
+
+func TestRLPList(t *testing.T) {
+	lorem := []byte("Lorem ipsum dolor sit amet, consectetur adipisicing elit")
+	// Vectors from the RLP specification, wrapped in a list because
+	// rlpList only produces lists
+	tests := []struct {
+		name  string
+		items []interface{}
+		want  string
+	}{
+		{"empty list", nil, "c0"},
+		{"cat dog", []interface{}{[]byte("cat"), []byte("dog")}, "c88363617483646f67"},
+		{"empty string", []interface{}{[]byte{}}, "c180"},
+		{"zero", []interface{}{uint64(0)}, "c180"},
+		{"single low byte", []interface{}{[]byte{0x0f}}, "c10f"},
+		{"single high byte", []interface{}{[]byte{0x80}}, "c28180"},
+		{"1024", []interface{}{uint64(1024)}, "c3820400"},
+		{"big int", []interface{}{big.NewInt(1024)}, "c3820400"},
+		{"zero big int", []interface{}{new(big.Int)}, "c180"},
+		{"56 byte string", []interface{}{lorem}, "f83ab838" + hex.EncodeToString(lorem)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hex.EncodeToString(rlpList(tt.items...)); got != tt.want {
+				t.Errorf("rlpList = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// The example transaction from EIP-155.
+const eip155Key = "0x4646464646464646464646464646464646464646464646464646464646464646"
+
+func TestNewSigner(t *testing.T) {
+	s, err := newSigner(eip155Key)
+	if err != nil {
+		t.Fatalf("newSigner: %v", err)
+	}
+	if got, want := s.from.Hex(), "0x9d8a62f656a8d1615c1294fd71e9cfb3e4855a4f"; got != want {
+		t.Errorf("address = %s, want %s", got, want)
+	}
+
+	for _, bad := range []string{"", "0x46", "zz" + eip155Key[4:], eip155Key + "46"} {
+		if _, err := newSigner(bad); err == nil {
+			t.Errorf("newSigner(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestSignEIP155(t *testing.T) {
+	s, err := newSigner(eip155Key)
+	if err != nil {
+		t.Fatalf("newSigner: %v", err)
+	}
+	to, _ := ParseAddress("0x3535353535353535353535353535353535353535")
+	tx := legacyTx{
+		Nonce:    9,
+		GasPrice: big.NewInt(20e9),
+		Gas:      21000,
+		To:       to,
+		Value:    big.NewInt(1e18),
+	}
+
+	// The signing payload appends chain ID, 0, 0 to the six fields
+	sigPayload := rlpList(tx.Nonce, tx.GasPrice, tx.Gas, tx.To[:], tx.Value, tx.Data, big.NewInt(1), uint64(0), uint64(0))
+	if want := unhex(t, "ec098504a817c800825208943535353535353535353535353535353535353535880de0b6b3a764000080018080"); !bytes.Equal(sigPayload, want) {
+		t.Errorf("signing payload = %x, want %x", sigPayload, want)
+	}
+	if got := Keccak256(sigPayload); hex.EncodeToString(got[:]) != "daf5a779ae972f972197303d7b574746c7ef83eadac0f2791ad23db92e4c8e53" {
+		t.Errorf("signing hash = %x", got)
+	}
+
+	raw, hash, err := s.sign(tx, big.NewInt(1))
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	want := unhex(t,
+		"f86c",
+		"09", "8504a817c800", "825208", "943535353535353535353535353535353535353535", "880de0b6b3a7640000", "80",
+		"25", // v = 1*2 + 35 + recovery id 0
+		"a028ef61340bd939bc2195fe537567866003e1a15d3c71ff63e1590620aa636276",
+		"a067cbe9d8997f761aecb703304b3800ccf555c9f3dc64214b297fb1966a3b6d83",
+	)
+	if !bytes.Equal(raw, want) {
+		t.Errorf("signed tx =\n%x\nwant\n%x", raw, want)
+	}
+	if got := hex.EncodeToString(hash[:]); got != "33469b22e9f636356c4160a87eb19df52b7412e8eac32a4a55ffe88ea8350788" {
+		t.Errorf("tx hash = %s", got)
+	}
+}
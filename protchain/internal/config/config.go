@@ -3,7 +3,7 @@ package config
 import (
 	"crypto/rand"
 	"encoding/hex"
-	"log"
+	"log/slog"
 	"os"
 	"strconv"
 	"strings"
@@ -19,6 +19,17 @@ type Config struct {
 	IPFSEndpoint string
 	BlockchainRPC string
 
+	// DrugScreeningVerifier contract. Verification needs the address;
+	// server-side commits also need the signing key.
+	VerifierContractAddress     string
+	BlockchainSignerKey         string
+	BlockchainConfirmations     int
+	BlockchainConfirmTimeoutSec int
+
+	// Token lifetimes
+	AccessTokenTTLMin   int
+	RefreshTokenTTLDays int
+
 	// DB connection pool
 	DBMaxOpenConns       int
 	DBMaxIdleConns       int
@@ -29,15 +40,77 @@ type Config struct {
 	HTTPWriteTimeout int
 	HTTPIdleTimeout  int
 
-	// Rate limiting
-	RateLimitRPS   float64
-	RateLimitBurst int
+	// Rate limiting. RateLimitRPS and RateLimitBurst are the per-IP
+	// budget of every request; RateLimitPolicies overrides the per-route
+	// policies (see ratelimit.ParsePolicies). The backend is "memory",
+	// "postgres" or "redis".
+	RateLimitRPS      float64
+	RateLimitBurst    int
+	RateLimitPolicies string
+	RateLimitBackend  string
+	RateLimitRedisURL string
+	RateLimitMaxKeys  int
+
+	// Prometheus metrics. MetricsAddr serves /metrics on a separate
+	// listener; otherwise MetricsEnabled mounts it on the API router.
+	MetricsEnabled bool
+	MetricsAddr    string
+
+	// OpenTelemetry tracing, exported over OTLP/HTTP. An empty
+	// TracingEndpoint disables it.
+	TracingEndpoint    string
+	TracingSampleRatio float64
+	TracingServiceName string
+
+	// BioAPI worker pool. BioapiWorkers lists static workers; without it
+	// BioapiURL is the only static worker.
+	BioapiWorkers            string
+	BioapiWorkerToken        string
+	BioapiWorkerTTLSec       int
+	BioapiHealthCheckSec     int
+	BioapiMaxRetries         int
+	BioapiBreakerThreshold   int
+	BioapiBreakerCooldownSec int
+	BioapiCacheTTLSec        int
+	BioapiCacheMaxEntryKB    int
+	BioapiCacheMaxMB         int
+
+	// Async job workers
+	JobWorkers    int
+	JobTimeoutSec int
+	// JobMaxAttempts is how many workers may stop responding on a job
+	// before it is failed rather than requeued
+	JobMaxAttempts int
+
+	// Sharding of large virtual screening jobs
+	ScreeningShardSize     int
+	ScreeningShardParallel int
+	ScreeningShardRetries  int
+
+	// Artifact storage ("local" or "s3")
+	ArtifactBackend     string
+	ArtifactDir         string
+	ArtifactMaxUploadMB int
+	S3Endpoint          string
+	S3Region            string
+	S3Bucket            string
+	S3AccessKey         string
+	S3SecretKey         string
+
+	// IPFS publication of workflow bundles
+	IPFSTimeoutSec  int
+	IPFSMaxBundleMB int
+
+	// Organization and team invitations: how long one stays valid, and how
+	// often lapsed ones are marked expired
+	InvitationTTLHours         int
+	InvitationSweepIntervalMin int
 }
 
 func Load() *Config {
 	jwtSecret := os.Getenv("JWT_SECRET")
 	if jwtSecret == "" {
-		log.Println("WARNING: JWT_SECRET not set. Generating a random secret for this session. Set JWT_SECRET in production.")
+		slog.Warn("JWT_SECRET not set. Generating a random secret for this session. Set JWT_SECRET in production.")
 		bytes := make([]byte, 32)
 		rand.Read(bytes)
 		jwtSecret = hex.EncodeToString(bytes)
@@ -58,6 +131,9 @@ func Load() *Config {
 		IPFSEndpoint:  getEnv("IPFS_ENDPOINT", "http://localhost:5001"),
 		BlockchainRPC: getEnv("BLOCKCHAIN_RPC", "https://purechainnode.com"),
 
+		AccessTokenTTLMin:   getEnvInt("ACCESS_TOKEN_TTL_MIN", 15),
+		RefreshTokenTTLDays: getEnvInt("REFRESH_TOKEN_TTL_DAYS", 30),
+
 		DBMaxOpenConns:       getEnvInt("DB_MAX_OPEN_CONNS", 25),
 		DBMaxIdleConns:       getEnvInt("DB_MAX_IDLE_CONNS", 5),
 		DBConnMaxLifetimeSec: getEnvInt("DB_CONN_MAX_LIFETIME_SEC", 300),
@@ -68,6 +144,57 @@ func Load() *Config {
 
 		RateLimitRPS:   float64(getEnvInt("RATE_LIMIT_RPS", 100)),
 		RateLimitBurst: getEnvInt("RATE_LIMIT_BURST", 200),
+
+		RateLimitPolicies: os.Getenv("RATE_LIMIT_POLICIES"),
+		RateLimitBackend:  getEnv("RATE_LIMIT_BACKEND", "memory"),
+		RateLimitRedisURL: os.Getenv("RATE_LIMIT_REDIS_URL"),
+		RateLimitMaxKeys:  getEnvInt("RATE_LIMIT_MAX_KEYS", 100000),
+
+		MetricsEnabled: getEnvBool("METRICS_ENABLED", false),
+		MetricsAddr:    os.Getenv("METRICS_ADDR"),
+
+		TracingEndpoint:    os.Getenv("TRACING_OTLP_ENDPOINT"),
+		TracingSampleRatio: getEnvFloat("TRACING_SAMPLE_RATIO", 1),
+		TracingServiceName: getEnv("TRACING_SERVICE_NAME", "protchain-api"),
+
+		BioapiWorkers:            os.Getenv("BIOAPI_WORKERS"),
+		BioapiWorkerToken:        os.Getenv("BIOAPI_WORKER_TOKEN"),
+		BioapiWorkerTTLSec:       getEnvInt("BIOAPI_WORKER_TTL_SEC", 90),
+		BioapiHealthCheckSec:     getEnvInt("BIOAPI_HEALTH_CHECK_SEC", 10),
+		BioapiMaxRetries:         getEnvInt("BIOAPI_MAX_RETRIES", 2),
+		BioapiBreakerThreshold:   getEnvInt("BIOAPI_BREAKER_THRESHOLD", 5),
+		BioapiBreakerCooldownSec: getEnvInt("BIOAPI_BREAKER_COOLDOWN_SEC", 30),
+		BioapiCacheTTLSec:        getEnvInt("BIOAPI_CACHE_TTL_SEC", 86400),
+		BioapiCacheMaxEntryKB:    getEnvInt("BIOAPI_CACHE_MAX_ENTRY_KB", 4096),
+		BioapiCacheMaxMB:         getEnvInt("BIOAPI_CACHE_MAX_MB", 1024),
+
+		JobWorkers:     getEnvPositiveInt("JOB_WORKERS", 4),
+		JobTimeoutSec:  getEnvPositiveInt("JOB_TIMEOUT_SEC", 1800),
+		JobMaxAttempts: getEnvPositiveInt("JOB_MAX_ATTEMPTS", 3),
+
+		ScreeningShardSize:     getEnvInt("SCREENING_SHARD_SIZE", 2000),
+		ScreeningShardParallel: getEnvInt("SCREENING_SHARD_PARALLEL", 8),
+		ScreeningShardRetries:  getEnvInt("SCREENING_SHARD_RETRIES", 2),
+
+		ArtifactBackend:     getEnv("ARTIFACT_BACKEND", "local"),
+		ArtifactDir:         getEnv("ARTIFACT_DIR", "./data/artifacts"),
+		ArtifactMaxUploadMB: getEnvInt("ARTIFACT_MAX_UPLOAD_MB", 200),
+		S3Endpoint:          getEnv("S3_ENDPOINT", "http://localhost:9000"),
+		S3Region:            getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:            getEnv("S3_BUCKET", "protchain-artifacts"),
+		S3AccessKey:         os.Getenv("S3_ACCESS_KEY"),
+		S3SecretKey:         os.Getenv("S3_SECRET_KEY"),
+
+		IPFSTimeoutSec:  getEnvInt("IPFS_TIMEOUT_SEC", 60),
+		IPFSMaxBundleMB: getEnvInt("IPFS_MAX_BUNDLE_MB", 64),
+
+		InvitationTTLHours:         getEnvInt("INVITATION_TTL_HOURS", 168),
+		InvitationSweepIntervalMin: getEnvPositiveInt("INVITATION_SWEEP_INTERVAL_MIN", 15),
+
+		VerifierContractAddress:     os.Getenv("VERIFIER_CONTRACT_ADDRESS"),
+		BlockchainSignerKey:         os.Getenv("BLOCKCHAIN_SIGNER_KEY"),
+		BlockchainConfirmations:     getEnvInt("BLOCKCHAIN_CONFIRMATIONS", 1),
+		BlockchainConfirmTimeoutSec: getEnvInt("BLOCKCHAIN_CONFIRM_TIMEOUT_SEC", 180),
 	}
 
 	// Append extra CORS origins from environment
@@ -99,6 +226,26 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// getEnvPositiveInt is getEnvInt for counts and durations that must be
+// positive; zero or a negative value falls back to the default.
+func getEnvPositiveInt(key string, defaultValue int) int {
+	value := getEnvInt(key, defaultValue)
+	if value <= 0 {
+		slog.Warn("Setting must be positive, using the default", "key", key, "default", defaultValue)
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
 func getEnvBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		if boolValue, err := strconv.ParseBool(value); err == nil {
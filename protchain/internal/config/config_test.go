@@ -0,0 +1,35 @@
+package config
+
+import "testing"
+
+func TestPositiveSettings(t *testing.T) {
+	settings := []struct {
+		key   string
+		field func(*Config) int
+		def   int
+	}{
+		{"JOB_WORKERS", func(c *Config) int { return c.JobWorkers }, 4},
+		{"JOB_TIMEOUT_SEC", func(c *Config) int { return c.JobTimeoutSec }, 1800},
+		{"JOB_MAX_ATTEMPTS", func(c *Config) int { return c.JobMaxAttempts }, 3},
+		{"INVITATION_SWEEP_INTERVAL_MIN", func(c *Config) int { return c.InvitationSweepIntervalMin }, 15},
+	}
+	for _, s := range settings {
+		tests := []struct {
+			value string
+			want  int
+		}{
+			{"", s.def},
+			{"7", 7},
+			{"1", 1},
+			{"0", s.def},
+			{"-2", s.def},
+			{"many", s.def},
+		}
+		for _, tt := range tests {
+			t.Setenv(s.key, tt.value)
+			if got := s.field(Load()); got != tt.want {
+				t.Errorf("%s=%q: got %d, want %d", s.key, tt.value, got, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Package databasetest gives tests a migrated Postgres schema of their own,
+// for SQL that a fake driver cannot evaluate. Tests using it are skipped
+// unless PROTCHAIN_TEST_DATABASE_URL names a database they may create
+// schemas in.
+package databasetest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"protchain/internal/database"
+)
+
+// EnvURL is the environment variable holding the test database URL.
+const EnvURL = "PROTCHAIN_TEST_DATABASE_URL"
+
+// Open returns a database whose search_path is a new schema with every
+// migration applied. The schema is dropped when the test ends.
+func Open(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv(EnvURL)
+	if dsn == "" {
+		t.Skipf("%s is not set", EnvURL)
+	}
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("databasetest: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatalf("databasetest: failed to create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`); err != nil {
+			t.Errorf("databasetest: failed to drop schema %s: %v", schema, err)
+		}
+	})
+
+	db, err := sql.Open("postgres", withSearchPath(t, dsn, schema))
+	if err != nil {
+		t.Fatalf("databasetest: %v", err)
+	}
+	// Close before the schema is dropped, as cleanups run last first
+	t.Cleanup(func() { db.Close() })
+
+	m, err := database.NewMigrator(db)
+	if err != nil {
+		t.Fatalf("databasetest: %v", err)
+	}
+	if _, err := m.Up(context.Background(), 0); err != nil {
+		t.Fatalf("databasetest: failed to migrate: %v", err)
+	}
+	return db
+}
+
+// withSearchPath adds a search_path run-time parameter to a URL or
+// key=value connection string.
+func withSearchPath(t *testing.T, dsn, schema string) string {
+	if !strings.HasPrefix(dsn, "postgres://") && !strings.HasPrefix(dsn, "postgresql://") {
+		return dsn + " search_path=" + schema
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatalf("databasetest: invalid %s: %v", EnvURL, err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
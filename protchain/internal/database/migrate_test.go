@@ -0,0 +1,143 @@
+package database_test
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"protchain/internal/database"
+	"protchain/internal/database/databasetest"
+	"protchain/migrations"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	ms, err := database.LoadMigrations(migrations.FS)
+	if err != nil {
+		t.Fatalf("LoadMigrations: %v", err)
+	}
+	if len(ms) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	for i, m := range ms {
+		if m.Version != int64(i+1) {
+			t.Errorf("migration %d has version %d", i+1, m.Version)
+		}
+		if strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+			t.Errorf("migration %d_%s has an empty script", m.Version, m.Name)
+		}
+	}
+
+	// Every embedded file is one half of a loaded pair; a misnamed file
+	// would otherwise be skipped without notice
+	names, err := fs.Glob(migrations.FS, "*.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2*len(ms) {
+		t.Errorf("%d SQL files embedded for %d migrations", len(names), len(ms))
+	}
+	for _, m := range ms {
+		for _, dir := range []string{"up", "down"} {
+			name := fmt.Sprintf("%06d_%s.%s.sql", m.Version, m.Name, dir)
+			if _, err := fs.Stat(migrations.FS, name); err != nil {
+				t.Errorf("%s: %v", name, err)
+			}
+		}
+	}
+}
+
+func TestLoadMigrationsOrder(t *testing.T) {
+	fsys := fstest.MapFS{"README.md": {Data: []byte("not a migration")}}
+	for v := 10; v >= 1; v-- {
+		fsys[fmt.Sprintf("%d_step_%d.up.sql", v, v)] = &fstest.MapFile{Data: []byte(fmt.Sprintf("-- up %d", v))}
+		fsys[fmt.Sprintf("%d_step_%d.down.sql", v, v)] = &fstest.MapFile{Data: []byte(fmt.Sprintf("-- down %d", v))}
+	}
+
+	ms, err := database.LoadMigrations(fsys)
+	if err != nil {
+		t.Fatalf("LoadMigrations: %v", err)
+	}
+	if len(ms) != 10 {
+		t.Fatalf("loaded %d migrations, want 10", len(ms))
+	}
+	for i, m := range ms {
+		v := i + 1
+		if m.Version != int64(v) || m.Name != fmt.Sprintf("step_%d", v) || m.Up != fmt.Sprintf("-- up %d", v) || m.Down != fmt.Sprintf("-- down %d", v) {
+			t.Errorf("migration %d = %+v", v, m)
+		}
+	}
+}
+
+func TestLoadMigrationsRejects(t *testing.T) {
+	file := &fstest.MapFile{Data: []byte("SELECT 1;")}
+	tests := []struct {
+		name  string
+		files []string
+		want  string
+	}{
+		{"missing down", []string{"000001_init.up.sql", "000002_more.up.sql", "000002_more.down.sql"}, "migration 1_init needs both up and down files"},
+		{"missing up", []string{"000001_init.up.sql", "000001_init.down.sql", "000002_more.down.sql"}, "migration 2_more needs both up and down files"},
+		{"two names", []string{"000001_init.up.sql", "000001_other.down.sql"}, "migration 1 has two names"},
+		{"duplicate version", []string{"000001_init.up.sql", "1_init.up.sql", "000001_init.down.sql"}, "migration 1 has two up files"},
+		{"gap", []string{"000001_init.up.sql", "000001_init.down.sql", "000003_more.up.sql", "000003_more.down.sql"}, "migration 2 is missing"},
+		{"not starting at 1", []string{"000002_init.up.sql", "000002_init.down.sql"}, "migration 1 is missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := fstest.MapFS{}
+			for _, name := range tt.files {
+				fsys[name] = file
+			}
+			ms, err := database.LoadMigrations(fsys)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadMigrations = %d migrations, %v; want error %q", len(ms), err, tt.want)
+			}
+		})
+	}
+}
+
+// TestMigrateDownAndUp reverts every migration and applies them again, so
+// each down script is run against the schema its up script built.
+func TestMigrateDownAndUp(t *testing.T) {
+	db := databasetest.Open(t)
+	ctx := context.Background()
+	m, err := database.NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, err := database.LoadMigrations(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reverted, err := m.Down(ctx, len(all))
+	if err != nil {
+		t.Fatalf("Down: %v", err)
+	}
+	if len(reverted) != len(all) || reverted[0].Version != int64(len(all)) {
+		t.Fatalf("Down reverted %d migrations, want all %d newest first", len(reverted), len(all))
+	}
+	status, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range status {
+		if s.AppliedAt != nil || s.Missing {
+			t.Errorf("after Down, migration %d: %+v", s.Version, s)
+		}
+	}
+
+	applied, err := m.Up(ctx, 0)
+	if err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if len(applied) != len(all) {
+		t.Errorf("Up applied %d migrations, want %d", len(applied), len(all))
+	}
+	if again, err := m.Up(ctx, 0); err != nil || len(again) != 0 {
+		t.Errorf("second Up = %d migrations, %v; want none", len(again), err)
+	}
+}
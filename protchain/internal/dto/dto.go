@@ -1,6 +1,9 @@
 package dto
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // Auth DTOs
 type RegisterRequest struct {
@@ -16,11 +19,23 @@ type LoginRequest struct {
 }
 
 type AuthResponse struct {
-	Token        string `json:"token"`
-	RefreshToken string `json:"refresh_token"`
+	Token        string       `json:"token"`
+	RefreshToken string       `json:"refresh_token"`
+	ExpiresIn    int          `json:"expires_in"`
 	User         UserResponse `json:"user"`
 }
 
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+	// AllSessions revokes every refresh token the user holds, not just
+	// this session's
+	AllSessions bool `json:"all_sessions"`
+}
+
 type UserResponse struct {
 	ID        int    `json:"id"`
 	Email     string `json:"email"`
@@ -32,6 +47,10 @@ type UserResponse struct {
 type CreateWorkflowRequest struct {
 	Name        string `json:"name" binding:"required"`
 	Description string `json:"description"`
+	TemplateID  *int   `json:"template_id"`
+	// StageParameters overrides template defaults per stage; keys are
+	// merged shallowly into the template's parameters.
+	StageParameters map[string]json.RawMessage `json:"stage_parameters"`
 }
 
 type UpdateWorkflowRequest struct {
@@ -43,20 +62,68 @@ type UpdateWorkflowRequest struct {
 
 type UpdateWorkflowBlockchainRequest struct {
 	BlockchainTxHash string `json:"blockchain_tx_hash" binding:"required"`
-	IPFSHash         string `json:"ipfs_hash" binding:"required"`
+	// IPFSHash is optional; if sent it must match the CID the server
+	// published for the workflow
+	IPFSHash string `json:"ipfs_hash"`
 }
 
 type WorkflowResponse struct {
-	ID                    int        `json:"id"`
-	Name                  string     `json:"name"`
-	Description           string     `json:"description"`
-	Status                string     `json:"status"`
-	Results               string     `json:"results"`
-	BlockchainTxHash      *string    `json:"blockchain_tx_hash"`
-	IPFSHash              *string    `json:"ipfs_hash"`
-	BlockchainCommittedAt *time.Time `json:"blockchain_committed_at"`
-	CreatedAt             time.Time  `json:"created_at"`
-	UpdatedAt             time.Time  `json:"updated_at"`
+	ID                    int             `json:"id"`
+	Name                  string          `json:"name"`
+	Description           string          `json:"description"`
+	Status                string          `json:"status"`
+	Results               string          `json:"results"`
+	BlockchainTxHash      *string         `json:"blockchain_tx_hash"`
+	IPFSHash              *string         `json:"ipfs_hash"`
+	BlockchainCommittedAt *time.Time      `json:"blockchain_committed_at"`
+	TemplateID            *int            `json:"template_id,omitempty"`
+	StagePlan             json.RawMessage `json:"stage_plan,omitempty"`
+	Permission            string          `json:"permission,omitempty"`
+	OwnerID               int             `json:"owner_id,omitempty"`
+	CreatedAt             time.Time       `json:"created_at"`
+	UpdatedAt             time.Time       `json:"updated_at"`
+}
+
+// Workflow template DTOs
+type TemplateStage struct {
+	Stage      string          `json:"stage" binding:"required"`
+	Parameters json.RawMessage `json:"parameters"`
+}
+
+type CreateWorkflowTemplateRequest struct {
+	OrganizationID int             `json:"organization_id" binding:"required"`
+	Name           string          `json:"name" binding:"required"`
+	Description    string          `json:"description"`
+	Stages         []TemplateStage `json:"stages" binding:"required,min=1,dive"`
+}
+
+type WorkflowTemplateResponse struct {
+	ID             int             `json:"id"`
+	OrganizationID *int            `json:"organization_id"`
+	Name           string          `json:"name"`
+	Version        int             `json:"version"`
+	Description    string          `json:"description"`
+	Stages         []TemplateStage `json:"stages"`
+	IsBuiltin      bool            `json:"is_builtin"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+// UpdateWorkflowTemplateRequest publishes a new version of a template.
+// Omitted fields carry over from the version being updated.
+type UpdateWorkflowTemplateRequest struct {
+	Description *string         `json:"description"`
+	Stages      []TemplateStage `json:"stages" binding:"omitempty,dive"`
+}
+
+// Binding site DTOs
+type StartBindingSiteAnalysisRequest struct {
+	// PDBID defaults to the structure processed in the structure
+	// preparation stage.
+	PDBID string `json:"pdb_id"`
+	// StructureData optionally supplies PDB file content instead of
+	// having BioAPI download the entry from RCSB.
+	StructureData string `json:"structure_data"`
 }
 
 // Organization DTOs
@@ -88,7 +155,28 @@ type OrganizationResponse struct {
 
 type InviteToOrganizationRequest struct {
 	Email string `json:"email" binding:"required,email"`
-	Role  string `json:"role" binding:"required"`
+	Role  string `json:"role" binding:"required,oneof=admin member"`
+}
+
+// UsageMetric is consumption of one resource against its plan limit.
+// Limit and Remaining are null when the plan does not limit it.
+type UsageMetric struct {
+	Used      float64  `json:"used"`
+	Limit     *float64 `json:"limit"`
+	Remaining *float64 `json:"remaining"`
+}
+
+// OrganizationUsageResponse reports an organization's usage in the
+// current billing month. Concurrent jobs and storage are current totals.
+type OrganizationUsageResponse struct {
+	OrganizationID int         `json:"organization_id"`
+	Plan           string      `json:"plan"`
+	PeriodStart    time.Time   `json:"period_start"`
+	PeriodEnd      time.Time   `json:"period_end"`
+	ConcurrentJobs UsageMetric `json:"concurrent_jobs"`
+	Compounds      UsageMetric `json:"compounds"`
+	MDNanoseconds  UsageMetric `json:"md_nanoseconds"`
+	StorageBytes   UsageMetric `json:"storage_bytes"`
 }
 
 // Team DTOs
@@ -118,15 +206,26 @@ type AddTeamMemberRequest struct {
 }
 
 // Invitation DTOs
+
+// InviteToTeamRequest invites to a team. Invitations cannot grant owner,
+// which only a team's creator holds.
+type InviteToTeamRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"required,oneof=admin member"`
+}
+
 type InvitationResponse struct {
 	ID             int        `json:"id"`
 	OrganizationID *int       `json:"organization_id"`
 	TeamID         *int       `json:"team_id"`
+	TeamName       *string    `json:"team_name,omitempty"`
 	Email          string     `json:"email"`
 	Role           string     `json:"role"`
 	Status         string     `json:"status"`
 	ExpiresAt      time.Time  `json:"expires_at"`
 	CreatedAt      time.Time  `json:"created_at"`
+	SentAt         time.Time  `json:"sent_at"`
+	SendCount      int        `json:"send_count"`
 	InvitedBy      UserResponse `json:"invited_by"`
 	Organization   *OrganizationResponse `json:"organization,omitempty"`
 	Team           *TeamResponse `json:"team,omitempty"`
@@ -137,7 +236,7 @@ type ShareWorkflowRequest struct {
 	OrganizationID  *int   `json:"organization_id"`
 	TeamID          *int   `json:"team_id"`
 	UserID          *int   `json:"user_id"`
-	PermissionLevel string `json:"permission_level" binding:"required"`
+	PermissionLevel string `json:"permission_level" binding:"required,oneof=view edit admin"`
 }
 
 type WorkflowPermissionResponse struct {
@@ -151,6 +250,188 @@ type WorkflowPermissionResponse struct {
 	CreatedAt       time.Time `json:"created_at"`
 }
 
+// Job DTOs
+type JobResponse struct {
+	ID         int             `json:"id"`
+	WorkflowID *int            `json:"workflow_id"`
+	Type       string          `json:"type"`
+	Status     string          `json:"status"`
+	Progress   int             `json:"progress"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Error      *string         `json:"error,omitempty"`
+	CacheHit   bool            `json:"cache_hit"`
+	CreatedAt  time.Time       `json:"created_at"`
+	StartedAt  *time.Time      `json:"started_at"`
+	FinishedAt *time.Time      `json:"finished_at"`
+}
+
+// Stage result DTOs
+type StageResultResponse struct {
+	ID            int             `json:"id"`
+	Stage         string          `json:"stage"`
+	RunNumber     int             `json:"run_number"`
+	Status        string          `json:"status"`
+	Parameters    json.RawMessage `json:"parameters,omitempty"`
+	Result        json.RawMessage `json:"result,omitempty"`
+	Error         *string         `json:"error,omitempty"`
+	BioAPIVersion *string         `json:"bioapi_version,omitempty"`
+	JobID         *int            `json:"job_id,omitempty"`
+	StartedAt     time.Time       `json:"started_at"`
+	FinishedAt    *time.Time      `json:"finished_at"`
+}
+
+// Artifact DTOs
+type ArtifactResponse struct {
+	ID          int       `json:"id"`
+	WorkflowID  int       `json:"workflow_id"`
+	Kind        string    `json:"kind"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	SHA256      string    `json:"sha256"`
+	SizeBytes   int64     `json:"size_bytes"`
+	UploadedBy  *int      `json:"uploaded_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// API key DTOs
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name" binding:"required,max=255"`
+	Scopes []string `json:"scopes" binding:"required,min=1"`
+	// OrganizationID makes this a service key owned by the organization
+	OrganizationID *int       `json:"organization_id"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+}
+
+type APIKeyResponse struct {
+	ID             int        `json:"id"`
+	Name           string     `json:"name"`
+	Prefix         string     `json:"prefix"`
+	Scopes         []string   `json:"scopes"`
+	OrganizationID *int       `json:"organization_id"`
+	CreatedBy      int        `json:"created_by"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	LastUsedAt     *time.Time `json:"last_used_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	// Key is the full secret, returned only when the key is created
+	Key string `json:"key,omitempty"`
+}
+
+// BioAPI worker DTOs
+type RegisterWorkerRequest struct {
+	URL          string   `json:"url" binding:"required,url"`
+	Capabilities []string `json:"capabilities"`
+}
+
+type WorkerRegistrationResponse struct {
+	ID           int      `json:"id"`
+	URL          string   `json:"url"`
+	Capabilities []string `json:"capabilities"`
+	// TTLSeconds is how long the registration lasts without a heartbeat
+	TTLSeconds int `json:"ttl_seconds"`
+}
+
+// IPFS DTOs
+type IPFSPublishResponse struct {
+	CID       string    `json:"cid"`
+	SHA256    string    `json:"sha256"`
+	SizeBytes int       `json:"size_bytes"`
+	PinnedAt  time.Time `json:"pinned_at"`
+}
+
+type IPFSBundleResponse struct {
+	CID      string     `json:"cid"`
+	SHA256   *string    `json:"sha256"`
+	PinnedAt *time.Time `json:"pinned_at"`
+	// SizeBytes is the cumulative size reported by the IPFS node
+	SizeBytes int64 `json:"size_bytes"`
+	// Intact is true when the fetched bundle hashes to the recorded digest
+	Intact bool `json:"intact"`
+	// MatchesCurrent is true when rebuilding the bundle from the database
+	// today produces the same digest
+	MatchesCurrent bool            `json:"matches_current"`
+	Bundle         json.RawMessage `json:"bundle,omitempty"`
+}
+
+// Blockchain commit DTOs
+type CommitWorkflowRequest struct {
+	// MoleculeID is the human-readable label stored on chain; it defaults
+	// to the workflow name
+	MoleculeID string `json:"molecule_id" binding:"omitempty,max=256"`
+}
+
+// MerkleProofStep is a sibling hash on the path to the root. Position is
+// "left" or "right": the side the sibling is on when hashing the pair.
+type MerkleProofStep struct {
+	Hash     string `json:"hash"`
+	Position string `json:"position"`
+}
+
+// HitProofResponse proves a screening hit is included in an anchored
+// batch. LeafData holds the exact bytes that were hashed into the leaf.
+type HitProofResponse struct {
+	CompoundID string            `json:"compound_id"`
+	LeafIndex  int               `json:"leaf_index"`
+	LeafData   string            `json:"leaf_data"`
+	LeafHash   string            `json:"leaf_hash"`
+	Proof      []MerkleProofStep `json:"proof"`
+	Root       string            `json:"root"`
+	Algorithm  string            `json:"algorithm"`
+	BatchID    int               `json:"batch_id"`
+	// Anchor fields are set once the root is confirmed on chain
+	Anchored        bool    `json:"anchored"`
+	ChainID         *int64  `json:"chain_id"`
+	ContractAddress *string `json:"contract_address"`
+	TxHash          *string `json:"tx_hash"`
+	BlockNumber     *int64  `json:"block_number"`
+	NumericID       *string `json:"numeric_id"`
+}
+
+// VerificationCheck compares one recomputed value with what is on chain.
+type VerificationCheck struct {
+	Name     string `json:"name"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+	Match    bool   `json:"match"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// VerificationReport is the outcome of checking a workflow against its
+// on-chain record. Match is true only if every check matches.
+type VerificationReport struct {
+	WorkflowID      int                 `json:"workflow_id"`
+	Match           bool                `json:"match"`
+	TxHash          string              `json:"tx_hash"`
+	ContractAddress string              `json:"contract_address"`
+	BlockNumber     uint64              `json:"block_number"`
+	BlockTimestamp  *time.Time          `json:"block_timestamp"`
+	NumericID       string              `json:"numeric_id,omitempty"`
+	ResultID        string              `json:"result_id,omitempty"`
+	Researcher      string              `json:"researcher,omitempty"`
+	MoleculeID      string              `json:"molecule_id,omitempty"`
+	Verified        bool                `json:"verified"`
+	IPFSHash        string              `json:"ipfs_hash,omitempty"`
+	Checks          []VerificationCheck `json:"checks"`
+	CheckedAt       time.Time           `json:"checked_at"`
+}
+
+// Activity DTOs
+type ActivityResponse struct {
+	ID             int             `json:"id"`
+	Action         string          `json:"action"`
+	Actor          UserResponse    `json:"actor"`
+	OrganizationID *int            `json:"organization_id"`
+	TeamID         *int            `json:"team_id"`
+	WorkflowID     *int            `json:"workflow_id"`
+	TargetType     *string         `json:"target_type"`
+	TargetID       *int            `json:"target_id"`
+	Before         json.RawMessage `json:"before,omitempty"`
+	After          json.RawMessage `json:"after,omitempty"`
+	Details        *string         `json:"details"`
+	RequestID      *string         `json:"request_id"`
+	APIKeyID       *int            `json:"api_key_id"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
 // Stats DTOs
 type UserStatsResponse struct {
 	TotalWorkflows     int `json:"total_workflows"`
@@ -184,3 +465,19 @@ type ErrorResponse struct {
 	Success bool   `json:"success"`
 	Error   string `json:"error"`
 }
+
+// QuotaErrorResponse rejects work that would exceed a plan quota.
+type QuotaErrorResponse struct {
+	Success bool          `json:"success"`
+	Error   string        `json:"error"`
+	Quota   QuotaExceeded `json:"quota"`
+}
+
+// QuotaExceeded names the exceeded quota and the account's standing.
+type QuotaExceeded struct {
+	Resource  string  `json:"resource"`
+	Plan      string  `json:"plan"`
+	Limit     float64 `json:"limit"`
+	Used      float64 `json:"used"`
+	Requested float64 `json:"requested"`
+}
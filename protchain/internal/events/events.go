@@ -0,0 +1,171 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types pushed to workflow subscribers.
+const (
+	TypeStatus      = "status"
+	TypeJobProgress = "job_progress"
+	TypeLog         = "log"
+	TypeCompleted   = "completed"
+	TypeFailed      = "failed"
+	TypePermissions = "permissions"
+)
+
+const (
+	// historySize is how many recent events are kept per workflow for
+	// Last-Event-ID replay.
+	historySize = 256
+	// subscriberBuffer bounds how far a slow client may fall behind before
+	// it is disconnected. It can reconnect and resume from history.
+	subscriberBuffer = 64
+	// historyRetention is how long an idle workflow's history is kept.
+	historyRetention = time.Hour
+)
+
+// Event is a single message on a workflow's stream.
+type Event struct {
+	ID         uint64      `json:"id"`
+	Type       string      `json:"type"`
+	WorkflowID int         `json:"workflow_id"`
+	Data       interface{} `json:"data"`
+	Time       time.Time   `json:"time"`
+}
+
+// Subscription receives events for one workflow until Close is called.
+// C is closed if the subscriber falls too far behind.
+type Subscription struct {
+	C <-chan Event
+
+	ch         chan Event
+	workflowID int
+	broker     *Broker
+	once       sync.Once
+}
+
+// Close detaches the subscription from the broker.
+func (s *Subscription) Close() {
+	s.broker.unsubscribe(s)
+}
+
+type topic struct {
+	history []Event
+	subs    map[*Subscription]struct{}
+	touched time.Time
+}
+
+// Broker is an in-process pub/sub hub keyed by workflow ID.
+type Broker struct {
+	mu        sync.Mutex
+	nextID    uint64
+	topics    map[int]*topic
+	lastPrune time.Time
+}
+
+func NewBroker() *Broker {
+	return &Broker{
+		// Seed IDs from the clock so they keep increasing across restarts and
+		// a stale Last-Event-ID never hides new events.
+		nextID: uint64(time.Now().UnixMilli()) * 1000,
+		topics: make(map[int]*topic),
+	}
+}
+
+// Publish records an event for a workflow and fans it out to subscribers.
+func (b *Broker) Publish(workflowID int, eventType string, data interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	e := Event{
+		ID:         b.nextID,
+		Type:       eventType,
+		WorkflowID: workflowID,
+		Data:       data,
+		Time:       time.Now(),
+	}
+
+	t := b.topic(workflowID)
+	t.history = append(t.history, e)
+	if len(t.history) > historySize {
+		t.history = t.history[len(t.history)-historySize:]
+	}
+
+	for s := range t.subs {
+		select {
+		case s.ch <- e:
+		default:
+			b.drop(t, s)
+		}
+	}
+
+	b.prune()
+}
+
+// Subscribe registers for a workflow's events. Events newer than
+// lastEventID that are still in history are returned for replay; pass 0 to
+// skip replay.
+func (b *Broker) Subscribe(workflowID int, lastEventID uint64) (*Subscription, []Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan Event, subscriberBuffer)
+	s := &Subscription{C: ch, ch: ch, workflowID: workflowID, broker: b}
+
+	t := b.topic(workflowID)
+	t.subs[s] = struct{}{}
+
+	var replay []Event
+	if lastEventID > 0 {
+		for _, e := range t.history {
+			if e.ID > lastEventID {
+				replay = append(replay, e)
+			}
+		}
+	}
+	return s, replay
+}
+
+func (b *Broker) unsubscribe(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if t, ok := b.topics[s.workflowID]; ok {
+		b.drop(t, s)
+	}
+}
+
+// drop removes a subscriber and closes its channel. Callers hold b.mu.
+func (b *Broker) drop(t *topic, s *Subscription) {
+	delete(t.subs, s)
+	s.once.Do(func() { close(s.ch) })
+}
+
+func (b *Broker) topic(workflowID int) *topic {
+	t, ok := b.topics[workflowID]
+	if !ok {
+		t = &topic{subs: make(map[*Subscription]struct{})}
+		b.topics[workflowID] = t
+	}
+	t.touched = time.Now()
+	return t
+}
+
+// prune forgets history for workflows nobody is watching that have been
+// quiet for historyRetention. Callers hold b.mu.
+func (b *Broker) prune() {
+	if time.Since(b.lastPrune) < time.Minute {
+		return
+	}
+	b.lastPrune = time.Now()
+
+	cutoff := time.Now().Add(-historyRetention)
+	for id, t := range b.topics {
+		if len(t.subs) == 0 && t.touched.Before(cutoff) {
+			delete(b.topics, id)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+// receive returns the next event on s, failing the test if none arrives.
+func receive(t *testing.T, s *Subscription) Event {
+	t.Helper()
+	select {
+	case e, ok := <-s.C:
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+	}
+	return Event{}
+}
+
+func TestSubscribe(t *testing.T) {
+	b := NewBroker()
+	s, replay := b.Subscribe(1, 0)
+	defer s.Close()
+	other, _ := b.Subscribe(2, 0)
+	defer other.Close()
+	if len(replay) != 0 {
+		t.Errorf("replay without Last-Event-ID = %v", replay)
+	}
+
+	b.Publish(1, TypeStatus, "running")
+	b.Publish(1, TypeLog, "docked")
+	first, second := receive(t, s), receive(t, s)
+	if first.Type != TypeStatus || first.Data != "running" || first.WorkflowID != 1 {
+		t.Errorf("first event = %+v", first)
+	}
+	if second.Type != TypeLog || second.ID <= first.ID {
+		t.Errorf("second event = %+v, want a log event after %d", second, first.ID)
+	}
+	select {
+	case e := <-other.C:
+		t.Errorf("subscriber of workflow 2 received %+v", e)
+	default:
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	b := NewBroker()
+	s, _ := b.Subscribe(1, 0)
+	kept, _ := b.Subscribe(1, 0)
+	defer kept.Close()
+
+	s.Close()
+	if _, ok := <-s.C; ok {
+		t.Error("closed subscription still open")
+	}
+	// A second Close is harmless
+	s.Close()
+
+	b.Publish(1, TypeStatus, "running")
+	receive(t, kept)
+	if n := len(b.topics[1].subs); n != 1 {
+		t.Errorf("workflow 1 has %d subscribers, want 1", n)
+	}
+}
+
+// TestSlowSubscriber checks that a subscriber whose buffer fills is
+// disconnected without holding up the others, and can resume from
+// history.
+func TestSlowSubscriber(t *testing.T) {
+	b := NewBroker()
+	slow, _ := b.Subscribe(1, 0)
+	fast, _ := b.Subscribe(1, 0)
+	defer fast.Close()
+
+	var last uint64
+	for i := 0; i <= subscriberBuffer; i++ {
+		b.Publish(1, TypeLog, i)
+		last = receive(t, fast).ID
+	}
+
+	var got []Event
+	for e := range slow.C {
+		got = append(got, e)
+	}
+	if len(got) != subscriberBuffer {
+		t.Fatalf("slow subscriber got %d events before being dropped, want %d", len(got), subscriberBuffer)
+	}
+	// Publishing after the drop neither blocks nor panics
+	b.Publish(1, TypeLog, "more")
+	receive(t, fast)
+
+	resumed, replay := b.Subscribe(1, got[len(got)-1].ID)
+	defer resumed.Close()
+	if len(replay) != 2 || replay[0].ID != last || replay[1].Data != "more" {
+		t.Errorf("replay after drop = %+v, want the missed event %d and the next one", replay, last)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	b := NewBroker()
+	var ids []uint64
+	for i := 0; i < historySize+10; i++ {
+		b.Publish(1, TypeLog, i)
+		ids = append(ids, b.nextID)
+	}
+
+	tests := []struct {
+		name        string
+		lastEventID uint64
+		want        int
+	}{
+		{"no Last-Event-ID", 0, 0},
+		{"recent", ids[len(ids)-4], 3},
+		{"latest", ids[len(ids)-1], 0},
+		// Older events than the history holds are gone; the rest replay
+		{"beyond history", ids[0], historySize},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, replay := b.Subscribe(1, tt.lastEventID)
+			defer s.Close()
+			if len(replay) != tt.want {
+				t.Fatalf("replayed %d events, want %d", len(replay), tt.want)
+			}
+			for i, e := range replay {
+				if e.ID <= tt.lastEventID || (i > 0 && e.ID <= replay[i-1].ID) {
+					t.Fatalf("replay out of order at %d: %+v", i, e)
+				}
+			}
+			if len(replay) > 0 && replay[len(replay)-1].ID != ids[len(ids)-1] {
+				t.Errorf("replay ends at %d, want %d", replay[len(replay)-1].ID, ids[len(ids)-1])
+			}
+		})
+	}
+
+	// Events published after subscribing are delivered live, not replayed
+	s, _ := b.Subscribe(1, ids[len(ids)-1])
+	defer s.Close()
+	b.Publish(1, TypeCompleted, nil)
+	if e := receive(t, s); e.Type != TypeCompleted {
+		t.Errorf("live event = %+v", e)
+	}
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"protchain/internal/authz"
+	"protchain/internal/dto"
+	"protchain/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// authorizeWorkflow checks that the caller holds at least need on the
+// workflow and returns the level they hold. Otherwise it writes the error
+// response: 404 if they have no access at all, so workflow IDs are not
+// disclosed, and 403 if their level is too low. Service API keys only
+// reach workflows filed under a team of their organization.
+func authorizeWorkflow(c *gin.Context, az *authz.Service, workflowID int, need string) (string, bool) {
+	userID, _ := c.Get("user_id")
+	uid, _ := userID.(int)
+
+	level, err := az.Require(c.Request.Context(), uid, workflowID, need)
+	if err == nil {
+		if orgID, ok := keyOrganization(c); ok {
+			var in bool
+			in, err = az.InOrganization(c.Request.Context(), workflowID, orgID)
+			if err == nil && !in {
+				err = authz.ErrNotFound
+			}
+		}
+	}
+	switch {
+	case errors.Is(err, authz.ErrNotFound):
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "Workflow not found"})
+		return "", false
+	case errors.Is(err, authz.ErrForbidden):
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Success: false, Error: "You need " + need + " permission on this workflow"})
+		return "", false
+	case err != nil:
+		logf(c, "failed to resolve permission on workflow %d for user %d: %v", workflowID, uid, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return "", false
+	}
+	c.Set("workflow_id", workflowID)
+	return level, true
+}
+
+// keyOrganization returns the organization the caller's service API key
+// is restricted to. It reports false for JWTs and personal keys.
+func keyOrganization(c *gin.Context) (int, bool) {
+	v, ok := c.Get("api_key_organization_id")
+	if !ok {
+		return 0, false
+	}
+	orgID, ok := v.(int)
+	return orgID, ok
+}
+
+// keyOrganizationArg is keyOrganization as a query argument that is NULL
+// when the caller is not restricted, for filters of the form
+// ($n::int IS NULL OR organization_id = $n).
+func keyOrganizationArg(c *gin.Context) sql.NullInt64 {
+	orgID, ok := keyOrganization(c)
+	return sql.NullInt64{Int64: int64(orgID), Valid: ok}
+}
+
+// callerEmail loads the caller's current email address. The email claim
+// of a JWT is fixed when the token is issued and goes stale if the
+// address changes, so invitations are matched against users instead.
+// When the user cannot be loaded it writes the error response.
+func callerEmail(c *gin.Context, db *sql.DB) (string, bool) {
+	userID, _ := c.Get("user_id")
+	var email string
+	err := db.QueryRowContext(dbContext(c), `SELECT email FROM users WHERE id = $1`, userID).Scan(&email)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Success: false, Error: "User not found"})
+		return "", false
+	}
+	if err != nil {
+		logf(c, "failed to load the email of user %v: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return "", false
+	}
+	return email, true
+}
+
+// isOrganizationAdmin reports whether the user may administer the
+// organization, which admins and owners may. A failed lookup counts as
+// no.
+func isOrganizationAdmin(c *gin.Context, db *sql.DB, orgID int, userID interface{}) bool {
+	var role string
+	err := db.QueryRowContext(dbContext(c), `
+		SELECT role FROM organization_members
+		WHERE organization_id = $1 AND user_id = $2
+	`, orgID, userID).Scan(&role)
+	return err == nil && (role == models.RoleAdmin || role == models.RoleOwner)
+}
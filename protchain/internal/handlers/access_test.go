@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"protchain/internal/authz"
+	"protchain/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAuthorizeWorkflowKeyOrganization(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		keyOrg interface{}
+		inOrg  bool
+		want   int
+	}{
+		{"session token", nil, false, http.StatusOK},
+		{"key for workflow's organization", 7, true, http.StatusOK},
+		{"key for another organization", 9, false, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := newFakeDB(t,
+				fakeRows{
+					match:   "SELECT user_id FROM workflows WHERE id",
+					columns: []string{"user_id"},
+					rows:    [][]driver.Value{{int64(3)}},
+				},
+				fakeRows{
+					match:   "t.organization_id = $2",
+					columns: []string{"exists"},
+					rows:    [][]driver.Value{{tt.inOrg}},
+				},
+			)
+			az := authz.New(db)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/workflows/42", nil)
+			c.Set("user_id", 3)
+			if tt.keyOrg != nil {
+				c.Set("api_key_organization_id", tt.keyOrg)
+			}
+
+			level, ok := authorizeWorkflow(c, az, 42, models.PermissionView)
+			if tt.want == http.StatusOK {
+				if !ok || level != models.PermissionOwner {
+					t.Fatalf("authorizeWorkflow = %q, %v; want owner, true", level, ok)
+				}
+				return
+			}
+			if ok {
+				t.Fatal("authorizeWorkflow allowed a workflow outside the key's organization")
+			}
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
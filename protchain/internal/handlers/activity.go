@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"protchain/internal/audit"
+	"protchain/internal/dto"
+	"protchain/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordActivity writes an audit entry on behalf of the caller, filling in
+// the actor, request ID and API key from the request context.
+func recordActivity(c *gin.Context, q audit.Execer, e audit.Entry) error {
+	userID, _ := c.Get("user_id")
+	e.ActorID, _ = userID.(int)
+	e.RequestID = requestID(c)
+	if v, ok := c.Get("api_key_id"); ok {
+		if id, ok := v.(int); ok {
+			e.APIKeyID = &id
+		}
+	}
+	return audit.Record(c.Request.Context(), q, e)
+}
+
+// requestID returns the ID assigned to the current request, falling back to
+// the one the client sent.
+func requestID(c *gin.Context) string {
+	if id := c.GetString("request_id"); id != "" {
+		return id
+	}
+	return c.GetHeader("X-Request-ID")
+}
+
+// GetWorkflowActivity returns the audit trail of a workflow, newest first
+func (h *WorkflowHandler) GetWorkflowActivity(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := authorizeWorkflow(c, h.authz, id, models.PermissionView); !ok {
+		return
+	}
+
+	listActivity(c, h.db, "a.workflow_id = $1", id)
+}
+
+// GetOrganizationActivity returns the audit trail of an organization,
+// including activity on workflows filed under its teams. Admins only.
+func (h *TeamHandler) GetOrganizationActivity(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	orgID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if !isOrganizationAdmin(c, h.db, orgID, userID) {
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Success: false, Error: "Only organization admins can view activity"})
+		return
+	}
+
+	listActivity(c, h.db, "a.organization_id = $1", orgID)
+}
+
+// listActivity writes a page of activity_log entries matching scope, which
+// is a condition on $1. It applies the action, user_id, target_type, since
+// and until query filters.
+func listActivity(c *gin.Context, db *sql.DB, scope string, scopeArg int) {
+	page, perPage, offset := parsePagination(c)
+
+	var action, targetType sql.NullString
+	if a := c.Query("action"); a != "" {
+		action = sql.NullString{String: a, Valid: true}
+	}
+	if t := c.Query("target_type"); t != "" {
+		targetType = sql.NullString{String: t, Valid: true}
+	}
+	var actor sql.NullInt64
+	if u := c.Query("user_id"); u != "" {
+		id, err := strconv.Atoi(u)
+		if err != nil || id <= 0 {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: "Invalid user_id parameter: must be a positive integer"})
+			return
+		}
+		actor = sql.NullInt64{Int64: int64(id), Valid: true}
+	}
+	since, ok := parseTimeQuery(c, "since")
+	if !ok {
+		return
+	}
+	until, ok := parseTimeQuery(c, "until")
+	if !ok {
+		return
+	}
+
+	where := scope + `
+		AND ($2::text IS NULL OR a.action = $2)
+		AND ($3::text IS NULL OR a.target_type = $3)
+		AND ($4::int IS NULL OR a.user_id = $4)
+		AND ($5::timestamptz IS NULL OR a.created_at >= $5)
+		AND ($6::timestamptz IS NULL OR a.created_at < $6)`
+	args := []interface{}{scopeArg, action, targetType, actor, since, until}
+
+	var total int
+	if err := db.QueryRowContext(dbContext(c), `SELECT COUNT(*) FROM activity_log a WHERE `+where, args...).Scan(&total); err != nil {
+		logf(c, "listActivity: failed to count entries: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to fetch activity"})
+		return
+	}
+
+	rows, err := db.QueryContext(dbContext(c), `
+		SELECT a.id, a.action, a.organization_id, a.team_id, a.workflow_id, a.target_type, a.target_id,
+		       a.before_state, a.after_state, a.details, a.request_id, a.api_key_id, a.created_at,
+		       u.id, u.email, COALESCE(u.first_name, ''), COALESCE(u.last_name, '')
+		FROM activity_log a
+		JOIN users u ON u.id = a.user_id
+		WHERE `+where+`
+		ORDER BY a.created_at DESC, a.id DESC
+		LIMIT $7 OFFSET $8
+	`, append(args, perPage, offset)...)
+	if err != nil {
+		logf(c, "listActivity: failed to list entries: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to fetch activity"})
+		return
+	}
+	defer rows.Close()
+
+	entries := make([]dto.ActivityResponse, 0)
+	for rows.Next() {
+		var (
+			e             dto.ActivityResponse
+			before, after []byte
+		)
+		if err := rows.Scan(&e.ID, &e.Action, &e.OrganizationID, &e.TeamID, &e.WorkflowID, &e.TargetType, &e.TargetID,
+			&before, &after, &e.Details, &e.RequestID, &e.APIKeyID, &e.CreatedAt,
+			&e.Actor.ID, &e.Actor.Email, &e.Actor.FirstName, &e.Actor.LastName); err != nil {
+			logf(c, "listActivity: failed to scan entry: %v", err)
+			continue
+		}
+		if len(before) > 0 {
+			e.Before = json.RawMessage(before)
+		}
+		if len(after) > 0 {
+			e.After = json.RawMessage(after)
+		}
+		entries = append(entries, e)
+	}
+
+	c.JSON(http.StatusOK, dto.PaginatedResponse{
+		Success: true,
+		Data:    entries,
+		Pagination: dto.PaginationMeta{
+			Page: page, PerPage: perPage, Total: total, TotalPages: totalPages(total, perPage),
+		},
+	})
+}
+
+// parseTimeQuery reads an optional RFC 3339 timestamp from the query
+// string. On failure it writes a 400 response and returns false.
+func parseTimeQuery(c *gin.Context, name string) (sql.NullTime, bool) {
+	raw := c.Query(name)
+	if raw == "" {
+		return sql.NullTime{}, true
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: "Invalid " + name + " parameter: must be an RFC 3339 timestamp"})
+		return sql.NullTime{}, false
+	}
+	return sql.NullTime{Time: t, Valid: true}, true
+}
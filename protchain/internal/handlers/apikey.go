@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"protchain/internal/apikeys"
+	"protchain/internal/audit"
+	"protchain/internal/dto"
+	"protchain/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+type APIKeyHandler struct {
+	db *sql.DB
+}
+
+func NewAPIKeyHandler(db *sql.DB) *APIKeyHandler {
+	return &APIKeyHandler{db: db}
+}
+
+// CreateAPIKey issues a personal key, or a service key when organization_id
+// is given and the caller administers that organization. The full key is
+// only ever returned here.
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req dto.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: err.Error()})
+		return
+	}
+	for _, s := range req.Scopes {
+		if !apikeys.ValidScope(s) {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: "Unknown scope: " + s})
+			return
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: "expires_at must be in the future"})
+		return
+	}
+
+	if req.OrganizationID != nil {
+		if !isOrganizationAdmin(c, h.db, *req.OrganizationID, userID) {
+			c.JSON(http.StatusForbidden, dto.ErrorResponse{Success: false, Error: "Only organization admins can create service keys"})
+			return
+		}
+	}
+
+	raw, prefix, hash, err := apikeys.Generate()
+	if err != nil {
+		logf(c, "CreateAPIKey: failed to generate key: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to create API key"})
+		return
+	}
+
+	k := models.APIKey{
+		UserID:         userID.(int),
+		OrganizationID: req.OrganizationID,
+		Name:           req.Name,
+		Prefix:         prefix,
+		Scopes:         req.Scopes,
+		ExpiresAt:      req.ExpiresAt,
+	}
+	tx, err := h.db.BeginTx(dbContext(c), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(dbContext(c), `
+		INSERT INTO api_keys (user_id, organization_id, name, prefix, key_hash, scopes, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at
+	`, k.UserID, k.OrganizationID, k.Name, k.Prefix, hash, pq.Array(k.Scopes), k.ExpiresAt, time.Now()).Scan(&k.ID, &k.CreatedAt)
+	if err != nil {
+		logf(c, "CreateAPIKey: failed to insert key: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to create API key"})
+		return
+	}
+
+	err = recordActivity(c, tx, audit.Entry{
+		Action:         audit.APIKeyCreated,
+		OrganizationID: k.OrganizationID,
+		TargetType:     audit.TargetAPIKey,
+		TargetID:       &k.ID,
+		After:          map[string]interface{}{"name": k.Name, "prefix": k.Prefix, "scopes": k.Scopes, "expires_at": k.ExpiresAt},
+	})
+	if err != nil {
+		logf(c, "CreateAPIKey: failed to record activity: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to create API key"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to commit transaction"})
+		return
+	}
+
+	resp := apiKeyResponse(k)
+	resp.Key = raw
+	c.JSON(http.StatusCreated, dto.SuccessResponse{
+		Success: true,
+		Message: "Store this key now; it will not be shown again",
+		Data:    resp,
+	})
+}
+
+// ListAPIKeys returns the caller's live personal keys and the service keys
+// of organizations they administer.
+func (h *APIKeyHandler) ListAPIKeys(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	rows, err := h.db.QueryContext(dbContext(c), `
+		SELECT id, user_id, organization_id, name, prefix, scopes, expires_at, last_used_at, created_at
+		FROM api_keys
+		WHERE revoked_at IS NULL AND (
+			(organization_id IS NULL AND user_id = $1)
+			OR organization_id IN (
+				SELECT organization_id FROM organization_members
+				WHERE user_id = $1 AND role IN ('admin', 'owner')))
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		logf(c, "ListAPIKeys: failed to list keys: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to fetch API keys"})
+		return
+	}
+	defer rows.Close()
+
+	result := make([]dto.APIKeyResponse, 0)
+	for rows.Next() {
+		var k models.APIKey
+		if err := rows.Scan(&k.ID, &k.UserID, &k.OrganizationID, &k.Name, &k.Prefix, pq.Array(&k.Scopes),
+			&k.ExpiresAt, &k.LastUsedAt, &k.CreatedAt); err != nil {
+			logf(c, "ListAPIKeys: failed to scan key: %v", err)
+			continue
+		}
+		result = append(result, apiKeyResponse(k))
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Success: true, Data: result})
+}
+
+// RevokeAPIKey revokes one of the caller's personal keys, or a service key
+// of an organization they administer.
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	keyID, ok := parseIDParam(c, "keyId")
+	if !ok {
+		return
+	}
+
+	tx, err := h.db.BeginTx(dbContext(c), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var (
+		name   string
+		prefix string
+		orgID  *int
+	)
+	err = tx.QueryRowContext(dbContext(c), `
+		UPDATE api_keys SET revoked_at = $1
+		WHERE id = $2 AND revoked_at IS NULL AND (
+			(organization_id IS NULL AND user_id = $3)
+			OR organization_id IN (
+				SELECT organization_id FROM organization_members
+				WHERE user_id = $3 AND role IN ('admin', 'owner')))
+		RETURNING name, prefix, organization_id
+	`, time.Now(), keyID, userID).Scan(&name, &prefix, &orgID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "API key not found"})
+		return
+	}
+	if err != nil {
+		logf(c, "RevokeAPIKey: failed to revoke key %d: %v", keyID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to revoke API key"})
+		return
+	}
+
+	err = recordActivity(c, tx, audit.Entry{
+		Action:         audit.APIKeyRevoked,
+		OrganizationID: orgID,
+		TargetType:     audit.TargetAPIKey,
+		TargetID:       &keyID,
+		Before:         map[string]interface{}{"name": name, "prefix": prefix},
+	})
+	if err != nil {
+		logf(c, "RevokeAPIKey: failed to record activity for key %d: %v", keyID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to revoke API key"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Success: true, Message: "API key revoked"})
+}
+
+func apiKeyResponse(k models.APIKey) dto.APIKeyResponse {
+	return dto.APIKeyResponse{
+		ID:             k.ID,
+		Name:           k.Name,
+		Prefix:         k.Prefix,
+		Scopes:         k.Scopes,
+		OrganizationID: k.OrganizationID,
+		CreatedBy:      k.UserID,
+		ExpiresAt:      k.ExpiresAt,
+		LastUsedAt:     k.LastUsedAt,
+		CreatedAt:      k.CreatedAt,
+	}
+}
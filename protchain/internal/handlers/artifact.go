@@ -0,0 +1,336 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"protchain/internal/artifacts"
+	"protchain/internal/audit"
+	"protchain/internal/authz"
+	"protchain/internal/dto"
+	"protchain/internal/models"
+	"protchain/internal/quota"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ArtifactHandler struct {
+	db        *sql.DB
+	store     artifacts.Store
+	authz     *authz.Service
+	quotas    *quota.Service
+	maxUpload int64
+}
+
+func NewArtifactHandler(db *sql.DB, store artifacts.Store, az *authz.Service, quotas *quota.Service, maxUploadBytes int64) *ArtifactHandler {
+	return &ArtifactHandler{db: db, store: store, authz: az, quotas: quotas, maxUpload: maxUploadBytes}
+}
+
+const artifactColumns = `id, workflow_id, kind, filename, content_type, sha256, size_bytes, uploaded_by, created_at`
+
+// UploadArtifact stores a multipart "file" against a workflow. Uploading the
+// same content with the same kind again returns the existing artifact and
+// is not audited again.
+func (h *ArtifactHandler) UploadArtifact(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	workflowID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := authorizeWorkflow(c, h.authz, workflowID, models.PermissionEdit); !ok {
+		return
+	}
+
+	kind := c.PostForm("kind")
+	if !isArtifactKind(kind) {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Success: false,
+			Error:   "kind must be one of: " + strings.Join(models.ArtifactKinds, ", "),
+		})
+		return
+	}
+
+	// Leave room for the multipart envelope around the file itself
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.maxUpload+1<<20)
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: "A file must be uploaded in the \"file\" field"})
+		return
+	}
+	if err := h.quotas.CheckStorage(dbContext(c), workflowID, fileHeader.Size); err != nil {
+		if errors.Is(err, quota.ErrWorkflowNotFound) {
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "Workflow not found"})
+		} else if !quotaExceeded(c, err) {
+			logf(c, "failed to check storage quota for workflow %d: %v", workflowID, err)
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to check storage quota"})
+		}
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: "Failed to read uploaded file"})
+		return
+	}
+	defer file.Close()
+
+	digest, size, err := artifacts.Save(c.Request.Context(), h.store, file, h.maxUpload)
+	if errors.Is(err, artifacts.ErrTooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, dto.ErrorResponse{
+			Success: false,
+			Error:   fmt.Sprintf("File exceeds the %d MB upload limit", h.maxUpload>>20),
+		})
+		return
+	}
+	if err != nil {
+		logf(c, "failed to store artifact for workflow %d: %v", workflowID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to store file"})
+		return
+	}
+
+	filename := filepath.Base(fileHeader.Filename)
+	contentType := fileHeader.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	tx, err := h.db.BeginTx(dbContext(c), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var a models.Artifact
+	err = tx.QueryRowContext(dbContext(c), `
+		INSERT INTO artifacts (workflow_id, kind, filename, content_type, sha256, size_bytes, uploaded_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (workflow_id, kind, sha256) DO NOTHING
+		RETURNING `+artifactColumns,
+		workflowID, kind, filename, contentType, digest, size, userID).Scan(
+		&a.ID, &a.WorkflowID, &a.Kind, &a.Filename, &a.ContentType, &a.SHA256, &a.SizeBytes, &a.UploadedBy, &a.CreatedAt)
+	status := http.StatusCreated
+	if err == sql.ErrNoRows {
+		status = http.StatusOK
+		err = tx.QueryRowContext(dbContext(c), `
+			SELECT `+artifactColumns+` FROM artifacts
+			WHERE workflow_id = $1 AND kind = $2 AND sha256 = $3
+		`, workflowID, kind, digest).Scan(
+			&a.ID, &a.WorkflowID, &a.Kind, &a.Filename, &a.ContentType, &a.SHA256, &a.SizeBytes, &a.UploadedBy, &a.CreatedAt)
+	}
+	if err != nil {
+		logf(c, "failed to record artifact for workflow %d: %v", workflowID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to record file"})
+		return
+	}
+
+	if status == http.StatusCreated {
+		err = recordActivity(c, tx, audit.Entry{
+			Action:     audit.WorkflowArtifactUploaded,
+			WorkflowID: &workflowID,
+			TargetType: audit.TargetArtifact,
+			TargetID:   &a.ID,
+			After: map[string]interface{}{
+				"kind":       a.Kind,
+				"filename":   a.Filename,
+				"sha256":     a.SHA256,
+				"size_bytes": a.SizeBytes,
+			},
+		})
+		if err != nil {
+			logf(c, "failed to record activity for artifact %d of workflow %d: %v", a.ID, workflowID, err)
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to record file"})
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(status, dto.SuccessResponse{Success: true, Data: artifactResponse(a)})
+}
+
+// ListArtifacts lists a workflow's artifacts, newest first, optionally
+// filtered by kind
+func (h *ArtifactHandler) ListArtifacts(c *gin.Context) {
+	workflowID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := authorizeWorkflow(c, h.authz, workflowID, models.PermissionView); !ok {
+		return
+	}
+	page, perPage, offset := parsePagination(c)
+
+	var kind sql.NullString
+	if k := c.Query("kind"); k != "" {
+		if !isArtifactKind(k) {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: "Unknown artifact kind: " + k})
+			return
+		}
+		kind = sql.NullString{String: k, Valid: true}
+	}
+
+	var total int
+	if err := h.db.QueryRowContext(dbContext(c), `
+		SELECT COUNT(*) FROM artifacts WHERE workflow_id = $1 AND ($2::text IS NULL OR kind = $2)
+	`, workflowID, kind).Scan(&total); err != nil {
+		logf(c, "ListArtifacts: failed to count artifacts: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to fetch artifacts"})
+		return
+	}
+
+	rows, err := h.db.QueryContext(dbContext(c), `
+		SELECT `+artifactColumns+` FROM artifacts
+		WHERE workflow_id = $1 AND ($2::text IS NULL OR kind = $2)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3 OFFSET $4
+	`, workflowID, kind, perPage, offset)
+	if err != nil {
+		logf(c, "ListArtifacts: failed to list artifacts: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to fetch artifacts"})
+		return
+	}
+	defer rows.Close()
+
+	result := make([]dto.ArtifactResponse, 0)
+	for rows.Next() {
+		var a models.Artifact
+		if err := rows.Scan(&a.ID, &a.WorkflowID, &a.Kind, &a.Filename, &a.ContentType, &a.SHA256, &a.SizeBytes,
+			&a.UploadedBy, &a.CreatedAt); err != nil {
+			logf(c, "ListArtifacts: failed to scan artifact: %v", err)
+			continue
+		}
+		result = append(result, artifactResponse(a))
+	}
+
+	c.JSON(http.StatusOK, dto.PaginatedResponse{
+		Success: true,
+		Data:    result,
+		Pagination: dto.PaginationMeta{
+			Page: page, PerPage: perPage, Total: total, TotalPages: totalPages(total, perPage),
+		},
+	})
+}
+
+// DownloadArtifact streams an artifact's content
+func (h *ArtifactHandler) DownloadArtifact(c *gin.Context) {
+	workflowID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	artifactID, ok := parseIDParam(c, "artifactId")
+	if !ok {
+		return
+	}
+	if _, ok := authorizeWorkflow(c, h.authz, workflowID, models.PermissionView); !ok {
+		return
+	}
+
+	var a models.Artifact
+	err := h.db.QueryRowContext(dbContext(c), `
+		SELECT `+artifactColumns+` FROM artifacts WHERE id = $1 AND workflow_id = $2
+	`, artifactID, workflowID).Scan(
+		&a.ID, &a.WorkflowID, &a.Kind, &a.Filename, &a.ContentType, &a.SHA256, &a.SizeBytes, &a.UploadedBy, &a.CreatedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "Artifact not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to fetch artifact"})
+		return
+	}
+
+	h.serve(c, a, true)
+}
+
+// GetWorkflowPDB returns the workflow's structure file, preferring the
+// processed structure over the uploaded one
+func (h *ArtifactHandler) GetWorkflowPDB(c *gin.Context) {
+	workflowID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := authorizeWorkflow(c, h.authz, workflowID, models.PermissionView); !ok {
+		return
+	}
+
+	var a models.Artifact
+	err := h.db.QueryRowContext(dbContext(c), `
+		SELECT `+artifactColumns+` FROM artifacts
+		WHERE workflow_id = $1 AND kind IN ($2, $3)
+		ORDER BY kind = $2 DESC, created_at DESC, id DESC
+		LIMIT 1
+	`, workflowID, models.ArtifactProcessedStructure, models.ArtifactStructure).Scan(
+		&a.ID, &a.WorkflowID, &a.Kind, &a.Filename, &a.ContentType, &a.SHA256, &a.SizeBytes, &a.UploadedBy, &a.CreatedAt)
+	if err == sql.ErrNoRows {
+		// Frontend falls back to fetching from RCSB based on workflow name
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{
+			Success: false,
+			Error:   "No PDB data stored for this workflow",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return
+	}
+
+	a.ContentType = "chemical/x-pdb"
+	h.serve(c, a, false)
+}
+
+// serve writes an artifact's content. The digest doubles as a strong ETag
+// since content never changes for a given artifact.
+func (h *ArtifactHandler) serve(c *gin.Context, a models.Artifact, attachment bool) {
+	etag := `"` + a.SHA256 + `"`
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	content, err := h.store.Get(c.Request.Context(), a.SHA256)
+	if err != nil {
+		logf(c, "failed to open artifact %d (%s): %v", a.ID, a.SHA256, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to read artifact content"})
+		return
+	}
+	defer content.Close()
+
+	disposition := "inline"
+	if attachment {
+		disposition = "attachment"
+	}
+	c.Header("ETag", etag)
+	c.Header("X-Content-SHA256", a.SHA256)
+	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": a.Filename}))
+	c.DataFromReader(http.StatusOK, a.SizeBytes, a.ContentType, content, nil)
+}
+
+func isArtifactKind(kind string) bool {
+	for _, k := range models.ArtifactKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func artifactResponse(a models.Artifact) dto.ArtifactResponse {
+	return dto.ArtifactResponse{
+		ID:          a.ID,
+		WorkflowID:  a.WorkflowID,
+		Kind:        a.Kind,
+		Filename:    a.Filename,
+		ContentType: a.ContentType,
+		SHA256:      a.SHA256,
+		SizeBytes:   a.SizeBytes,
+		UploadedBy:  a.UploadedBy,
+		CreatedAt:   a.CreatedAt,
+	}
+}
@@ -1,7 +1,12 @@
 package handlers
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
 	"net/http"
 	"time"
 
@@ -14,14 +19,18 @@ import (
 )
 
 type AuthHandler struct {
-	db        *sql.DB
-	jwtSecret string
+	db         *sql.DB
+	jwtSecret  string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
 }
 
-func NewAuthHandler(db *sql.DB, jwtSecret string) *AuthHandler {
+func NewAuthHandler(db *sql.DB, jwtSecret string, accessTTL, refreshTTL time.Duration) *AuthHandler {
 	return &AuthHandler{
-		db:        db,
-		jwtSecret: jwtSecret,
+		db:         db,
+		jwtSecret:  jwtSecret,
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
 	}
 }
 
@@ -37,7 +46,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 
 	// Check if user already exists
 	var existingID int
-		err := h.db.QueryRow("SELECT id FROM users WHERE email = $1", req.Email).Scan(&existingID)
+	err := h.db.QueryRowContext(dbContext(c), "SELECT id FROM users WHERE email = $1", req.Email).Scan(&existingID)
 	if err != sql.ErrNoRows {
 		c.JSON(http.StatusConflict, dto.ErrorResponse{
 			Success: false,
@@ -58,7 +67,8 @@ func (h *AuthHandler) Register(c *gin.Context) {
 
 	// Create user and return the new user's ID
 	var userID int
-	err = h.db.QueryRow(`
+	var refreshToken string
+	err = h.db.QueryRowContext(dbContext(c), `
 		INSERT INTO users (email, password_hash, first_name, last_name, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, $6)
 		RETURNING id
@@ -74,6 +84,9 @@ func (h *AuthHandler) Register(c *gin.Context) {
 
 	// Generate JWT token
 	token, err := h.generateToken(int(userID), req.Email)
+	if err == nil {
+		refreshToken, err = h.issueRefreshToken(c, h.db, int(userID), "")
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Success: false,
@@ -85,7 +98,9 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	c.JSON(http.StatusCreated, dto.SuccessResponse{
 		Success: true,
 		Data: dto.AuthResponse{
-			Token: token,
+			Token:        token,
+			RefreshToken: refreshToken,
+			ExpiresIn:    int(h.accessTTL.Seconds()),
 			User: dto.UserResponse{
 				ID:        int(userID),
 				Email:     req.Email,
@@ -108,7 +123,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 
 	// Get user from database
 	var user models.User
-	err := h.db.QueryRow(`
+	err := h.db.QueryRowContext(dbContext(c), `
 		SELECT id, email, password_hash, first_name, last_name
 		FROM users WHERE email = $1
 	`, req.Email).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.FirstName, &user.LastName)
@@ -140,6 +155,10 @@ func (h *AuthHandler) Login(c *gin.Context) {
 
 	// Generate JWT token
 	token, err := h.generateToken(user.ID, user.Email)
+	var refreshToken string
+	if err == nil {
+		refreshToken, err = h.issueRefreshToken(c, h.db, user.ID, "")
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Success: false,
@@ -151,7 +170,9 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	c.JSON(http.StatusOK, dto.SuccessResponse{
 		Success: true,
 		Data: dto.AuthResponse{
-			Token: token,
+			Token:        token,
+			RefreshToken: refreshToken,
+			ExpiresIn:    int(h.accessTTL.Seconds()),
 			User: dto.UserResponse{
 				ID:        user.ID,
 				Email:     user.Email,
@@ -162,27 +183,92 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	})
 }
 
+// RefreshToken exchanges a refresh token for a new access token and a new
+// refresh token. Each refresh token works once; presenting one that has
+// already been used means it was copied, so the whole family is revoked
+// and both parties have to log in again.
 func (h *AuthHandler) RefreshToken(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
+	var req dto.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
 			Success: false,
-			Error:   "User not authenticated",
+			Error:   err.Error(),
 		})
 		return
 	}
 
-	email, exists := c.Get("email")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
-			Success: false,
-			Error:   "User not authenticated",
-		})
+	tx, err := h.db.BeginTx(dbContext(c), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
 		return
 	}
+	defer tx.Rollback()
 
-	// Generate new token
-	token, err := h.generateToken(userID.(int), email.(string))
+	var tokenID, userID int
+	var familyID string
+	var expiresAt time.Time
+	var usedAt, revokedAt sql.NullTime
+	err = tx.QueryRowContext(dbContext(c), `
+		SELECT id, user_id, family_id, expires_at, used_at, revoked_at
+		FROM refresh_tokens WHERE token_hash = $1
+		FOR UPDATE
+	`, hashRefreshToken(req.RefreshToken)).Scan(&tokenID, &userID, &familyID, &expiresAt, &usedAt, &revokedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Success: false, Error: "Invalid refresh token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return
+	}
+
+	if usedAt.Valid || revokedAt.Valid {
+		if usedAt.Valid && !revokedAt.Valid {
+			logf(c, "refresh token reuse detected for user %d; revoking token family %s", userID, familyID)
+			_, err := tx.ExecContext(dbContext(c), `
+				UPDATE refresh_tokens SET revoked_at = NOW()
+				WHERE family_id = $1 AND revoked_at IS NULL
+			`, familyID)
+			if err == nil {
+				err = tx.Commit()
+			}
+			if err != nil {
+				logf(c, "failed to revoke refresh token family %s: %v", familyID, err)
+			}
+		}
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Success: false, Error: "Refresh token has been revoked"})
+		return
+	}
+	if time.Now().After(expiresAt) {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Success: false, Error: "Refresh token has expired"})
+		return
+	}
+
+	var user models.User
+	err = tx.QueryRowContext(dbContext(c), `
+		SELECT id, email, first_name, last_name FROM users WHERE id = $1
+	`, userID).Scan(&user.ID, &user.Email, &user.FirstName, &user.LastName)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Success: false, Error: "User not found"})
+		return
+	}
+
+	refreshToken, err := h.issueRefreshToken(c, tx, userID, familyID)
+	if err != nil {
+		logf(c, "failed to rotate refresh token for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to generate token"})
+		return
+	}
+	if _, err := tx.ExecContext(dbContext(c), `
+		UPDATE refresh_tokens
+		SET used_at = NOW(), replaced_by = (SELECT id FROM refresh_tokens WHERE token_hash = $1)
+		WHERE id = $2
+	`, hashRefreshToken(refreshToken), tokenID); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return
+	}
+
+	token, err := h.generateToken(user.ID, user.Email)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Success: false,
@@ -191,20 +277,119 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		return
 	}
 
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return
+	}
+
 	c.JSON(http.StatusOK, dto.SuccessResponse{
 		Success: true,
-		Data: gin.H{"token": token},
+		Data: dto.AuthResponse{
+			Token:        token,
+			RefreshToken: refreshToken,
+			ExpiresIn:    int(h.accessTTL.Seconds()),
+			User: dto.UserResponse{
+				ID:        user.ID,
+				Email:     user.Email,
+				FirstName: user.FirstName,
+				LastName:  user.LastName,
+			},
+		},
 	})
 }
 
+// Logout revokes the presented refresh token's family, or every refresh
+// token the user holds with all_sessions. Access tokens already issued stay
+// valid until they expire.
+func (h *AuthHandler) Logout(c *gin.Context) {
+	var req dto.LogoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	var userID int
+	var familyID string
+	err := h.db.QueryRowContext(dbContext(c), `
+		SELECT user_id, family_id FROM refresh_tokens WHERE token_hash = $1
+	`, hashRefreshToken(req.RefreshToken)).Scan(&userID, &familyID)
+	if err == sql.ErrNoRows {
+		// Nothing to revoke; logging out twice is not an error
+		c.JSON(http.StatusOK, dto.SuccessResponse{Success: true, Message: "Logged out"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return
+	}
+
+	if req.AllSessions {
+		_, err = h.db.ExecContext(dbContext(c), `
+			UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL
+		`, userID)
+	} else {
+		_, err = h.db.ExecContext(dbContext(c), `
+			UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL
+		`, familyID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Success: true, Message: "Logged out"})
+}
+
 func (h *AuthHandler) generateToken(userID int, email string) (string, error) {
 	claims := jwt.MapClaims{
 		"user_id": userID,
 		"email":   email,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(),
+		"exp":     time.Now().Add(h.accessTTL).Unix(),
 		"iat":     time.Now().Unix(),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(h.jwtSecret))
 }
+
+// execer is satisfied by *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// issueRefreshToken stores a new refresh token for the user and returns it.
+// An empty familyID starts a new family, i.e. a new login session.
+func (h *AuthHandler) issueRefreshToken(c *gin.Context, db execer, userID int, familyID string) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	if familyID == "" {
+		family := make([]byte, 16)
+		if _, err := rand.Read(family); err != nil {
+			return "", err
+		}
+		familyID = hex.EncodeToString(family)
+	}
+
+	_, err := db.ExecContext(dbContext(c), `
+		INSERT INTO refresh_tokens (user_id, token_hash, family_id, expires_at, user_agent, ip_address)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, userID, hashRefreshToken(token), familyID, time.Now().Add(h.refreshTTL), c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// hashRefreshToken returns the stored form of a refresh token. The tokens
+// are 256-bit random values, so a fast hash is enough.
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
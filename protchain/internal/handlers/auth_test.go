@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// authRequest posts body to an AuthHandler method and returns the
+// recorded response.
+func authRequest(handler gin.HandlerFunc, body string) *httptest.ResponseRecorder {
+	r := gin.New()
+	r.POST("/", handler)
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// storedRefreshToken is the refresh_tokens row found for the presented
+// token, locked for rotation.
+func storedRefreshToken(expiresAt time.Time, usedAt, revokedAt interface{}) fakeRows {
+	return fakeRows{
+		match:   "FROM refresh_tokens WHERE token_hash = $1",
+		columns: []string{"id", "user_id", "family_id", "expires_at", "used_at", "revoked_at"},
+		rows:    [][]driver.Value{{int64(10), int64(3), "family", expiresAt, usedAt, revokedAt}},
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, f := newFakeDB(t,
+		storedRefreshToken(time.Now().Add(time.Hour), nil, nil),
+		fakeRows{
+			match:   "SELECT id, email, first_name, last_name FROM users",
+			columns: []string{"id", "email", "first_name", "last_name"},
+			rows:    [][]driver.Value{{int64(3), "ada@example.com", "Ada", "Lovelace"}},
+		},
+	)
+	h := NewAuthHandler(db, "secret", 15*time.Minute, 24*time.Hour)
+
+	w := authRequest(h.RefreshToken, `{"refresh_token":"old"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Data struct {
+			Token        string `json:"token"`
+			RefreshToken string `json:"refresh_token"`
+			ExpiresIn    int    `json:"expires_in"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data.Token == "" || resp.Data.ExpiresIn != 900 {
+		t.Errorf("access token = %q, expires in %d", resp.Data.Token, resp.Data.ExpiresIn)
+	}
+	next := resp.Data.RefreshToken
+	if next == "" || next == "old" {
+		t.Fatalf("refresh token not rotated: %q", next)
+	}
+
+	// The new token joins the old one's family, and the old one is spent
+	// and points at it
+	issued := f.exec("INSERT INTO refresh_tokens")
+	if issued == nil {
+		t.Fatal("no refresh token issued")
+	}
+	if issued.args[0] != int64(3) || issued.args[1] != hashRefreshToken(next) || issued.args[2] != "family" {
+		t.Errorf("issued token (user, hash, family) = %v", issued.args[:3])
+	}
+	used := f.exec("SET used_at = NOW(), replaced_by")
+	if used == nil || used.args[0] != hashRefreshToken(next) || used.args[1] != int64(10) {
+		t.Errorf("old token not marked used: %v", used)
+	}
+	if f.exec("revoked_at = NOW()") != nil {
+		t.Error("rotation revoked tokens")
+	}
+}
+
+func TestRefreshTokenRejected(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		stored fakeRows
+		want   string
+		// revokes is whether the token's family is revoked
+		revokes bool
+	}{
+		{"reused", storedRefreshToken(now.Add(time.Hour), now.Add(-time.Minute), nil), "Refresh token has been revoked", true},
+		{"revoked", storedRefreshToken(now.Add(time.Hour), nil, now.Add(-time.Minute)), "Refresh token has been revoked", false},
+		{"reused after revocation", storedRefreshToken(now.Add(time.Hour), now.Add(-time.Hour), now.Add(-time.Minute)), "Refresh token has been revoked", false},
+		{"expired", storedRefreshToken(now.Add(-time.Minute), nil, nil), "Refresh token has expired", false},
+		{"unknown", fakeRows{match: "FOR UPDATE", columns: []string{"id"}}, "Invalid refresh token", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, f := newFakeDB(t, tt.stored)
+			h := NewAuthHandler(db, "secret", 15*time.Minute, 24*time.Hour)
+
+			w := authRequest(h.RefreshToken, `{"refresh_token":"old"}`)
+			if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), tt.want) {
+				t.Fatalf("status = %d: %s; want 401 %q", w.Code, w.Body, tt.want)
+			}
+			if f.exec("INSERT INTO refresh_tokens") != nil {
+				t.Error("rejected token was exchanged for a new one")
+			}
+			revoke := f.exec("WHERE family_id = $1 AND revoked_at IS NULL")
+			if tt.revokes != (revoke != nil) {
+				t.Fatalf("family revoked = %v, want %v", revoke != nil, tt.revokes)
+			}
+			if revoke != nil && revoke.args[0] != "family" {
+				t.Errorf("revoked family %v", revoke.args[0])
+			}
+		})
+	}
+}
+
+func TestLogout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		allSessions bool
+		revoke      string
+		arg         driver.Value
+	}{
+		{false, "WHERE family_id = $1", "family"},
+		{true, "WHERE user_id = $1", int64(3)},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("all_sessions=%v", tt.allSessions), func(t *testing.T) {
+			db, f := newFakeDB(t, fakeRows{
+				match:   "SELECT user_id, family_id FROM refresh_tokens",
+				columns: []string{"user_id", "family_id"},
+				rows:    [][]driver.Value{{int64(3), "family"}},
+			})
+			h := NewAuthHandler(db, "secret", 15*time.Minute, 24*time.Hour)
+
+			w := authRequest(h.Logout, fmt.Sprintf(`{"refresh_token":"old","all_sessions":%v}`, tt.allSessions))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			if len(f.execs) != 1 {
+				t.Fatalf("logout ran %d statements, want 1: %v", len(f.execs), f.execs)
+			}
+			e := f.execs[0]
+			if !strings.Contains(e.query, "SET revoked_at = NOW() "+tt.revoke) || e.args[0] != tt.arg {
+				t.Errorf("logout ran %q with %v, want revocation %s %v", e.query, e.args, tt.revoke, tt.arg)
+			}
+		})
+	}
+
+	t.Run("unknown token", func(t *testing.T) {
+		db, f := newFakeDB(t, fakeRows{match: "SELECT user_id, family_id FROM refresh_tokens", columns: []string{"user_id", "family_id"}})
+		h := NewAuthHandler(db, "secret", 15*time.Minute, 24*time.Hour)
+
+		if w := authRequest(h.Logout, `{"refresh_token":"gone","all_sessions":true}`); w.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+		if len(f.execs) != 0 {
+			t.Errorf("logout with an unknown token ran %v", f.execs)
+		}
+	})
+}
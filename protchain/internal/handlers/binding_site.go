@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+
+	"protchain/internal/bioapi"
+	"protchain/internal/models"
+	"protchain/internal/results"
+)
+
+const (
+	// minBoxEdge is the smallest docking box edge (Å) derived for a pocket;
+	// anything tighter leaves no room for ligand flexibility.
+	minBoxEdge = 16.0
+	// boxPadding is added to the pocket's equivalent cube edge so ligands
+	// can extend past the cavity mouth.
+	boxPadding = 8.0
+)
+
+// processedPDBID returns the PDB ID in a structure preparation result, or
+// "" if the structure has not been processed.
+func processedPDBID(result []byte) string {
+	if len(result) == 0 {
+		return ""
+	}
+	var out struct {
+		PDBID string `json:"pdb_id"`
+		Data  struct {
+			PDBID string `json:"pdb_id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(result, &out); err != nil {
+		return ""
+	}
+	if out.Data.PDBID != "" {
+		return out.Data.PDBID
+	}
+	return out.PDBID
+}
+
+// bindingSitesFromBioAPI converts a BioAPI binding site result into
+// pockets ready to be stored. Pockets are numbered in the order BioAPI
+// ranked them.
+func bindingSitesFromBioAPI(result *bioapi.BindingSitesResult) ([]models.BindingSite, error) {
+	sites := make([]models.BindingSite, 0, len(result.BindingSites))
+	for i, s := range result.BindingSites {
+		size := dockingBox(s.Volume)
+		if s.Size != nil && s.Size.X > 0 && s.Size.Y > 0 && s.Size.Z > 0 {
+			size = models.Vec3(*s.Size)
+		}
+		residues := make([]models.BindingSiteResidue, 0, len(s.NearbyResidues))
+		for _, r := range s.NearbyResidues {
+			residues = append(residues, models.BindingSiteResidue(r))
+		}
+		sites = append(sites, models.BindingSite{
+			SiteNumber:        i + 1,
+			Center:            models.Vec3(s.Center),
+			Size:              size,
+			Volume:            s.Volume,
+			DruggabilityScore: s.DruggabilityScore,
+			Hydrophobicity:    s.Hydrophobicity,
+			EnclosureScore:    s.EnclosureScore,
+			Residues:          residues,
+			Method:            result.Method,
+		})
+	}
+	if len(sites) == 0 {
+		return nil, errors.New("no binding sites detected")
+	}
+	return sites, nil
+}
+
+// dockingBox derives a cubic docking box from a pocket volume (Å³) for
+// detectors that report no extent.
+func dockingBox(volume float64) models.Vec3 {
+	edge := math.Cbrt(math.Max(volume, 0)) + boxPadding
+	if edge < minBoxEdge {
+		edge = minBoxEdge
+	}
+	edge = math.Round(edge*10) / 10
+	return models.Vec3{X: edge, Y: edge, Z: edge}
+}
+
+// storeBindingSites replaces the workflow's pockets with sites, records the
+// stage run as succeeded and moves the workflow to the binding sites stage.
+func (h *WorkflowHandler) storeBindingSites(ctx context.Context, workflowID, runID int, sites []models.BindingSite, result []byte, version string) error {
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM binding_sites WHERE workflow_id = $1`, workflowID); err != nil {
+		return err
+	}
+
+	for i := range sites {
+		s := &sites[i]
+		residues, err := json.Marshal(s.Residues)
+		if err != nil {
+			return err
+		}
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO binding_sites (workflow_id, site_number, center_x, center_y, center_z,
+				size_x, size_y, size_z, volume, druggability_score, hydrophobicity, enclosure_score,
+				residues, method)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+			RETURNING id, created_at
+		`, workflowID, s.SiteNumber, s.Center.X, s.Center.Y, s.Center.Z,
+			s.Size.X, s.Size.Y, s.Size.Z, s.Volume, s.DruggabilityScore, s.Hydrophobicity, s.EnclosureScore,
+			residues, s.Method).Scan(&s.ID, &s.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("insert site %d: %w", s.SiteNumber, err)
+		}
+		s.WorkflowID = workflowID
+	}
+
+	if err := results.Finish(context.Background(), tx, runID, models.ResultSucceeded, result, "", version); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE workflows SET status = $1, updated_at = NOW() WHERE id = $2
+	`, models.StatusBindingSites, workflowID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// loadBindingSites returns a workflow's pockets, most druggable first.
+func (h *WorkflowHandler) loadBindingSites(ctx context.Context, workflowID int) ([]models.BindingSite, error) {
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, workflow_id, site_number, center_x, center_y, center_z,
+			size_x, size_y, size_z, volume, druggability_score, hydrophobicity, enclosure_score,
+			residues, COALESCE(method, ''), created_at
+		FROM binding_sites
+		WHERE workflow_id = $1
+		ORDER BY druggability_score DESC, site_number
+	`, workflowID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sites := make([]models.BindingSite, 0)
+	for rows.Next() {
+		var s models.BindingSite
+		var residues []byte
+		if err := rows.Scan(&s.ID, &s.WorkflowID, &s.SiteNumber, &s.Center.X, &s.Center.Y, &s.Center.Z,
+			&s.Size.X, &s.Size.Y, &s.Size.Z, &s.Volume, &s.DruggabilityScore, &s.Hydrophobicity, &s.EnclosureScore,
+			&residues, &s.Method, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(residues, &s.Residues); err != nil {
+			return nil, fmt.Errorf("decode residues for site %d: %w", s.ID, err)
+		}
+		sites = append(sites, s)
+	}
+	return sites, rows.Err()
+}
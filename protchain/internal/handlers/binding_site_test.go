@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"protchain/internal/authz"
+	"protchain/internal/bioapi"
+	"protchain/internal/bioapi/bioapitest"
+	"protchain/internal/events"
+	"protchain/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBindingSitesFromBioAPI(t *testing.T) {
+	var result bioapi.BindingSitesResult
+	err := json.Unmarshal([]byte(`{"method":"fpocket","binding_sites":[
+		{"site_id":4,"center":{"x":1,"y":2,"z":3},"size":{"x":20,"y":18,"z":22},"volume":900,"druggability_score":0.8,"nearby_residues":[{"chain":"A","residue_number":86,"residue_name":"ASP","distance":3.1}]},
+		{"site_id":2,"center":{"x":-4,"y":0,"z":5},"volume":1000,"druggability_score":0.4}
+	]}`), &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sites, err := bindingSitesFromBioAPI(&result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sites) != 2 {
+		t.Fatalf("converted %d sites, want 2", len(sites))
+	}
+
+	// Sites are numbered in BioAPI's order, not by its site IDs
+	first, second := sites[0], sites[1]
+	if first.SiteNumber != 1 || second.SiteNumber != 2 {
+		t.Errorf("site numbers = %d, %d; want 1, 2", first.SiteNumber, second.SiteNumber)
+	}
+	if first.Size != (models.Vec3{X: 20, Y: 18, Z: 22}) || first.Method != "fpocket" || len(first.Residues) != 1 {
+		t.Errorf("first site = %+v", first)
+	}
+	// A pocket without an extent gets a box from its volume, and no
+	// residues is an empty list rather than null
+	if second.Size != dockingBox(1000) || second.Residues == nil || len(second.Residues) != 0 {
+		t.Errorf("second site = %+v", second)
+	}
+
+	if _, err := bindingSitesFromBioAPI(&bioapi.BindingSitesResult{Method: "fpocket"}); err == nil {
+		t.Error("a result without pockets converted, want an error")
+	}
+}
+
+func TestDockingBox(t *testing.T) {
+	tests := []struct {
+		volume float64
+		edge   float64
+	}{
+		{0, minBoxEdge},
+		{-5, minBoxEdge},
+		{512, minBoxEdge},
+		{1000, 18},
+		{3375, 23},
+		{2000, 20.6},
+	}
+	for _, tt := range tests {
+		if got := dockingBox(tt.volume); got != (models.Vec3{X: tt.edge, Y: tt.edge, Z: tt.edge}) {
+			t.Errorf("dockingBox(%v) = %+v, want edges of %v", tt.volume, got, tt.edge)
+		}
+	}
+}
+
+func TestProcessedPDBID(t *testing.T) {
+	tests := []struct {
+		results string
+		want    string
+	}{
+		{"", ""},
+		{`{"data":{"pdb_id":"1ABC"}}`, "1ABC"},
+		{`{"pdb_id":"2XYZ"}`, "2XYZ"},
+		{`{"pdb_id":"2XYZ","data":{"pdb_id":"1ABC"}}`, "1ABC"},
+		{`{"data":{}}`, ""},
+		{`not json`, ""},
+	}
+	for _, tt := range tests {
+		if got := processedPDBID([]byte(tt.results)); got != tt.want {
+			t.Errorf("processedPDBID(%q) = %q, want %q", tt.results, got, tt.want)
+		}
+	}
+}
+
+// TestBindingSiteAnalysisStoreFailure checks that a run whose pockets
+// cannot be stored is closed as failed rather than left running.
+func TestBindingSiteAnalysisStoreFailure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, f := newFakeDB(t,
+		fakeRows{
+			match:   "SELECT user_id FROM workflows WHERE id",
+			columns: []string{"user_id"},
+			rows:    [][]driver.Value{{int64(3)}},
+		},
+		fakeRows{
+			match:   "INSERT INTO workflow_stage_results",
+			columns: []string{"id", "run_number"},
+			rows:    [][]driver.Value{{int64(7), int64(1)}},
+		},
+		fakeRows{
+			match: "INSERT INTO binding_sites",
+			err:   errors.New("disk full"),
+		},
+	)
+	srv := bioapitest.NewServer()
+	defer srv.Close()
+	broker := events.NewBroker()
+	h := NewWorkflowHandler(db, nil, srv.Client(bioapi.Config{}), broker, authz.New(db))
+	sub, _ := broker.Subscribe(42, 0)
+	defer sub.Close()
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", 3) })
+	r.POST("/workflows/:id/binding-site-analysis", h.StartBindingSiteAnalysis)
+	req := httptest.NewRequest(http.MethodPost, "/workflows/42/binding-site-analysis", strings.NewReader(`{"pdb_id":"1ABC"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500: %s", w.Code, w.Body)
+	}
+	if e := f.exec("UPDATE workflow_stage_results"); e == nil || e.args[0] != models.ResultFailed {
+		t.Errorf("stage run not closed as failed; execs: %v", f.execs)
+	}
+	if f.exec("UPDATE workflows") != nil {
+		t.Errorf("workflow advanced although its pockets were not stored")
+	}
+	for len(sub.C) > 0 {
+		if e := <-sub.C; e.Type == events.TypeFailed {
+			data := e.Data.(gin.H)
+			if data["stage"] != models.StageBindingSiteAnalysis || !strings.Contains(data["error"].(string), "disk full") {
+				t.Errorf("failure event = %v", data)
+			}
+			return
+		}
+	}
+	t.Error("no failure event published")
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"protchain/internal/bioapi"
+	"protchain/internal/bioapi/bioapitest"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bindingAnalysis sends a direct binding analysis request through h and
+// returns the recorded response.
+func bindingAnalysis(ctx context.Context, h *WorkflowHandler) *httptest.ResponseRecorder {
+	r := gin.New()
+	r.POST("/binding/direct-binding-analysis", h.DirectBindingAnalysis)
+	req := httptest.NewRequest(http.MethodPost, "/binding/direct-binding-analysis", strings.NewReader(`{"pdb_id":"1ABC"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req.WithContext(ctx))
+	return w
+}
+
+func TestDirectBindingAnalysisBioAPIFailures(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ep := bioapi.EndpointBindingAnalysis.Name
+
+	tests := []struct {
+		name string
+		// setup configures the fake and returns the request context
+		setup      func(t *testing.T, srv *bioapitest.Server) context.Context
+		wantStatus int
+		wantError  string
+		wantCalls  int
+	}{
+		{
+			name: "recovers after retries",
+			setup: func(t *testing.T, srv *bioapitest.Server) context.Context {
+				srv.Fail(ep, http.StatusServiceUnavailable, 2)
+				return context.Background()
+			},
+			wantStatus: http.StatusOK,
+			wantCalls:  3,
+		},
+		{
+			name: "retries exhausted",
+			setup: func(t *testing.T, srv *bioapitest.Server) context.Context {
+				srv.Fail(ep, http.StatusServiceUnavailable, 10)
+				return context.Background()
+			},
+			wantStatus: http.StatusBadGateway,
+			wantError:  "The binding analysis service failed: Service Unavailable",
+			wantCalls:  3,
+		},
+		{
+			name: "validation errors pass through",
+			setup: func(t *testing.T, srv *bioapitest.Server) context.Context {
+				srv.Respond(ep, http.StatusUnprocessableEntity, map[string]string{"detail": "Invalid PDB ID"})
+				return context.Background()
+			},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantError:  "Invalid PDB ID",
+			wantCalls:  1,
+		},
+		{
+			name: "request deadline",
+			setup: func(t *testing.T, srv *bioapitest.Server) context.Context {
+				srv.Handle(ep, func(w http.ResponseWriter, r *http.Request) {
+					<-r.Context().Done()
+				})
+				ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+				t.Cleanup(cancel)
+				return ctx
+			},
+			wantStatus: http.StatusGatewayTimeout,
+			wantError:  "The binding analysis service timed out",
+			wantCalls:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := bioapitest.NewServer()
+			defer srv.Close()
+			ctx := tt.setup(t, srv)
+			h := NewWorkflowHandler(nil, nil, srv.Client(bioapi.Config{MaxRetries: 2, RetryBackoff: time.Millisecond}), nil, nil)
+
+			w := bindingAnalysis(ctx, h)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantError != "" && !strings.Contains(w.Body.String(), `"error":"`+tt.wantError+`"`) {
+				t.Errorf("body = %s, want error %q", w.Body, tt.wantError)
+			}
+			if got := len(srv.Requests(ep)); got != tt.wantCalls {
+				t.Errorf("fake saw %d requests, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestDirectBindingAnalysisBreakerOpen(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ep := bioapi.EndpointBindingAnalysis.Name
+
+	srv := bioapitest.NewServer()
+	defer srv.Close()
+	pool := bioapi.NewPool(bioapi.PoolConfig{
+		Static:           []bioapi.WorkerSpec{{ID: "fake", URL: srv.URL, Capabilities: []string{bioapi.CapabilityAll}}},
+		BreakerThreshold: 1,
+		BreakerCooldown:  20 * time.Millisecond,
+	})
+	h := NewWorkflowHandler(nil, nil, srv.Client(bioapi.Config{Pool: pool}), nil, nil)
+
+	srv.Fail(ep, http.StatusBadGateway, 1)
+	if w := bindingAnalysis(context.Background(), h); w.Code != http.StatusBadGateway {
+		t.Fatalf("failing worker: status = %d, want 502", w.Code)
+	}
+	w := bindingAnalysis(context.Background(), h)
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "temporarily unavailable") {
+		t.Fatalf("open breaker: status = %d: %s", w.Code, w.Body)
+	}
+	if got := len(srv.Requests(ep)); got != 1 {
+		t.Errorf("open breaker let a call through: fake saw %d requests", got)
+	}
+
+	// Once the cooldown passes a probe goes through and closes it
+	time.Sleep(20 * time.Millisecond)
+	if w := bindingAnalysis(context.Background(), h); w.Code != http.StatusOK {
+		t.Fatalf("half-open probe: status = %d: %s", w.Code, w.Body)
+	}
+	if w := bindingAnalysis(context.Background(), h); w.Code != http.StatusOK {
+		t.Fatalf("closed breaker: status = %d: %s", w.Code, w.Body)
+	}
+}
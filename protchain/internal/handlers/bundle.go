@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"protchain/internal/models"
+)
+
+// bundleFormat identifies the layout of a published workflow bundle.
+const bundleFormat = "protchain.workflow-bundle/v1"
+
+// workflowBundle is the canonical record of a workflow published to IPFS:
+// the latest successful run of every stage and the digests of its
+// artifacts. Building it twice from unchanged data yields identical bytes.
+type workflowBundle struct {
+	Format    string           `json:"format"`
+	Workflow  bundleWorkflow   `json:"workflow"`
+	Stages    []bundleStage    `json:"stages"`
+	Artifacts []bundleArtifact `json:"artifacts"`
+}
+
+type bundleWorkflow struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	OwnerID     int       `json:"owner_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type bundleStage struct {
+	Stage         string          `json:"stage"`
+	RunNumber     int             `json:"run_number"`
+	Parameters    json.RawMessage `json:"parameters"`
+	Result        json.RawMessage `json:"result"`
+	BioAPIVersion string          `json:"bioapi_version"`
+	StartedAt     time.Time       `json:"started_at"`
+	FinishedAt    *time.Time      `json:"finished_at"`
+}
+
+type bundleArtifact struct {
+	Kind        string `json:"kind"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	SHA256      string `json:"sha256"`
+	SizeBytes   int64  `json:"size_bytes"`
+}
+
+// buildBundle assembles and encodes a workflow's bundle, returning the
+// bytes and their hex SHA-256 digest.
+func buildBundle(ctx context.Context, db *sql.DB, workflowID int) ([]byte, string, error) {
+	b := workflowBundle{Format: bundleFormat, Stages: []bundleStage{}, Artifacts: []bundleArtifact{}}
+
+	var description sql.NullString
+	err := db.QueryRowContext(ctx, `
+		SELECT id, name, description, user_id, created_at FROM workflows WHERE id = $1
+	`, workflowID).Scan(&b.Workflow.ID, &b.Workflow.Name, &description, &b.Workflow.OwnerID, &b.Workflow.CreatedAt)
+	if err != nil {
+		return nil, "", err
+	}
+	b.Workflow.Description = description.String
+	b.Workflow.CreatedAt = b.Workflow.CreatedAt.UTC()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT DISTINCT ON (stage) stage, run_number, parameters, result, bioapi_version, started_at, finished_at
+		FROM workflow_stage_results
+		WHERE workflow_id = $1 AND status = $2
+		ORDER BY stage, run_number DESC
+	`, workflowID, models.ResultSucceeded)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			s              bundleStage
+			params, result []byte
+			version        sql.NullString
+		)
+		if err := rows.Scan(&s.Stage, &s.RunNumber, &params, &result, &version, &s.StartedAt, &s.FinishedAt); err != nil {
+			return nil, "", err
+		}
+		if s.Parameters, err = canonicalJSON(params); err != nil {
+			return nil, "", err
+		}
+		if s.Result, err = canonicalJSON(result); err != nil {
+			return nil, "", err
+		}
+		s.BioAPIVersion = version.String
+		s.StartedAt = s.StartedAt.UTC()
+		if s.FinishedAt != nil {
+			t := s.FinishedAt.UTC()
+			s.FinishedAt = &t
+		}
+		b.Stages = append(b.Stages, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+	sortStages(b.Stages)
+
+	arows, err := db.QueryContext(ctx, `
+		SELECT kind, filename, content_type, sha256, size_bytes
+		FROM artifacts WHERE workflow_id = $1
+		ORDER BY kind, sha256
+	`, workflowID)
+	if err != nil {
+		return nil, "", err
+	}
+	defer arows.Close()
+	for arows.Next() {
+		var a bundleArtifact
+		if err := arows.Scan(&a.Kind, &a.Filename, &a.ContentType, &a.SHA256, &a.SizeBytes); err != nil {
+			return nil, "", err
+		}
+		b.Artifacts = append(b.Artifacts, a)
+	}
+	if err := arows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	data, err := json.Marshal(b)
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(data)
+	return data, hex.EncodeToString(sum[:]), nil
+}
+
+// sortStages orders bundle stages by pipeline position, then name for
+// stages outside the pipeline.
+func sortStages(stages []bundleStage) {
+	rank := func(stage string) int {
+		for i, s := range models.PipelineStages {
+			if s == stage {
+				return i
+			}
+		}
+		return len(models.PipelineStages)
+	}
+	sort.SliceStable(stages, func(i, j int) bool {
+		ri, rj := rank(stages[i].Stage), rank(stages[j].Stage)
+		if ri != rj {
+			return ri < rj
+		}
+		return stages[i].Stage < stages[j].Stage
+	})
+}
+
+// canonicalJSON re-encodes raw JSON with sorted object keys and no
+// insignificant whitespace. Numbers keep their original text. Empty input
+// becomes null.
+func canonicalJSON(raw []byte) (json.RawMessage, error) {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return json.RawMessage("null"), nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(out), nil
+}
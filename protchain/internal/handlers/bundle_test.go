@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"protchain/internal/models"
+)
+
+func TestCanonicalJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"empty", "", "null"},
+		{"whitespace only", " \n\t", "null"},
+		{"null", "null", "null"},
+		{"sorted keys", `{"b":1,"a":2}`, `{"a":2,"b":1}`},
+		{"nested keys", `{"z":{"y":1,"x":[{"d":1,"c":2}]},"a":null}`, `{"a":null,"z":{"x":[{"c":2,"d":1}],"y":1}}`},
+		{"insignificant whitespace", "{ \"a\" : [ 1 , 2 ] }\n", `{"a":[1,2]}`},
+		{"number text kept", `{"score":-7.50,"n":1e3}`, `{"n":1e3,"score":-7.50}`},
+		{"large integer kept", `{"id":12345678901234567890}`, `{"id":12345678901234567890}`},
+		{"array order kept", `[3,1,2]`, `[3,1,2]`},
+		{"string", `"ATP"`, `"ATP"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := canonicalJSON([]byte(tt.in))
+			if err != nil {
+				t.Fatalf("canonicalJSON(%q): %v", tt.in, err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("canonicalJSON(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalJSONInvalid(t *testing.T) {
+	for _, in := range []string{`{"a":`, `{a:1}`, `[1,]`} {
+		if _, err := canonicalJSON([]byte(in)); err == nil {
+			t.Errorf("canonicalJSON(%q) succeeded, want an error", in)
+		}
+	}
+}
+
+func TestCanonicalJSONIdempotent(t *testing.T) {
+	in := []byte(`{"poses":[{"score":-9.1,"rmsd":0.0}],"engine":"vina","seed":42}`)
+	once, err := canonicalJSON(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	twice, err := canonicalJSON(once)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(once, twice) {
+		t.Errorf("canonicalJSON is not idempotent: %s then %s", once, twice)
+	}
+}
+
+// bundleFixture returns canned workflow, stage and artifact rows. The
+// stages are returned in the order given and their JSON is stored with the
+// given formatting, as Postgres might return it from different writes.
+func bundleFixture(loc *time.Location, stages [][]driver.Value) []fakeRows {
+	created := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC).In(loc)
+	return []fakeRows{
+		{
+			match:   "FROM workflows WHERE id",
+			columns: []string{"id", "name", "description", "user_id", "created_at"},
+			rows:    [][]driver.Value{{int64(7), "EGFR screen", nil, int64(3), created}},
+		},
+		{
+			match:   "FROM workflow_stage_results",
+			columns: []string{"stage", "run_number", "parameters", "result", "bioapi_version", "started_at", "finished_at"},
+			rows:    stages,
+		},
+		{
+			match:   "FROM artifacts WHERE workflow_id",
+			columns: []string{"kind", "filename", "content_type", "sha256", "size_bytes"},
+			rows: [][]driver.Value{
+				{"library", "ligands.sdf", "chemical/x-mdl-sdfile", "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae", int64(1024)},
+				{"structure", "1m17.pdb", "chemical/x-pdb", "fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9", int64(4096)},
+			},
+		},
+	}
+}
+
+func TestBuildBundleDeterministic(t *testing.T) {
+	started := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	finished := started.Add(5 * time.Minute)
+	tokyo := time.FixedZone("JST", 9*60*60)
+
+	prep := func(loc *time.Location, params, result string) []driver.Value {
+		return []driver.Value{models.StageStructurePreparation, int64(1), []byte(params), []byte(result), "1.4.0", started.In(loc), finished.In(loc)}
+	}
+	dock := func(loc *time.Location, params, result string) []driver.Value {
+		return []driver.Value{models.StageMolecularDocking, int64(2), []byte(params), []byte(result), nil, started.In(loc), nil}
+	}
+
+	db1, _ := newFakeDB(t, bundleFixture(time.UTC, [][]driver.Value{
+		prep(time.UTC, `{"ph":7.4,"add_hydrogens":true}`, `{"atoms":1800}`),
+		dock(time.UTC, `{"exhaustiveness":8,"seed":1}`, `{"poses":[{"score":-9.10,"ligand":"L1"}]}`),
+	})...)
+	db2, _ := newFakeDB(t, bundleFixture(tokyo, [][]driver.Value{
+		dock(tokyo, "{\n  \"seed\": 1,\n  \"exhaustiveness\": 8\n}", `{ "poses": [ { "ligand": "L1", "score": -9.10 } ] }`),
+		prep(tokyo, `{"add_hydrogens": true, "ph": 7.4}`, `{"atoms": 1800}`),
+	})...)
+
+	ctx := context.Background()
+	data1, digest1, err := buildBundle(ctx, db1, 7)
+	if err != nil {
+		t.Fatalf("buildBundle: %v", err)
+	}
+	data2, digest2, err := buildBundle(ctx, db2, 7)
+	if err != nil {
+		t.Fatalf("buildBundle: %v", err)
+	}
+
+	if !bytes.Equal(data1, data2) {
+		t.Errorf("bundles differ:\n%s\n%s", data1, data2)
+	}
+	if digest1 != digest2 {
+		t.Errorf("digests differ: %s and %s", digest1, digest2)
+	}
+	sum := sha256.Sum256(data1)
+	if digest1 != hex.EncodeToString(sum[:]) {
+		t.Errorf("digest %s is not the SHA-256 of the bundle", digest1)
+	}
+
+	var b workflowBundle
+	if err := json.Unmarshal(data1, &b); err != nil {
+		t.Fatalf("decoding bundle: %v", err)
+	}
+	if b.Format != bundleFormat {
+		t.Errorf("format = %q, want %q", b.Format, bundleFormat)
+	}
+	if len(b.Stages) != 2 || b.Stages[0].Stage != models.StageStructurePreparation || b.Stages[1].Stage != models.StageMolecularDocking {
+		t.Errorf("stages not in pipeline order: %+v", b.Stages)
+	}
+	if got := string(b.Stages[1].Parameters); got != `{"exhaustiveness":8,"seed":1}` {
+		t.Errorf("docking parameters = %s, want canonical JSON", got)
+	}
+	if b.Workflow.CreatedAt.Location() != time.UTC {
+		t.Errorf("created_at not normalised to UTC: %v", b.Workflow.CreatedAt)
+	}
+}
+
+func TestBuildBundleEmptyWorkflow(t *testing.T) {
+	// No stages and no artifacts: both lists must encode as [] rather than
+	// null so an empty workflow still has one canonical form.
+	db, _ := newFakeDB(t, append(bundleFixture(time.UTC, nil)[:2], fakeRows{
+		match:   "FROM artifacts WHERE workflow_id",
+		columns: []string{"kind", "filename", "content_type", "sha256", "size_bytes"},
+	})...)
+
+	data, _, err := buildBundle(context.Background(), db, 7)
+	if err != nil {
+		t.Fatalf("buildBundle: %v", err)
+	}
+	want := `{"format":"protchain.workflow-bundle/v1","workflow":{"id":7,"name":"EGFR screen","description":"","owner_id":3,"created_at":"2024-03-01T09:30:00Z"},"stages":[],"artifacts":[]}`
+	if string(data) != want {
+		t.Errorf("bundle =\n%s\nwant\n%s", data, want)
+	}
+}
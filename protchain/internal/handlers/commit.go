@@ -0,0 +1,325 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"protchain/internal/audit"
+	"protchain/internal/chain"
+	"protchain/internal/dto"
+	"protchain/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const commitColumns = `id, workflow_id, status, chain_id, contract_address, from_address, ipfs_hash,
+	result_hash, molecule_data_hash, molecule_id, tx_hash, block_number, block_hash, numeric_id::text,
+	result_id, gas_used, gas_price::text, error, committed_by, created_at, confirmed_at`
+
+// CommitWorkflow records the workflow's published bundle on the
+// DrugScreeningVerifier contract and waits for the transaction to be
+// confirmed. If confirmation takes longer than the configured timeout the
+// commit stays pending and calling this again resumes waiting for it.
+func (h *ProvenanceHandler) CommitWorkflow(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := authorizeWorkflow(c, h.authz, id, models.PermissionEdit); !ok {
+		return
+	}
+	if h.chain == nil || !h.chain.CanSign() {
+		c.JSON(http.StatusServiceUnavailable, dto.ErrorResponse{Success: false, Error: "Blockchain commits are not configured on this server"})
+		return
+	}
+
+	var req dto.CommitWorkflowRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: err.Error()})
+		return
+	}
+
+	// An attempt with no transaction hash outlived its request without
+	// broadcasting anything, so it is safe to give up on
+	if _, err := h.db.ExecContext(dbContext(c), `
+		UPDATE blockchain_commits SET status = $1, error = 'abandoned before broadcast'
+		WHERE workflow_id = $2 AND status = $3 AND tx_hash IS NULL AND created_at < $4
+	`, models.CommitFailed, id, models.CommitPending, time.Now().Add(-h.confirmTimeout)); err != nil {
+		logf(c, "CommitWorkflow: failed to clear abandoned commits for workflow %d: %v", id, err)
+	}
+
+	var (
+		pendingID int
+		pendingTx sql.NullString
+	)
+	err := h.db.QueryRowContext(dbContext(c), `
+		SELECT id, tx_hash FROM blockchain_commits WHERE workflow_id = $1 AND status = $2
+	`, id, models.CommitPending).Scan(&pendingID, &pendingTx)
+	switch {
+	case err == nil && pendingTx.Valid:
+		h.awaitCommit(c, id, pendingID, pendingTx.String)
+		return
+	case err == nil:
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Success: false, Error: "A commit for this workflow is already in progress"})
+		return
+	case err != sql.ErrNoRows:
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return
+	}
+
+	var (
+		name, cid string
+		digest    sql.NullString
+	)
+	err = h.db.QueryRowContext(dbContext(c), `
+		SELECT name, COALESCE(ipfs_hash, ''), ipfs_bundle_sha256 FROM workflows WHERE id = $1
+	`, id).Scan(&name, &cid, &digest)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return
+	}
+	if cid == "" || !digest.Valid {
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Success: false, Error: "Publish the workflow bundle to IPFS before committing it"})
+		return
+	}
+
+	var committedTx string
+	err = h.db.QueryRowContext(dbContext(c), `
+		SELECT tx_hash FROM blockchain_commits
+		WHERE workflow_id = $1 AND ipfs_hash = $2 AND status = $3
+	`, id, cid, models.CommitConfirmed).Scan(&committedTx)
+	if err == nil {
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Success: false, Error: "This bundle is already committed in transaction " + committedTx})
+		return
+	}
+	if err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	bundle, current, err := buildBundle(ctx, h.db, id)
+	if err != nil {
+		logf(c, "CommitWorkflow: failed to build bundle for workflow %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to build workflow bundle"})
+		return
+	}
+	if current != digest.String {
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Success: false, Error: "Workflow results changed since the bundle was published; publish it again first"})
+		return
+	}
+	moleculeHash, err := moleculeDataHash(ctx, h.db, id)
+	if err != nil {
+		logf(c, "CommitWorkflow: failed to hash inputs of workflow %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return
+	}
+	resultHash := chain.Keccak256(bundle)
+	moleculeID := strings.TrimSpace(req.MoleculeID)
+	if moleculeID == "" {
+		moleculeID = name
+	}
+
+	chainID, err := h.chain.ChainID(ctx)
+	if err != nil {
+		logf(c, "CommitWorkflow: failed to reach chain: %v", err)
+		c.JSON(http.StatusBadGateway, dto.ErrorResponse{Success: false, Error: "Failed to reach blockchain node"})
+		return
+	}
+
+	// Reserve the workflow's single pending slot before broadcasting, so
+	// concurrent requests cannot both send a transaction
+	var commitID int
+	err = h.db.QueryRowContext(dbContext(c), `
+		INSERT INTO blockchain_commits (workflow_id, status, chain_id, contract_address, from_address, ipfs_hash,
+			result_hash, molecule_data_hash, molecule_id, committed_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id
+	`, id, models.CommitPending, chainID.Int64(), h.chain.Contract(), h.chain.From(), cid,
+		"0x"+hex.EncodeToString(resultHash[:]), "0x"+hex.EncodeToString(moleculeHash[:]), moleculeID,
+		userID, time.Now()).Scan(&commitID)
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Success: false, Error: "A commit for this workflow is already in progress"})
+		return
+	}
+	if err != nil {
+		logf(c, "CommitWorkflow: failed to record commit for workflow %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to record commit"})
+		return
+	}
+
+	txHash, err := h.chain.RecordScreeningResult(ctx, resultHash, moleculeHash, moleculeID)
+	if err != nil {
+		logf(c, "CommitWorkflow: failed to send transaction for workflow %d: %v", id, err)
+		h.failCommit(dbContext(c), commitID, err.Error())
+		c.JSON(http.StatusBadGateway, dto.ErrorResponse{Success: false, Error: "Failed to submit blockchain transaction: " + err.Error()})
+		return
+	}
+	if _, err := h.db.ExecContext(dbContext(c), `UPDATE blockchain_commits SET tx_hash = $1 WHERE id = $2`, txHash, commitID); err != nil {
+		// The transaction is out; keep going so the receipt is still saved
+		logf(c, "CommitWorkflow: failed to store tx hash %s for commit %d: %v", txHash, commitID, err)
+	}
+
+	h.awaitCommit(c, id, commitID, txHash)
+}
+
+// awaitCommit waits for txHash to be confirmed and records the receipt on
+// the commit and the workflow.
+func (h *ProvenanceHandler) awaitCommit(c *gin.Context, workflowID, commitID int, txHash string) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.confirmTimeout)
+	defer cancel()
+
+	receipt, err := h.chain.WaitForReceipt(ctx, txHash)
+	if errors.Is(err, chain.ErrReverted) {
+		_, uerr := h.db.ExecContext(dbContext(c), `
+			UPDATE blockchain_commits
+			SET status = $1, error = $2, block_number = $3, block_hash = $4, gas_used = $5, gas_price = $6
+			WHERE id = $7
+		`, models.CommitFailed, "transaction reverted", int64(receipt.BlockNumber), receipt.BlockHash,
+			int64(receipt.GasUsed), receipt.GasPrice.String(), commitID)
+		if uerr != nil {
+			logf(c, "awaitCommit: failed to mark commit %d reverted: %v", commitID, uerr)
+		}
+		c.JSON(http.StatusBadGateway, dto.ErrorResponse{Success: false, Error: "Transaction " + txHash + " reverted on chain"})
+		return
+	}
+	if err != nil {
+		logf(c, "awaitCommit: transaction %s for workflow %d not confirmed yet: %v", txHash, workflowID, err)
+		commit, lerr := h.loadCommit(dbContext(c), commitID)
+		if lerr != nil {
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+			return
+		}
+		c.JSON(http.StatusAccepted, dto.SuccessResponse{
+			Success: true,
+			Message: "Transaction submitted but not confirmed yet; commit again to resume waiting",
+			Data:    commit,
+		})
+		return
+	}
+
+	tx, err := h.db.BeginTx(dbContext(c), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	var cid string
+	err = tx.QueryRowContext(dbContext(c), `
+		UPDATE blockchain_commits
+		SET status = $1, block_number = $2, block_hash = $3, numeric_id = $4, result_id = $5,
+		    gas_used = $6, gas_price = $7, confirmed_at = $8
+		WHERE id = $9
+		RETURNING ipfs_hash
+	`, models.CommitConfirmed, int64(receipt.BlockNumber), receipt.BlockHash, receipt.NumericID.String(), receipt.ResultID,
+		int64(receipt.GasUsed), receipt.GasPrice.String(), now, commitID).Scan(&cid)
+	if err != nil {
+		logf(c, "awaitCommit: failed to confirm commit %d: %v", commitID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to record commit"})
+		return
+	}
+
+	var prevTx string
+	err = tx.QueryRowContext(dbContext(c), `
+		SELECT COALESCE(blockchain_tx_hash, '') FROM workflows WHERE id = $1 FOR UPDATE
+	`, workflowID).Scan(&prevTx)
+	if err == nil {
+		_, err = tx.ExecContext(dbContext(c), `
+			UPDATE workflows SET blockchain_tx_hash = $1, blockchain_committed_at = $2, updated_at = $2
+			WHERE id = $3
+		`, txHash, now, workflowID)
+	}
+	if err != nil {
+		logf(c, "awaitCommit: failed to update workflow %d: %v", workflowID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to record commit"})
+		return
+	}
+
+	err = recordActivity(c, tx, audit.Entry{
+		Action:     audit.WorkflowBlockchainCommitted,
+		WorkflowID: &workflowID,
+		TargetType: audit.TargetWorkflow,
+		TargetID:   &workflowID,
+		Before:     map[string]interface{}{"blockchain_tx_hash": prevTx},
+		After: map[string]interface{}{
+			"blockchain_tx_hash": txHash,
+			"ipfs_hash":          cid,
+			"block_number":       receipt.BlockNumber,
+			"numeric_id":         receipt.NumericID.String(),
+		},
+	})
+	if err != nil {
+		logf(c, "awaitCommit: failed to record activity for workflow %d: %v", workflowID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to record commit"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to commit transaction"})
+		return
+	}
+
+	commit, err := h.loadCommit(dbContext(c), commitID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, dto.SuccessResponse{Success: true, Message: "Workflow committed to blockchain", Data: commit})
+}
+
+func (h *ProvenanceHandler) failCommit(ctx context.Context, commitID int, reason string) {
+	if _, err := h.db.ExecContext(ctx, `
+		UPDATE blockchain_commits SET status = $1, error = $2 WHERE id = $3
+	`, models.CommitFailed, reason, commitID); err != nil {
+		slog.Error("failCommit: failed to mark commit failed", "commit_id", commitID, "error", err)
+	}
+}
+
+func (h *ProvenanceHandler) loadCommit(ctx context.Context, commitID int) (*models.BlockchainCommit, error) {
+	var m models.BlockchainCommit
+	err := h.db.QueryRowContext(ctx, `SELECT `+commitColumns+` FROM blockchain_commits WHERE id = $1`, commitID).Scan(
+		&m.ID, &m.WorkflowID, &m.Status, &m.ChainID, &m.ContractAddress, &m.FromAddress, &m.IPFSHash,
+		&m.ResultHash, &m.MoleculeDataHash, &m.MoleculeID, &m.TxHash, &m.BlockNumber, &m.BlockHash, &m.NumericID,
+		&m.ResultID, &m.GasUsed, &m.GasPrice, &m.Error, &m.CommittedBy, &m.CreatedAt, &m.ConfirmedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// moleculeDataHash digests a workflow's input files, the uploaded
+// structures and compound libraries, as Keccak-256 over their sorted
+// "kind:sha256" lines.
+func moleculeDataHash(ctx context.Context, db *sql.DB, workflowID int) ([32]byte, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT kind, sha256 FROM artifacts
+		WHERE workflow_id = $1 AND kind IN ($2, $3)
+		ORDER BY kind, sha256
+	`, workflowID, models.ArtifactStructure, models.ArtifactCompoundLibrary)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	defer rows.Close()
+
+	var b strings.Builder
+	for rows.Next() {
+		var kind, sum string
+		if err := rows.Scan(&kind, &sum); err != nil {
+			return [32]byte{}, err
+		}
+		b.WriteString(kind + ":" + sum + "\n")
+	}
+	if err := rows.Err(); err != nil {
+		return [32]byte{}, err
+	}
+	return chain.Keccak256([]byte(b.String())), nil
+}
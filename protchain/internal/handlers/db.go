@@ -0,0 +1,15 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+)
+
+// dbContext returns the context for the database calls made while serving
+// c. It carries the request's trace, so queries show up under the route's
+// span, but is not cancelled when the client disconnects: a write
+// abandoned halfway through a handler is worse than a wasted one.
+func dbContext(c *gin.Context) context.Context {
+	return context.WithoutCancel(c.Request.Context())
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"protchain/internal/database"
+
+	"github.com/XSAM/otelsql"
+)
+
+// fakeRows is a canned result set for queries containing match. A
+// non-nil err fails the query instead.
+type fakeRows struct {
+	match   string
+	columns []string
+	rows    [][]driver.Value
+	err     error
+}
+
+// fakeExec is a statement run through Exec, or a query.
+type fakeExec struct {
+	query string
+	args  []driver.Value
+}
+
+// fakeDB is a database/sql driver that answers queries from canned result
+// sets, so handler code can be exercised without Postgres. The first
+// result whose match is a substring of the query wins; any other query
+// fails the test. Execs succeed. Both are recorded.
+type fakeDB struct {
+	t       *testing.T
+	results []fakeRows
+
+	mu      sync.Mutex
+	execs   []fakeExec
+	queries []fakeExec
+}
+
+func newFakeDB(t *testing.T, results ...fakeRows) (*sql.DB, *fakeDB) {
+	f := &fakeDB{t: t, results: results}
+	db := sql.OpenDB(f)
+	t.Cleanup(func() { db.Close() })
+	return db, f
+}
+
+// newTracedFakeDB is newFakeDB wrapped in otelsql as the server wraps
+// Postgres.
+func newTracedFakeDB(t *testing.T, results ...fakeRows) (*sql.DB, *fakeDB) {
+	f := &fakeDB{t: t, results: results}
+	db := otelsql.OpenDB(f, database.TracingOptions()...)
+	t.Cleanup(func() { db.Close() })
+	return db, f
+}
+
+// exec returns the first recorded exec containing match, or nil.
+func (f *fakeDB) exec(match string) *fakeExec {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return findStatement(f.execs, match)
+}
+
+// query returns the first recorded query containing match, or nil.
+func (f *fakeDB) query(match string) *fakeExec {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return findStatement(f.queries, match)
+}
+
+func findStatement(statements []fakeExec, match string) *fakeExec {
+	for i := range statements {
+		if strings.Contains(statements[i].query, match) {
+			return &statements[i]
+		}
+	}
+	return nil
+}
+
+func recordStatement(query string, args []driver.NamedValue) fakeExec {
+	e := fakeExec{query: query}
+	for _, a := range args {
+		e.args = append(e.args, a.Value)
+	}
+	return e
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) { return fakeConn{f}, nil }
+func (f *fakeDB) Driver() driver.Driver                        { return fakeDriver{f} }
+
+type fakeDriver struct{ f *fakeDB }
+
+func (d fakeDriver) Open(string) (driver.Conn, error) { return fakeConn(d), nil }
+
+type fakeConn struct{ f *fakeDB }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("fakedb: prepared statements are not supported")
+}
+func (c fakeConn) Close() error              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+func (c fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.f.mu.Lock()
+	c.f.queries = append(c.f.queries, recordStatement(query, args))
+	c.f.mu.Unlock()
+	for _, r := range c.f.results {
+		if strings.Contains(query, r.match) {
+			if r.err != nil {
+				return nil, r.err
+			}
+			return &fakeCursor{columns: r.columns, rows: r.rows}, nil
+		}
+	}
+	c.f.t.Errorf("fakedb: unexpected query:\n%s", query)
+	return nil, fmt.Errorf("fakedb: unexpected query")
+}
+
+func (c fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.f.mu.Lock()
+	c.f.execs = append(c.f.execs, recordStatement(query, args))
+	c.f.mu.Unlock()
+	return driver.RowsAffected(1), nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeCursor struct {
+	columns []string
+	rows    [][]driver.Value
+	next    int
+}
+
+func (r *fakeCursor) Columns() []string { return r.columns }
+func (r *fakeCursor) Close() error      { return nil }
+
+func (r *fakeCursor) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
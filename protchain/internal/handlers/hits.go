@@ -0,0 +1,510 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"protchain/internal/audit"
+	"protchain/internal/chain"
+	"protchain/internal/dto"
+	"protchain/internal/merkle"
+	"protchain/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+const hitBatchColumns = `id, workflow_id, stage_result_id, root, leaf_count, status, chain_id, contract_address,
+	tx_hash, block_number, numeric_id::text, gas_used, error, created_by, created_at, anchored_at`
+
+// hitLeaf is one screening hit as hashed into a batch.
+type hitLeaf struct {
+	compoundID string
+	data       []byte
+}
+
+// AnchorHits builds a Merkle tree over the hits of the latest virtual
+// screening run and records its root on the verifier contract in a single
+// transaction. Anchoring unchanged hits again returns the existing batch;
+// a batch whose transaction is still unconfirmed is resumed.
+func (h *ProvenanceHandler) AnchorHits(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := authorizeWorkflow(c, h.authz, id, models.PermissionEdit); !ok {
+		return
+	}
+	if h.chain == nil || !h.chain.CanSign() {
+		c.JSON(http.StatusServiceUnavailable, dto.ErrorResponse{Success: false, Error: "Blockchain commits are not configured on this server"})
+		return
+	}
+
+	var (
+		resultID int
+		raw      []byte
+	)
+	err := h.db.QueryRowContext(dbContext(c), `
+		SELECT id, result FROM workflow_stage_results
+		WHERE workflow_id = $1 AND stage = $2 AND status = $3
+		ORDER BY run_number DESC LIMIT 1
+	`, id, models.StageVirtualScreening, models.ResultSucceeded).Scan(&resultID, &raw)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Success: false, Error: "Workflow has no successful virtual screening run"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return
+	}
+
+	leaves, err := screeningHits(raw)
+	if err != nil {
+		logf(c, "AnchorHits: failed to read hits of stage result %d: %v", resultID, err)
+		c.JSON(http.StatusUnprocessableEntity, dto.ErrorResponse{Success: false, Error: "Virtual screening result has no readable hits"})
+		return
+	}
+	if len(leaves) == 0 {
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Success: false, Error: "Virtual screening found no hits to anchor"})
+		return
+	}
+
+	batchID, err := h.storeHitBatch(dbContext(c), id, resultID, userID, leaves)
+	if err != nil {
+		logf(c, "AnchorHits: failed to store hit batch for workflow %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to store hit batch"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	tx, err := h.db.BeginTx(dbContext(c), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Hold the batch row while broadcasting so concurrent requests cannot
+	// anchor the same root twice
+	var (
+		status, root string
+		txHash       sql.NullString
+	)
+	err = tx.QueryRowContext(dbContext(c), `
+		SELECT status, root, tx_hash FROM hit_batches WHERE id = $1 FOR UPDATE NOWAIT
+	`, batchID).Scan(&status, &root, &txHash)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "55P03" {
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Success: false, Error: "These hits are already being anchored"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return
+	}
+
+	switch {
+	case status == models.CommitConfirmed:
+		tx.Rollback()
+		h.respondHitBatch(c, http.StatusOK, batchID, "Hits are already anchored")
+		return
+	case status == models.CommitPending && txHash.Valid:
+		tx.Rollback()
+		h.awaitHitBatch(c, id, batchID, txHash.String)
+		return
+	}
+
+	chainID, err := h.chain.ChainID(ctx)
+	if err != nil {
+		logf(c, "AnchorHits: failed to reach chain: %v", err)
+		c.JSON(http.StatusBadGateway, dto.ErrorResponse{Success: false, Error: "Failed to reach blockchain node"})
+		return
+	}
+	rootHash, err := parseHash(root)
+	if err != nil {
+		logf(c, "AnchorHits: batch %d has a malformed root: %v", batchID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to anchor hits"})
+		return
+	}
+	inputs, err := moleculeDataHash(ctx, h.db, id)
+	if err != nil {
+		logf(c, "AnchorHits: failed to hash inputs of workflow %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return
+	}
+
+	sent, sendErr := h.chain.RecordScreeningResult(ctx, rootHash, inputs, fmt.Sprintf("workflow-%d/hits/batch-%d", id, batchID))
+	if sendErr != nil {
+		logf(c, "AnchorHits: failed to send transaction for batch %d: %v", batchID, sendErr)
+		_, err = tx.ExecContext(dbContext(c), `UPDATE hit_batches SET status = $1, error = $2 WHERE id = $3`, models.CommitFailed, sendErr.Error(), batchID)
+	} else {
+		_, err = tx.ExecContext(dbContext(c), `
+			UPDATE hit_batches
+			SET status = $1, error = NULL, tx_hash = $2, chain_id = $3, contract_address = $4
+			WHERE id = $5
+		`, models.CommitPending, sent, chainID.Int64(), h.chain.Contract(), batchID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		logf(c, "AnchorHits: failed to update batch %d: %v", batchID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to record hit batch"})
+		return
+	}
+	if sendErr != nil {
+		c.JSON(http.StatusBadGateway, dto.ErrorResponse{Success: false, Error: "Failed to submit blockchain transaction: " + sendErr.Error()})
+		return
+	}
+
+	h.awaitHitBatch(c, id, batchID, sent)
+}
+
+// storeHitBatch saves the tree over leaves, returning the ID of the batch.
+// A batch with the same root is reused.
+func (h *ProvenanceHandler) storeHitBatch(ctx context.Context, workflowID, resultID int, userID interface{}, leaves []hitLeaf) (int, error) {
+	hashes := make([][32]byte, len(leaves))
+	for i, l := range leaves {
+		hashes[i] = merkle.LeafHash(l.data)
+	}
+	tree := merkle.New(hashes)
+	root := tree.Root()
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var batchID int
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO hit_batches (workflow_id, stage_result_id, root, leaf_count, status, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (workflow_id, root) DO NOTHING
+		RETURNING id
+	`, workflowID, resultID, "0x"+hex.EncodeToString(root[:]), len(leaves), models.CommitPending, userID, time.Now()).Scan(&batchID)
+	if err == sql.ErrNoRows {
+		err = tx.QueryRowContext(ctx, `
+			SELECT id FROM hit_batches WHERE workflow_id = $1 AND root = $2
+		`, workflowID, "0x"+hex.EncodeToString(root[:])).Scan(&batchID)
+		return batchID, err
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	positions := make([]int64, len(leaves))
+	ids := make([]string, len(leaves))
+	data := make([]string, len(leaves))
+	for i, l := range leaves {
+		positions[i], ids[i], data[i] = int64(i), l.compoundID, string(l.data)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO hit_leaves (batch_id, position, compound_id, data)
+		SELECT $1, unnest($2::int[]), unnest($3::text[]), unnest($4::text[])
+	`, batchID, pq.Array(positions), pq.Array(ids), pq.Array(data)); err != nil {
+		return 0, err
+	}
+
+	var levels, nodePositions []int64
+	var nodes [][]byte
+	for level, hs := range tree.Levels() {
+		for pos, hash := range hs {
+			levels = append(levels, int64(level))
+			nodePositions = append(nodePositions, int64(pos))
+			nodes = append(nodes, append([]byte(nil), hash[:]...))
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO hit_tree_nodes (batch_id, level, position, hash)
+		SELECT $1, unnest($2::int[]), unnest($3::int[]), unnest($4::bytea[])
+	`, batchID, pq.Array(levels), pq.Array(nodePositions), pq.Array(nodes)); err != nil {
+		return 0, err
+	}
+
+	return batchID, tx.Commit()
+}
+
+// awaitHitBatch waits for a batch's transaction and records the receipt.
+func (h *ProvenanceHandler) awaitHitBatch(c *gin.Context, workflowID, batchID int, txHash string) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.confirmTimeout)
+	defer cancel()
+
+	receipt, err := h.chain.WaitForReceipt(ctx, txHash)
+	if errors.Is(err, chain.ErrReverted) {
+		if _, uerr := h.db.ExecContext(dbContext(c), `
+			UPDATE hit_batches SET status = $1, error = 'transaction reverted', block_number = $2, gas_used = $3
+			WHERE id = $4
+		`, models.CommitFailed, int64(receipt.BlockNumber), int64(receipt.GasUsed), batchID); uerr != nil {
+			logf(c, "awaitHitBatch: failed to mark batch %d reverted: %v", batchID, uerr)
+		}
+		c.JSON(http.StatusBadGateway, dto.ErrorResponse{Success: false, Error: "Transaction " + txHash + " reverted on chain"})
+		return
+	}
+	if err != nil {
+		logf(c, "awaitHitBatch: transaction %s for batch %d not confirmed yet: %v", txHash, batchID, err)
+		h.respondHitBatch(c, http.StatusAccepted, batchID, "Transaction submitted but not confirmed yet; anchor again to resume waiting")
+		return
+	}
+
+	tx, err := h.db.BeginTx(dbContext(c), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var (
+		root      string
+		leafCount int
+	)
+	err = tx.QueryRowContext(dbContext(c), `
+		UPDATE hit_batches
+		SET status = $1, block_number = $2, numeric_id = $3, gas_used = $4, anchored_at = $5
+		WHERE id = $6
+		RETURNING root, leaf_count
+	`, models.CommitConfirmed, int64(receipt.BlockNumber), receipt.NumericID.String(), int64(receipt.GasUsed),
+		time.Now(), batchID).Scan(&root, &leafCount)
+	if err != nil {
+		logf(c, "awaitHitBatch: failed to confirm batch %d: %v", batchID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to record hit batch"})
+		return
+	}
+
+	err = recordActivity(c, tx, audit.Entry{
+		Action:     audit.WorkflowHitsAnchored,
+		WorkflowID: &workflowID,
+		TargetType: audit.TargetWorkflow,
+		TargetID:   &workflowID,
+		After: map[string]interface{}{
+			"batch_id":     batchID,
+			"root":         root,
+			"leaf_count":   leafCount,
+			"tx_hash":      txHash,
+			"block_number": receipt.BlockNumber,
+			"numeric_id":   receipt.NumericID.String(),
+		},
+	})
+	if err != nil {
+		logf(c, "awaitHitBatch: failed to record activity for workflow %d: %v", workflowID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to record hit batch"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to commit transaction"})
+		return
+	}
+
+	h.respondHitBatch(c, http.StatusOK, batchID, "Hits anchored on chain")
+}
+
+func (h *ProvenanceHandler) respondHitBatch(c *gin.Context, status, batchID int, message string) {
+	b, err := h.loadHitBatch(dbContext(c), `id = $1`, batchID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return
+	}
+	c.JSON(status, dto.SuccessResponse{Success: true, Message: message, Data: b})
+}
+
+// GetHitProof returns the Merkle inclusion proof of one compound's hit.
+// It uses the newest anchored batch unless batch_id is given.
+func (h *ProvenanceHandler) GetHitProof(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := authorizeWorkflow(c, h.authz, id, models.PermissionView); !ok {
+		return
+	}
+	compound := c.Param("compound")
+
+	var batchFilter sql.NullInt64
+	if raw := c.Query("batch_id"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: "Invalid batch_id parameter: must be a positive integer"})
+			return
+		}
+		batchFilter = sql.NullInt64{Int64: int64(n), Valid: true}
+	}
+
+	batch, err := h.loadHitBatch(dbContext(c), `workflow_id = $1 AND ($2::int IS NULL OR id = $2)
+		ORDER BY (status = 'confirmed') DESC, created_at DESC LIMIT 1`, id, batchFilter)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "No hit batch found for this workflow"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return
+	}
+
+	resp := dto.HitProofResponse{
+		CompoundID:      compound,
+		Root:            batch.Root,
+		Algorithm:       merkle.Algorithm,
+		BatchID:         batch.ID,
+		Anchored:        batch.Status == models.CommitConfirmed,
+		ChainID:         batch.ChainID,
+		ContractAddress: batch.ContractAddress,
+		TxHash:          batch.TxHash,
+		BlockNumber:     batch.BlockNumber,
+		NumericID:       batch.NumericID,
+		Proof:           []dto.MerkleProofStep{},
+	}
+	err = h.db.QueryRowContext(dbContext(c), `
+		SELECT position, data FROM hit_leaves WHERE batch_id = $1 AND compound_id = $2
+	`, batch.ID, compound).Scan(&resp.LeafIndex, &resp.LeafData)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "Compound is not in the hit batch"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return
+	}
+
+	siblings := merkle.Siblings(resp.LeafIndex, batch.LeafCount)
+	levels := make([]int64, len(siblings))
+	positions := make([]int64, len(siblings))
+	for i, s := range siblings {
+		levels[i], positions[i] = int64(s.Level), int64(s.Position)
+	}
+	rows, err := h.db.QueryContext(dbContext(c), `
+		SELECT level, position, hash FROM hit_tree_nodes
+		WHERE batch_id = $1 AND (level, position) IN (SELECT * FROM unnest($2::int[], $3::int[]))
+	`, batch.ID, pq.Array(levels), pq.Array(positions))
+	if err != nil {
+		logf(c, "GetHitProof: failed to load nodes of batch %d: %v", batch.ID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	nodes := make(map[[2]int][32]byte, len(siblings))
+	for rows.Next() {
+		var (
+			level, pos int
+			hash       []byte
+		)
+		if err := rows.Scan(&level, &pos, &hash); err != nil {
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+			return
+		}
+		var h32 [32]byte
+		copy(h32[:], hash)
+		nodes[[2]int{level, pos}] = h32
+	}
+
+	leaf := merkle.LeafHash([]byte(resp.LeafData))
+	resp.LeafHash = "0x" + hex.EncodeToString(leaf[:])
+	proof := make([]merkle.Step, 0, len(siblings))
+	for _, s := range siblings {
+		hash, ok := nodes[[2]int{s.Level, s.Position}]
+		if !ok {
+			logf(c, "GetHitProof: batch %d is missing node %d/%d", batch.ID, s.Level, s.Position)
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Stored hit tree is incomplete"})
+			return
+		}
+		proof = append(proof, merkle.Step{Hash: hash, Left: s.Left})
+		position := "right"
+		if s.Left {
+			position = "left"
+		}
+		resp.Proof = append(resp.Proof, dto.MerkleProofStep{Hash: "0x" + hex.EncodeToString(hash[:]), Position: position})
+	}
+
+	// Never hand out a proof that would not verify
+	root, err := parseHash(batch.Root)
+	if err != nil || !merkle.Verify(leaf, proof, root) {
+		logf(c, "GetHitProof: proof for %q does not match root of batch %d", compound, batch.ID)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Stored hit tree is inconsistent"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Success: true, Data: resp})
+}
+
+func (h *ProvenanceHandler) loadHitBatch(ctx context.Context, where string, args ...interface{}) (*models.HitBatch, error) {
+	var b models.HitBatch
+	err := h.db.QueryRowContext(ctx, `SELECT `+hitBatchColumns+` FROM hit_batches WHERE `+where, args...).Scan(
+		&b.ID, &b.WorkflowID, &b.StageResultID, &b.Root, &b.LeafCount, &b.Status, &b.ChainID, &b.ContractAddress,
+		&b.TxHash, &b.BlockNumber, &b.NumericID, &b.GasUsed, &b.Error, &b.CreatedBy, &b.CreatedAt, &b.AnchoredAt)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// screeningHits extracts the hits of a virtual screening result, keyed by
+// compound name and sorted so the tree does not depend on score order.
+// Duplicate names get a "#n" suffix.
+func screeningHits(raw []byte) ([]hitLeaf, error) {
+	var body struct {
+		TopCompounds []json.RawMessage `json:"top_compounds"`
+		Data         *struct {
+			TopCompounds []json.RawMessage `json:"top_compounds"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return nil, err
+	}
+	hits := body.TopCompounds
+	if body.Data != nil {
+		hits = body.Data.TopCompounds
+	}
+
+	leaves := make([]hitLeaf, 0, len(hits))
+	seen := make(map[string]int)
+	for i, hit := range hits {
+		var key struct {
+			Name   string `json:"name"`
+			SMILES string `json:"smiles"`
+		}
+		if err := json.Unmarshal(hit, &key); err != nil {
+			return nil, fmt.Errorf("hit %d: %w", i, err)
+		}
+		id := key.Name
+		if id == "" {
+			id = key.SMILES
+		}
+		if id == "" {
+			id = fmt.Sprintf("hit-%d", i+1)
+		}
+		if n := seen[id]; n > 0 {
+			seen[id] = n + 1
+			id = fmt.Sprintf("%s#%d", id, n+1)
+		} else {
+			seen[id] = 1
+		}
+
+		data, err := canonicalJSON(hit)
+		if err != nil {
+			return nil, fmt.Errorf("hit %d: %w", i, err)
+		}
+		leaves = append(leaves, hitLeaf{compoundID: id, data: data})
+	}
+
+	sort.Slice(leaves, func(i, j int) bool { return leaves[i].compoundID < leaves[j].compoundID })
+	return leaves, nil
+}
+
+// parseHash decodes a 0x-prefixed 32-byte hex hash.
+func parseHash(s string) ([32]byte, error) {
+	var out [32]byte
+	if len(s) != 66 || s[:2] != "0x" {
+		return out, fmt.Errorf("invalid hash %q", s)
+	}
+	_, err := hex.Decode(out[:], []byte(s[2:]))
+	return out, err
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"protchain/internal/authz"
+	"protchain/internal/dto"
+	"protchain/internal/merkle"
+	"protchain/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestGetHitProofMatchesTree checks that a proof assembled from stored
+// nodes, laid out the way AnchorHits stores them, is the proof the tree
+// itself gives, including for the carried-up last leaf.
+func TestGetHitProofMatchesTree(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	data := []string{
+		`{"compound":"L1","score":-9.1}`,
+		`{"compound":"L2","score":-8.7}`,
+		`{"compound":"L3","score":-8.2}`,
+		`{"compound":"L4","score":-7.9}`,
+		`{"compound":"L5","score":-7.5}`,
+	}
+	hashes := make([][32]byte, len(data))
+	for i, d := range data {
+		hashes[i] = merkle.LeafHash([]byte(d))
+	}
+	tree := merkle.New(hashes)
+	root := tree.Root()
+
+	var nodeRows [][]driver.Value
+	for level, hs := range tree.Levels() {
+		for pos, h := range hs {
+			nodeRows = append(nodeRows, []driver.Value{int64(level), int64(pos), append([]byte(nil), h[:]...)})
+		}
+	}
+	batchRow := []driver.Value{
+		int64(11), int64(42), nil, "0x" + hex.EncodeToString(root[:]), int64(len(data)), models.CommitConfirmed,
+		int64(1337), "0x5fbdb2315678afecb367f032d93f642f64180aa3", "0xabc", int64(99), "4", int64(50000), nil,
+		int64(3), time.Now(), time.Now(),
+	}
+
+	for i := range data {
+		t.Run(fmt.Sprintf("leaf %d", i), func(t *testing.T) {
+			db, _ := newFakeDB(t,
+				fakeRows{
+					match:   "SELECT user_id FROM workflows WHERE id",
+					columns: []string{"user_id"},
+					rows:    [][]driver.Value{{int64(3)}},
+				},
+				fakeRows{
+					match: "FROM hit_batches WHERE",
+					columns: []string{"id", "workflow_id", "stage_result_id", "root", "leaf_count", "status", "chain_id",
+						"contract_address", "tx_hash", "block_number", "numeric_id", "gas_used", "error", "created_by",
+						"created_at", "anchored_at"},
+					rows: [][]driver.Value{batchRow},
+				},
+				fakeRows{
+					match:   "FROM hit_leaves WHERE batch_id",
+					columns: []string{"position", "data"},
+					rows:    [][]driver.Value{{int64(i), data[i]}},
+				},
+				fakeRows{
+					match:   "FROM hit_tree_nodes",
+					columns: []string{"level", "position", "hash"},
+					rows:    nodeRows,
+				},
+			)
+			h := NewProvenanceHandler(db, nil, nil, authz.New(db), 0, 0)
+
+			r := gin.New()
+			r.Use(func(c *gin.Context) { c.Set("user_id", 3) })
+			r.GET("/workflows/:id/hits/:compound/proof", h.GetHitProof)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/workflows/42/hits/L%d/proof", i+1), nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+
+			var body struct {
+				Data dto.HitProofResponse `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if body.Data.LeafIndex != i || body.Data.LeafHash != "0x"+hex.EncodeToString(hashes[i][:]) {
+				t.Errorf("leaf = %d %s, want %d %x", body.Data.LeafIndex, body.Data.LeafHash, i, hashes[i])
+			}
+
+			want := tree.Proof(i)
+			if len(body.Data.Proof) != len(want) {
+				t.Fatalf("proof has %d steps, want %d", len(body.Data.Proof), len(want))
+			}
+			for k, step := range want {
+				position := "right"
+				if step.Left {
+					position = "left"
+				}
+				got := body.Data.Proof[k]
+				if got.Hash != "0x"+hex.EncodeToString(step.Hash[:]) || got.Position != position {
+					t.Errorf("step %d = %+v, want %x on the %s", k, got, step.Hash, position)
+				}
+			}
+		})
+	}
+}
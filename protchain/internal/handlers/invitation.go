@@ -0,0 +1,408 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	"protchain/internal/audit"
+	"protchain/internal/dto"
+	"protchain/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// createInvitation stores a pending invitation of email to orgID, or to
+// teamID within it when teamID is set, and responds 201 with its token.
+// An email is not invited where it is already a member, and has at most
+// one pending invitation to each organization and team; a lapsed one the
+// sweeper has not reached yet is expired on the spot.
+func (h *TeamHandler) createInvitation(c *gin.Context, orgID int, teamID *int, email, role string) {
+	userID, _ := c.Get("user_id")
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	var isMember bool
+	var err error
+	if teamID != nil {
+		err = h.db.QueryRowContext(dbContext(c), `
+			SELECT EXISTS (
+				SELECT 1 FROM team_members m JOIN users u ON u.id = m.user_id
+				WHERE m.team_id = $1 AND lower(u.email) = $2
+			)
+		`, *teamID, email).Scan(&isMember)
+	} else {
+		err = h.db.QueryRowContext(dbContext(c), `
+			SELECT EXISTS (
+				SELECT 1 FROM organization_members m JOIN users u ON u.id = m.user_id
+				WHERE m.organization_id = $1 AND lower(u.email) = $2
+			)
+		`, orgID, email).Scan(&isMember)
+	}
+	if err != nil {
+		logf(c, "createInvitation: failed to check membership of %s in org %d: %v", email, orgID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to create invitation"})
+		return
+	}
+	if isMember {
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Success: false, Error: email + " is already a member"})
+		return
+	}
+
+	tx, err := h.db.BeginTx(dbContext(c), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(dbContext(c), `
+		UPDATE invitations SET status = $1, updated_at = NOW()
+		WHERE organization_id = $2 AND team_id IS NOT DISTINCT FROM $3::int AND lower(email) = $4
+		  AND status = $5 AND expires_at <= NOW()
+	`, models.InvitationExpired, orgID, teamID, email, models.InvitationPending)
+	if err != nil {
+		logf(c, "createInvitation: failed to expire lapsed invitations of %s in org %d: %v", email, orgID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to create invitation"})
+		return
+	}
+
+	token := generateInvitationToken()
+	expiresAt := time.Now().Add(h.inviteTTL)
+
+	var invitationID int
+	err = tx.QueryRowContext(dbContext(c), `
+		INSERT INTO invitations (organization_id, team_id, email, role, token, invited_by, status, expires_at, sent_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW(), NOW(), NOW())
+		RETURNING id
+	`, orgID, teamID, email, role, token, userID, models.InvitationPending, expiresAt).Scan(&invitationID)
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, dto.ErrorResponse{
+			Success: false,
+			Error:   "A pending invitation has already been sent to " + email + "; resend it instead",
+		})
+		return
+	}
+	if err != nil {
+		logf(c, "createInvitation: failed to insert invitation for org %d: %v", orgID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to create invitation"})
+		return
+	}
+
+	action := audit.OrganizationMemberInvited
+	if teamID != nil {
+		action = audit.TeamMemberInvited
+	}
+	err = recordActivity(c, tx, audit.Entry{
+		Action:         action,
+		OrganizationID: &orgID,
+		TeamID:         teamID,
+		TargetType:     audit.TargetInvitation,
+		TargetID:       &invitationID,
+		After:          map[string]interface{}{"email": email, "role": role, "expires_at": expiresAt},
+	})
+	if err != nil {
+		logf(c, "createInvitation: failed to record activity for org %d: %v", orgID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to create invitation"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.SuccessResponse{
+		Success: true,
+		Data: gin.H{
+			"id":         invitationID,
+			"token":      token,
+			"email":      email,
+			"role":       role,
+			"team_id":    teamID,
+			"expires_at": expiresAt,
+		},
+	})
+}
+
+// InviteToTeam invites an email to a team of the organization. Accepting
+// also makes the invitee a member of the organization.
+func (h *TeamHandler) InviteToTeam(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	orgID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	teamID, ok := parseIDParam(c, "teamId")
+	if !ok {
+		return
+	}
+
+	if !isOrganizationAdmin(c, h.db, orgID, userID) {
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Success: false, Error: "Only admins can invite team members"})
+		return
+	}
+
+	var req dto.InviteToTeamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: err.Error()})
+		return
+	}
+
+	var exists bool
+	err := h.db.QueryRowContext(dbContext(c), `
+		SELECT EXISTS (SELECT 1 FROM teams WHERE id = $1 AND organization_id = $2)
+	`, teamID, orgID).Scan(&exists)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to fetch team"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "Team not found"})
+		return
+	}
+
+	h.createInvitation(c, orgID, &teamID, req.Email, req.Role)
+}
+
+// ListOrganizationInvitations lists the invitations to an organization and
+// its teams, newest first. The status query parameter filters them and
+// defaults to pending; "all" lists every status.
+func (h *TeamHandler) ListOrganizationInvitations(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	orgID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if !isOrganizationAdmin(c, h.db, orgID, userID) {
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Success: false, Error: "Only admins can view invitations"})
+		return
+	}
+
+	var status sql.NullString
+	switch s := c.DefaultQuery("status", models.InvitationPending); s {
+	case "all":
+	case models.InvitationPending, models.InvitationAccepted, models.InvitationDeclined,
+		models.InvitationRevoked, models.InvitationExpired:
+		status = sql.NullString{String: s, Valid: true}
+	default:
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: "Invalid status filter"})
+		return
+	}
+	page, perPage, offset := parsePagination(c)
+
+	var total int
+	if err := h.db.QueryRowContext(dbContext(c), `
+		SELECT COUNT(*) FROM invitations
+		WHERE organization_id = $1 AND ($2::text IS NULL OR status = $2)
+	`, orgID, status).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to fetch invitations"})
+		return
+	}
+
+	rows, err := h.db.QueryContext(dbContext(c), `
+		SELECT i.id, i.organization_id, i.team_id, t.name, i.email, i.role, i.status, i.expires_at,
+		       i.created_at, COALESCE(i.sent_at, i.created_at), i.send_count,
+		       u.id, u.email, u.first_name, u.last_name
+		FROM invitations i
+		JOIN users u ON i.invited_by = u.id
+		LEFT JOIN teams t ON i.team_id = t.id
+		WHERE i.organization_id = $1 AND ($2::text IS NULL OR i.status = $2)
+		ORDER BY i.created_at DESC
+		LIMIT $3 OFFSET $4
+	`, orgID, status, perPage, offset)
+	if err != nil {
+		logf(c, "ListOrganizationInvitations: failed to query org %d: %v", orgID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to fetch invitations"})
+		return
+	}
+	defer rows.Close()
+
+	invitations := make([]dto.InvitationResponse, 0)
+	for rows.Next() {
+		var inv dto.InvitationResponse
+		if err := rows.Scan(&inv.ID, &inv.OrganizationID, &inv.TeamID, &inv.TeamName, &inv.Email, &inv.Role,
+			&inv.Status, &inv.ExpiresAt, &inv.CreatedAt, &inv.SentAt, &inv.SendCount,
+			&inv.InvitedBy.ID, &inv.InvitedBy.Email, &inv.InvitedBy.FirstName, &inv.InvitedBy.LastName); err != nil {
+			logf(c, "ListOrganizationInvitations: failed to scan invitation: %v", err)
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to fetch invitations"})
+			return
+		}
+		invitations = append(invitations, inv)
+	}
+
+	c.JSON(http.StatusOK, dto.PaginatedResponse{
+		Success: true,
+		Data:    invitations,
+		Pagination: dto.PaginationMeta{
+			Page: page, PerPage: perPage, Total: total, TotalPages: totalPages(total, perPage),
+		},
+	})
+}
+
+// RevokeInvitation withdraws a pending invitation so its token can no
+// longer be accepted.
+func (h *TeamHandler) RevokeInvitation(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	orgID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	invitationID, ok := parseIDParam(c, "invitationId")
+	if !ok {
+		return
+	}
+
+	if !isOrganizationAdmin(c, h.db, orgID, userID) {
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Success: false, Error: "Only admins can revoke invitations"})
+		return
+	}
+
+	tx, err := h.db.BeginTx(dbContext(c), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var email string
+	var teamID *int
+	err = tx.QueryRowContext(dbContext(c), `
+		UPDATE invitations SET status = $1, updated_at = NOW()
+		WHERE id = $2 AND organization_id = $3 AND status = $4
+		RETURNING email, team_id
+	`, models.InvitationRevoked, invitationID, orgID, models.InvitationPending).Scan(&email, &teamID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "Pending invitation not found"})
+		return
+	}
+	if err != nil {
+		logf(c, "RevokeInvitation: failed to revoke invitation %d: %v", invitationID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to revoke invitation"})
+		return
+	}
+
+	err = recordActivity(c, tx, audit.Entry{
+		Action:         audit.InvitationRevoked,
+		OrganizationID: &orgID,
+		TeamID:         teamID,
+		TargetType:     audit.TargetInvitation,
+		TargetID:       &invitationID,
+		Before:         map[string]interface{}{"status": models.InvitationPending},
+		After:          map[string]interface{}{"status": models.InvitationRevoked, "email": email},
+	})
+	if err != nil {
+		logf(c, "RevokeInvitation: failed to record activity for invitation %d: %v", invitationID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to revoke invitation"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Success: true, Message: "Invitation revoked"})
+}
+
+// ResendInvitation reissues a pending or expired invitation with a new
+// token and a fresh expiry. The previous token stops working.
+func (h *TeamHandler) ResendInvitation(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	orgID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	invitationID, ok := parseIDParam(c, "invitationId")
+	if !ok {
+		return
+	}
+
+	if !isOrganizationAdmin(c, h.db, orgID, userID) {
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Success: false, Error: "Only admins can resend invitations"})
+		return
+	}
+
+	tx, err := h.db.BeginTx(dbContext(c), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	token := generateInvitationToken()
+	expiresAt := time.Now().Add(h.inviteTTL)
+
+	var inv struct {
+		Email     string
+		Role      string
+		TeamID    *int
+		Status    string
+		SendCount int
+	}
+	err = tx.QueryRowContext(dbContext(c), `
+		SELECT email, role, team_id, status FROM invitations
+		WHERE id = $1 AND organization_id = $2 AND status IN ($3, $4)
+		FOR UPDATE
+	`, invitationID, orgID, models.InvitationPending, models.InvitationExpired).Scan(
+		&inv.Email, &inv.Role, &inv.TeamID, &inv.Status)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "Pending or expired invitation not found"})
+		return
+	}
+	if err != nil {
+		logf(c, "ResendInvitation: failed to fetch invitation %d: %v", invitationID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to resend invitation"})
+		return
+	}
+
+	err = tx.QueryRowContext(dbContext(c), `
+		UPDATE invitations
+		SET token = $1, status = $2, expires_at = $3, sent_at = NOW(), send_count = send_count + 1, updated_at = NOW()
+		WHERE id = $4
+		RETURNING send_count
+	`, token, models.InvitationPending, expiresAt, invitationID).Scan(&inv.SendCount)
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, dto.ErrorResponse{
+			Success: false,
+			Error:   "A newer invitation is already pending for " + inv.Email,
+		})
+		return
+	}
+	if err != nil {
+		logf(c, "ResendInvitation: failed to reissue invitation %d: %v", invitationID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to resend invitation"})
+		return
+	}
+
+	err = recordActivity(c, tx, audit.Entry{
+		Action:         audit.InvitationResent,
+		OrganizationID: &orgID,
+		TeamID:         inv.TeamID,
+		TargetType:     audit.TargetInvitation,
+		TargetID:       &invitationID,
+		Before:         map[string]interface{}{"status": inv.Status},
+		After:          map[string]interface{}{"status": models.InvitationPending, "expires_at": expiresAt, "send_count": inv.SendCount},
+	})
+	if err != nil {
+		logf(c, "ResendInvitation: failed to record activity for invitation %d: %v", invitationID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to resend invitation"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{
+		Success: true,
+		Data: gin.H{
+			"id":         invitationID,
+			"token":      token,
+			"email":      inv.Email,
+			"role":       inv.Role,
+			"team_id":    inv.TeamID,
+			"expires_at": expiresAt,
+			"send_count": inv.SendCount,
+		},
+	})
+}
@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"protchain/internal/audit"
+	"protchain/internal/dto"
+	"protchain/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+func TestInvitationRoles(t *testing.T) {
+	tests := []struct {
+		role string
+		ok   bool
+	}{
+		{models.RoleAdmin, true},
+		{models.RoleMember, true},
+		{models.RoleOwner, false},
+		{"Admin", false},
+		{"superuser", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		reqs := map[string]interface{}{
+			"organization": dto.InviteToOrganizationRequest{Email: "a@example.com", Role: tt.role},
+			"team":         dto.InviteToTeamRequest{Email: "a@example.com", Role: tt.role},
+		}
+		for kind, req := range reqs {
+			if err := binding.Validator.ValidateStruct(req); (err == nil) != tt.ok {
+				t.Errorf("%s invitation with role %q: err = %v, want ok = %v", kind, tt.role, err, tt.ok)
+			}
+		}
+	}
+}
+
+// TestInviteRejectsRoles checks that an admin cannot invite with a role
+// outside the team roles, and that nothing is written when they try.
+func TestInviteRejectsRoles(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for _, path := range []string{"/organizations/5/invite", "/organizations/5/teams/8/invite"} {
+		for _, role := range []string{models.RoleOwner, "superuser"} {
+			t.Run(fmt.Sprintf("%s as %s", path, role), func(t *testing.T) {
+				db, f := newFakeDB(t, fakeRows{
+					match:   "SELECT role FROM organization_members",
+					columns: []string{"role"},
+					rows:    [][]driver.Value{{models.RoleAdmin}},
+				})
+				h := NewTeamHandler(db, nil, nil, nil, 0)
+
+				r := gin.New()
+				r.Use(func(c *gin.Context) { c.Set("user_id", 3) })
+				r.POST("/organizations/:id/invite", h.InviteToOrganization)
+				r.POST("/organizations/:id/teams/:teamId/invite", h.InviteToTeam)
+				body := fmt.Sprintf(`{"email":"new@example.com","role":%q}`, role)
+				req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+				req.Header.Set("Content-Type", "application/json")
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+
+				if w.Code != http.StatusBadRequest {
+					t.Errorf("status = %d, want 400: %s", w.Code, w.Body)
+				}
+				if len(f.execs) != 0 {
+					t.Errorf("rejected invitation wrote to the database: %v", f.execs)
+				}
+			})
+		}
+	}
+}
+
+// TestAcceptInvitationEmail checks that invitations are matched against
+// the account's current email, not the one in the caller's token.
+func TestAcceptInvitationEmail(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name    string
+		invited string
+		want    int
+	}{
+		{"current email", "New@example.com", http.StatusOK},
+		{"email in the token", "old@example.com", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, f := newFakeDB(t,
+				fakeRows{
+					match:   "SELECT email FROM users",
+					columns: []string{"email"},
+					rows:    [][]driver.Value{{"new@example.com"}},
+				},
+				fakeRows{
+					match:   "FROM invitations",
+					columns: []string{"id", "organization_id", "team_id", "email", "role"},
+					rows:    [][]driver.Value{{int64(9), int64(5), nil, tt.invited, models.RoleMember}},
+				},
+			)
+			h := NewTeamHandler(db, nil, nil, nil, 0)
+
+			r := gin.New()
+			r.Use(func(c *gin.Context) {
+				c.Set("user_id", 3)
+				c.Set("email", "old@example.com")
+			})
+			r.POST("/invitations/:token/accept", h.AcceptInvitation)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/invitations/abc/accept", nil))
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			joined := f.exec("INSERT INTO organization_members") != nil
+			if joined != (tt.want == http.StatusOK) {
+				t.Errorf("joined the organization = %v", joined)
+			}
+		})
+	}
+}
+
+func TestDeclineInvitationEmail(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, f := newFakeDB(t,
+		fakeRows{
+			match:   "SELECT email FROM users",
+			columns: []string{"email"},
+			rows:    [][]driver.Value{{"new@example.com"}},
+		},
+		fakeRows{
+			match:   "UPDATE invitations",
+			columns: []string{"id", "organization_id", "team_id"},
+			rows:    [][]driver.Value{{int64(9), int64(5), nil}},
+		},
+	)
+	h := NewTeamHandler(db, nil, nil, nil, 0)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", 3)
+		c.Set("email", "old@example.com")
+	})
+	r.POST("/invitations/:token/decline", h.DeclineInvitation)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/invitations/abc/decline", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	if got := f.query("UPDATE invitations").args[3]; got != "new@example.com" {
+		t.Errorf("declined invitations sent to %v, want the current email", got)
+	}
+}
+
+// TestInvitationAdmins checks that organization owners manage invitations
+// as admins do.
+func TestInvitationAdmins(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name string
+		role []driver.Value
+		want int
+	}{
+		{"admin", []driver.Value{models.RoleAdmin}, http.StatusOK},
+		{"owner", []driver.Value{models.RoleOwner}, http.StatusOK},
+		{"member", []driver.Value{models.RoleMember}, http.StatusForbidden},
+		{"outsider", nil, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roles := fakeRows{match: "SELECT role FROM organization_members", columns: []string{"role"}}
+			if tt.role != nil {
+				roles.rows = [][]driver.Value{tt.role}
+			}
+			db, _ := newFakeDB(t, roles,
+				fakeRows{match: "SELECT COUNT(*) FROM invitations", columns: []string{"count"}, rows: [][]driver.Value{{int64(0)}}},
+				fakeRows{match: "FROM invitations i", columns: make([]string, 15)},
+			)
+			h := NewTeamHandler(db, nil, nil, nil, 0)
+
+			r := gin.New()
+			r.Use(func(c *gin.Context) { c.Set("user_id", 3) })
+			r.GET("/organizations/:id/invitations", h.ListOrganizationInvitations)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/organizations/5/invitations", nil))
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+// TestRevokeInvitation checks that only a pending invitation can be
+// revoked, and that the revocation is audited.
+func TestRevokeInvitation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name    string
+		pending bool
+		want    int
+	}{
+		{"pending", true, http.StatusOK},
+		{"already accepted", false, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			revoked := fakeRows{match: "UPDATE invitations", columns: []string{"email", "team_id"}}
+			if tt.pending {
+				revoked.rows = [][]driver.Value{{"new@example.com", int64(8)}}
+			}
+			db, f := newFakeDB(t,
+				fakeRows{
+					match:   "SELECT role FROM organization_members",
+					columns: []string{"role"},
+					rows:    [][]driver.Value{{models.RoleAdmin}},
+				},
+				revoked,
+			)
+			h := NewTeamHandler(db, nil, nil, nil, 0)
+
+			r := gin.New()
+			r.Use(func(c *gin.Context) { c.Set("user_id", 3) })
+			r.DELETE("/organizations/:id/invitations/:invitationId", h.RevokeInvitation)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/organizations/5/invitations/9", nil))
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if q := f.query("UPDATE invitations"); q == nil || q.args[0] != models.InvitationRevoked || q.args[3] != models.InvitationPending {
+				t.Errorf("revoking ran %+v", q)
+			}
+			logged := f.exec("INSERT INTO activity_log")
+			if (logged != nil) != tt.pending {
+				t.Fatalf("activity recorded = %v", logged != nil)
+			}
+			if logged != nil && logged.args[4] != audit.InvitationRevoked {
+				t.Errorf("recorded action %v", logged.args[4])
+			}
+		})
+	}
+}
+
+func TestListOrganizationInvitationsStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, f := newFakeDB(t, fakeRows{
+		match:   "SELECT role FROM organization_members",
+		columns: []string{"role"},
+		rows:    [][]driver.Value{{models.RoleAdmin}},
+	})
+	h := NewTeamHandler(db, nil, nil, nil, 0)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", 3) })
+	r.GET("/organizations/:id/invitations", h.ListOrganizationInvitations)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/organizations/5/invitations?status=lapsed", nil))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400: %s", w.Code, w.Body)
+	}
+	if q := f.query("FROM invitations"); q != nil {
+		t.Errorf("an invalid filter queried invitations: %s", q.query)
+	}
+}
@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"protchain/internal/authz"
+	"protchain/internal/bioapi"
+	"protchain/internal/dto"
+	"protchain/internal/jobs"
+	"protchain/internal/models"
+	"protchain/internal/quota"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JobHandler struct {
+	db   *sql.DB
+	jobs *jobs.Manager
+}
+
+func NewJobHandler(db *sql.DB, jobManager *jobs.Manager) *JobHandler {
+	return &JobHandler{db: db, jobs: jobManager}
+}
+
+// GetJob returns a single job, including its result once finished
+func (h *JobHandler) GetJob(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	jobID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var j models.Job
+	err := h.db.QueryRowContext(dbContext(c), `
+		SELECT id, workflow_id, type, status, progress, result, error, cache_hit, created_at, started_at, finished_at
+		FROM jobs
+		WHERE id = $1 AND user_id = $2 AND ($3::int IS NULL OR organization_id = $3)
+	`, jobID, userID, keyOrganizationArg(c)).Scan(&j.ID, &j.WorkflowID, &j.Type, &j.Status, &j.Progress, &j.Result, &j.Error, &j.CacheHit,
+		&j.CreatedAt, &j.StartedAt, &j.FinishedAt)
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "Job not found"})
+		return
+	}
+	if err != nil {
+		logf(c, "GetJob: failed to fetch job %d: %v", jobID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to fetch job"})
+		return
+	}
+
+	if j.Status == models.JobSucceeded && jobs.Cacheable(j.Type) {
+		setCacheStatus(c, &bioapi.Response{Cached: j.CacheHit})
+	}
+	c.JSON(http.StatusOK, dto.SuccessResponse{Success: true, Data: jobResponse(j, true)})
+}
+
+// ListJobs returns the caller's jobs, optionally filtered by status and workflow
+func (h *JobHandler) ListJobs(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	page, perPage, offset := parsePagination(c)
+
+	var status sql.NullString
+	if s := c.Query("status"); s != "" {
+		status = sql.NullString{String: s, Valid: true}
+	}
+	var workflowID sql.NullInt64
+	if w := c.Query("workflow_id"); w != "" {
+		id, err := strconv.Atoi(w)
+		if err != nil || id <= 0 {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: "Invalid workflow_id parameter: must be a positive integer"})
+			return
+		}
+		workflowID = sql.NullInt64{Int64: int64(id), Valid: true}
+	}
+	orgID := keyOrganizationArg(c)
+
+	var total int
+	if err := h.db.QueryRowContext(dbContext(c), `
+		SELECT COUNT(*) FROM jobs
+		WHERE user_id = $1 AND ($2::text IS NULL OR status = $2) AND ($3::int IS NULL OR workflow_id = $3)
+		  AND ($4::int IS NULL OR organization_id = $4)
+	`, userID, status, workflowID, orgID).Scan(&total); err != nil {
+		logf(c, "ListJobs: failed to count jobs: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to fetch jobs"})
+		return
+	}
+
+	rows, err := h.db.QueryContext(dbContext(c), `
+		SELECT id, workflow_id, type, status, progress, error, cache_hit, created_at, started_at, finished_at
+		FROM jobs
+		WHERE user_id = $1 AND ($2::text IS NULL OR status = $2) AND ($3::int IS NULL OR workflow_id = $3)
+		  AND ($4::int IS NULL OR organization_id = $4)
+		ORDER BY created_at DESC
+		LIMIT $5 OFFSET $6
+	`, userID, status, workflowID, orgID, perPage, offset)
+	if err != nil {
+		logf(c, "ListJobs: failed to list jobs: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to fetch jobs"})
+		return
+	}
+	defer rows.Close()
+
+	result := make([]dto.JobResponse, 0)
+	for rows.Next() {
+		var j models.Job
+		if err := rows.Scan(&j.ID, &j.WorkflowID, &j.Type, &j.Status, &j.Progress, &j.Error, &j.CacheHit,
+			&j.CreatedAt, &j.StartedAt, &j.FinishedAt); err != nil {
+			logf(c, "ListJobs: failed to scan job: %v", err)
+			continue
+		}
+		result = append(result, jobResponse(j, false))
+	}
+
+	c.JSON(http.StatusOK, dto.PaginatedResponse{
+		Success: true,
+		Data:    result,
+		Pagination: dto.PaginationMeta{
+			Page: page, PerPage: perPage, Total: total, TotalPages: totalPages(total, perPage),
+		},
+	})
+}
+
+// CancelJob cancels a queued or running job
+func (h *JobHandler) CancelJob(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	jobID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if orgID, ok := keyOrganization(c); ok {
+		var in bool
+		err := h.db.QueryRowContext(dbContext(c), `
+			SELECT EXISTS (SELECT 1 FROM jobs WHERE id = $1 AND organization_id = $2)
+		`, jobID, orgID).Scan(&in)
+		if err != nil {
+			logf(c, "CancelJob: failed to check organization of job %d: %v", jobID, err)
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to cancel job"})
+			return
+		}
+		if !in {
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "Job not found"})
+			return
+		}
+	}
+
+	err := h.jobs.Cancel(c.Request.Context(), jobID, userID.(int))
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "Job not found"})
+		return
+	case errors.Is(err, jobs.ErrNotCancellable):
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Success: false, Error: "Job has already finished"})
+		return
+	case err != nil:
+		logf(c, "CancelJob: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to cancel job"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Success: true, Message: "Job cancelled"})
+}
+
+func jobResponse(j models.Job, withResult bool) dto.JobResponse {
+	resp := dto.JobResponse{
+		ID:         j.ID,
+		WorkflowID: j.WorkflowID,
+		Type:       j.Type,
+		Status:     j.Status,
+		Progress:   j.Progress,
+		Error:      j.Error,
+		CacheHit:   j.CacheHit,
+		CreatedAt:  j.CreatedAt,
+		StartedAt:  j.StartedAt,
+		FinishedAt: j.FinishedAt,
+	}
+	if withResult && len(j.Result) > 0 {
+		resp.Result = json.RawMessage(j.Result)
+	}
+	return resp
+}
+
+// submitJob reads a BioAPI request body, checks that the caller may edit
+// any workflow it names, and queues it as an asynchronous job. A job
+// submitted with a service API key and no workflow is billed to the key's
+// organization. It responds 202 with the job ID, or 402/429 if the job
+// exceeds a plan quota.
+func submitJob(c *gin.Context, manager *jobs.Manager, az *authz.Service, jobType string) {
+	userID, _ := c.Get("user_id")
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: "Failed to read request body"})
+		return
+	}
+	if !json.Valid(body) {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: "Request body must be valid JSON"})
+		return
+	}
+
+	workflowID, err := workflowIDFromPayload(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: err.Error()})
+		return
+	}
+	if workflowID != nil {
+		if _, ok := authorizeWorkflow(c, az, *workflowID, models.PermissionEdit); !ok {
+			return
+		}
+	}
+	var orgID *int
+	if id, ok := keyOrganization(c); ok {
+		orgID = &id
+	}
+
+	job, err := manager.Submit(c.Request.Context(), userID.(int), orgID, workflowID, jobType, body, noCache(c))
+	if quotaExceeded(c, err) {
+		return
+	}
+	if errors.Is(err, quota.ErrWorkflowNotFound) {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "Workflow not found"})
+		return
+	}
+	if err != nil {
+		logf(c, "failed to submit %s job: %v", jobType, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to submit job"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, dto.SuccessResponse{
+		Success: true,
+		Data:    jobResponse(*job, false),
+	})
+}
+
+// workflowIDFromPayload extracts the optional workflow_id field that every
+// long-running BioAPI request carries. BioAPI accepts it as a string, but
+// clients also send it as a number.
+func workflowIDFromPayload(body []byte) (*int, error) {
+	var payload struct {
+		WorkflowID json.RawMessage `json:"workflow_id"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, errors.New("Request body must be a JSON object")
+	}
+	if len(payload.WorkflowID) == 0 || string(payload.WorkflowID) == "null" {
+		return nil, nil
+	}
+
+	var raw string
+	if err := json.Unmarshal(payload.WorkflowID, &raw); err != nil {
+		raw = string(payload.WorkflowID)
+	}
+	if raw == "" {
+		return nil, nil
+	}
+	id, err := strconv.Atoi(raw)
+	if err != nil || id <= 0 {
+		return nil, errors.New("Invalid workflow_id: must be a positive integer")
+	}
+	return &id, nil
+}
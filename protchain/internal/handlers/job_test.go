@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"protchain/internal/events"
+	"protchain/internal/jobs"
+	"protchain/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestSubmitJobWithoutWorkflow checks that a job filed under no workflow
+// is stored with the organization of the service key that submitted it.
+func TestSubmitJobWithoutWorkflow(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		keyOrg interface{}
+		// want is the organization_id the job is inserted with
+		want driver.Value
+	}{
+		{"session token", nil, nil},
+		{"organization key", 7, int64(7)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, f := newFakeDB(t, fakeRows{
+				match:   "INSERT INTO jobs",
+				columns: []string{"id", "created_at", "updated_at"},
+				rows:    [][]driver.Value{{int64(1), time.Now(), time.Now()}},
+			})
+			manager := jobs.NewManager(db, events.NewBroker(), nil, 1, time.Minute, 3, jobs.ShardConfig{}, nil)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"binding_site":{}}`))
+			c.Set("user_id", 3)
+			if tt.keyOrg != nil {
+				c.Set("api_key_organization_id", tt.keyOrg)
+			}
+
+			submitJob(c, manager, nil, models.JobVirtualScreening)
+			if w.Code != http.StatusAccepted {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			insert := f.query("INSERT INTO jobs")
+			if insert == nil {
+				t.Fatal("no job inserted")
+			}
+			if got := insert.args[8]; got != tt.want {
+				t.Errorf("job inserted with organization_id %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+
+	"protchain/internal/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestLogger returns a logger tagged with the request ID, route, user
+// and, once authorized, workflow of the current request.
+func requestLogger(c *gin.Context) *slog.Logger {
+	l := logging.FromContext(c.Request.Context()).With("route", c.FullPath())
+	if v, ok := c.Get("user_id"); ok {
+		l = l.With("user_id", v)
+	}
+	if v, ok := c.Get("workflow_id"); ok {
+		l = l.With("workflow_id", v)
+	}
+	return l
+}
+
+// logf logs an error that occurred while serving c.
+func logf(c *gin.Context, format string, args ...interface{}) {
+	requestLogger(c).Error(fmt.Sprintf(format, args...))
+}
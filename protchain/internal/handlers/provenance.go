@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"protchain/internal/audit"
+	"protchain/internal/authz"
+	"protchain/internal/chain"
+	"protchain/internal/dto"
+	"protchain/internal/ipfs"
+	"protchain/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProvenanceHandler publishes workflow bundles to IPFS and anchors them on
+// chain. chain is nil when no verifier contract is configured.
+type ProvenanceHandler struct {
+	db             *sql.DB
+	ipfs           *ipfs.Client
+	chain          *chain.Client
+	authz          *authz.Service
+	maxBundle      int64
+	confirmTimeout time.Duration
+}
+
+func NewProvenanceHandler(db *sql.DB, client *ipfs.Client, chainClient *chain.Client, az *authz.Service, maxBundleBytes int64, confirmTimeout time.Duration) *ProvenanceHandler {
+	return &ProvenanceHandler{
+		db:             db,
+		ipfs:           client,
+		chain:          chainClient,
+		authz:          az,
+		maxBundle:      maxBundleBytes,
+		confirmTimeout: confirmTimeout,
+	}
+}
+
+// PublishWorkflowBundle builds the workflow's canonical bundle, adds and
+// pins it on the IPFS node and records the resulting CID. The CID is what a
+// later blockchain commit must refer to.
+func (h *ProvenanceHandler) PublishWorkflowBundle(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := authorizeWorkflow(c, h.authz, id, models.PermissionEdit); !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	bundle, digest, err := buildBundle(ctx, h.db, id)
+	if err != nil {
+		logf(c, "PublishWorkflowBundle: failed to build bundle for workflow %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to build workflow bundle"})
+		return
+	}
+	if int64(len(bundle)) > h.maxBundle {
+		c.JSON(http.StatusRequestEntityTooLarge, dto.ErrorResponse{Success: false, Error: "Workflow bundle exceeds the publication size limit"})
+		return
+	}
+
+	cid, err := h.ipfs.Add(ctx, fmt.Sprintf("workflow-%d.json", id), bundle, true)
+	if err != nil {
+		logf(c, "PublishWorkflowBundle: failed to add bundle for workflow %d: %v", id, err)
+		c.JSON(http.StatusBadGateway, dto.ErrorResponse{Success: false, Error: "Failed to publish bundle to IPFS"})
+		return
+	}
+
+	tx, err := h.db.BeginTx(dbContext(c), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var prevCID, prevDigest string
+	err = tx.QueryRowContext(dbContext(c), `
+		SELECT COALESCE(ipfs_hash, ''), COALESCE(ipfs_bundle_sha256, '')
+		FROM workflows WHERE id = $1 FOR UPDATE
+	`, id).Scan(&prevCID, &prevDigest)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "Workflow not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to record workflow bundle"})
+		return
+	}
+
+	now := time.Now()
+	_, err = tx.ExecContext(dbContext(c), `
+		UPDATE workflows
+		SET ipfs_hash = $1, ipfs_bundle_sha256 = $2, ipfs_pinned_at = $3, updated_at = $3
+		WHERE id = $4
+	`, cid, digest, now, id)
+	if err != nil {
+		logf(c, "PublishWorkflowBundle: failed to store CID for workflow %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to record workflow bundle"})
+		return
+	}
+
+	before, after := audit.Diff(
+		map[string]interface{}{"ipfs_hash": prevCID, "ipfs_bundle_sha256": prevDigest},
+		map[string]interface{}{"ipfs_hash": cid, "ipfs_bundle_sha256": digest},
+	)
+	err = recordActivity(c, tx, audit.Entry{
+		Action:     audit.WorkflowBundlePublished,
+		WorkflowID: &id,
+		TargetType: audit.TargetWorkflow,
+		TargetID:   &id,
+		Before:     before,
+		After:      after,
+	})
+	if err != nil {
+		logf(c, "PublishWorkflowBundle: failed to record activity for workflow %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to record workflow bundle"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, dto.SuccessResponse{
+		Success: true,
+		Message: "Workflow bundle published",
+		Data: dto.IPFSPublishResponse{
+			CID:       cid,
+			SHA256:    digest,
+			SizeBytes: len(bundle),
+			PinnedAt:  now,
+		},
+	})
+}
+
+// GetWorkflowIPFS re-fetches the published bundle from IPFS and reports
+// whether it still hashes to the recorded digest and whether it matches
+// what the database would produce today.
+func (h *ProvenanceHandler) GetWorkflowIPFS(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := authorizeWorkflow(c, h.authz, id, models.PermissionView); !ok {
+		return
+	}
+
+	var (
+		cid  sql.NullString
+		resp dto.IPFSBundleResponse
+	)
+	err := h.db.QueryRowContext(dbContext(c), `
+		SELECT ipfs_hash, ipfs_bundle_sha256, ipfs_pinned_at FROM workflows WHERE id = $1
+	`, id).Scan(&cid, &resp.SHA256, &resp.PinnedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return
+	}
+	if !cid.Valid || cid.String == "" {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "Workflow has no published bundle"})
+		return
+	}
+	resp.CID = cid.String
+
+	ctx := c.Request.Context()
+	data, err := h.ipfs.Cat(ctx, resp.CID, h.maxBundle)
+	if errors.Is(err, ipfs.ErrTooLarge) {
+		c.JSON(http.StatusBadGateway, dto.ErrorResponse{Success: false, Error: "Published content exceeds the bundle size limit"})
+		return
+	}
+	if err != nil {
+		logf(c, "GetWorkflowIPFS: failed to fetch %s for workflow %d: %v", resp.CID, id, err)
+		c.JSON(http.StatusBadGateway, dto.ErrorResponse{Success: false, Error: "Failed to fetch bundle from IPFS"})
+		return
+	}
+	if st, err := h.ipfs.Stat(ctx, resp.CID); err == nil {
+		resp.SizeBytes = st.CumulativeSize
+	} else {
+		logf(c, "GetWorkflowIPFS: failed to stat %s: %v", resp.CID, err)
+		resp.SizeBytes = int64(len(data))
+	}
+
+	sum := sha256.Sum256(data)
+	fetched := hex.EncodeToString(sum[:])
+	// Bundles published before the digest was recorded cannot be checked
+	resp.Intact = resp.SHA256 != nil && *resp.SHA256 == fetched
+
+	if _, current, err := buildBundle(ctx, h.db, id); err != nil {
+		logf(c, "GetWorkflowIPFS: failed to rebuild bundle for workflow %d: %v", id, err)
+	} else {
+		resp.MatchesCurrent = current == fetched
+	}
+
+	if json.Valid(data) {
+		resp.Bundle = json.RawMessage(data)
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Success: true, Data: resp})
+}
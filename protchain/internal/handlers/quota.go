@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"protchain/internal/dto"
+	"protchain/internal/quota"
+
+	"github.com/gin-gonic/gin"
+)
+
+// quotaExceeded responds to work rejected by a plan quota and reports
+// whether err was such a rejection. A concurrent job limit frees up as
+// jobs finish, so it answers 429; the monthly and storage quotas need a
+// bigger plan or the next billing period, so they answer 402.
+func quotaExceeded(c *gin.Context, err error) bool {
+	var exceeded *quota.ExceededError
+	if !errors.As(err, &exceeded) {
+		return false
+	}
+
+	status := http.StatusPaymentRequired
+	var message string
+	switch exceeded.Resource {
+	case quota.ResourceConcurrentJobs:
+		status = http.StatusTooManyRequests
+		message = fmt.Sprintf("The %s plan runs at most %g jobs at once; wait for one to finish", exceeded.Plan, exceeded.Limit)
+	case quota.ResourceCompounds:
+		message = fmt.Sprintf("This job needs %g compounds but only %g of the %s plan's %g per month remain",
+			exceeded.Requested, remaining(exceeded), exceeded.Plan, exceeded.Limit)
+	case quota.ResourceMDNanoseconds:
+		message = fmt.Sprintf("This job needs %g ns of molecular dynamics but only %g of the %s plan's %g ns per month remain",
+			exceeded.Requested, remaining(exceeded), exceeded.Plan, exceeded.Limit)
+	case quota.ResourceStorageBytes:
+		message = fmt.Sprintf("This file needs %d MB but only %d MB of the %s plan's %d MB of storage remain",
+			int64(exceeded.Requested)>>20, int64(remaining(exceeded))>>20, exceeded.Plan, int64(exceeded.Limit)>>20)
+	default:
+		message = exceeded.Error()
+	}
+
+	c.JSON(status, dto.QuotaErrorResponse{
+		Success: false,
+		Error:   message,
+		Quota: dto.QuotaExceeded{
+			Resource:  exceeded.Resource,
+			Plan:      exceeded.Plan,
+			Limit:     exceeded.Limit,
+			Used:      exceeded.Used,
+			Requested: exceeded.Requested,
+		},
+	})
+	return true
+}
+
+func remaining(e *quota.ExceededError) float64 {
+	if e.Used >= e.Limit {
+		return 0
+	}
+	return e.Limit - e.Used
+}
+
+// usageMetric reports used against limit, which is nil when unlimited.
+func usageMetric(used float64, limit *float64) dto.UsageMetric {
+	m := dto.UsageMetric{Used: used, Limit: limit}
+	if limit != nil {
+		left := *limit - used
+		if left < 0 {
+			left = 0
+		}
+		m.Remaining = &left
+	}
+	return m
+}
+
+// GetOrganizationUsage reports the organization's consumption against the
+// limits of its plan. Any member may view it.
+func (h *TeamHandler) GetOrganizationUsage(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	orgID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var role string
+	err := h.db.QueryRowContext(dbContext(c), `
+		SELECT role FROM organization_members
+		WHERE organization_id = $1 AND user_id = $2
+	`, orgID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "Organization not found"})
+		return
+	}
+	if err != nil {
+		logf(c, "failed to check membership of organization %d: %v", orgID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to fetch usage"})
+		return
+	}
+
+	report, err := h.quotas.Report(dbContext(c), orgID)
+	if err != nil {
+		logf(c, "failed to report usage of organization %d: %v", orgID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to fetch usage"})
+		return
+	}
+
+	plan, usage := report.Plan, report.Usage
+	c.JSON(http.StatusOK, dto.SuccessResponse{
+		Success: true,
+		Data: dto.OrganizationUsageResponse{
+			OrganizationID: orgID,
+			Plan:           plan.Name,
+			PeriodStart:    report.PeriodStart,
+			PeriodEnd:      report.PeriodEnd,
+			ConcurrentJobs: usageMetric(float64(usage.ConcurrentJobs), floatLimit(plan.MaxConcurrentJobs)),
+			Compounds:      usageMetric(float64(usage.Compounds), floatLimit(plan.MaxCompoundsPerMonth)),
+			MDNanoseconds:  usageMetric(usage.MDNanoseconds, plan.MaxMDNsPerMonth),
+			StorageBytes:   usageMetric(float64(usage.StorageBytes), floatLimit(plan.MaxStorageBytes)),
+		},
+	})
+}
+
+func floatLimit(limit *int64) *float64 {
+	if limit == nil {
+		return nil
+	}
+	f := float64(*limit)
+	return &f
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"protchain/internal/dto"
+	"protchain/internal/models"
+)
+
+const stageResultColumns = `id, stage, run_number, status, parameters, result, error, bioapi_version, job_id, started_at, finished_at`
+
+// queryStageResults runs a query selecting stageResultColumns.
+func (h *WorkflowHandler) queryStageResults(ctx context.Context, query string, args ...interface{}) ([]dto.StageResultResponse, error) {
+	rows, err := h.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := make([]dto.StageResultResponse, 0)
+	for rows.Next() {
+		var r models.StageResult
+		if err := rows.Scan(&r.ID, &r.Stage, &r.RunNumber, &r.Status, &r.Parameters, &r.Result, &r.Error,
+			&r.BioAPIVersion, &r.JobID, &r.StartedAt, &r.FinishedAt); err != nil {
+			return nil, err
+		}
+		runs = append(runs, stageResultResponse(r))
+	}
+	return runs, rows.Err()
+}
+
+func stageResultResponse(r models.StageResult) dto.StageResultResponse {
+	resp := dto.StageResultResponse{
+		ID:            r.ID,
+		Stage:         r.Stage,
+		RunNumber:     r.RunNumber,
+		Status:        r.Status,
+		Error:         r.Error,
+		BioAPIVersion: r.BioAPIVersion,
+		JobID:         r.JobID,
+		StartedAt:     r.StartedAt,
+		FinishedAt:    r.FinishedAt,
+	}
+	if len(r.Parameters) > 0 {
+		resp.Parameters = json.RawMessage(r.Parameters)
+	}
+	if len(r.Result) > 0 {
+		resp.Result = json.RawMessage(r.Result)
+	}
+	return resp
+}
+
+func isPipelineStage(stage string) bool {
+	for _, s := range models.PipelineStages {
+		if s == stage {
+			return true
+		}
+	}
+	return false
+}
+
+// sortByPipeline orders stage runs by the stage's position in the pipeline.
+func sortByPipeline(runs []dto.StageResultResponse) {
+	order := make(map[string]int, len(models.PipelineStages))
+	for i, s := range models.PipelineStages {
+		order[s] = i
+	}
+	sort.SliceStable(runs, func(i, j int) bool {
+		return order[runs[i].Stage] < order[runs[j].Stage]
+	})
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"protchain/internal/authz"
+	"protchain/internal/dto"
+	"protchain/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetWorkflowStageResults(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	started := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	db, f := newFakeDB(t,
+		fakeRows{
+			match:   "SELECT user_id FROM workflows WHERE id",
+			columns: []string{"user_id"},
+			rows:    [][]driver.Value{{int64(3)}},
+		},
+		fakeRows{
+			match:   "FROM workflow_stage_results",
+			columns: []string{"id", "stage", "run_number", "status", "parameters", "result", "error", "bioapi_version", "job_id", "started_at", "finished_at"},
+			rows: [][]driver.Value{
+				{int64(12), models.StageBindingSiteAnalysis, int64(2), models.ResultFailed, []byte(`{"pdb_id":"1ABC"}`), nil, "BioAPI returned status 500", nil, nil, started.Add(time.Hour), started.Add(time.Hour)},
+				{int64(11), models.StageBindingSiteAnalysis, int64(1), models.ResultSucceeded, []byte(`{"pdb_id":"1ABC"}`), []byte(`{"sites":3}`), nil, "2.0.0", nil, started, started.Add(time.Minute)},
+			},
+		},
+	)
+	h := NewWorkflowHandler(db, nil, nil, nil, authz.New(db))
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", 3) })
+	r.GET("/workflows/:id/results/:stage", h.GetWorkflowStageResults)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/workflows/42/results/folding", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown stage: status = %d, want 400", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/workflows/42/results/"+models.StageBindingSiteAnalysis, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Latest  dto.StageResultResponse   `json:"latest"`
+		History []dto.StageResultResponse `json:"history"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	// Earlier runs are kept next to the latest one
+	if len(resp.History) != 2 || resp.Latest.RunNumber != 2 {
+		t.Fatalf("latest run %d of %d", resp.Latest.RunNumber, len(resp.History))
+	}
+	failed, succeeded := resp.History[0], resp.History[1]
+	if failed.Status != models.ResultFailed || failed.Error == nil || *failed.Error != "BioAPI returned status 500" || failed.Result != nil {
+		t.Errorf("failed run = %+v", failed)
+	}
+	if string(succeeded.Result) != `{"sites":3}` || string(succeeded.Parameters) != `{"pdb_id":"1ABC"}` ||
+		succeeded.BioAPIVersion == nil || *succeeded.BioAPIVersion != "2.0.0" {
+		t.Errorf("succeeded run = %+v", succeeded)
+	}
+	if len(f.execs) != 0 {
+		t.Errorf("reading results wrote to the database: %v", f.execs)
+	}
+}
+
+func TestSortByPipeline(t *testing.T) {
+	runs := []dto.StageResultResponse{
+		{ID: 1, Stage: models.StageMolecularDocking},
+		{ID: 2, Stage: models.StageStructurePreparation},
+		{ID: 3, Stage: models.StageVirtualScreening},
+		{ID: 4, Stage: models.StageStructurePreparation},
+	}
+	sortByPipeline(runs)
+	var ids []int
+	for _, r := range runs {
+		ids = append(ids, r.ID)
+	}
+	// Runs of one stage keep their order
+	if want := []int{2, 4, 3, 1}; len(ids) != 4 || ids[0] != want[0] || ids[1] != want[1] || ids[2] != want[2] || ids[3] != want[3] {
+		t.Errorf("sorted runs = %v, want %v", ids, want)
+	}
+}
@@ -5,41 +5,51 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"protchain/internal/audit"
+	"protchain/internal/authz"
 	"protchain/internal/dto"
+	"protchain/internal/events"
 	"protchain/internal/models"
+	"protchain/internal/quota"
 
 	"github.com/gin-gonic/gin"
 )
 
 type TeamHandler struct {
-	db *sql.DB
+	db     *sql.DB
+	events *events.Broker
+	authz  *authz.Service
+	quotas *quota.Service
+	// inviteTTL is how long an invitation stays valid after it is sent
+	inviteTTL time.Duration
 }
 
-func NewTeamHandler(db *sql.DB) *TeamHandler {
-	return &TeamHandler{db: db}
+func NewTeamHandler(db *sql.DB, broker *events.Broker, az *authz.Service, quotas *quota.Service, inviteTTL time.Duration) *TeamHandler {
+	return &TeamHandler{db: db, events: broker, authz: az, quotas: quotas, inviteTTL: inviteTTL}
 }
 
 // Organization handlers
 func (h *TeamHandler) ListOrganizations(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	page, perPage, offset := parsePagination(c)
+	keyOrgID := keyOrganizationArg(c)
 
 	var total int
-	if err := h.db.QueryRow(`
+	if err := h.db.QueryRowContext(dbContext(c), `
 		SELECT COUNT(*) FROM organizations WHERE id IN (
 			SELECT organization_id FROM organization_members WHERE user_id = $1
-		)
-	`, userID).Scan(&total); err != nil {
+		) AND ($2::int IS NULL OR id = $2)
+	`, userID, keyOrgID).Scan(&total); err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to fetch organizations"})
 		return
 	}
 
-	rows, err := h.db.Query(`
+	rows, err := h.db.QueryContext(dbContext(c), `
 		SELECT o.id, o.name, o.description, o.domain, o.plan, o.created_at, o.updated_at,
 		       COUNT(DISTINCT om.user_id) as member_count,
 		       COUNT(DISTINCT t.id) as team_count
@@ -48,11 +58,11 @@ func (h *TeamHandler) ListOrganizations(c *gin.Context) {
 		LEFT JOIN teams t ON o.id = t.organization_id
 		WHERE o.id IN (
 			SELECT organization_id FROM organization_members WHERE user_id = $1
-		)
+		) AND ($4::int IS NULL OR o.id = $4)
 		GROUP BY o.id
 		ORDER BY o.created_at DESC
 		LIMIT $2 OFFSET $3
-	`, userID, perPage, offset)
+	`, userID, perPage, offset, keyOrgID)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
@@ -88,6 +98,10 @@ func (h *TeamHandler) ListOrganizations(c *gin.Context) {
 
 func (h *TeamHandler) CreateOrganization(c *gin.Context) {
 	userID, _ := c.Get("user_id")
+	if _, ok := keyOrganization(c); ok {
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Success: false, Error: "Organization API keys cannot create organizations"})
+		return
+	}
 
 	var req dto.CreateOrganizationRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -98,7 +112,7 @@ func (h *TeamHandler) CreateOrganization(c *gin.Context) {
 		return
 	}
 
-	tx, err := h.db.Begin()
+	tx, err := h.db.BeginTx(dbContext(c), nil)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Success: false,
@@ -109,7 +123,7 @@ func (h *TeamHandler) CreateOrganization(c *gin.Context) {
 	defer tx.Rollback()
 
 	var orgID int
-	err = tx.QueryRow(`
+	err = tx.QueryRowContext(dbContext(c), `
 		INSERT INTO organizations (name, description, domain, plan, created_at, updated_at)
 		VALUES ($1, $2, $3, 'free', $4, $5)
 		RETURNING id
@@ -123,7 +137,7 @@ func (h *TeamHandler) CreateOrganization(c *gin.Context) {
 		return
 	}
 
-	_, err = tx.Exec(`
+	_, err = tx.ExecContext(dbContext(c), `
 		INSERT INTO organization_members (organization_id, user_id, role, joined_at)
 		VALUES ($1, $2, $3, $4)
 	`, orgID, userID, models.RoleAdmin, time.Now())
@@ -136,6 +150,22 @@ func (h *TeamHandler) CreateOrganization(c *gin.Context) {
 		return
 	}
 
+	err = recordActivity(c, tx, audit.Entry{
+		Action:         audit.OrganizationCreated,
+		OrganizationID: &orgID,
+		TargetType:     audit.TargetOrganization,
+		TargetID:       &orgID,
+		After:          map[string]interface{}{"name": req.Name, "description": req.Description, "domain": req.Domain},
+	})
+	if err != nil {
+		logf(c, "CreateOrganization: failed to record activity: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Success: false,
+			Error:   "Failed to create organization",
+		})
+		return
+	}
+
 	if err := tx.Commit(); err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Success: false,
@@ -165,7 +195,7 @@ func (h *TeamHandler) GetOrganization(c *gin.Context) {
 	orgID := c.Param("id")
 
 	var memberCount int
-	err := h.db.QueryRow(`
+	err := h.db.QueryRowContext(dbContext(c), `
 		SELECT COUNT(*) FROM organization_members
 		WHERE organization_id = $1 AND user_id = $2
 	`, orgID, userID).Scan(&memberCount)
@@ -175,7 +205,7 @@ func (h *TeamHandler) GetOrganization(c *gin.Context) {
 	}
 
 	var org dto.OrganizationResponse
-	err = h.db.QueryRow(`
+	err = h.db.QueryRowContext(dbContext(c), `
 		SELECT o.id, o.name, o.description, o.domain, o.plan, o.created_at, o.updated_at,
 		       (SELECT COUNT(*) FROM organization_members WHERE organization_id = o.id) as member_count,
 		       (SELECT COUNT(*) FROM teams WHERE organization_id = o.id) as team_count
@@ -198,10 +228,13 @@ func (h *TeamHandler) GetOrganization(c *gin.Context) {
 
 func (h *TeamHandler) UpdateOrganization(c *gin.Context) {
 	userID, _ := c.Get("user_id")
-	orgID := c.Param("id")
+	orgID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
 
 	var role string
-	err := h.db.QueryRow(`
+	err := h.db.QueryRowContext(dbContext(c), `
 		SELECT role FROM organization_members
 		WHERE organization_id = $1 AND user_id = $2
 	`, orgID, userID).Scan(&role)
@@ -216,7 +249,24 @@ func (h *TeamHandler) UpdateOrganization(c *gin.Context) {
 		return
 	}
 
-	_, err = h.db.Exec(`
+	tx, err := h.db.BeginTx(dbContext(c), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var name, description, domain string
+	err = tx.QueryRowContext(dbContext(c), `
+		SELECT name, COALESCE(description, ''), COALESCE(domain, '')
+		FROM organizations WHERE id = $1 FOR UPDATE
+	`, orgID).Scan(&name, &description, &domain)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to update organization"})
+		return
+	}
+
+	_, err = tx.ExecContext(dbContext(c), `
 		UPDATE organizations
 		SET name = $1, description = $2, domain = $3, updated_at = $4
 		WHERE id = $5
@@ -227,15 +277,41 @@ func (h *TeamHandler) UpdateOrganization(c *gin.Context) {
 		return
 	}
 
+	before, after := audit.Diff(
+		map[string]interface{}{"name": name, "description": description, "domain": domain},
+		map[string]interface{}{"name": req.Name, "description": req.Description, "domain": req.Domain},
+	)
+	err = recordActivity(c, tx, audit.Entry{
+		Action:         audit.OrganizationUpdated,
+		OrganizationID: &orgID,
+		TargetType:     audit.TargetOrganization,
+		TargetID:       &orgID,
+		Before:         before,
+		After:          after,
+	})
+	if err != nil {
+		logf(c, "UpdateOrganization: failed to record activity for org %d: %v", orgID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to update organization"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to commit transaction"})
+		return
+	}
+
 	c.JSON(http.StatusOK, dto.SuccessResponse{Success: true, Message: "Organization updated successfully"})
 }
 
 func (h *TeamHandler) DeleteOrganization(c *gin.Context) {
 	userID, _ := c.Get("user_id")
-	orgID := c.Param("id")
+	orgID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
 
 	var role string
-	err := h.db.QueryRow(`
+	err := h.db.QueryRowContext(dbContext(c), `
 		SELECT role FROM organization_members
 		WHERE organization_id = $1 AND user_id = $2
 	`, orgID, userID).Scan(&role)
@@ -244,26 +320,44 @@ func (h *TeamHandler) DeleteOrganization(c *gin.Context) {
 		return
 	}
 
-	tx, err := h.db.Begin()
+	tx, err := h.db.BeginTx(dbContext(c), nil)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
 		return
 	}
 	defer tx.Rollback()
 
+	var name string
+	if err := tx.QueryRowContext(dbContext(c), `SELECT name FROM organizations WHERE id = $1 FOR UPDATE`, orgID).Scan(&name); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to delete organization"})
+		return
+	}
+	err = recordActivity(c, tx, audit.Entry{
+		Action:         audit.OrganizationDeleted,
+		OrganizationID: &orgID,
+		TargetType:     audit.TargetOrganization,
+		TargetID:       &orgID,
+		Before:         map[string]interface{}{"name": name},
+	})
+	if err != nil {
+		logf(c, "DeleteOrganization: failed to record activity for org %d: %v", orgID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to delete organization"})
+		return
+	}
+
 	cascadeDeletes := []struct {
 		query string
 		desc  string
 	}{
 		{`DELETE FROM team_members WHERE team_id IN (SELECT id FROM teams WHERE organization_id = $1)`, "team_members"},
-		{`DELETE FROM teams WHERE organization_id = $1`, "teams"},
 		{`DELETE FROM invitations WHERE organization_id = $1`, "invitations"},
+		{`DELETE FROM teams WHERE organization_id = $1`, "teams"},
 		{`DELETE FROM organization_members WHERE organization_id = $1`, "organization_members"},
 		{`DELETE FROM organizations WHERE id = $1`, "organizations"},
 	}
 	for _, d := range cascadeDeletes {
-		if _, err = tx.Exec(d.query, orgID); err != nil {
-			log.Printf("DeleteOrganization: failed to delete %s for org %s: %v", d.desc, orgID, err)
+		if _, err = tx.ExecContext(dbContext(c), d.query, orgID); err != nil {
+			logf(c, "DeleteOrganization: failed to delete %s for org %d: %v", d.desc, orgID, err)
 			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: fmt.Sprintf("Failed to delete %s", d.desc)})
 			return
 		}
@@ -280,14 +374,12 @@ func (h *TeamHandler) DeleteOrganization(c *gin.Context) {
 
 func (h *TeamHandler) InviteToOrganization(c *gin.Context) {
 	userID, _ := c.Get("user_id")
-	orgID := c.Param("id")
+	orgID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
 
-	var role string
-	err := h.db.QueryRow(`
-		SELECT role FROM organization_members
-		WHERE organization_id = $1 AND user_id = $2
-	`, orgID, userID).Scan(&role)
-	if err != nil || role != models.RoleAdmin {
+	if !isOrganizationAdmin(c, h.db, orgID, userID) {
 		c.JSON(http.StatusForbidden, dto.ErrorResponse{Success: false, Error: "Only admins can invite members"})
 		return
 	}
@@ -298,33 +390,7 @@ func (h *TeamHandler) InviteToOrganization(c *gin.Context) {
 		return
 	}
 
-	token := generateInvitationToken()
-	expiresAt := time.Now().Add(7 * 24 * time.Hour)
-
-	orgIDInt, parseErr := parseIntParam(orgID)
-	if parseErr != nil {
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: "Invalid organization ID"})
-		return
-	}
-	_, err = h.db.Exec(`
-		INSERT INTO invitations (organization_id, email, role, token, invited_by, status, expires_at, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-	`, orgIDInt, req.Email, req.Role, token, userID, models.InvitationPending, expiresAt, time.Now())
-
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to create invitation"})
-		return
-	}
-
-	c.JSON(http.StatusCreated, dto.SuccessResponse{
-		Success: true,
-		Data: gin.H{
-			"token":      token,
-			"email":      req.Email,
-			"role":       req.Role,
-			"expires_at": expiresAt,
-		},
-	})
+	h.createInvitation(c, orgID, nil, req.Email, req.Role)
 }
 
 func (h *TeamHandler) ListOrganizationMembers(c *gin.Context) {
@@ -332,7 +398,7 @@ func (h *TeamHandler) ListOrganizationMembers(c *gin.Context) {
 	orgID := c.Param("id")
 
 	var memberCheck int
-	err := h.db.QueryRow(`
+	err := h.db.QueryRowContext(dbContext(c), `
 		SELECT COUNT(*) FROM organization_members
 		WHERE organization_id = $1 AND user_id = $2
 	`, orgID, userID).Scan(&memberCheck)
@@ -344,12 +410,12 @@ func (h *TeamHandler) ListOrganizationMembers(c *gin.Context) {
 	page, perPage, offset := parsePagination(c)
 
 	var total int
-	if err := h.db.QueryRow(`SELECT COUNT(*) FROM organization_members WHERE organization_id = $1`, orgID).Scan(&total); err != nil {
+	if err := h.db.QueryRowContext(dbContext(c), `SELECT COUNT(*) FROM organization_members WHERE organization_id = $1`, orgID).Scan(&total); err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to fetch members"})
 		return
 	}
 
-	rows, err := h.db.Query(`
+	rows, err := h.db.QueryContext(dbContext(c), `
 		SELECT om.id, om.organization_id, om.user_id, om.role, om.joined_at,
 		       u.email, u.first_name, u.last_name
 		FROM organization_members om
@@ -395,11 +461,17 @@ func (h *TeamHandler) ListOrganizationMembers(c *gin.Context) {
 
 func (h *TeamHandler) RemoveOrganizationMember(c *gin.Context) {
 	userID, _ := c.Get("user_id")
-	orgID := c.Param("id")
-	targetUserID := c.Param("userId")
+	orgID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	targetUserID, ok := parseIDParam(c, "userId")
+	if !ok {
+		return
+	}
 
 	var role string
-	err := h.db.QueryRow(`
+	err := h.db.QueryRowContext(dbContext(c), `
 		SELECT role FROM organization_members
 		WHERE organization_id = $1 AND user_id = $2
 	`, orgID, userID).Scan(&role)
@@ -413,26 +485,47 @@ func (h *TeamHandler) RemoveOrganizationMember(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Invalid user session"})
 		return
 	}
-	if strconv.Itoa(uid) == targetUserID {
+	if uid == targetUserID {
 		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: "Cannot remove yourself from the organization"})
 		return
 	}
 
-	result, err := h.db.Exec(`
+	tx, err := h.db.BeginTx(dbContext(c), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var removedRole string
+	err = tx.QueryRowContext(dbContext(c), `
 		DELETE FROM organization_members
 		WHERE organization_id = $1 AND user_id = $2
-	`, orgID, targetUserID)
+		RETURNING COALESCE(role, '')
+	`, orgID, targetUserID).Scan(&removedRole)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "Member not found"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to remove member"})
 		return
 	}
 
-	rowsAffected, raErr := result.RowsAffected()
-	if raErr != nil {
-		log.Printf("RemoveOrganizationMember: RowsAffected error: %v", raErr)
+	err = recordActivity(c, tx, audit.Entry{
+		Action:         audit.OrganizationMemberRemoved,
+		OrganizationID: &orgID,
+		TargetType:     audit.TargetUser,
+		TargetID:       &targetUserID,
+		Before:         map[string]interface{}{"user_id": targetUserID, "role": removedRole},
+	})
+	if err != nil {
+		logf(c, "RemoveOrganizationMember: failed to record activity for org %d: %v", orgID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to remove member"})
+		return
 	}
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "Member not found"})
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to commit transaction"})
 		return
 	}
 
@@ -445,7 +538,7 @@ func (h *TeamHandler) ListTeams(c *gin.Context) {
 	orgID := c.Param("id")
 
 	var memberCheck int
-	err := h.db.QueryRow(`
+	err := h.db.QueryRowContext(dbContext(c), `
 		SELECT COUNT(*) FROM organization_members
 		WHERE organization_id = $1 AND user_id = $2
 	`, orgID, userID).Scan(&memberCheck)
@@ -457,12 +550,12 @@ func (h *TeamHandler) ListTeams(c *gin.Context) {
 	page, perPage, offset := parsePagination(c)
 
 	var total int
-	if err := h.db.QueryRow(`SELECT COUNT(*) FROM teams WHERE organization_id = $1`, orgID).Scan(&total); err != nil {
+	if err := h.db.QueryRowContext(dbContext(c), `SELECT COUNT(*) FROM teams WHERE organization_id = $1`, orgID).Scan(&total); err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to fetch teams"})
 		return
 	}
 
-	rows, err := h.db.Query(`
+	rows, err := h.db.QueryContext(dbContext(c), `
 		SELECT t.id, t.organization_id, t.name, t.description, t.created_at, t.updated_at,
 		       (SELECT COUNT(*) FROM team_members WHERE team_id = t.id) as member_count
 		FROM teams t
@@ -499,7 +592,7 @@ func (h *TeamHandler) CreateTeam(c *gin.Context) {
 	orgID := c.Param("id")
 
 	var role string
-	err := h.db.QueryRow(`
+	err := h.db.QueryRowContext(dbContext(c), `
 		SELECT role FROM organization_members
 		WHERE organization_id = $1 AND user_id = $2
 	`, orgID, userID).Scan(&role)
@@ -519,8 +612,15 @@ func (h *TeamHandler) CreateTeam(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: "Invalid organization ID"})
 		return
 	}
+	tx, err := h.db.BeginTx(dbContext(c), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
 	var teamID int
-	err = h.db.QueryRow(`
+	err = tx.QueryRowContext(dbContext(c), `
 		INSERT INTO teams (organization_id, name, description, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id
@@ -530,7 +630,7 @@ func (h *TeamHandler) CreateTeam(c *gin.Context) {
 		return
 	}
 
-	_, err = h.db.Exec(`
+	_, err = tx.ExecContext(dbContext(c), `
 		INSERT INTO team_members (team_id, user_id, role, joined_at)
 		VALUES ($1, $2, $3, $4)
 	`, teamID, userID, models.RoleOwner, time.Now())
@@ -539,6 +639,24 @@ func (h *TeamHandler) CreateTeam(c *gin.Context) {
 		return
 	}
 
+	err = recordActivity(c, tx, audit.Entry{
+		Action:         audit.TeamCreated,
+		OrganizationID: &orgIDInt,
+		TeamID:         &teamID,
+		TargetType:     audit.TargetTeam,
+		TargetID:       &teamID,
+		After:          map[string]interface{}{"name": req.Name, "description": req.Description},
+	})
+	if err != nil {
+		logf(c, "CreateTeam: failed to record activity for org %d: %v", orgIDInt, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to create team"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to commit transaction"})
+		return
+	}
+
 	c.JSON(http.StatusCreated, dto.SuccessResponse{
 		Success: true,
 		Data: dto.TeamResponse{
@@ -559,7 +677,7 @@ func (h *TeamHandler) GetTeam(c *gin.Context) {
 	teamID := c.Param("teamId")
 
 	var memberCheck int
-	err := h.db.QueryRow(`
+	err := h.db.QueryRowContext(dbContext(c), `
 		SELECT COUNT(*) FROM organization_members
 		WHERE organization_id = $1 AND user_id = $2
 	`, orgID, userID).Scan(&memberCheck)
@@ -569,7 +687,7 @@ func (h *TeamHandler) GetTeam(c *gin.Context) {
 	}
 
 	var team dto.TeamResponse
-	err = h.db.QueryRow(`
+	err = h.db.QueryRowContext(dbContext(c), `
 		SELECT t.id, t.organization_id, t.name, t.description, t.created_at, t.updated_at,
 		       (SELECT COUNT(*) FROM team_members WHERE team_id = t.id) as member_count
 		FROM teams t
@@ -591,11 +709,17 @@ func (h *TeamHandler) GetTeam(c *gin.Context) {
 
 func (h *TeamHandler) UpdateTeam(c *gin.Context) {
 	userID, _ := c.Get("user_id")
-	orgID := c.Param("id")
-	teamID := c.Param("teamId")
+	orgID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	teamID, ok := parseIDParam(c, "teamId")
+	if !ok {
+		return
+	}
 
 	var role string
-	err := h.db.QueryRow(`
+	err := h.db.QueryRowContext(dbContext(c), `
 		SELECT role FROM organization_members
 		WHERE organization_id = $1 AND user_id = $2
 	`, orgID, userID).Scan(&role)
@@ -610,7 +734,28 @@ func (h *TeamHandler) UpdateTeam(c *gin.Context) {
 		return
 	}
 
-	_, err = h.db.Exec(`
+	tx, err := h.db.BeginTx(dbContext(c), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var name, description string
+	err = tx.QueryRowContext(dbContext(c), `
+		SELECT name, COALESCE(description, '') FROM teams
+		WHERE id = $1 AND organization_id = $2 FOR UPDATE
+	`, teamID, orgID).Scan(&name, &description)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "Team not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to update team"})
+		return
+	}
+
+	_, err = tx.ExecContext(dbContext(c), `
 		UPDATE teams SET name = $1, description = $2, updated_at = $3
 		WHERE id = $4 AND organization_id = $5
 	`, req.Name, req.Description, time.Now(), teamID, orgID)
@@ -619,16 +764,45 @@ func (h *TeamHandler) UpdateTeam(c *gin.Context) {
 		return
 	}
 
+	before, after := audit.Diff(
+		map[string]interface{}{"name": name, "description": description},
+		map[string]interface{}{"name": req.Name, "description": req.Description},
+	)
+	err = recordActivity(c, tx, audit.Entry{
+		Action:         audit.TeamUpdated,
+		OrganizationID: &orgID,
+		TeamID:         &teamID,
+		TargetType:     audit.TargetTeam,
+		TargetID:       &teamID,
+		Before:         before,
+		After:          after,
+	})
+	if err != nil {
+		logf(c, "UpdateTeam: failed to record activity for team %d: %v", teamID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to update team"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to commit transaction"})
+		return
+	}
+
 	c.JSON(http.StatusOK, dto.SuccessResponse{Success: true, Message: "Team updated successfully"})
 }
 
 func (h *TeamHandler) DeleteTeam(c *gin.Context) {
 	userID, _ := c.Get("user_id")
-	orgID := c.Param("id")
-	teamID := c.Param("teamId")
+	orgID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	teamID, ok := parseIDParam(c, "teamId")
+	if !ok {
+		return
+	}
 
 	var role string
-	err := h.db.QueryRow(`
+	err := h.db.QueryRowContext(dbContext(c), `
 		SELECT role FROM organization_members
 		WHERE organization_id = $1 AND user_id = $2
 	`, orgID, userID).Scan(&role)
@@ -637,20 +811,49 @@ func (h *TeamHandler) DeleteTeam(c *gin.Context) {
 		return
 	}
 
-	tx, err := h.db.Begin()
+	tx, err := h.db.BeginTx(dbContext(c), nil)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
 		return
 	}
 	defer tx.Rollback()
 
-	if _, err = tx.Exec(`DELETE FROM team_members WHERE team_id = $1`, teamID); err != nil {
-		log.Printf("DeleteTeam: failed to delete team_members for team %s: %v", teamID, err)
+	var name string
+	err = tx.QueryRowContext(dbContext(c), `SELECT name FROM teams WHERE id = $1 AND organization_id = $2 FOR UPDATE`, teamID, orgID).Scan(&name)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "Team not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to delete team"})
+		return
+	}
+	err = recordActivity(c, tx, audit.Entry{
+		Action:         audit.TeamDeleted,
+		OrganizationID: &orgID,
+		TeamID:         &teamID,
+		TargetType:     audit.TargetTeam,
+		TargetID:       &teamID,
+		Before:         map[string]interface{}{"name": name},
+	})
+	if err != nil {
+		logf(c, "DeleteTeam: failed to record activity for team %d: %v", teamID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to delete team"})
+		return
+	}
+
+	if _, err = tx.ExecContext(dbContext(c), `DELETE FROM invitations WHERE team_id = $1`, teamID); err != nil {
+		logf(c, "DeleteTeam: failed to delete invitations for team %d: %v", teamID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to delete team invitations"})
+		return
+	}
+	if _, err = tx.ExecContext(dbContext(c), `DELETE FROM team_members WHERE team_id = $1`, teamID); err != nil {
+		logf(c, "DeleteTeam: failed to delete team_members for team %d: %v", teamID, err)
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to delete team members"})
 		return
 	}
-	if _, err = tx.Exec(`DELETE FROM teams WHERE id = $1 AND organization_id = $2`, teamID, orgID); err != nil {
-		log.Printf("DeleteTeam: failed to delete team %s: %v", teamID, err)
+	if _, err = tx.ExecContext(dbContext(c), `DELETE FROM teams WHERE id = $1 AND organization_id = $2`, teamID, orgID); err != nil {
+		logf(c, "DeleteTeam: failed to delete team %d: %v", teamID, err)
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to delete team"})
 		return
 	}
@@ -665,11 +868,17 @@ func (h *TeamHandler) DeleteTeam(c *gin.Context) {
 
 func (h *TeamHandler) AddTeamMember(c *gin.Context) {
 	userID, _ := c.Get("user_id")
-	orgID := c.Param("id")
-	teamID := c.Param("teamId")
+	orgID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	teamID, ok := parseIDParam(c, "teamId")
+	if !ok {
+		return
+	}
 
 	var role string
-	err := h.db.QueryRow(`
+	err := h.db.QueryRowContext(dbContext(c), `
 		SELECT role FROM organization_members
 		WHERE organization_id = $1 AND user_id = $2
 	`, orgID, userID).Scan(&role)
@@ -685,7 +894,7 @@ func (h *TeamHandler) AddTeamMember(c *gin.Context) {
 	}
 
 	var orgMemberCheck int
-	err = h.db.QueryRow(`
+	err = h.db.QueryRowContext(dbContext(c), `
 		SELECT COUNT(*) FROM organization_members
 		WHERE organization_id = $1 AND user_id = $2
 	`, orgID, req.UserID).Scan(&orgMemberCheck)
@@ -694,7 +903,14 @@ func (h *TeamHandler) AddTeamMember(c *gin.Context) {
 		return
 	}
 
-	_, err = h.db.Exec(`
+	tx, err := h.db.BeginTx(dbContext(c), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(dbContext(c), `
 		INSERT INTO team_members (team_id, user_id, role, joined_at)
 		VALUES ($1, $2, $3, $4)
 	`, teamID, req.UserID, req.Role, time.Now())
@@ -703,17 +919,45 @@ func (h *TeamHandler) AddTeamMember(c *gin.Context) {
 		return
 	}
 
+	memberID := req.UserID
+	err = recordActivity(c, tx, audit.Entry{
+		Action:         audit.TeamMemberAdded,
+		OrganizationID: &orgID,
+		TeamID:         &teamID,
+		TargetType:     audit.TargetUser,
+		TargetID:       &memberID,
+		After:          map[string]interface{}{"user_id": req.UserID, "role": req.Role},
+	})
+	if err != nil {
+		logf(c, "AddTeamMember: failed to record activity for team %d: %v", teamID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to add team member"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to commit transaction"})
+		return
+	}
+
 	c.JSON(http.StatusCreated, dto.SuccessResponse{Success: true, Message: "Team member added successfully"})
 }
 
 func (h *TeamHandler) RemoveTeamMember(c *gin.Context) {
 	userID, _ := c.Get("user_id")
-	orgID := c.Param("id")
-	teamID := c.Param("teamId")
-	targetUserID := c.Param("userId")
+	orgID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	teamID, ok := parseIDParam(c, "teamId")
+	if !ok {
+		return
+	}
+	targetUserID, ok := parseIDParam(c, "userId")
+	if !ok {
+		return
+	}
 
 	var role string
-	err := h.db.QueryRow(`
+	err := h.db.QueryRowContext(dbContext(c), `
 		SELECT role FROM organization_members
 		WHERE organization_id = $1 AND user_id = $2
 	`, orgID, userID).Scan(&role)
@@ -722,21 +966,44 @@ func (h *TeamHandler) RemoveTeamMember(c *gin.Context) {
 		return
 	}
 
-	result, err := h.db.Exec(`
+	tx, err := h.db.BeginTx(dbContext(c), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var removedRole string
+	err = tx.QueryRowContext(dbContext(c), `
 		DELETE FROM team_members
 		WHERE team_id = $1 AND user_id = $2
-	`, teamID, targetUserID)
+		  AND team_id IN (SELECT id FROM teams WHERE organization_id = $3)
+		RETURNING COALESCE(role, '')
+	`, teamID, targetUserID, orgID).Scan(&removedRole)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "Team member not found"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to remove team member"})
 		return
 	}
 
-	rowsAffected, raErr := result.RowsAffected()
-	if raErr != nil {
-		log.Printf("RemoveTeamMember: RowsAffected error: %v", raErr)
+	err = recordActivity(c, tx, audit.Entry{
+		Action:         audit.TeamMemberRemoved,
+		OrganizationID: &orgID,
+		TeamID:         &teamID,
+		TargetType:     audit.TargetUser,
+		TargetID:       &targetUserID,
+		Before:         map[string]interface{}{"user_id": targetUserID, "role": removedRole},
+	})
+	if err != nil {
+		logf(c, "RemoveTeamMember: failed to record activity for team %d: %v", teamID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to remove team member"})
+		return
 	}
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "Team member not found"})
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to commit transaction"})
 		return
 	}
 
@@ -745,28 +1012,35 @@ func (h *TeamHandler) RemoveTeamMember(c *gin.Context) {
 
 // Invitation handlers
 func (h *TeamHandler) ListInvitations(c *gin.Context) {
-	email, _ := c.Get("email")
+	email, ok := callerEmail(c, h.db)
+	if !ok {
+		return
+	}
 	page, perPage, offset := parsePagination(c)
+	keyOrgID := keyOrganizationArg(c)
 
 	var total int
-	if err := h.db.QueryRow(`
-		SELECT COUNT(*) FROM invitations WHERE email = $1 AND status = 'pending' AND expires_at > NOW()
-	`, email).Scan(&total); err != nil {
+	if err := h.db.QueryRowContext(dbContext(c), `
+		SELECT COUNT(*) FROM invitations
+		WHERE lower(email) = lower($1) AND status = 'pending' AND expires_at > NOW()
+		  AND ($2::int IS NULL OR organization_id = $2)
+	`, email, keyOrgID).Scan(&total); err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to fetch invitations"})
 		return
 	}
 
-	rows, err := h.db.Query(`
+	rows, err := h.db.QueryContext(dbContext(c), `
 		SELECT i.id, i.token, i.organization_id, i.team_id, i.email, i.role, i.status, i.expires_at, i.created_at,
 		       u.id, u.email, u.first_name, u.last_name,
 		       o.id, o.name
 		FROM invitations i
 		JOIN users u ON i.invited_by = u.id
 		LEFT JOIN organizations o ON i.organization_id = o.id
-		WHERE i.email = $1 AND i.status = 'pending' AND i.expires_at > NOW()
+		WHERE lower(i.email) = lower($1) AND i.status = 'pending' AND i.expires_at > NOW()
+		  AND ($4::int IS NULL OR i.organization_id = $4)
 		ORDER BY i.created_at DESC
 		LIMIT $2 OFFSET $3
-	`, email, perPage, offset)
+	`, email, perPage, offset, keyOrgID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to fetch invitations"})
 		return
@@ -816,21 +1090,31 @@ func (h *TeamHandler) ListInvitations(c *gin.Context) {
 	})
 }
 
+// AcceptInvitation joins the caller to the invitation's organization, and
+// team if it names one. Only the account that now holds the invited email
+// may accept; a team invitation makes the caller a plain member of the
+// organization.
 func (h *TeamHandler) AcceptInvitation(c *gin.Context) {
 	userID, _ := c.Get("user_id")
+	email, ok := callerEmail(c, h.db)
+	if !ok {
+		return
+	}
 	token := c.Param("token")
 
 	var inv struct {
 		ID             int
 		OrganizationID *int
 		TeamID         *int
+		Email          string
 		Role           string
 	}
-	err := h.db.QueryRow(`
-		SELECT id, organization_id, team_id, role
+	err := h.db.QueryRowContext(dbContext(c), `
+		SELECT id, organization_id, team_id, email, role
 		FROM invitations
 		WHERE token = $1 AND status = 'pending' AND expires_at > NOW()
-	`, token).Scan(&inv.ID, &inv.OrganizationID, &inv.TeamID, &inv.Role)
+		  AND ($2::int IS NULL OR organization_id = $2)
+	`, token, keyOrganizationArg(c)).Scan(&inv.ID, &inv.OrganizationID, &inv.TeamID, &inv.Email, &inv.Role)
 
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "Invitation not found or expired"})
@@ -840,8 +1124,12 @@ func (h *TeamHandler) AcceptInvitation(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to fetch invitation"})
 		return
 	}
+	if !strings.EqualFold(inv.Email, email) {
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Success: false, Error: "This invitation was sent to a different email address"})
+		return
+	}
 
-	tx, err := h.db.Begin()
+	tx, err := h.db.BeginTx(dbContext(c), nil)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
 		return
@@ -849,11 +1137,15 @@ func (h *TeamHandler) AcceptInvitation(c *gin.Context) {
 	defer tx.Rollback()
 
 	if inv.OrganizationID != nil {
-		_, err = tx.Exec(`
+		orgRole := inv.Role
+		if inv.TeamID != nil {
+			orgRole = models.RoleMember
+		}
+		_, err = tx.ExecContext(dbContext(c), `
 			INSERT INTO organization_members (organization_id, user_id, role, joined_at)
 			VALUES ($1, $2, $3, $4)
 			ON CONFLICT (organization_id, user_id) DO NOTHING
-		`, *inv.OrganizationID, userID, inv.Role, time.Now())
+		`, *inv.OrganizationID, userID, orgRole, time.Now())
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to join organization"})
 			return
@@ -861,7 +1153,7 @@ func (h *TeamHandler) AcceptInvitation(c *gin.Context) {
 	}
 
 	if inv.TeamID != nil {
-		_, err = tx.Exec(`
+		_, err = tx.ExecContext(dbContext(c), `
 			INSERT INTO team_members (team_id, user_id, role, joined_at)
 			VALUES ($1, $2, $3, $4)
 			ON CONFLICT (team_id, user_id) DO NOTHING
@@ -872,8 +1164,30 @@ func (h *TeamHandler) AcceptInvitation(c *gin.Context) {
 		}
 	}
 
-	_, err = tx.Exec(`UPDATE invitations SET status = $1 WHERE id = $2`, models.InvitationAccepted, inv.ID)
+	// The status guard stops a token being accepted twice at once
+	res, err := tx.ExecContext(dbContext(c), `
+		UPDATE invitations SET status = $1, updated_at = NOW() WHERE id = $2 AND status = $3
+	`, models.InvitationAccepted, inv.ID, models.InvitationPending)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to update invitation"})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "Invitation not found or expired"})
+		return
+	}
+
+	err = recordActivity(c, tx, audit.Entry{
+		Action:         audit.InvitationAccepted,
+		OrganizationID: inv.OrganizationID,
+		TeamID:         inv.TeamID,
+		TargetType:     audit.TargetInvitation,
+		TargetID:       &inv.ID,
+		Before:         map[string]interface{}{"status": models.InvitationPending},
+		After:          map[string]interface{}{"status": models.InvitationAccepted, "role": inv.Role},
+	})
 	if err != nil {
+		logf(c, "AcceptInvitation: failed to record activity for invitation %d: %v", inv.ID, err)
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to update invitation"})
 		return
 	}
@@ -886,26 +1200,59 @@ func (h *TeamHandler) AcceptInvitation(c *gin.Context) {
 	c.JSON(http.StatusOK, dto.SuccessResponse{Success: true, Message: "Invitation accepted successfully"})
 }
 
+// DeclineInvitation turns down an invitation sent to the caller's email.
 func (h *TeamHandler) DeclineInvitation(c *gin.Context) {
+	email, ok := callerEmail(c, h.db)
+	if !ok {
+		return
+	}
 	token := c.Param("token")
 
-	result, err := h.db.Exec(`
-		UPDATE invitations SET status = $1
-		WHERE token = $2 AND status = $3
-	`, models.InvitationDeclined, token, models.InvitationPending)
+	tx, err := h.db.BeginTx(dbContext(c), nil)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to decline invitation"})
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
 		return
 	}
+	defer tx.Rollback()
 
-	rowsAffected, raErr := result.RowsAffected()
-	if raErr != nil {
-		log.Printf("DeclineInvitation: RowsAffected error: %v", raErr)
+	var inv struct {
+		ID             int
+		OrganizationID *int
+		TeamID         *int
 	}
-	if rowsAffected == 0 {
+	err = tx.QueryRowContext(dbContext(c), `
+		UPDATE invitations SET status = $1, updated_at = NOW()
+		WHERE token = $2 AND status = $3 AND lower(email) = lower($4)
+		  AND ($5::int IS NULL OR organization_id = $5)
+		RETURNING id, organization_id, team_id
+	`, models.InvitationDeclined, token, models.InvitationPending, email, keyOrganizationArg(c)).Scan(&inv.ID, &inv.OrganizationID, &inv.TeamID)
+	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "Invitation not found"})
 		return
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to decline invitation"})
+		return
+	}
+
+	err = recordActivity(c, tx, audit.Entry{
+		Action:         audit.InvitationDeclined,
+		OrganizationID: inv.OrganizationID,
+		TeamID:         inv.TeamID,
+		TargetType:     audit.TargetInvitation,
+		TargetID:       &inv.ID,
+		Before:         map[string]interface{}{"status": models.InvitationPending},
+		After:          map[string]interface{}{"status": models.InvitationDeclined},
+	})
+	if err != nil {
+		logf(c, "DeclineInvitation: failed to record activity for invitation %d: %v", inv.ID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to decline invitation"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to commit transaction"})
+		return
+	}
 
 	c.JSON(http.StatusOK, dto.SuccessResponse{Success: true, Message: "Invitation declined"})
 }
@@ -913,14 +1260,13 @@ func (h *TeamHandler) DeclineInvitation(c *gin.Context) {
 // Workflow sharing handlers
 func (h *TeamHandler) ShareWorkflow(c *gin.Context) {
 	userID, _ := c.Get("user_id")
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
 	workflowID := c.Param("id")
 
-	var ownerCheck int
-	err := h.db.QueryRow(`
-		SELECT COUNT(*) FROM workflows WHERE id = $1 AND user_id = $2
-	`, workflowID, userID).Scan(&ownerCheck)
-	if err != nil || ownerCheck == 0 {
-		c.JSON(http.StatusForbidden, dto.ErrorResponse{Success: false, Error: "You can only share your own workflows"})
+	if _, ok := authorizeWorkflow(c, h.authz, id, models.PermissionAdmin); !ok {
 		return
 	}
 
@@ -930,32 +1276,80 @@ func (h *TeamHandler) ShareWorkflow(c *gin.Context) {
 		return
 	}
 
-	_, err = h.db.Exec(`
+	grantees := 0
+	for _, target := range []*int{req.OrganizationID, req.TeamID, req.UserID} {
+		if target != nil {
+			grantees++
+		}
+	}
+	if grantees != 1 {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: "Exactly one of organization_id, team_id or user_id is required"})
+		return
+	}
+
+	tx, err := h.db.BeginTx(dbContext(c), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var permissionID int
+	err = tx.QueryRowContext(dbContext(c), `
 		INSERT INTO workflow_permissions (workflow_id, organization_id, team_id, user_id, permission_level, granted_by)
 		VALUES ($1, $2, $3, $4, $5, $6)
-	`, workflowID, req.OrganizationID, req.TeamID, req.UserID, req.PermissionLevel, userID)
+		RETURNING id
+	`, workflowID, req.OrganizationID, req.TeamID, req.UserID, req.PermissionLevel, userID).Scan(&permissionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to share workflow"})
+		return
+	}
+
+	err = recordActivity(c, tx, audit.Entry{
+		Action:     audit.WorkflowShared,
+		WorkflowID: &id,
+		TargetType: audit.TargetPermission,
+		TargetID:   &permissionID,
+		After: map[string]interface{}{
+			"organization_id":  req.OrganizationID,
+			"team_id":          req.TeamID,
+			"user_id":          req.UserID,
+			"permission_level": req.PermissionLevel,
+		},
+	})
 	if err != nil {
+		logf(c, "ShareWorkflow: failed to record activity for workflow %d: %v", id, err)
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to share workflow"})
 		return
 	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to commit transaction"})
+		return
+	}
+
+	h.events.Publish(id, events.TypePermissions, gin.H{
+		"action":           "shared",
+		"organization_id":  req.OrganizationID,
+		"team_id":          req.TeamID,
+		"user_id":          req.UserID,
+		"permission_level": req.PermissionLevel,
+	})
 
 	c.JSON(http.StatusCreated, dto.SuccessResponse{Success: true, Message: "Workflow shared successfully"})
 }
 
 func (h *TeamHandler) GetWorkflowPermissions(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
 	workflowID := c.Param("id")
 
-	var ownerCheck int
-	err := h.db.QueryRow(`
-		SELECT COUNT(*) FROM workflows WHERE id = $1 AND user_id = $2
-	`, workflowID, userID).Scan(&ownerCheck)
-	if err != nil || ownerCheck == 0 {
-		c.JSON(http.StatusForbidden, dto.ErrorResponse{Success: false, Error: "Access denied"})
+	if _, ok := authorizeWorkflow(c, h.authz, id, models.PermissionAdmin); !ok {
 		return
 	}
 
-	rows, err := h.db.Query(`
+	rows, err := h.db.QueryContext(dbContext(c), `
 		SELECT wp.id, wp.workflow_id, wp.organization_id, wp.team_id, wp.user_id, wp.permission_level,
 		       u.id, u.email, u.first_name, u.last_name
 		FROM workflow_permissions wp
@@ -983,28 +1377,47 @@ func (h *TeamHandler) GetWorkflowPermissions(c *gin.Context) {
 }
 
 func (h *TeamHandler) UpdateWorkflowPermissions(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
 	workflowID := c.Param("id")
 
-	var ownerCheck int
-	err := h.db.QueryRow(`
-		SELECT COUNT(*) FROM workflows WHERE id = $1 AND user_id = $2
-	`, workflowID, userID).Scan(&ownerCheck)
-	if err != nil || ownerCheck == 0 {
-		c.JSON(http.StatusForbidden, dto.ErrorResponse{Success: false, Error: "Access denied"})
+	if _, ok := authorizeWorkflow(c, h.authz, id, models.PermissionAdmin); !ok {
 		return
 	}
 
 	var req struct {
 		PermissionID    int    `json:"permission_id" binding:"required"`
-		PermissionLevel string `json:"permission_level" binding:"required"`
+		PermissionLevel string `json:"permission_level" binding:"required,oneof=view edit admin"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: err.Error()})
 		return
 	}
 
-	_, err = h.db.Exec(`
+	tx, err := h.db.BeginTx(dbContext(c), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	var previous string
+	err = tx.QueryRowContext(dbContext(c), `
+		SELECT COALESCE(permission_level, '') FROM workflow_permissions
+		WHERE id = $1 AND workflow_id = $2 FOR UPDATE
+	`, req.PermissionID, workflowID).Scan(&previous)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "Permission not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to update permissions"})
+		return
+	}
+
+	_, err = tx.ExecContext(dbContext(c), `
 		UPDATE workflow_permissions SET permission_level = $1
 		WHERE id = $2 AND workflow_id = $3
 	`, req.PermissionLevel, req.PermissionID, workflowID)
@@ -1013,6 +1426,30 @@ func (h *TeamHandler) UpdateWorkflowPermissions(c *gin.Context) {
 		return
 	}
 
+	err = recordActivity(c, tx, audit.Entry{
+		Action:     audit.WorkflowPermissionChanged,
+		WorkflowID: &id,
+		TargetType: audit.TargetPermission,
+		TargetID:   &req.PermissionID,
+		Before:     map[string]interface{}{"permission_level": previous},
+		After:      map[string]interface{}{"permission_level": req.PermissionLevel},
+	})
+	if err != nil {
+		logf(c, "UpdateWorkflowPermissions: failed to record activity for workflow %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to update permissions"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to commit transaction"})
+		return
+	}
+
+	h.events.Publish(id, events.TypePermissions, gin.H{
+		"action":           "updated",
+		"permission_id":    req.PermissionID,
+		"permission_level": req.PermissionLevel,
+	})
+
 	c.JSON(http.StatusOK, dto.SuccessResponse{Success: true, Message: "Permissions updated successfully"})
 }
 
@@ -0,0 +1,495 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"protchain/internal/audit"
+	"protchain/internal/dto"
+	"protchain/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+var errTemplateNotFound = errors.New("template not found")
+
+// GetWorkflowTemplates lists the built-in templates plus those owned by the
+// caller's organizations. Only the latest version of each template is
+// returned unless all_versions=true.
+func (h *WorkflowHandler) GetWorkflowTemplates(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var orgFilter sql.NullInt64
+	if o := c.Query("organization_id"); o != "" {
+		id, err := strconv.Atoi(o)
+		if err != nil || id <= 0 {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: "Invalid organization_id parameter: must be a positive integer"})
+			return
+		}
+		orgFilter = sql.NullInt64{Int64: int64(id), Valid: true}
+	}
+
+	selectClause := "SELECT"
+	if c.Query("all_versions") != "true" {
+		selectClause = "SELECT DISTINCT ON (COALESCE(organization_id, 0), name)"
+	}
+	query := selectClause + `
+		id, organization_id, name, version, description, stages, is_builtin, created_at, updated_at
+		FROM workflow_templates
+		WHERE (is_builtin OR organization_id IN (
+			SELECT organization_id FROM organization_members WHERE user_id = $1
+		))
+		AND ($2::int IS NULL OR is_builtin OR organization_id = $2)
+		ORDER BY COALESCE(organization_id, 0), name, version DESC
+	`
+	rows, err := h.db.QueryContext(dbContext(c), query, userID, orgFilter)
+	if err != nil {
+		logf(c, "GetWorkflowTemplates: failed to list templates: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to fetch workflow templates"})
+		return
+	}
+	defer rows.Close()
+
+	templates := make([]dto.WorkflowTemplateResponse, 0)
+	for rows.Next() {
+		t, err := scanTemplate(rows)
+		if err != nil {
+			logf(c, "GetWorkflowTemplates: failed to scan template: %v", err)
+			continue
+		}
+		templates = append(templates, templateResponse(t))
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Success: true, Data: templates})
+}
+
+// GetWorkflowTemplate returns a single template version
+func (h *WorkflowHandler) GetWorkflowTemplate(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	templateID, ok := parseIDParam(c, "templateId")
+	if !ok {
+		return
+	}
+
+	t, err := loadTemplate(dbContext(c), h.db, templateID, userID)
+	if err == errTemplateNotFound {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "Workflow template not found"})
+		return
+	}
+	if err != nil {
+		logf(c, "GetWorkflowTemplate: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to fetch workflow template"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Success: true, Data: templateResponse(t)})
+}
+
+// CreateWorkflowTemplate creates version 1 of an organization template
+func (h *WorkflowHandler) CreateWorkflowTemplate(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req dto.CreateWorkflowTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: err.Error()})
+		return
+	}
+
+	var role string
+	err := h.db.QueryRowContext(dbContext(c), `
+		SELECT role FROM organization_members
+		WHERE organization_id = $1 AND user_id = $2
+	`, req.OrganizationID, userID).Scan(&role)
+	if err != nil || role != models.RoleAdmin {
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Success: false, Error: "Only organization admins can manage workflow templates"})
+		return
+	}
+
+	stages, err := normalizeStagePlan(req.Stages)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: err.Error()})
+		return
+	}
+	stagesJSON, err := json.Marshal(stages)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to serialize stages"})
+		return
+	}
+
+	tx, err := h.db.BeginTx(dbContext(c), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var t models.WorkflowTemplate
+	err = tx.QueryRowContext(dbContext(c), `
+		INSERT INTO workflow_templates (organization_id, name, version, description, stages, created_by, created_at, updated_at)
+		VALUES ($1, $2, 1, $3, $4, $5, NOW(), NOW())
+		RETURNING id, created_at, updated_at
+	`, req.OrganizationID, req.Name, req.Description, stagesJSON, userID).Scan(&t.ID, &t.CreatedAt, &t.UpdatedAt)
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Success: false, Error: "A template with this name already exists; update it to publish a new version"})
+		return
+	}
+	if err != nil {
+		logf(c, "CreateWorkflowTemplate: failed to insert template: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to create workflow template"})
+		return
+	}
+
+	err = recordActivity(c, tx, audit.Entry{
+		Action:         audit.TemplateCreated,
+		OrganizationID: &req.OrganizationID,
+		TargetType:     audit.TargetTemplate,
+		TargetID:       &t.ID,
+		After:          templateSnapshot(req.Name, 1, req.Description, stages),
+	})
+	if err != nil {
+		logf(c, "CreateWorkflowTemplate: failed to record activity for template %d: %v", t.ID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to create workflow template"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to commit transaction"})
+		return
+	}
+
+	t.OrganizationID = &req.OrganizationID
+	t.Name = req.Name
+	t.Version = 1
+	t.Description = req.Description
+	t.Stages = stages
+
+	c.JSON(http.StatusCreated, dto.SuccessResponse{Success: true, Data: templateResponse(&t)})
+}
+
+// UpdateWorkflowTemplate publishes a new version of an organization
+// template. Existing versions are immutable so workflows created from them
+// keep pointing at the plan they were instantiated with.
+func (h *WorkflowHandler) UpdateWorkflowTemplate(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	templateID, ok := parseIDParam(c, "templateId")
+	if !ok {
+		return
+	}
+
+	var req dto.UpdateWorkflowTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: err.Error()})
+		return
+	}
+
+	base, ok := h.loadWritableTemplate(c, templateID, userID)
+	if !ok {
+		return
+	}
+
+	next := *base
+	if req.Description != nil {
+		next.Description = *req.Description
+	}
+	if len(req.Stages) > 0 {
+		stages, err := normalizeStagePlan(req.Stages)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: err.Error()})
+			return
+		}
+		next.Stages = stages
+	}
+	stagesJSON, err := json.Marshal(next.Stages)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to serialize stages"})
+		return
+	}
+
+	tx, err := h.db.BeginTx(dbContext(c), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(dbContext(c), `
+		INSERT INTO workflow_templates (organization_id, name, version, description, stages, created_by, created_at, updated_at)
+		SELECT $1, $2, COALESCE(MAX(version), 0) + 1, $3, $4, $5, NOW(), NOW()
+		FROM workflow_templates
+		WHERE organization_id = $1 AND name = $2
+		RETURNING id, version, created_at, updated_at
+	`, base.OrganizationID, base.Name, next.Description, stagesJSON, userID).Scan(&next.ID, &next.Version, &next.CreatedAt, &next.UpdatedAt)
+	if isUniqueViolation(err) {
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Success: false, Error: "Template was updated concurrently; retry"})
+		return
+	}
+	if err != nil {
+		logf(c, "UpdateWorkflowTemplate: failed to insert version: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to update workflow template"})
+		return
+	}
+
+	before, after := audit.Diff(
+		templateSnapshot(base.Name, base.Version, base.Description, base.Stages),
+		templateSnapshot(next.Name, next.Version, next.Description, next.Stages),
+	)
+	err = recordActivity(c, tx, audit.Entry{
+		Action:         audit.TemplateUpdated,
+		OrganizationID: base.OrganizationID,
+		TargetType:     audit.TargetTemplate,
+		TargetID:       &next.ID,
+		Before:         before,
+		After:          after,
+		Details:        fmt.Sprintf("new version of template %d", base.ID),
+	})
+	if err != nil {
+		logf(c, "UpdateWorkflowTemplate: failed to record activity for template %d: %v", next.ID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to update workflow template"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Success: true, Data: templateResponse(&next)})
+}
+
+// DeleteWorkflowTemplate removes a single template version that no
+// workflow was created from
+func (h *WorkflowHandler) DeleteWorkflowTemplate(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	templateID, ok := parseIDParam(c, "templateId")
+	if !ok {
+		return
+	}
+
+	t, ok := h.loadWritableTemplate(c, templateID, userID)
+	if !ok {
+		return
+	}
+
+	tx, err := h.db.BeginTx(dbContext(c), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var inUse int
+	if err := tx.QueryRowContext(dbContext(c), `SELECT COUNT(*) FROM workflows WHERE template_id = $1`, templateID).Scan(&inUse); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return
+	}
+	if inUse > 0 {
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Success: false, Error: "Template version is in use by existing workflows"})
+		return
+	}
+
+	if _, err := tx.ExecContext(dbContext(c), `DELETE FROM workflow_templates WHERE id = $1`, templateID); err != nil {
+		logf(c, "DeleteWorkflowTemplate: failed to delete template %d: %v", templateID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to delete workflow template"})
+		return
+	}
+
+	err = recordActivity(c, tx, audit.Entry{
+		Action:         audit.TemplateDeleted,
+		OrganizationID: t.OrganizationID,
+		TargetType:     audit.TargetTemplate,
+		TargetID:       &templateID,
+		Before:         templateSnapshot(t.Name, t.Version, t.Description, t.Stages),
+	})
+	if err != nil {
+		logf(c, "DeleteWorkflowTemplate: failed to record activity for template %d: %v", templateID, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to delete workflow template"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Success: true, Message: "Workflow template deleted successfully"})
+}
+
+// templateSnapshot is the audited state of a template version.
+func templateSnapshot(name string, version int, description string, stages []models.TemplateStage) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        name,
+		"version":     version,
+		"description": description,
+		"stages":      stages,
+	}
+}
+
+// loadWritableTemplate fetches a template and checks the caller is an admin
+// of the owning organization. On failure it writes the response and
+// returns false.
+func (h *WorkflowHandler) loadWritableTemplate(c *gin.Context, templateID int, userID interface{}) (*models.WorkflowTemplate, bool) {
+	t, err := loadTemplate(dbContext(c), h.db, templateID, userID)
+	if err == errTemplateNotFound {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "Workflow template not found"})
+		return nil, false
+	}
+	if err != nil {
+		logf(c, "loadWritableTemplate: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to fetch workflow template"})
+		return nil, false
+	}
+	if t.IsBuiltin {
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Success: false, Error: "Built-in templates cannot be modified"})
+		return nil, false
+	}
+
+	var role string
+	err = h.db.QueryRowContext(dbContext(c), `
+		SELECT role FROM organization_members
+		WHERE organization_id = $1 AND user_id = $2
+	`, *t.OrganizationID, userID).Scan(&role)
+	if err != nil || role != models.RoleAdmin {
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Success: false, Error: "Only organization admins can manage workflow templates"})
+		return nil, false
+	}
+	return t, true
+}
+
+// loadTemplate fetches a template the user can see: a built-in one or one
+// owned by an organization they belong to.
+func loadTemplate(ctx context.Context, db *sql.DB, templateID int, userID interface{}) (*models.WorkflowTemplate, error) {
+	row := db.QueryRowContext(ctx, `
+		SELECT id, organization_id, name, version, description, stages, is_builtin, created_at, updated_at
+		FROM workflow_templates
+		WHERE id = $1 AND (is_builtin OR organization_id IN (
+			SELECT organization_id FROM organization_members WHERE user_id = $2
+		))
+	`, templateID, userID)
+
+	t, err := scanTemplate(row)
+	if err == sql.ErrNoRows {
+		return nil, errTemplateNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch template %d: %w", templateID, err)
+	}
+	return t, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTemplate(row rowScanner) (*models.WorkflowTemplate, error) {
+	var t models.WorkflowTemplate
+	var description sql.NullString
+	var stages []byte
+	if err := row.Scan(&t.ID, &t.OrganizationID, &t.Name, &t.Version, &description, &stages,
+		&t.IsBuiltin, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		return nil, err
+	}
+	t.Description = description.String
+	if err := json.Unmarshal(stages, &t.Stages); err != nil {
+		return nil, fmt.Errorf("invalid stages for template %d: %w", t.ID, err)
+	}
+	return &t, nil
+}
+
+func templateResponse(t *models.WorkflowTemplate) dto.WorkflowTemplateResponse {
+	stages := make([]dto.TemplateStage, len(t.Stages))
+	for i, s := range t.Stages {
+		stages[i] = dto.TemplateStage{Stage: s.Stage, Parameters: s.Parameters}
+	}
+	return dto.WorkflowTemplateResponse{
+		ID:             t.ID,
+		OrganizationID: t.OrganizationID,
+		Name:           t.Name,
+		Version:        t.Version,
+		Description:    t.Description,
+		Stages:         stages,
+		IsBuiltin:      t.IsBuiltin,
+		CreatedAt:      t.CreatedAt,
+		UpdatedAt:      t.UpdatedAt,
+	}
+}
+
+// normalizeStagePlan checks that every stage is a known pipeline stage,
+// appears at most once and in pipeline order, and that its parameters are a
+// JSON object (defaulting to {}).
+func normalizeStagePlan(in []dto.TemplateStage) ([]models.TemplateStage, error) {
+	order := make(map[string]int, len(models.PipelineStages))
+	for i, s := range models.PipelineStages {
+		order[s] = i
+	}
+
+	out := make([]models.TemplateStage, 0, len(in))
+	last := -1
+	for _, s := range in {
+		idx, ok := order[s.Stage]
+		if !ok {
+			return nil, fmt.Errorf("unknown stage %q", s.Stage)
+		}
+		if idx <= last {
+			return nil, fmt.Errorf("stage %q is duplicated or out of pipeline order", s.Stage)
+		}
+		last = idx
+
+		params := s.Parameters
+		if len(params) == 0 || string(params) == "null" {
+			params = json.RawMessage(`{}`)
+		}
+		var obj map[string]interface{}
+		if err := json.Unmarshal(params, &obj); err != nil {
+			return nil, fmt.Errorf("parameters for stage %q must be a JSON object", s.Stage)
+		}
+		out = append(out, models.TemplateStage{Stage: s.Stage, Parameters: params})
+	}
+	return out, nil
+}
+
+// instantiateStagePlan copies a template's stages for a new workflow,
+// shallow-merging any per-stage parameter overrides over the defaults.
+func instantiateStagePlan(t *models.WorkflowTemplate, overrides map[string]json.RawMessage) ([]byte, error) {
+	plan := make([]models.TemplateStage, len(t.Stages))
+	copy(plan, t.Stages)
+
+	for stage, override := range overrides {
+		i := -1
+		for j := range plan {
+			if plan[j].Stage == stage {
+				i = j
+				break
+			}
+		}
+		if i < 0 {
+			return nil, fmt.Errorf("template %q has no stage %q", t.Name, stage)
+		}
+
+		params := map[string]interface{}{}
+		if err := json.Unmarshal(plan[i].Parameters, &params); err != nil {
+			return nil, fmt.Errorf("invalid default parameters for stage %q", stage)
+		}
+		var extra map[string]interface{}
+		if err := json.Unmarshal(override, &extra); err != nil {
+			return nil, fmt.Errorf("stage_parameters for %q must be a JSON object", stage)
+		}
+		for k, v := range extra {
+			params[k] = v
+		}
+		merged, err := json.Marshal(params)
+		if err != nil {
+			return nil, err
+		}
+		plan[i].Parameters = merged
+	}
+
+	return json.Marshal(plan)
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"protchain/internal/dto"
+	"protchain/internal/models"
+)
+
+func TestNormalizeStagePlan(t *testing.T) {
+	plan, err := normalizeStagePlan([]dto.TemplateStage{
+		{Stage: models.StageStructurePreparation},
+		{Stage: models.StageVirtualScreening, Parameters: json.RawMessage(`{"max_compounds":50}`)},
+		{Stage: models.StageMolecularDocking, Parameters: json.RawMessage(`null`)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{`{}`, `{"max_compounds":50}`, `{}`}
+	if len(plan) != len(want) {
+		t.Fatalf("plan = %+v", plan)
+	}
+	for i, s := range plan {
+		if string(s.Parameters) != want[i] {
+			t.Errorf("stage %s parameters = %s, want %s", s.Stage, s.Parameters, want[i])
+		}
+	}
+
+	tests := []struct {
+		name   string
+		stages []dto.TemplateStage
+		want   string
+	}{
+		{"unknown stage", []dto.TemplateStage{{Stage: "folding"}}, `unknown stage "folding"`},
+		{"duplicate", []dto.TemplateStage{{Stage: models.StageVirtualScreening}, {Stage: models.StageVirtualScreening}}, "duplicated or out of pipeline order"},
+		{"out of order", []dto.TemplateStage{{Stage: models.StageMolecularDocking}, {Stage: models.StageVirtualScreening}}, "duplicated or out of pipeline order"},
+		{"parameters not an object", []dto.TemplateStage{{Stage: models.StageVirtualScreening, Parameters: json.RawMessage(`[1]`)}}, "must be a JSON object"},
+	}
+	for _, tt := range tests {
+		if _, err := normalizeStagePlan(tt.stages); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestInstantiateStagePlan(t *testing.T) {
+	tmpl := &models.WorkflowTemplate{
+		Name: "screen",
+		Stages: []models.TemplateStage{
+			{Stage: models.StageVirtualScreening, Parameters: json.RawMessage(`{"max_compounds":50,"library":"fda"}`)},
+			{Stage: models.StageMolecularDocking, Parameters: json.RawMessage(`{}`)},
+		},
+	}
+
+	raw, err := instantiateStagePlan(tmpl, map[string]json.RawMessage{
+		models.StageVirtualScreening: json.RawMessage(`{"max_compounds":10}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"stage":"virtual_screening","parameters":{"library":"fda","max_compounds":10}},{"stage":"molecular_docking","parameters":{}}]`
+	if string(raw) != want {
+		t.Errorf("plan = %s, want %s", raw, want)
+	}
+	// The template itself is left as it was
+	if got := string(tmpl.Stages[0].Parameters); got != `{"max_compounds":50,"library":"fda"}` {
+		t.Errorf("template parameters changed to %s", got)
+	}
+
+	if _, err := instantiateStagePlan(tmpl, map[string]json.RawMessage{models.StageLeadOptimization: json.RawMessage(`{}`)}); err == nil {
+		t.Error("override of a stage missing from the template accepted")
+	}
+	if _, err := instantiateStagePlan(tmpl, map[string]json.RawMessage{models.StageMolecularDocking: json.RawMessage(`"fast"`)}); err == nil {
+		t.Error("override that is not an object accepted")
+	}
+}
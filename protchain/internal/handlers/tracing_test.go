@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"protchain/internal/authz"
+	"protchain/internal/bioapi"
+	"protchain/internal/bioapi/bioapitest"
+	"protchain/internal/events"
+	"protchain/internal/middleware"
+	"protchain/internal/tracing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TestProcessStructureTrace follows a request through the tracing
+// middleware, the traced database and the BioAPI client, and checks that
+// every span joins the caller's trace under the request's span.
+func TestProcessStructureTrace(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	exporter := tracetest.NewInMemoryExporter()
+	shutdown, err := tracing.Setup(context.Background(), tracing.Config{Exporter: exporter, SampleRatio: 1})
+	if err != nil {
+		t.Fatalf("tracing.Setup: %v", err)
+	}
+	t.Cleanup(func() { shutdown(context.Background()) })
+
+	db, _ := newTracedFakeDB(t,
+		fakeRows{
+			match:   "SELECT user_id FROM workflows WHERE id",
+			columns: []string{"user_id"},
+			rows:    [][]driver.Value{{int64(3)}},
+		},
+		fakeRows{
+			match:   "INSERT INTO workflow_stage_results",
+			columns: []string{"id", "run_number"},
+			rows:    [][]driver.Value{{int64(7), int64(1)}},
+		},
+	)
+	srv := bioapitest.NewServer()
+	defer srv.Close()
+	h := NewWorkflowHandler(db, nil, srv.Client(bioapi.Config{}), events.NewBroker(), authz.New(db))
+
+	r := gin.New()
+	r.Use(middleware.Tracing())
+	r.Use(func(c *gin.Context) { c.Set("user_id", 3) })
+	r.POST("/workflows/:id/structure", h.ProcessStructure)
+
+	const (
+		traceID  = "4bf92f3577b34da6a3ce929d0e0e4736"
+		callerID = "00f067aa0ba902b7"
+	)
+	req := httptest.NewRequest(http.MethodPost, "/workflows/42/structure", strings.NewReader(`{"pdbId":"1ABC"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("traceparent", "00-"+traceID+"-"+callerID+"-01")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+
+	spans := exporter.GetSpans()
+	var server *tracetest.SpanStub
+	for i := range spans {
+		if spans[i].SpanKind == trace.SpanKindServer {
+			server = &spans[i]
+		}
+	}
+	if server == nil {
+		t.Fatalf("no server span among %d spans", len(spans))
+	}
+	if server.Name != "POST /workflows/:id/structure" {
+		t.Errorf("server span = %q", server.Name)
+	}
+	if got := server.SpanContext.TraceID().String(); got != traceID {
+		t.Errorf("server span is in trace %s, want the caller's %s", got, traceID)
+	}
+	if got := server.Parent.SpanID().String(); got != callerID || !server.Parent.IsRemote() {
+		t.Errorf("server span parent = %s, want the caller's span %s", got, callerID)
+	}
+
+	var queries []string
+	var client *tracetest.SpanStub
+	for i := range spans {
+		s := &spans[i]
+		if s == server {
+			continue
+		}
+		if s.SpanContext.TraceID() != server.SpanContext.TraceID() {
+			t.Errorf("span %q is in trace %s", s.Name, s.SpanContext.TraceID())
+		}
+		if s.Parent.SpanID() != server.SpanContext.SpanID() {
+			t.Errorf("span %q has parent %s, want the server span %s", s.Name, s.Parent.SpanID(), server.SpanContext.SpanID())
+		}
+		switch {
+		case s.Name == "bioapi "+bioapi.EndpointStructure.Name:
+			client = s
+		case strings.HasPrefix(s.Name, "sql."):
+			if q, ok := attr(s, "db.statement"); ok {
+				queries = append(queries, q)
+			}
+		default:
+			t.Errorf("unexpected span %q", s.Name)
+		}
+	}
+
+	for _, want := range []string{"SELECT user_id FROM workflows", "INSERT INTO workflow_stage_results", "UPDATE workflows SET status"} {
+		found := false
+		for _, q := range queries {
+			found = found || strings.Contains(q, want)
+		}
+		if !found {
+			t.Errorf("no query span for %q among %d", want, len(queries))
+		}
+	}
+
+	if client == nil {
+		t.Fatal("no BioAPI span")
+	}
+	if client.SpanKind != trace.SpanKindClient {
+		t.Errorf("BioAPI span kind = %v, want client", client.SpanKind)
+	}
+	calls := srv.Requests(bioapi.EndpointStructure.Name)
+	if len(calls) != 1 {
+		t.Fatalf("fake saw %d structure requests, want 1", len(calls))
+	}
+	// BioAPI continues the trace under the client span
+	want := "00-" + traceID + "-" + client.SpanContext.SpanID().String() + "-01"
+	if got := calls[0].Header.Get("traceparent"); got != want {
+		t.Errorf("traceparent sent to BioAPI = %q, want %q", got, want)
+	}
+}
+
+// attr returns the string value of a span attribute.
+func attr(s *tracetest.SpanStub, key string) (string, bool) {
+	for _, kv := range s.Attributes {
+		if string(kv.Key) == key {
+			return kv.Value.AsString(), true
+		}
+	}
+	return "", false
+}
@@ -24,7 +24,7 @@ func (h *UserHandler) GetProfile(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 
 	var user models.User
-	err := h.db.QueryRow(`
+	err := h.db.QueryRowContext(dbContext(c), `
 		SELECT id, email, first_name, last_name, created_at, updated_at
 		FROM users WHERE id = $1
 	`, userID).Scan(&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.CreatedAt, &user.UpdatedAt)
@@ -91,7 +91,7 @@ func (h *UserHandler) UpdateProfile(c *gin.Context) {
 
 	// Update user profile
 	if passwordHash != nil {
-		_, err := h.db.Exec(`
+		_, err := h.db.ExecContext(dbContext(c), `
 			UPDATE users
 			SET first_name = $1, last_name = $2, email = $3, password_hash = $4, updated_at = $5
 			WHERE id = $6
@@ -105,7 +105,7 @@ func (h *UserHandler) UpdateProfile(c *gin.Context) {
 			return
 		}
 	} else {
-		_, err := h.db.Exec(`
+		_, err := h.db.ExecContext(dbContext(c), `
 			UPDATE users
 			SET first_name = $1, last_name = $2, email = $3, updated_at = $4
 			WHERE id = $5
@@ -132,7 +132,7 @@ func (h *UserHandler) GetStats(c *gin.Context) {
 	var stats dto.UserStatsResponse
 
 	// Get total workflows
-	err := h.db.QueryRow(`
+	err := h.db.QueryRowContext(dbContext(c), `
 		SELECT COUNT(*) FROM workflows WHERE user_id = $1
 	`, userID).Scan(&stats.TotalWorkflows)
 	if err != nil {
@@ -140,7 +140,7 @@ func (h *UserHandler) GetStats(c *gin.Context) {
 	}
 
 	// Get completed workflows
-	err = h.db.QueryRow(`
+	err = h.db.QueryRowContext(dbContext(c), `
 		SELECT COUNT(*) FROM workflows WHERE user_id = $1 AND status = 'completed'
 	`, userID).Scan(&stats.CompletedWorkflows)
 	if err != nil {
@@ -148,7 +148,7 @@ func (h *UserHandler) GetStats(c *gin.Context) {
 	}
 
 	// Get organization count
-	err = h.db.QueryRow(`
+	err = h.db.QueryRowContext(dbContext(c), `
 		SELECT COUNT(DISTINCT organization_id) FROM organization_members WHERE user_id = $1
 	`, userID).Scan(&stats.OrganizationCount)
 	if err != nil {
@@ -156,7 +156,7 @@ func (h *UserHandler) GetStats(c *gin.Context) {
 	}
 
 	// Get team count
-	err = h.db.QueryRow(`
+	err = h.db.QueryRowContext(dbContext(c), `
 		SELECT COUNT(DISTINCT team_id) FROM team_members WHERE user_id = $1
 	`, userID).Scan(&stats.TeamCount)
 	if err != nil {
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"protchain/internal/chain"
+	"protchain/internal/dto"
+	"protchain/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// VerifyWorkflow checks a committed workflow against the chain. It reads
+// the ResultRecorded event of the commit transaction and the stored
+// screening result, then recomputes the result hash from the IPFS bundle
+// and from the database, and the molecule data hash from the inputs.
+func (h *ProvenanceHandler) VerifyWorkflow(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := authorizeWorkflow(c, h.authz, id, models.PermissionView); !ok {
+		return
+	}
+	if h.chain == nil {
+		c.JSON(http.StatusServiceUnavailable, dto.ErrorResponse{Success: false, Error: "Blockchain verification is not configured on this server"})
+		return
+	}
+
+	var txHash, cid, currentCID, digest sql.NullString
+	if err := h.db.QueryRowContext(dbContext(c), `
+		SELECT blockchain_tx_hash, ipfs_hash, ipfs_bundle_sha256 FROM workflows WHERE id = $1
+	`, id).Scan(&txHash, &currentCID, &digest); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return
+	}
+	cid = currentCID
+	// Prefer the latest server-side commit, which records the CID it anchored
+	err := h.db.QueryRowContext(dbContext(c), `
+		SELECT tx_hash, ipfs_hash FROM blockchain_commits
+		WHERE workflow_id = $1 AND status = $2
+		ORDER BY confirmed_at DESC LIMIT 1
+	`, id, models.CommitConfirmed).Scan(&txHash, &cid)
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return
+	}
+	if !txHash.Valid || txHash.String == "" {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "Workflow has not been committed to the blockchain"})
+		return
+	}
+
+	report := dto.VerificationReport{
+		WorkflowID:      id,
+		TxHash:          txHash.String,
+		ContractAddress: h.chain.Contract(),
+		IPFSHash:        cid.String,
+		Checks:          []dto.VerificationCheck{},
+		CheckedAt:       time.Now(),
+	}
+	check := func(name, expected, actual, detail string) {
+		report.Checks = append(report.Checks, dto.VerificationCheck{
+			Name:     name,
+			Expected: expected,
+			Actual:   actual,
+			Match:    expected != "" && strings.EqualFold(expected, actual),
+			Detail:   detail,
+		})
+	}
+
+	ctx := c.Request.Context()
+	receipt, err := h.chain.Receipt(ctx, txHash.String)
+	switch {
+	case errors.Is(err, chain.ErrNoEvent):
+		check("result_recorded_event", "ResultRecorded", "", "The transaction did not emit ResultRecorded from the verifier contract")
+		c.JSON(http.StatusOK, dto.SuccessResponse{Success: true, Data: report})
+		return
+	case err != nil:
+		logf(c, "VerifyWorkflow: failed to fetch receipt %s: %v", txHash.String, err)
+		c.JSON(http.StatusBadGateway, dto.ErrorResponse{Success: false, Error: "Failed to read from blockchain node"})
+		return
+	case receipt == nil:
+		check("result_recorded_event", "ResultRecorded", "", "Transaction not found or not yet mined")
+		c.JSON(http.StatusOK, dto.SuccessResponse{Success: true, Data: report})
+		return
+	case receipt.NumericID == nil:
+		report.BlockNumber = receipt.BlockNumber
+		check("result_recorded_event", "ResultRecorded", "", "Transaction reverted")
+		c.JSON(http.StatusOK, dto.SuccessResponse{Success: true, Data: report})
+		return
+	}
+	check("result_recorded_event", "ResultRecorded", "ResultRecorded", "")
+
+	report.BlockNumber = receipt.BlockNumber
+	report.NumericID = receipt.NumericID.String()
+	report.ResultID = receipt.ResultID
+	if t, err := h.chain.BlockTime(ctx, receipt.BlockNumber); err == nil {
+		report.BlockTimestamp = &t
+	} else {
+		logf(c, "VerifyWorkflow: failed to fetch block %d: %v", receipt.BlockNumber, err)
+	}
+
+	stored, err := h.chain.GetScreeningResult(ctx, receipt.NumericID)
+	if err != nil {
+		logf(c, "VerifyWorkflow: failed to read result %s: %v", report.NumericID, err)
+		c.JSON(http.StatusBadGateway, dto.ErrorResponse{Success: false, Error: "Failed to read from blockchain node"})
+		return
+	}
+	report.Researcher = stored.Researcher
+	report.MoleculeID = stored.MoleculeID
+	report.Verified = stored.Verified
+
+	check("result_id", receipt.ResultID, stored.ResultID, "Event result ID against the stored result")
+	check("researcher", receipt.Researcher, stored.Researcher, "Event researcher against the stored result")
+
+	if cid.String == "" {
+		check("result_hash_ipfs", "", stored.ResultHash, "No IPFS bundle is recorded for this workflow")
+	} else if data, err := h.ipfs.Cat(ctx, cid.String, h.maxBundle); err != nil {
+		logf(c, "VerifyWorkflow: failed to fetch %s: %v", cid.String, err)
+		check("result_hash_ipfs", "", stored.ResultHash, "Could not fetch the bundle from IPFS")
+	} else {
+		sum := chain.Keccak256(data)
+		check("result_hash_ipfs", "0x"+hex.EncodeToString(sum[:]), stored.ResultHash, "Keccak-256 of the IPFS bundle")
+		// The digest recorded at publication only describes the current CID
+		if digest.Valid && cid.String == currentCID.String {
+			sha := sha256.Sum256(data)
+			check("ipfs_bundle_sha256", digest.String, hex.EncodeToString(sha[:]), "SHA-256 recorded at publication against the fetched bundle")
+		}
+	}
+
+	if bundle, _, err := buildBundle(ctx, h.db, id); err != nil {
+		logf(c, "VerifyWorkflow: failed to build bundle for workflow %d: %v", id, err)
+		check("result_hash_current", "", stored.ResultHash, "Could not rebuild the bundle from stored results")
+	} else {
+		sum := chain.Keccak256(bundle)
+		check("result_hash_current", "0x"+hex.EncodeToString(sum[:]), stored.ResultHash, "Keccak-256 of the bundle rebuilt from stored results")
+	}
+
+	if sum, err := moleculeDataHash(ctx, h.db, id); err != nil {
+		logf(c, "VerifyWorkflow: failed to hash inputs of workflow %d: %v", id, err)
+		check("molecule_data_hash", "", stored.MoleculeDataHash, "Could not hash the workflow inputs")
+	} else {
+		check("molecule_data_hash", "0x"+hex.EncodeToString(sum[:]), stored.MoleculeDataHash, "Keccak-256 of the input artifact digests")
+	}
+
+	report.Match = true
+	for _, ch := range report.Checks {
+		report.Match = report.Match && ch.Match
+	}
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Success: true, Data: report})
+}
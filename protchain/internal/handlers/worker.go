@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"protchain/internal/bioapi"
+	"protchain/internal/dto"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WorkerHandler serves the BioAPI worker registry. Workers authenticate
+// with the shared worker token rather than as users.
+type WorkerHandler struct {
+	registry *bioapi.Registry
+	pool     *bioapi.Pool
+}
+
+func NewWorkerHandler(registry *bioapi.Registry, pool *bioapi.Pool) *WorkerHandler {
+	return &WorkerHandler{registry: registry, pool: pool}
+}
+
+// ListWorkers returns the health and load of every worker known to this
+// replica.
+func (h *WorkerHandler) ListWorkers(c *gin.Context) {
+	c.JSON(http.StatusOK, dto.SuccessResponse{Success: true, Data: h.pool.Workers()})
+}
+
+// RegisterWorker adds a worker to the pool, or renews it if its URL is
+// already registered. The worker must then heartbeat within the TTL.
+func (h *WorkerHandler) RegisterWorker(c *gin.Context) {
+	var req dto.RegisterWorkerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: err.Error()})
+		return
+	}
+
+	spec, err := h.registry.Register(c.Request.Context(), req.URL, req.Capabilities)
+	if err != nil {
+		logf(c, "RegisterWorker: failed to register %s: %v", req.URL, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to register worker"})
+		return
+	}
+	h.pool.Add(spec)
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Success: true, Data: h.registration(spec)})
+}
+
+// WorkerHeartbeat renews a registration. A 404 tells the worker to
+// register again.
+func (h *WorkerHandler) WorkerHeartbeat(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	spec, err := h.registry.Heartbeat(c.Request.Context(), id)
+	if errors.Is(err, bioapi.ErrWorkerNotFound) {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "Worker not registered"})
+		return
+	}
+	if err != nil {
+		logf(c, "WorkerHeartbeat: failed to renew worker %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to renew registration"})
+		return
+	}
+	h.pool.Add(spec)
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Success: true, Data: h.registration(spec)})
+}
+
+// DeregisterWorker removes a worker, e.g. when it shuts down. Calls
+// already routed to it are allowed to finish.
+func (h *WorkerHandler) DeregisterWorker(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	url, err := h.registry.Deregister(c.Request.Context(), id)
+	if errors.Is(err, bioapi.ErrWorkerNotFound) {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "Worker not registered"})
+		return
+	}
+	if err != nil {
+		logf(c, "DeregisterWorker: failed to remove worker %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to deregister worker"})
+		return
+	}
+	h.pool.Remove(url)
+
+	c.JSON(http.StatusOK, dto.SuccessResponse{Success: true, Message: "Worker deregistered"})
+}
+
+func (h *WorkerHandler) registration(spec bioapi.WorkerSpec) dto.WorkerRegistrationResponse {
+	id, _ := strconv.Atoi(spec.ID)
+	return dto.WorkerRegistrationResponse{
+		ID:           id,
+		URL:          spec.URL,
+		Capabilities: spec.Capabilities,
+		TTLSeconds:   int(h.registry.TTL().Seconds()),
+	}
+}
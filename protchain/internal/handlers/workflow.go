@@ -1,28 +1,41 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	"protchain/internal/audit"
+	"protchain/internal/authz"
+	"protchain/internal/bioapi"
 	"protchain/internal/dto"
+	"protchain/internal/events"
+	"protchain/internal/jobs"
 	"protchain/internal/models"
+	"protchain/internal/results"
 
+	"github.com/gin-contrib/sse"
 	"github.com/gin-gonic/gin"
 )
 
 type WorkflowHandler struct {
-	db *sql.DB
+	db     *sql.DB
+	jobs   *jobs.Manager
+	bioapi *bioapi.Client
+	events *events.Broker
+	authz  *authz.Service
 }
 
-func NewWorkflowHandler(db *sql.DB) *WorkflowHandler {
-	return &WorkflowHandler{db: db}
+func NewWorkflowHandler(db *sql.DB, jobManager *jobs.Manager, bioapiClient *bioapi.Client, broker *events.Broker, az *authz.Service) *WorkflowHandler {
+	return &WorkflowHandler{db: db, jobs: jobManager, bioapi: bioapiClient, events: broker, authz: az}
 }
 
 func (h *WorkflowHandler) ListWorkflows(c *gin.Context) {
@@ -36,26 +49,30 @@ func (h *WorkflowHandler) ListWorkflows(c *gin.Context) {
 	}
 
 	page, perPage, offset := parsePagination(c)
+	orgID := keyOrganizationArg(c)
 
 	// Get total count
 	var total int
-	if err := h.db.QueryRow(`SELECT COUNT(*) FROM workflows WHERE user_id = $1`, userID).Scan(&total); err != nil {
-		log.Printf("failed to count workflows: %s", err)
+	if err := h.db.QueryRowContext(dbContext(c), `
+		SELECT COUNT(*) FROM workflows
+		WHERE user_id = $1 AND ($2::int IS NULL OR team_id IN (SELECT id FROM teams WHERE organization_id = $2))
+	`, userID, orgID).Scan(&total); err != nil {
+		logf(c, "failed to count workflows: %s", err)
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to fetch workflows"})
 		return
 	}
 
-	rows, err := h.db.Query(`
+	rows, err := h.db.QueryContext(dbContext(c), `
 		SELECT id, user_id, name, description, status, results, blockchain_tx_hash, ipfs_hash,
 		       blockchain_committed_at, created_at, updated_at, team_id
 		FROM workflows
-		WHERE user_id = $1
+		WHERE user_id = $1 AND ($4::int IS NULL OR team_id IN (SELECT id FROM teams WHERE organization_id = $4))
 		ORDER BY created_at DESC
 		LIMIT $2 OFFSET $3
-	`, userID, perPage, offset)
+	`, userID, perPage, offset, orgID)
 
 	if err != nil {
-		log.Printf("failed to list workflow information: %s", err)
+		logf(c, "failed to list workflow information: %s", err)
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Success: false,
 			Error:   "Failed to fetch workflows",
@@ -71,7 +88,7 @@ func (h *WorkflowHandler) ListWorkflows(c *gin.Context) {
 			&w.BlockchainTxHash, &w.IPFSHash, &w.BlockchainCommittedAt,
 			&w.CreatedAt, &w.UpdatedAt, &w.TeamID)
 		if err != nil {
-			log.Printf("failed to scan workflow: %s", err)
+			logf(c, "failed to scan workflow: %s", err)
 			continue
 		}
 
@@ -109,6 +126,91 @@ func (h *WorkflowHandler) ListWorkflows(c *gin.Context) {
 	})
 }
 
+// ListSharedWorkflows lists workflows owned by someone else that the caller
+// can access through a grant, a team or an organization, with the caller's
+// effective permission on each
+func (h *WorkflowHandler) ListSharedWorkflows(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	page, perPage, offset := parsePagination(c)
+	orgID := keyOrganizationArg(c)
+
+	var total int
+	if err := h.db.QueryRowContext(dbContext(c), `
+		SELECT COUNT(DISTINCT g.workflow_id)
+		FROM (`+authz.GrantsQuery+`) g
+		JOIN workflows w ON w.id = g.workflow_id
+		WHERE w.user_id <> $1 AND g.rank > 0
+		  AND ($2::int IS NULL OR w.team_id IN (SELECT id FROM teams WHERE organization_id = $2))
+	`, userID, orgID).Scan(&total); err != nil {
+		logf(c, "failed to count shared workflows: %s", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to fetch workflows"})
+		return
+	}
+
+	rows, err := h.db.QueryContext(dbContext(c), `
+		SELECT w.id, w.user_id, w.name, w.description, w.status, w.blockchain_tx_hash, w.ipfs_hash,
+		       w.blockchain_committed_at, w.created_at, w.updated_at, s.rank
+		FROM (
+			SELECT g.workflow_id, MAX(g.rank) AS rank
+			FROM (`+authz.GrantsQuery+`) g
+			GROUP BY g.workflow_id
+		) s
+		JOIN workflows w ON w.id = s.workflow_id
+		WHERE w.user_id <> $1 AND s.rank > 0
+		  AND ($4::int IS NULL OR w.team_id IN (SELECT id FROM teams WHERE organization_id = $4))
+		ORDER BY w.updated_at DESC
+		LIMIT $2 OFFSET $3
+	`, userID, perPage, offset, orgID)
+	if err != nil {
+		logf(c, "failed to list shared workflows: %s", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to fetch workflows"})
+		return
+	}
+	defer rows.Close()
+
+	workflows := make([]dto.WorkflowResponse, 0)
+	for rows.Next() {
+		var w models.Workflow
+		var rank int
+		if err := rows.Scan(&w.ID, &w.UserID, &w.Name, &w.Description, &w.Status,
+			&w.BlockchainTxHash, &w.IPFSHash, &w.BlockchainCommittedAt,
+			&w.CreatedAt, &w.UpdatedAt, &rank); err != nil {
+			logf(c, "failed to scan shared workflow: %s", err)
+			continue
+		}
+
+		description := ""
+		if w.Description != nil {
+			description = *w.Description
+		}
+
+		workflows = append(workflows, dto.WorkflowResponse{
+			ID:                    w.ID,
+			Name:                  w.Name,
+			Description:           description,
+			Status:                w.Status,
+			BlockchainTxHash:      w.BlockchainTxHash,
+			IPFSHash:              w.IPFSHash,
+			BlockchainCommittedAt: w.BlockchainCommittedAt,
+			Permission:            authz.LevelForRank(rank),
+			OwnerID:               w.UserID,
+			CreatedAt:             w.CreatedAt,
+			UpdatedAt:             w.UpdatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, dto.PaginatedResponse{
+		Success: true,
+		Data:    workflows,
+		Pagination: dto.PaginationMeta{
+			Page:       page,
+			PerPage:    perPage,
+			Total:      total,
+			TotalPages: totalPages(total, perPage),
+		},
+	})
+}
+
 func (h *WorkflowHandler) CreateWorkflow(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -128,12 +230,66 @@ func (h *WorkflowHandler) CreateWorkflow(c *gin.Context) {
 		return
 	}
 
+	var stagePlan []byte
+	if req.TemplateID != nil {
+		t, err := loadTemplate(dbContext(c), h.db, *req.TemplateID, userID)
+		if err == errTemplateNotFound {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Success: false,
+				Error:   "Workflow template not found",
+			})
+			return
+		}
+		if err != nil {
+			logf(c, "error loading workflow template: %v", err)
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+				Success: false,
+				Error:   "Failed to load workflow template",
+			})
+			return
+		}
+		stagePlan, err = instantiateStagePlan(t, req.StageParameters)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+	} else if len(req.StageParameters) > 0 {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Success: false,
+			Error:   "stage_parameters requires template_id",
+		})
+		return
+	}
+
 	var workflowID int
 		// Get user's default team_id
 	var teamID int
-	err := h.db.QueryRow(`SELECT team_id FROM team_members WHERE user_id = $1 AND role = $2`, userID, models.RoleOwner).Scan(&teamID)
+	var err error
+	if orgID, ok := keyOrganization(c); ok {
+		// Service keys file the workflow in their own organization,
+		// under the caller's team there
+		err = h.db.QueryRowContext(dbContext(c), `
+			SELECT tm.team_id FROM team_members tm
+			JOIN teams t ON t.id = tm.team_id
+			WHERE tm.user_id = $1 AND t.organization_id = $2
+			ORDER BY tm.role = $3 DESC, tm.team_id
+			LIMIT 1
+		`, userID, orgID, models.RoleOwner).Scan(&teamID)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Success: false,
+				Error:   "You are not a member of any team in this API key's organization",
+			})
+			return
+		}
+	} else {
+		err = h.db.QueryRowContext(dbContext(c), `SELECT team_id FROM team_members WHERE user_id = $1 AND role = $2`, userID, models.RoleOwner).Scan(&teamID)
+	}
 	if err != nil && err != sql.ErrNoRows {
-		log.Printf("error selecting team id: %v", err)
+		logf(c, "error selecting team id: %v", err)
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Success: false,
 			Error:   "Failed to find user team",
@@ -141,14 +297,21 @@ func (h *WorkflowHandler) CreateWorkflow(c *gin.Context) {
 		return
 	}
 
-	err = h.db.QueryRow(`
-		INSERT INTO workflows (user_id, team_id, name, description, status, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	tx, err := h.db.BeginTx(dbContext(c), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(dbContext(c), `
+		INSERT INTO workflows (user_id, team_id, name, description, status, template_id, stage_plan, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 		RETURNING id
-	`, userID, teamID, req.Name, req.Description, models.StatusDraft, time.Now(), time.Now()).Scan(&workflowID)
+	`, userID, teamID, req.Name, req.Description, models.StatusDraft, req.TemplateID, stagePlan, time.Now(), time.Now()).Scan(&workflowID)
 
 	if err != nil {
-		log.Printf("error creating workflow: %v", err)
+		logf(c, "error creating workflow: %v", err)
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Success: false,
 			Error:   "Failed to create workflow",
@@ -156,6 +319,28 @@ func (h *WorkflowHandler) CreateWorkflow(c *gin.Context) {
 		return
 	}
 
+	err = recordActivity(c, tx, audit.Entry{
+		Action:     audit.WorkflowCreated,
+		WorkflowID: &workflowID,
+		TargetType: audit.TargetWorkflow,
+		TargetID:   &workflowID,
+		After: map[string]interface{}{
+			"name":        req.Name,
+			"description": req.Description,
+			"status":      models.StatusDraft,
+			"template_id": req.TemplateID,
+		},
+	})
+	if err != nil {
+		logf(c, "error recording workflow creation: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to create workflow"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to commit transaction"})
+		return
+	}
+
 	now := time.Now()
 	c.JSON(http.StatusCreated, dto.SuccessResponse{
 		Success: true,
@@ -164,6 +349,8 @@ func (h *WorkflowHandler) CreateWorkflow(c *gin.Context) {
 			Name:        req.Name,
 			Description: req.Description,
 			Status:      models.StatusDraft,
+			TemplateID:  req.TemplateID,
+			StagePlan:   stagePlan,
 			CreatedAt:   now,
 			UpdatedAt:   now,
 		},
@@ -171,8 +358,12 @@ func (h *WorkflowHandler) CreateWorkflow(c *gin.Context) {
 }
 
 func (h *WorkflowHandler) GetWorkflow(c *gin.Context) {
-	userID, _ := c.Get("user_id")
-	if _, ok := parseIDParam(c, "id"); !ok {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	permission, ok := authorizeWorkflow(c, h.authz, id, models.PermissionView)
+	if !ok {
 		return
 	}
 	workflowID := c.Param("id")
@@ -181,14 +372,14 @@ func (h *WorkflowHandler) GetWorkflow(c *gin.Context) {
 	var description, results, blockchainTxHash, ipfsHash sql.NullString
 	var blockchainCommittedAt sql.NullTime
 	
-	err := h.db.QueryRow(`
+	err := h.db.QueryRowContext(dbContext(c), `
 		SELECT id, name, description, status, results, blockchain_tx_hash, ipfs_hash,
-		       blockchain_committed_at, created_at, updated_at
+		       blockchain_committed_at, template_id, stage_plan, created_at, updated_at
 		FROM workflows 
-		WHERE id = $1 AND user_id = $2
-	`, workflowID, userID).Scan(&w.ID, &w.Name, &description, &w.Status, &results,
+		WHERE id = $1
+	`, workflowID).Scan(&w.ID, &w.Name, &description, &w.Status, &results,
 		&blockchainTxHash, &ipfsHash, &blockchainCommittedAt,
-		&w.CreatedAt, &w.UpdatedAt)
+		&w.TemplateID, &w.StagePlan, &w.CreatedAt, &w.UpdatedAt)
 	
 	// Convert sql.NullString to *string
 	if description.Valid {
@@ -244,6 +435,9 @@ func (h *WorkflowHandler) GetWorkflow(c *gin.Context) {
 			BlockchainTxHash:      w.BlockchainTxHash,
 			IPFSHash:              w.IPFSHash,
 			BlockchainCommittedAt: w.BlockchainCommittedAt,
+			TemplateID:            w.TemplateID,
+			StagePlan:             w.StagePlan,
+			Permission:            permission,
 			CreatedAt:             w.CreatedAt,
 			UpdatedAt:             w.UpdatedAt,
 		},
@@ -251,8 +445,11 @@ func (h *WorkflowHandler) GetWorkflow(c *gin.Context) {
 }
 
 func (h *WorkflowHandler) UpdateWorkflow(c *gin.Context) {
-	userID, _ := c.Get("user_id")
-	if _, ok := parseIDParam(c, "id"); !ok {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := authorizeWorkflow(c, h.authz, id, models.PermissionEdit); !ok {
 		return
 	}
 	workflowID := c.Param("id")
@@ -266,11 +463,32 @@ func (h *WorkflowHandler) UpdateWorkflow(c *gin.Context) {
 		return
 	}
 
-	_, err := h.db.Exec(`
+	tx, err := h.db.BeginTx(dbContext(c), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var name, description, status, results string
+	err = tx.QueryRowContext(dbContext(c), `
+		SELECT name, COALESCE(description, ''), COALESCE(status, ''), COALESCE(results, '')
+		FROM workflows WHERE id = $1 FOR UPDATE
+	`, workflowID).Scan(&name, &description, &status, &results)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "Workflow not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to update workflow"})
+		return
+	}
+
+	_, err = tx.ExecContext(dbContext(c), `
 		UPDATE workflows 
 		SET name = $1, description = $2, status = $3, results = $4, updated_at = $5
-		WHERE id = $6 AND user_id = $7
-	`, req.Name, req.Description, req.Status, req.Results, time.Now(), workflowID, userID)
+		WHERE id = $6
+	`, req.Name, req.Description, req.Status, req.Results, time.Now(), workflowID)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
@@ -280,6 +498,32 @@ func (h *WorkflowHandler) UpdateWorkflow(c *gin.Context) {
 		return
 	}
 
+	before, after := audit.Diff(
+		map[string]interface{}{"name": name, "description": description, "status": status, "results": results},
+		map[string]interface{}{"name": req.Name, "description": req.Description, "status": req.Status, "results": req.Results},
+	)
+	err = recordActivity(c, tx, audit.Entry{
+		Action:     audit.WorkflowUpdated,
+		WorkflowID: &id,
+		TargetType: audit.TargetWorkflow,
+		TargetID:   &id,
+		Before:     before,
+		After:      after,
+	})
+	if err != nil {
+		logf(c, "UpdateWorkflow: failed to record activity for workflow %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to update workflow"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to commit transaction"})
+		return
+	}
+
+	if req.Status != "" {
+		h.publishStatus(id, req.Status)
+	}
+
 	c.JSON(http.StatusOK, dto.SuccessResponse{
 		Success: true,
 		Message: "Workflow updated successfully",
@@ -287,7 +531,13 @@ func (h *WorkflowHandler) UpdateWorkflow(c *gin.Context) {
 }
 
 func (h *WorkflowHandler) UpdateWorkflowBlockchainInfo(c *gin.Context) {
-	userID, _ := c.Get("user_id")
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := authorizeWorkflow(c, h.authz, id, models.PermissionEdit); !ok {
+		return
+	}
 	workflowID := c.Param("id")
 
 	var req dto.UpdateWorkflowBlockchainRequest
@@ -299,12 +549,44 @@ func (h *WorkflowHandler) UpdateWorkflowBlockchainInfo(c *gin.Context) {
 		return
 	}
 
+	tx, err := h.db.BeginTx(dbContext(c), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var txHash, ipfsHash string
+	err = tx.QueryRowContext(dbContext(c), `
+		SELECT COALESCE(blockchain_tx_hash, ''), COALESCE(ipfs_hash, '')
+		FROM workflows WHERE id = $1 FOR UPDATE
+	`, workflowID).Scan(&txHash, &ipfsHash)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "Workflow not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to update workflow blockchain info"})
+		return
+	}
+
+	// The CID is set by the server when it publishes the bundle; the client
+	// only reports the transaction that anchored it
+	if ipfsHash == "" {
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Success: false, Error: "Publish the workflow bundle to IPFS before committing it"})
+		return
+	}
+	if req.IPFSHash != "" && req.IPFSHash != ipfsHash {
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Success: false, Error: "ipfs_hash does not match the published workflow bundle"})
+		return
+	}
+
 	now := time.Now()
-	_, err := h.db.Exec(`
+	_, err = tx.ExecContext(dbContext(c), `
 		UPDATE workflows 
-		SET blockchain_tx_hash = $1, ipfs_hash = $2, blockchain_committed_at = $3, updated_at = $4
-		WHERE id = $5 AND user_id = $6
-	`, req.BlockchainTxHash, req.IPFSHash, now, now, workflowID, userID)
+		SET blockchain_tx_hash = $1, blockchain_committed_at = $2, updated_at = $3
+		WHERE id = $4
+	`, req.BlockchainTxHash, now, now, workflowID)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
@@ -314,6 +596,28 @@ func (h *WorkflowHandler) UpdateWorkflowBlockchainInfo(c *gin.Context) {
 		return
 	}
 
+	before, after := audit.Diff(
+		map[string]interface{}{"blockchain_tx_hash": txHash},
+		map[string]interface{}{"blockchain_tx_hash": req.BlockchainTxHash, "ipfs_hash": ipfsHash},
+	)
+	err = recordActivity(c, tx, audit.Entry{
+		Action:     audit.WorkflowBlockchainCommitted,
+		WorkflowID: &id,
+		TargetType: audit.TargetWorkflow,
+		TargetID:   &id,
+		Before:     before,
+		After:      after,
+	})
+	if err != nil {
+		logf(c, "UpdateWorkflowBlockchainInfo: failed to record activity for workflow %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to update workflow blockchain info"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to commit transaction"})
+		return
+	}
+
 	c.JSON(http.StatusOK, dto.SuccessResponse{
 		Success: true,
 		Message: "Workflow blockchain info updated successfully",
@@ -321,13 +625,16 @@ func (h *WorkflowHandler) UpdateWorkflowBlockchainInfo(c *gin.Context) {
 }
 
 func (h *WorkflowHandler) DeleteWorkflow(c *gin.Context) {
-	userID, _ := c.Get("user_id")
-	if _, ok := parseIDParam(c, "id"); !ok {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := authorizeWorkflow(c, h.authz, id, models.PermissionAdmin); !ok {
 		return
 	}
 	workflowID := c.Param("id")
 
-	tx, err := h.db.Begin()
+	tx, err := h.db.BeginTx(dbContext(c), nil)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to start transaction"})
 		return
@@ -336,17 +643,52 @@ func (h *WorkflowHandler) DeleteWorkflow(c *gin.Context) {
 		_ = tx.Rollback()
 	}()
 
+	var snapshot struct {
+		name, status string
+		ownerID      int
+	}
+	err = tx.QueryRowContext(dbContext(c), `
+		SELECT name, COALESCE(status, ''), user_id FROM workflows WHERE id = $1 FOR UPDATE
+	`, workflowID).Scan(&snapshot.name, &snapshot.status, &snapshot.ownerID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "Workflow not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to delete workflow"})
+		return
+	}
+
+	// Record before deleting so the entry can still be filed under the
+	// workflow's organization
+	err = recordActivity(c, tx, audit.Entry{
+		Action:     audit.WorkflowDeleted,
+		WorkflowID: &id,
+		TargetType: audit.TargetWorkflow,
+		TargetID:   &id,
+		Before: map[string]interface{}{
+			"name":     snapshot.name,
+			"status":   snapshot.status,
+			"owner_id": snapshot.ownerID,
+		},
+	})
+	if err != nil {
+		logf(c, "DeleteWorkflow: failed to record activity for workflow %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to delete workflow"})
+		return
+	}
+
 	// Delete dependent permissions first to avoid FK constraint errors
-	if _, err := tx.Exec(`DELETE FROM workflow_permissions WHERE workflow_id = $1`, workflowID); err != nil {
+	if _, err := tx.ExecContext(dbContext(c), `DELETE FROM workflow_permissions WHERE workflow_id = $1`, workflowID); err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to delete workflow permissions"})
 		return
 	}
 
 	// Then delete the workflow row
-	result, err := tx.Exec(`
+	result, err := tx.ExecContext(dbContext(c), `
 		DELETE FROM workflows 
-		WHERE id = $1 AND user_id = $2
-	`, workflowID, userID)
+		WHERE id = $1
+	`, workflowID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to delete workflow"})
 		return
@@ -354,7 +696,7 @@ func (h *WorkflowHandler) DeleteWorkflow(c *gin.Context) {
 
 	rowsAffected, raErr := result.RowsAffected()
 	if raErr != nil {
-		log.Printf("DeleteWorkflow: RowsAffected error: %v", raErr)
+		logf(c, "DeleteWorkflow: RowsAffected error: %v", raErr)
 	}
 	if rowsAffected == 0 {
 		c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "Workflow not found"})
@@ -369,61 +711,25 @@ func (h *WorkflowHandler) DeleteWorkflow(c *gin.Context) {
 	c.JSON(http.StatusOK, dto.SuccessResponse{Success: true, Message: "Workflow deleted successfully"})
 }
 
-func (h *WorkflowHandler) GetWorkflowPDB(c *gin.Context) {
-	workflowID := c.Param("id")
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
-			Success: false,
-			Error:   "User not authenticated",
-		})
-		return
-	}
-
-	// Check if workflow belongs to user
-	var count int
-	err := h.db.QueryRow(`
-		SELECT COUNT(*) FROM workflows 
-		WHERE id = $1 AND user_id = $2
-	`, workflowID, userID).Scan(&count)
-
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
-			Success: false,
-			Error:   "Database error",
-		})
+// GetWorkflowStatus returns the current status of a workflow
+func (h *WorkflowHandler) GetWorkflowStatus(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
 		return
 	}
-
-	if count == 0 {
-		c.JSON(http.StatusNotFound, dto.ErrorResponse{
-			Success: false,
-			Error:   "Workflow not found",
-		})
+	if _, ok := authorizeWorkflow(c, h.authz, id, models.PermissionView); !ok {
 		return
 	}
-
-	// Return 404 since no PDB data is stored for this workflow yet
-	// Frontend will handle fetching from RCSB based on workflow name
-	c.JSON(http.StatusNotFound, dto.ErrorResponse{
-		Success: false,
-		Error:   "No PDB data stored for this workflow",
-	})
-}
-
-// GetWorkflowStatus returns the current status of a workflow
-func (h *WorkflowHandler) GetWorkflowStatus(c *gin.Context) {
-	userID, _ := c.Get("user_id")
 	workflowID := c.Param("id")
 
 	var workflow models.Workflow
 	var description, results sql.NullString
 	
-	err := h.db.QueryRow(`
+	err := h.db.QueryRowContext(dbContext(c), `
 		SELECT id, user_id, name, description, status, results, created_at, updated_at
 		FROM workflows 
-		WHERE id = $1 AND user_id = $2
-	`, workflowID, userID).Scan(
+		WHERE id = $1
+	`, workflowID).Scan(
 		&workflow.ID, &workflow.UserID, &workflow.Name, &description,
 		&workflow.Status, &results, &workflow.CreatedAt, &workflow.UpdatedAt,
 	)
@@ -467,31 +773,160 @@ func (h *WorkflowHandler) GetWorkflowStatus(c *gin.Context) {
 	})
 }
 
-// GetWorkflowResults returns the results of a workflow
-func (h *WorkflowHandler) GetWorkflowResults(c *gin.Context) {
-	userID, _ := c.Get("user_id")
-	workflowID := c.Param("id")
+// StreamWorkflowEvents streams status transitions, job progress, log lines
+// and completion events for a workflow as Server-Sent Events. Clients that
+// reconnect with Last-Event-ID receive whatever they missed that is still
+// in the broker's history.
+func (h *WorkflowHandler) StreamWorkflowEvents(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := authorizeWorkflow(c, h.authz, id, models.PermissionView); !ok {
+		return
+	}
 
-	var workflow models.Workflow
-	var description, results sql.NullString
-	
-	err := h.db.QueryRow(`
-		SELECT id, user_id, name, description, status, results, created_at, updated_at
-		FROM workflows 
-		WHERE id = $1 AND user_id = $2
-	`, workflowID, userID).Scan(
-		&workflow.ID, &workflow.UserID, &workflow.Name, &description,
-		&workflow.Status, &results, &workflow.CreatedAt, &workflow.UpdatedAt,
-	)
+	var status string
+	err := h.db.QueryRowContext(dbContext(c), `
+		SELECT status FROM workflows WHERE id = $1
+	`, id).Scan(&status)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "Workflow not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Database error"})
+		return
+	}
 
-	// Convert sql.NullString to *string
-	if description.Valid {
-		workflow.Description = &description.String
+	lastID := c.GetHeader("Last-Event-ID")
+	if lastID == "" {
+		lastID = c.Query("last_event_id")
 	}
-	if results.Valid {
-		workflow.Results = &results.String
+	var lastEventID uint64
+	if lastID != "" {
+		lastEventID, err = strconv.ParseUint(lastID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: "Invalid Last-Event-ID"})
+			return
+		}
+	}
+
+	// The server's write timeout is meant for ordinary responses; a stream
+	// lasts as long as the screening it follows. Dead clients are noticed
+	// when a keepalive fails to write.
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		logf(c, "failed to clear write deadline of event stream for workflow %d: %v", id, err)
+	}
+
+	sub, replay := h.events.Subscribe(id, lastEventID)
+	defer sub.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	// A fresh connection starts with the current status so clients don't
+	// need a separate poll. It carries no id so it never moves the resume
+	// point.
+	if lastEventID == 0 {
+		c.Render(-1, sse.Event{Event: events.TypeStatus, Data: gin.H{"workflow_id": id, "data": gin.H{"status": status}}})
+	}
+	for _, e := range replay {
+		renderEvent(c, e)
+	}
+	c.Writer.Flush()
+
+	keepalive := time.NewTicker(15 * time.Second)
+	defer keepalive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case e, open := <-sub.C:
+			if !open {
+				return false
+			}
+			renderEvent(c, e)
+			return true
+		case <-keepalive.C:
+			_, err := io.WriteString(w, ": keepalive\n\n")
+			return err == nil
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+func renderEvent(c *gin.Context, e events.Event) {
+	c.Render(-1, sse.Event{
+		Id:    strconv.FormatUint(e.ID, 10),
+		Event: e.Type,
+		Data:  e,
+	})
+}
+
+func (h *WorkflowHandler) publishStatus(workflowID int, status string) {
+	h.events.Publish(workflowID, events.TypeStatus, gin.H{"status": status})
+}
+
+func (h *WorkflowHandler) publishLog(workflowID int, message string) {
+	h.events.Publish(workflowID, events.TypeLog, gin.H{"message": message})
+}
+
+func (h *WorkflowHandler) publishFailure(workflowID int, stage, message string) {
+	h.events.Publish(workflowID, events.TypeFailed, gin.H{"stage": stage, "error": message})
+}
+
+// failStage records a failed stage run and reports it on the workflow's
+// event stream.
+func (h *WorkflowHandler) failStage(workflowID, runID int, stage, message, version string) {
+	if err := results.Finish(context.Background(), h.db, runID, models.ResultFailed, nil, message, version); err != nil {
+		slog.Error("failed to record stage failure", "stage", stage, "workflow_id", workflowID, "error", err)
+	}
+	h.publishFailure(workflowID, stage, message)
+}
+
+// completeStage stores a successful stage run and advances the workflow to
+// status in one transaction.
+func (h *WorkflowHandler) completeStage(ctx context.Context, workflowID, runID int, result []byte, version, status string) error {
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := results.Finish(context.Background(), tx, runID, models.ResultSucceeded, result, "", version); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE workflows SET status = $1, updated_at = NOW() WHERE id = $2
+	`, status, workflowID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetWorkflowResults returns the latest run of every stage that has been
+// run for a workflow, in pipeline order
+func (h *WorkflowHandler) GetWorkflowResults(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := authorizeWorkflow(c, h.authz, id, models.PermissionView); !ok {
+		return
 	}
 
+	var workflow models.Workflow
+	var legacy sql.NullString
+	err := h.db.QueryRowContext(dbContext(c), `
+		SELECT id, name, status, results
+		FROM workflows 
+		WHERE id = $1
+	`, id).Scan(&workflow.ID, &workflow.Name, &workflow.Status, &legacy)
+
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, dto.ErrorResponse{
 			Success: false,
@@ -508,124 +943,113 @@ func (h *WorkflowHandler) GetWorkflowResults(c *gin.Context) {
 		return
 	}
 
-	// Parse results JSON if available
-	resultsStr := ""
-	if workflow.Results != nil {
-		resultsStr = *workflow.Results
+	runs, err := h.queryStageResults(dbContext(c), `
+		SELECT DISTINCT ON (stage) `+stageResultColumns+`
+		FROM workflow_stage_results
+		WHERE workflow_id = $1
+		ORDER BY stage, run_number DESC
+	`, id)
+	if err != nil {
+		logf(c, "failed to fetch stage results for workflow %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Success: false,
+			Error:   "Failed to fetch workflow results",
+		})
+		return
 	}
 
-	if resultsStr == "" {
+	if len(runs) == 0 && legacy.String == "" {
 		c.JSON(http.StatusNotFound, dto.ErrorResponse{
 			Success: false,
 			Error:   "No results available for this workflow",
 		})
 		return
 	}
+	sortByPipeline(runs)
 
-	c.JSON(http.StatusOK, gin.H{
+	resp := gin.H{
 		"success": true,
-		"results": resultsStr,
+		"stages":  runs,
 		"workflow": gin.H{
 			"id":     workflow.ID,
 			"name":   workflow.Name,
 			"status": workflow.Status,
 		},
-	})
+	}
+	// Workflows created before per-stage storage keep their single blob
+	if legacy.String != "" {
+		resp["legacy_results"] = legacy.String
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
-// RegisterWorkflow registers a workflow for processing
-func (h *WorkflowHandler) RegisterWorkflow(c *gin.Context) {
-	userID, _ := c.Get("user_id")
-	workflowID := c.Param("id")
-
-	var req struct {
-		WorkflowID string `json:"workflow_id"`
-		Path       string `json:"path"`
-		WSLPath    string `json:"wsl_path"`
+// GetWorkflowStageResults returns every run of one stage, newest first
+func (h *WorkflowHandler) GetWorkflowStageResults(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
+	stage := c.Param("stage")
+	if !isPipelineStage(stage) {
 		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
 			Success: false,
-			Error:   "Invalid request format",
+			Error:   "Unknown stage: " + stage,
 		})
 		return
 	}
 
-	// Update workflow status to registered
-	_, err := h.db.Exec(`
-		UPDATE workflows 
-		SET status = $1, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $2 AND user_id = $3
-	`, models.StatusRegistered, workflowID, userID)
+	if _, ok := authorizeWorkflow(c, h.authz, id, models.PermissionView); !ok {
+		return
+	}
 
+	history, err := h.queryStageResults(dbContext(c), `
+		SELECT `+stageResultColumns+`
+		FROM workflow_stage_results
+		WHERE workflow_id = $1 AND stage = $2
+		ORDER BY run_number DESC
+	`, id, stage)
 	if err != nil {
+		logf(c, "failed to fetch %s results for workflow %d: %v", stage, id, err)
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Success: false,
-			Error:   "Failed to register workflow",
+			Error:   "Failed to fetch workflow results",
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": "Workflow registered successfully",
-		"workflow_id": workflowID,
-		"status": models.StatusRegistered,
-	})
-}
-
-// StartBindingSiteAnalysis starts binding site analysis for a workflow
-func (h *WorkflowHandler) StartBindingSiteAnalysis(c *gin.Context) {
-	userID, _ := c.Get("user_id")
-	workflowID := c.Param("id")
-
-	// Verify workflow exists and belongs to user
-	var workflow models.Workflow
-	err := h.db.QueryRow(`
-		SELECT id, status FROM workflows 
-		WHERE id = $1 AND user_id = $2
-	`, workflowID, userID).Scan(&workflow.ID, &workflow.Status)
-
-	if err == sql.ErrNoRows {
+	if len(history) == 0 {
 		c.JSON(http.StatusNotFound, dto.ErrorResponse{
 			Success: false,
-			Error:   "Workflow not found",
-		})
-		return
-	}
-
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
-			Success: false,
-			Error:   "Failed to access workflow",
+			Error:   "No results available for this stage",
 		})
 		return
 	}
 
-	c.JSON(http.StatusNotImplemented, dto.ErrorResponse{
-		Success: false,
-		Error:   "Binding site analysis service not implemented. Please configure bioinformatics processing pipeline.",
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"workflow_id": id,
+		"stage":       stage,
+		"latest":      history[0],
+		"history":     history,
 	})
 }
 
-// ProcessStructure processes protein structure for a workflow
-func (h *WorkflowHandler) ProcessStructure(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{
-			Success: false,
-			Error:   "User not authenticated",
-		})
+// RegisterWorkflow registers a workflow for processing
+func (h *WorkflowHandler) RegisterWorkflow(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, ok := authorizeWorkflow(c, h.authz, id, models.PermissionEdit); !ok {
 		return
 	}
 	workflowID := c.Param("id")
 
 	var req struct {
-		PDBContent string `json:"pdb_content"`
-		ProteinID  string `json:"protein_id"`
-		PDBId      string `json:"pdbId"`
-		Stage      string `json:"stage"`
+		WorkflowID string `json:"workflow_id"`
+		Path       string `json:"path"`
+		WSLPath    string `json:"wsl_path"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -636,499 +1060,455 @@ func (h *WorkflowHandler) ProcessStructure(c *gin.Context) {
 		return
 	}
 
-	// Use PDBId if provided (from frontend), otherwise use ProteinID
-	pdbId := req.PDBId
-	if pdbId == "" {
-		pdbId = req.ProteinID
-	}
-
-	if pdbId == "" {
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
-			Success: false,
-			Error:   "PDB ID is required",
-		})
+	tx, err := h.db.BeginTx(dbContext(c), nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to start transaction"})
 		return
 	}
+	defer tx.Rollback()
 
-	// Verify workflow exists and belongs to user
-	var workflow models.Workflow
-	err := h.db.QueryRow(`
-		SELECT id, status FROM workflows 
-		WHERE id = $1 AND user_id = $2
-	`, workflowID, userID).Scan(&workflow.ID, &workflow.Status)
-
+	var status string
+	err = tx.QueryRowContext(dbContext(c), `
+		SELECT COALESCE(status, '') FROM workflows WHERE id = $1 FOR UPDATE
+	`, id).Scan(&status)
 	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, dto.ErrorResponse{
-			Success: false,
-			Error:   "Workflow not found",
-		})
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Success: false, Error: "Workflow not found"})
 		return
 	}
-
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
-			Success: false,
-			Error:   "Failed to access workflow",
-		})
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to register workflow"})
 		return
 	}
 
-	// Call BioAPI service for structure processing
-	bioapiURL := os.Getenv("BIOAPI_URL")
-	if bioapiURL == "" {
-		bioapiURL = "http://localhost:8000"
-	}
-
-	// Prepare request for BioAPI - match the StructureRequest schema
-	bioapiReq := map[string]interface{}{
-		"pdb_id": pdbId,
-		"structure_data": nil, // Optional field, can be null
-	}
+	// Update workflow status to registered
+	_, err = tx.ExecContext(dbContext(c), `
+		UPDATE workflows 
+		SET status = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2
+	`, models.StatusRegistered, id)
 
-	reqBody, err := json.Marshal(bioapiReq)
 	if err != nil {
-		log.Printf("failed to marshal BioAPI request: %v", err)
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Success: false,
-			Error:   "Failed to prepare structure processing request",
+			Error:   "Failed to register workflow",
 		})
 		return
 	}
 
-	// Make request to BioAPI
-	endpoint := fmt.Sprintf("%s/api/v1/workflows/%s/structure", bioapiURL, workflowID)
-	
-	resp, err := http.Post(
-		endpoint,
-		"application/json",
-		strings.NewReader(string(reqBody)),
-	)
+	err = recordActivity(c, tx, audit.Entry{
+		Action:     audit.WorkflowRegistered,
+		WorkflowID: &id,
+		TargetType: audit.TargetWorkflow,
+		TargetID:   &id,
+		Before:     map[string]interface{}{"status": status},
+		After:      map[string]interface{}{"status": models.StatusRegistered},
+	})
 	if err != nil {
-		log.Printf("BioAPI request failed: %v", err)
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
-			Success: false,
-			Error:   "Failed to connect to structure processing service: " + err.Error(),
-		})
+		logf(c, "RegisterWorkflow: failed to record activity for workflow %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to register workflow"})
 		return
 	}
-	defer resp.Body.Close()
-
-	// Read BioAPI response
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("failed to read BioAPI response: %v", err)
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
-			Success: false,
-			Error:   "Failed to read structure processing response",
-		})
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to commit transaction"})
 		return
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("BioAPI error - status: %d", resp.StatusCode)
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Structure processing service error (Status %d): %s", resp.StatusCode, string(body)),
-		})
+	h.publishStatus(id, models.StatusRegistered)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Workflow registered successfully",
+		"workflow_id": workflowID,
+		"status": models.StatusRegistered,
+	})
+}
+
+// StartBindingSiteAnalysis detects binding pockets on the workflow's
+// processed structure via BioAPI and stores them in binding_sites,
+// replacing any pockets from a previous run.
+func (h *WorkflowHandler) StartBindingSiteAnalysis(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
 		return
 	}
+	if _, ok := authorizeWorkflow(c, h.authz, id, models.PermissionEdit); !ok {
+		return
+	}
+	workflowID := c.Param("id")
 
-	// Parse BioAPI response
-	var bioapiResponse map[string]interface{}
-	if err := json.Unmarshal(body, &bioapiResponse); err != nil {
-		log.Printf("failed to parse BioAPI response: %v", err)
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+	var req dto.StartBindingSiteAnalysisRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+				Success: false,
+				Error:   "Invalid request format",
+			})
+			return
+		}
+	}
+
+	pdbID := req.PDBID
+	if pdbID == "" {
+		structure, err := results.Latest(c.Request.Context(), h.db, id, models.StageStructurePreparation)
+		if err != nil {
+			logf(c, "failed to load structure preparation result for workflow %d: %v", id, err)
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+				Success: false,
+				Error:   "Failed to access workflow",
+			})
+			return
+		}
+		pdbID = processedPDBID(structure)
+	}
+	if pdbID == "" {
+		c.JSON(http.StatusConflict, dto.ErrorResponse{
 			Success: false,
-			Error:   "Failed to parse structure processing response: " + err.Error(),
+			Error:   "Structure has not been processed for this workflow; run structure preparation first or supply pdb_id",
 		})
 		return
 	}
 
-	// Update workflow with results
-	resultsJSON, err := json.Marshal(bioapiResponse)
+	bioapiReq := bioapi.BindingAnalysisRequest{PDBID: pdbID}
+	if req.StructureData != "" {
+		bioapiReq.StructureData = &req.StructureData
+	}
+	reqBody, err := json.Marshal(bioapiReq)
 	if err != nil {
-		log.Printf("failed to serialize results: %v", err)
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Success: false,
-			Error:   "Failed to serialize results",
+			Error:   "Failed to prepare binding site analysis request",
 		})
 		return
 	}
 
-	_, err = h.db.Exec(`
-		UPDATE workflows 
-		SET results = $1, status = $2, updated_at = NOW()
-		WHERE id = $3 AND user_id = $4
-	`, string(resultsJSON), models.StatusStructureProcessed, workflowID, userID)
-
+	runID, runNumber, err := results.Start(c.Request.Context(), h.db, id, models.StageBindingSiteAnalysis, reqBody, nil)
 	if err != nil {
-		log.Printf("failed to update workflow with results: %v", err)
+		logf(c, "failed to record binding site analysis run: %v", err)
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Success: false,
-			Error:   "Failed to update workflow with results: " + err.Error(),
+			Error:   "Failed to record binding site analysis run",
 		})
 		return
 	}
 
-	// Return success response with results
-	c.JSON(http.StatusOK, dto.SuccessResponse{
-		Success: true,
-		Data:    bioapiResponse,
-	})
-}
-
-// GetWorkflowBindingSites returns binding sites for a workflow
-func (h *WorkflowHandler) GetWorkflowBindingSites(c *gin.Context) {
-	userID, _ := c.Get("user_id")
-	workflowID := c.Param("id")
-
-	var workflow models.Workflow
-	var results sql.NullString
-	
-	err := h.db.QueryRow(`
-		SELECT id, user_id, name, results
-		FROM workflows 
-		WHERE id = $1 AND user_id = $2
-	`, workflowID, userID).Scan(
-		&workflow.ID, &workflow.UserID, &workflow.Name, &results,
-	)
-
-	// Convert sql.NullString to *string
-	if results.Valid {
-		workflow.Results = &results.String
-	}
+	h.publishLog(id, fmt.Sprintf("Detecting binding sites on %s (run %d)", pdbID, runNumber))
 
-	if err == sql.ErrNoRows {
-		c.JSON(http.StatusNotFound, dto.ErrorResponse{
-			Success: false,
-			Error:   "Workflow not found",
-		})
+	result, resp, err := h.bioapi.WorkflowBindingSites(c.Request.Context(), workflowID, bioapiReq)
+	version := responseVersion(resp)
+	if err != nil {
+		logf(c, "BioAPI binding site request failed: %v", err)
+		h.failStage(id, runID, models.StageBindingSiteAnalysis, err.Error(), version)
+		respondBioAPIError(c, "binding site analysis", err)
 		return
 	}
 
+	sites, err := bindingSitesFromBioAPI(result)
 	if err != nil {
+		logf(c, "failed to parse BioAPI binding sites: %v", err)
+		h.failStage(id, runID, models.StageBindingSiteAnalysis, err.Error(), version)
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Success: false,
-			Error:   "Failed to fetch binding sites",
+			Error:   "Failed to parse binding site analysis response: " + err.Error(),
 		})
 		return
 	}
 
-	// Parse binding sites from workflow results
-	resultsStr := ""
-	if workflow.Results != nil {
-		resultsStr = *workflow.Results
-	}
-
-	if resultsStr == "" {
-		c.JSON(http.StatusNotFound, dto.ErrorResponse{
+	if err := h.storeBindingSites(dbContext(c), id, runID, sites, resp.Body, version); err != nil {
+		logf(c, "failed to store binding sites for workflow %d: %v", id, err)
+		h.failStage(id, runID, models.StageBindingSiteAnalysis, err.Error(), version)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Success: false,
-			Error:   "No binding site analysis results available for this workflow",
+			Error:   "Failed to store binding sites",
 		})
 		return
 	}
 
-	// Return the actual results from the database
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"results": resultsStr,
-		"workflow_id": workflowID,
-	})
-}
+	h.publishStatus(id, models.StatusBindingSites)
+	h.events.Publish(id, events.TypeCompleted, gin.H{"stage": models.StageBindingSiteAnalysis, "run_number": runNumber, "sites_found": len(sites)})
 
-// GetWorkflowTemplates returns available workflow templates
-func (h *WorkflowHandler) GetWorkflowTemplates(c *gin.Context) {
-	c.JSON(http.StatusNotImplemented, dto.ErrorResponse{
-		Success: false,
-		Error:   "Workflow templates service not implemented. Please configure template management system.",
+	c.JSON(http.StatusOK, dto.SuccessResponse{
+		Success: true,
+		Data: gin.H{
+			"workflow_id":   id,
+			"pdb_id":        pdbID,
+			"run_number":    runNumber,
+			"binding_sites": sites,
+		},
 	})
 }
 
-// VirtualScreening proxies virtual screening requests to BioAPI
-func (h *WorkflowHandler) VirtualScreening(c *gin.Context) {
-	body, err := io.ReadAll(c.Request.Body)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: "Failed to read request body"})
+// ProcessStructure processes protein structure for a workflow
+func (h *WorkflowHandler) ProcessStructure(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
 		return
 	}
-
-	bioapiURL := os.Getenv("BIOAPI_URL")
-	if bioapiURL == "" {
-		bioapiURL = "http://localhost:8000"
+	if _, ok := authorizeWorkflow(c, h.authz, id, models.PermissionEdit); !ok {
+		return
 	}
+	workflowID := c.Param("id")
 
-	endpoint := fmt.Sprintf("%s/api/v1/screening/virtual-screening", bioapiURL)
+	var req struct {
+		PDBContent string `json:"pdb_content"`
+		ProteinID  string `json:"protein_id"`
+		PDBId      string `json:"pdbId"`
+		Stage      string `json:"stage"`
+	}
 
-	// Large compound libraries (10k+) can take 20-30 minutes; use a long-timeout client
-	longClient := &http.Client{Timeout: 30 * time.Minute}
-	resp, err := longClient.Post(endpoint, "application/json", strings.NewReader(string(body)))
-	if err != nil {
-		log.Printf("BioAPI virtual screening request failed: %v", err)
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
 			Success: false,
-			Error:   "Failed to connect to virtual screening service: " + err.Error(),
+			Error:   "Invalid request format",
 		})
 		return
 	}
-	defer resp.Body.Close()
-
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to read virtual screening response"})
-		return
-	}
 
-	var result map[string]interface{}
-	if err := json.Unmarshal(respBody, &result); err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to parse virtual screening response"})
-		return
+	// Use PDBId if provided (from frontend), otherwise use ProteinID
+	pdbId := req.PDBId
+	if pdbId == "" {
+		pdbId = req.ProteinID
 	}
 
-	c.JSON(resp.StatusCode, result)
-}
-
-// VinaDocking proxies real Vina molecular docking requests to BioAPI
-func (h *WorkflowHandler) VinaDocking(c *gin.Context) {
-	body, err := io.ReadAll(c.Request.Body)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: "Failed to read request body"})
+	if pdbId == "" {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Success: false,
+			Error:   "PDB ID is required",
+		})
 		return
 	}
 
-	bioapiURL := os.Getenv("BIOAPI_URL")
-	if bioapiURL == "" {
-		bioapiURL = "http://localhost:8000"
-	}
-
-	endpoint := fmt.Sprintf("%s/api/v1/screening/vina-docking", bioapiURL)
-
-	// Vina docking with large libraries can take 20-30 minutes; use a long-timeout client
-	longClient := &http.Client{Timeout: 30 * time.Minute}
-	resp, err := longClient.Post(endpoint, "application/json", strings.NewReader(string(body)))
+	bioapiReq := bioapi.StructureRequest{PDBID: pdbId}
+	reqBody, err := json.Marshal(bioapiReq)
 	if err != nil {
-		log.Printf("BioAPI Vina docking request failed: %v", err)
+		logf(c, "failed to marshal BioAPI request: %v", err)
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Success: false,
-			Error:   "Failed to connect to Vina docking service: " + err.Error(),
+			Error:   "Failed to prepare structure processing request",
 		})
 		return
 	}
-	defer resp.Body.Close()
 
-	respBody, err := io.ReadAll(resp.Body)
+	runID, runNumber, err := results.Start(c.Request.Context(), h.db, id, models.StageStructurePreparation, reqBody, nil)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to read Vina docking response"})
-		return
-	}
-
-	var result map[string]interface{}
-	if err := json.Unmarshal(respBody, &result); err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to parse Vina docking response"})
+		logf(c, "failed to record structure preparation run: %v", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+			Success: false,
+			Error:   "Failed to record structure processing run",
+		})
 		return
 	}
 
-	c.JSON(resp.StatusCode, result)
-}
+	h.publishLog(id, fmt.Sprintf("Processing structure %s (run %d)", pdbId, runNumber))
 
-// MolecularDynamics proxies MD simulation requests to BioAPI
-func (h *WorkflowHandler) MolecularDynamics(c *gin.Context) {
-	body, err := io.ReadAll(c.Request.Body)
+	_, resp, err := h.bioapi.ProcessStructure(bioapiContext(c), workflowID, bioapiReq)
+	setCacheStatus(c, resp)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: "Failed to read request body"})
+		logf(c, "BioAPI structure request failed: %v", err)
+		h.failStage(id, runID, models.StageStructurePreparation, err.Error(), responseVersion(resp))
+		respondBioAPIError(c, "structure processing", err)
 		return
 	}
 
-	bioapiURL := os.Getenv("BIOAPI_URL")
-	if bioapiURL == "" {
-		bioapiURL = "http://localhost:8000"
-	}
-
-	endpoint := fmt.Sprintf("%s/api/v1/simulation/molecular-dynamics", bioapiURL)
-
-	// MD simulations can run 20-30 minutes with OpenMM; use a long-timeout client
-	longClient := &http.Client{Timeout: 30 * time.Minute}
-	resp, err := longClient.Post(endpoint, "application/json", strings.NewReader(string(body)))
-	if err != nil {
-		log.Printf("BioAPI MD simulation request failed: %v", err)
+	if err := h.completeStage(dbContext(c), id, runID, resp.Body, resp.Version, models.StatusStructureProcessed); err != nil {
+		logf(c, "failed to store structure preparation results: %v", err)
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Success: false,
-			Error:   "Failed to connect to MD simulation service: " + err.Error(),
+			Error:   "Failed to update workflow with results: " + err.Error(),
 		})
 		return
 	}
-	defer resp.Body.Close()
-
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to read MD simulation response"})
-		return
-	}
 
-	var result map[string]interface{}
-	if err := json.Unmarshal(respBody, &result); err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to parse MD simulation response"})
-		return
-	}
+	h.publishStatus(id, models.StatusStructureProcessed)
+	h.events.Publish(id, events.TypeCompleted, gin.H{"stage": models.StageStructurePreparation, "run_number": runNumber})
 
-	c.JSON(resp.StatusCode, result)
+	// Return BioAPI's response as stored with the run
+	c.JSON(http.StatusOK, dto.SuccessResponse{
+		Success: true,
+		Data:    json.RawMessage(resp.Body),
+	})
 }
 
-// LeadOptimization proxies lead optimization requests to BioAPI
-func (h *WorkflowHandler) LeadOptimization(c *gin.Context) {
-	body, err := io.ReadAll(c.Request.Body)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: "Failed to read request body"})
+// GetWorkflowBindingSites returns the pockets detected for a workflow,
+// best druggability first
+func (h *WorkflowHandler) GetWorkflowBindingSites(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
 		return
 	}
-
-	bioapiURL := os.Getenv("BIOAPI_URL")
-	if bioapiURL == "" {
-		bioapiURL = "http://localhost:8000"
+	if _, ok := authorizeWorkflow(c, h.authz, id, models.PermissionView); !ok {
+		return
 	}
 
-	endpoint := fmt.Sprintf("%s/api/v1/optimization/lead-optimization", bioapiURL)
-	resp, err := http.Post(endpoint, "application/json", strings.NewReader(string(body)))
+	sites, err := h.loadBindingSites(dbContext(c), id)
 	if err != nil {
-		log.Printf("BioAPI lead optimization request failed: %v", err)
+		logf(c, "failed to load binding sites for workflow %d: %v", id, err)
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
 			Success: false,
-			Error:   "Failed to connect to lead optimization service: " + err.Error(),
+			Error:   "Failed to fetch binding sites",
 		})
 		return
 	}
-	defer resp.Body.Close()
 
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to read lead optimization response"})
+	if len(sites) == 0 {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{
+			Success: false,
+			Error:   "No binding site analysis results available for this workflow",
+		})
 		return
 	}
 
-	var result map[string]interface{}
-	if err := json.Unmarshal(respBody, &result); err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to parse lead optimization response"})
-		return
-	}
+	c.JSON(http.StatusOK, gin.H{
+		"success":       true,
+		"binding_sites": sites,
+		"workflow_id":   id,
+	})
+}
 
-	c.JSON(resp.StatusCode, result)
+// VirtualScreening queues a virtual screening job against BioAPI.
+// Large compound libraries (10k+) can take 20-30 minutes, so the request
+// returns a job ID immediately; poll GET /jobs/:id for the result.
+func (h *WorkflowHandler) VirtualScreening(c *gin.Context) {
+	submitJob(c, h.jobs, h.authz, models.JobVirtualScreening)
 }
 
-// AIDruggabilityScore proxies ML druggability scoring to BioAPI
-func (h *WorkflowHandler) AIDruggabilityScore(c *gin.Context) {
-	body, err := io.ReadAll(c.Request.Body)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: "Failed to read request body"})
-		return
-	}
+// VinaDocking queues a Vina molecular docking job against BioAPI
+func (h *WorkflowHandler) VinaDocking(c *gin.Context) {
+	submitJob(c, h.jobs, h.authz, models.JobVinaDocking)
+}
 
-	bioapiURL := os.Getenv("BIOAPI_URL")
-	if bioapiURL == "" {
-		bioapiURL = "http://localhost:8000"
-	}
+// MolecularDynamics queues an OpenMM MD simulation job against BioAPI
+func (h *WorkflowHandler) MolecularDynamics(c *gin.Context) {
+	submitJob(c, h.jobs, h.authz, models.JobMolecularDynamics)
+}
 
-	endpoint := fmt.Sprintf("%s/api/v1/structure/binding-sites/ai-score", bioapiURL)
-	resp, err := http.Post(endpoint, "application/json", strings.NewReader(string(body)))
-	if err != nil {
-		log.Printf("BioAPI AI scoring request failed: %v", err)
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
-			Success: false,
-			Error:   "Failed to connect to AI scoring service: " + err.Error(),
-		})
-		return
-	}
-	defer resp.Body.Close()
+// LeadOptimization queues a lead optimization job against BioAPI
+func (h *WorkflowHandler) LeadOptimization(c *gin.Context) {
+	submitJob(c, h.jobs, h.authz, models.JobLeadOptimization)
+}
 
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to read AI scoring response"})
+// AIDruggabilityScore proxies ML druggability scoring to BioAPI
+func (h *WorkflowHandler) AIDruggabilityScore(c *gin.Context) {
+	var req bioapi.AIDruggabilityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: "binding_sites list is required"})
 		return
 	}
 
-	var result map[string]interface{}
-	if err := json.Unmarshal(respBody, &result); err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to parse AI scoring response"})
+	result, resp, err := h.bioapi.AIDruggability(bioapiContext(c), req)
+	setCacheStatus(c, resp)
+	if err != nil {
+		logf(c, "BioAPI AI scoring request failed: %v", err)
+		respondBioAPIError(c, "AI scoring", err)
 		return
 	}
 
-	c.JSON(resp.StatusCode, result)
+	c.JSON(http.StatusOK, dto.SuccessResponse{Success: true, Data: result})
 }
 
 // LiteratureSearch proxies literature search requests to BioAPI
 func (h *WorkflowHandler) LiteratureSearch(c *gin.Context) {
-	body, err := io.ReadAll(c.Request.Body)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: "Failed to read request body"})
-		return
-	}
-
-	bioapiURL := os.Getenv("BIOAPI_URL")
-	if bioapiURL == "" {
-		bioapiURL = "http://localhost:8000"
-	}
-
-	endpoint := fmt.Sprintf("%s/api/v1/literature/search", bioapiURL)
-	resp, err := http.Post(endpoint, "application/json", strings.NewReader(string(body)))
-	if err != nil {
-		log.Printf("BioAPI literature search request failed: %v", err)
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
-			Success: false,
-			Error:   "Failed to connect to literature search service: " + err.Error(),
-		})
+	var req bioapi.LiteratureSearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: "pdb_id is required"})
 		return
 	}
-	defer resp.Body.Close()
 
-	respBody, err := io.ReadAll(resp.Body)
+	result, _, err := h.bioapi.LiteratureSearch(c.Request.Context(), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to read literature search response"})
+		logf(c, "BioAPI literature search request failed: %v", err)
+		respondBioAPIError(c, "literature search", err)
 		return
 	}
 
-	var result map[string]interface{}
-	if err := json.Unmarshal(respBody, &result); err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to parse literature search response"})
-		return
-	}
-
-	c.JSON(resp.StatusCode, result)
+	c.JSON(http.StatusOK, dto.SuccessResponse{Success: true, Data: result})
 }
 
 // DirectBindingAnalysis proxies binding site analysis requests to BioAPI
 func (h *WorkflowHandler) DirectBindingAnalysis(c *gin.Context) {
-	body, err := io.ReadAll(c.Request.Body)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: "Failed to read request body"})
+	var req bioapi.BindingAnalysisRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.PDBID == "" {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Success: false, Error: "pdb_id is required"})
 		return
 	}
 
-	bioapiURL := os.Getenv("BIOAPI_URL")
-	if bioapiURL == "" {
-		bioapiURL = "http://localhost:8000"
+	result, resp, err := h.bioapi.BindingAnalysis(bioapiContext(c), req)
+	setCacheStatus(c, resp)
+	if err != nil {
+		logf(c, "BioAPI binding analysis request failed: %v", err)
+		respondBioAPIError(c, "binding analysis", err)
+		return
 	}
 
-	endpoint := fmt.Sprintf("%s/api/v1/binding/direct-binding-analysis", bioapiURL)
-	resp, err := http.Post(endpoint, "application/json", strings.NewReader(string(body)))
-	if err != nil {
-		log.Printf("BioAPI binding analysis request failed: %v", err)
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+	c.JSON(http.StatusOK, dto.SuccessResponse{Success: true, Data: result})
+}
+
+// respondBioAPIError reports a failed BioAPI call. BioAPI's own 4xx
+// responses are passed through; anything else is a gateway error.
+func respondBioAPIError(c *gin.Context, service string, err error) {
+	var apiErr *bioapi.Error
+	switch {
+	case errors.Is(err, bioapi.ErrUnavailable), errors.Is(err, bioapi.ErrNoWorker):
+		c.JSON(http.StatusServiceUnavailable, dto.ErrorResponse{
 			Success: false,
-			Error:   "Failed to connect to binding analysis service: " + err.Error(),
+			Error:   "The " + service + " service is temporarily unavailable",
+		})
+	case errors.Is(err, context.DeadlineExceeded):
+		c.JSON(http.StatusGatewayTimeout, dto.ErrorResponse{
+			Success: false,
+			Error:   "The " + service + " service timed out",
+		})
+	case errors.As(err, &apiErr) && apiErr.StatusCode >= 400 && apiErr.StatusCode < 500:
+		c.JSON(apiErr.StatusCode, dto.ErrorResponse{Success: false, Error: apiErr.Detail})
+	case errors.As(err, &apiErr):
+		c.JSON(http.StatusBadGateway, dto.ErrorResponse{
+			Success: false,
+			Error:   fmt.Sprintf("The %s service failed: %s", service, apiErr.Detail),
+		})
+	default:
+		c.JSON(http.StatusBadGateway, dto.ErrorResponse{
+			Success: false,
+			Error:   "Failed to connect to the " + service + " service",
 		})
-		return
 	}
-	defer resp.Body.Close()
+}
 
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to read binding analysis response"})
-		return
+// cacheStatusHeader tells clients whether a BioAPI result was reused.
+const cacheStatusHeader = "X-Cache"
+
+// bioapiContext returns the request context for a BioAPI call, bypassing
+// the result cache if the client sent Cache-Control: no-cache.
+func bioapiContext(c *gin.Context) context.Context {
+	if noCache(c) {
+		return bioapi.WithoutCache(c.Request.Context())
+	}
+	return c.Request.Context()
+}
+
+func noCache(c *gin.Context) bool {
+	for _, directive := range strings.Split(c.GetHeader("Cache-Control"), ",") {
+		if strings.EqualFold(strings.TrimSpace(directive), "no-cache") {
+			return true
+		}
 	}
+	return false
+}
 
-	var result map[string]interface{}
-	if err := json.Unmarshal(respBody, &result); err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to parse binding analysis response"})
+// setCacheStatus reports a cache HIT or MISS for the BioAPI response.
+func setCacheStatus(c *gin.Context, resp *bioapi.Response) {
+	if resp == nil {
 		return
 	}
+	if resp.Cached {
+		c.Header(cacheStatusHeader, "HIT")
+	} else {
+		c.Header(cacheStatusHeader, "MISS")
+	}
+}
 
-	c.JSON(resp.StatusCode, result)
+// responseVersion returns the BioAPI version of resp, or "" without one.
+func responseVersion(resp *bioapi.Response) string {
+	if resp == nil {
+		return ""
+	}
+	return resp.Version
 }
@@ -0,0 +1,46 @@
+// Package invitations keeps organization and team invitations tidy. An
+// invitation past its expiry can no longer be accepted either way, but
+// marking it expired frees its email for a new invitation and keeps the
+// admins' list of outstanding invitations accurate.
+package invitations
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"protchain/internal/models"
+)
+
+// Expire marks pending invitations past their expiry as expired and
+// returns how many there were.
+func Expire(ctx context.Context, db *sql.DB) (int64, error) {
+	res, err := db.ExecContext(ctx, `
+		UPDATE invitations SET status = $1, updated_at = NOW()
+		WHERE status = $2 AND expires_at <= NOW()
+	`, models.InvitationExpired, models.InvitationPending)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Run expires lapsed invitations every interval until ctx is cancelled.
+func Run(ctx context.Context, db *sql.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := Expire(ctx, db)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("invitations: sweep failed", "error", err)
+		} else if n > 0 {
+			slog.Info("invitations: expired invitations", "count", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// Package ipfs is a small client for the Kubo (go-ipfs) HTTP RPC API,
+// covering what ProtChain needs to publish and re-read workflow bundles.
+package ipfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrTooLarge is returned by Cat when the content exceeds the limit.
+var ErrTooLarge = errors.New("ipfs content exceeds size limit")
+
+// Error is an error reported by the IPFS node.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("ipfs: %s (HTTP %d)", e.Message, e.StatusCode)
+}
+
+// Stat describes an object on the node.
+type Stat struct {
+	CID            string `json:"Hash"`
+	Size           int64  `json:"Size"`
+	CumulativeSize int64  `json:"CumulativeSize"`
+	Type           string `json:"Type"`
+}
+
+type Client struct {
+	endpoint string
+	http     *http.Client
+}
+
+// New returns a client for the RPC API at endpoint, e.g.
+// http://localhost:5001.
+func New(endpoint string, timeout time.Duration) *Client {
+	return &Client{
+		endpoint: strings.TrimRight(endpoint, "/"),
+		http:     &http.Client{Timeout: timeout},
+	}
+}
+
+// Add uploads data as a single file and returns its CIDv1. The content is
+// pinned when pin is true.
+func (c *Client) Add(ctx context.Context, name string, data []byte, pin bool) (string, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("file", name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := part.Write(data); err != nil {
+		return "", err
+	}
+	if err := mw.Close(); err != nil {
+		return "", err
+	}
+
+	q := url.Values{}
+	q.Set("pin", fmt.Sprint(pin))
+	q.Set("cid-version", "1")
+	var out struct {
+		Hash string `json:"Hash"`
+	}
+	if err := c.call(ctx, "add", q, mw.FormDataContentType(), &body, &out); err != nil {
+		return "", err
+	}
+	if out.Hash == "" {
+		return "", errors.New("ipfs: add returned no CID")
+	}
+	return out.Hash, nil
+}
+
+// Pin pins cid recursively on the node.
+func (c *Client) Pin(ctx context.Context, cid string) error {
+	q := url.Values{}
+	q.Set("arg", cid)
+	return c.call(ctx, "pin/add", q, "", nil, nil)
+}
+
+// Cat returns the content of cid, refusing anything over maxBytes.
+func (c *Client) Cat(ctx context.Context, cid string, maxBytes int64) ([]byte, error) {
+	q := url.Values{}
+	q.Set("arg", cid)
+	q.Set("length", fmt.Sprint(maxBytes+1))
+
+	resp, err := c.post(ctx, "cat", q, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, ErrTooLarge
+	}
+	return data, nil
+}
+
+// Stat returns size information for cid.
+func (c *Client) Stat(ctx context.Context, cid string) (*Stat, error) {
+	q := url.Values{}
+	q.Set("arg", "/ipfs/"+cid)
+	var st Stat
+	if err := c.call(ctx, "files/stat", q, "", nil, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// call posts to an RPC command and decodes a JSON response into out, if
+// out is non-nil.
+func (c *Client) call(ctx context.Context, cmd string, q url.Values, contentType string, body io.Reader, out interface{}) error {
+	resp, err := c.post(ctx, cmd, q, contentType, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		_, err := io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("ipfs: decoding %s response: %w", cmd, err)
+	}
+	return nil
+}
+
+// post issues an RPC call. The Kubo API only accepts POST.
+func (c *Client) post(ctx context.Context, cmd string, q url.Values, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint+"/api/v0/"+cmd+"?"+q.Encode(), body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var e struct {
+			Message string `json:"Message"`
+		}
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if json.Unmarshal(raw, &e) != nil || e.Message == "" {
+			e.Message = strings.TrimSpace(string(raw))
+		}
+		return nil, &Error{StatusCode: resp.StatusCode, Message: e.Message}
+	}
+	return resp, nil
+}
@@ -0,0 +1,190 @@
+package ipfs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newNode starts a fake Kubo RPC endpoint and returns a client for it.
+func newNode(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	// A trailing slash must not produce //api/v0 paths.
+	return New(srv.URL+"/", 5*time.Second)
+}
+
+func TestAdd(t *testing.T) {
+	c := newNode(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v0/add" {
+			t.Errorf("request = %s %s, want POST /api/v0/add", r.Method, r.URL.Path)
+		}
+		q := r.URL.Query()
+		if q.Get("pin") != "true" || q.Get("cid-version") != "1" {
+			t.Errorf("query = %s, want pin=true and cid-version=1", r.URL.RawQuery)
+		}
+		f, hdr, err := r.FormFile("file")
+		if err != nil {
+			t.Errorf("reading multipart file: %v", err)
+			return
+		}
+		defer f.Close()
+		data, _ := io.ReadAll(f)
+		if hdr.Filename != "workflow-7.json" || string(data) != `{"format":"x"}` {
+			t.Errorf("uploaded %q = %q", hdr.Filename, data)
+		}
+		io.WriteString(w, `{"Name":"workflow-7.json","Hash":"bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku","Size":"14"}`)
+	})
+
+	cid, err := c.Add(context.Background(), "workflow-7.json", []byte(`{"format":"x"}`), true)
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if cid != "bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku" {
+		t.Errorf("cid = %q", cid)
+	}
+}
+
+func TestAddWithoutCID(t *testing.T) {
+	c := newNode(t, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"Name":"a.json"}`)
+	})
+	if _, err := c.Add(context.Background(), "a.json", []byte("{}"), false); err == nil {
+		t.Fatal("Add succeeded without a CID in the response")
+	}
+}
+
+func TestPin(t *testing.T) {
+	var calls int
+	c := newNode(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path != "/api/v0/pin/add" || r.URL.Query().Get("arg") != "bafyroot" {
+			t.Errorf("request = %s?%s", r.URL.Path, r.URL.RawQuery)
+		}
+		io.WriteString(w, `{"Pins":["bafyroot"]}`)
+	})
+	if err := c.Pin(context.Background(), "bafyroot"); err != nil {
+		t.Fatalf("Pin: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("node called %d times, want 1", calls)
+	}
+}
+
+func TestCat(t *testing.T) {
+	const content = `{"format":"protchain.workflow-bundle/v1"}`
+	tests := []struct {
+		name     string
+		maxBytes int64
+		err      error
+	}{
+		{"under limit", 1 << 20, nil},
+		{"exactly at limit", int64(len(content)), nil},
+		{"over limit", int64(len(content)) - 1, ErrTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newNode(t, func(w http.ResponseWriter, r *http.Request) {
+				q := r.URL.Query()
+				if r.URL.Path != "/api/v0/cat" || q.Get("arg") != "bafybundle" {
+					t.Errorf("request = %s?%s", r.URL.Path, r.URL.RawQuery)
+				}
+				// Ask the node for one byte past the limit so oversized
+				// content is detected without reading all of it.
+				if want := tt.maxBytes + 1; q.Get("length") != strconv.FormatInt(want, 10) {
+					t.Errorf("length = %s, want %d", q.Get("length"), want)
+				}
+				io.WriteString(w, content)
+			})
+
+			data, err := c.Cat(context.Background(), "bafybundle", tt.maxBytes)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Cat error = %v, want %v", err, tt.err)
+			}
+			if tt.err == nil && string(data) != content {
+				t.Errorf("Cat = %q, want %q", data, content)
+			}
+		})
+	}
+}
+
+func TestStat(t *testing.T) {
+	c := newNode(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v0/files/stat" || r.URL.Query().Get("arg") != "/ipfs/bafybundle" {
+			t.Errorf("request = %s?%s", r.URL.Path, r.URL.RawQuery)
+		}
+		io.WriteString(w, `{"Hash":"bafybundle","Size":42,"CumulativeSize":53,"Blocks":0,"Type":"file"}`)
+	})
+
+	st, err := c.Stat(context.Background(), "bafybundle")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	want := Stat{CID: "bafybundle", Size: 42, CumulativeSize: 53, Type: "file"}
+	if *st != want {
+		t.Errorf("Stat = %+v, want %+v", *st, want)
+	}
+}
+
+func TestNodeErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		message string
+	}{
+		{"json message", http.StatusInternalServerError, `{"Message":"invalid path \"bafynope\"","Code":0,"Type":"error"}`, `invalid path "bafynope"`},
+		{"plain text", http.StatusNotFound, "404 page not found\n", "404 page not found"},
+		{"json without message", http.StatusBadRequest, `{"Code":1}`, `{"Code":1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newNode(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			})
+
+			_, err := c.Cat(context.Background(), "bafynope", 1024)
+			var ipfsErr *Error
+			if !errors.As(err, &ipfsErr) {
+				t.Fatalf("Cat error = %v, want *ipfs.Error", err)
+			}
+			if ipfsErr.StatusCode != tt.status || ipfsErr.Message != tt.message {
+				t.Errorf("error = %d %q, want %d %q", ipfsErr.StatusCode, ipfsErr.Message, tt.status, tt.message)
+			}
+		})
+	}
+}
+
+func TestMalformedResponse(t *testing.T) {
+	c := newNode(t, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "not json")
+	})
+	if _, err := c.Stat(context.Background(), "bafybundle"); err == nil || !strings.Contains(err.Error(), "files/stat") {
+		t.Fatalf("Stat error = %v, want a decoding error naming the command", err)
+	}
+}
+
+func TestContextCancelled(t *testing.T) {
+	release := make(chan struct{})
+	c := newNode(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	})
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.Pin(ctx, "bafyroot"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Pin error = %v, want context.DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,241 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"protchain/internal/models"
+)
+
+// fakeJob is a row of the fake jobs table.
+type fakeJob struct {
+	id, userID int64
+	jobType    string
+	status     string
+	attempts   int64
+	progress   int64
+	created    time.Time
+	heartbeat  time.Time
+	err        string
+}
+
+// fakeQueue is a database/sql driver holding an in-memory jobs table, so
+// the queue can be exercised without Postgres. It recognises each
+// statement Manager issues by a fragment of its SQL and applies it under
+// one lock, as row locks serialise them in Postgres. Writes to the stage
+// results and workflows tables succeed without effect; any other
+// statement fails the test.
+type fakeQueue struct {
+	t *testing.T
+
+	mu     sync.Mutex
+	jobs   []*fakeJob
+	nextID int64
+}
+
+func newFakeQueue(t *testing.T) (*sql.DB, *fakeQueue) {
+	q := &fakeQueue{t: t}
+	db := sql.OpenDB(q)
+	t.Cleanup(func() { db.Close() })
+	return db, q
+}
+
+// add inserts a job with the given status, created after every other job.
+func (q *fakeQueue) add(status string) *fakeJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.nextID++
+	j := &fakeJob{
+		id:        q.nextID,
+		userID:    1,
+		jobType:   models.JobVinaDocking,
+		status:    status,
+		created:   time.Now().Add(time.Duration(q.nextID) * time.Millisecond),
+		heartbeat: time.Now(),
+	}
+	q.jobs = append(q.jobs, j)
+	return j
+}
+
+// get returns a copy of a job's row.
+func (q *fakeQueue) get(id int64) fakeJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, j := range q.jobs {
+		if j.id == id {
+			return *j
+		}
+	}
+	q.t.Fatalf("fakequeue: no job %d", id)
+	return fakeJob{}
+}
+
+func (q *fakeQueue) find(id int64) *fakeJob {
+	for _, j := range q.jobs {
+		if j.id == id {
+			return j
+		}
+	}
+	return nil
+}
+
+func (q *fakeQueue) Connect(context.Context) (driver.Conn, error) { return fakeConn{q}, nil }
+func (q *fakeQueue) Driver() driver.Driver                        { return fakeDriver{q} }
+
+type fakeDriver struct{ q *fakeQueue }
+
+func (d fakeDriver) Open(string) (driver.Conn, error) { return fakeConn(d), nil }
+
+type fakeConn struct{ q *fakeQueue }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("fakequeue: prepared statements are not supported")
+}
+func (c fakeConn) Close() error              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+func (c fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q := c.q
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	switch {
+	case strings.Contains(query, "FOR UPDATE SKIP LOCKED"):
+		// claim: the oldest queued job, which no other claim can also get
+		var oldest *fakeJob
+		for _, j := range q.jobs {
+			if j.status == arg(args, 2) && (oldest == nil || j.created.Before(oldest.created)) {
+				oldest = j
+			}
+		}
+		cur := &fakeCursor{columns: []string{"id", "user_id", "workflow_id", "type", "payload", "no_cache", "request_id", "traceparent"}}
+		if oldest != nil {
+			oldest.status = arg(args, 1).(string)
+			oldest.attempts++
+			oldest.heartbeat = time.Now()
+			cur.rows = [][]driver.Value{{oldest.id, oldest.userID, nil, oldest.jobType, []byte(`{}`), false, "", ""}}
+		}
+		return cur, nil
+
+	case strings.Contains(query, "attempts >= $3"):
+		// failExhausted
+		cur := &fakeCursor{columns: []string{"id", "workflow_id", "type", "request_id", "attempts"}}
+		for _, j := range q.jobs {
+			if j.status == arg(args, 1) && j.heartbeat.Before(arg(args, 2).(time.Time)) && j.attempts >= arg(args, 3).(int64) {
+				cur.rows = append(cur.rows, []driver.Value{j.id, nil, j.jobType, "", j.attempts})
+			}
+		}
+		return cur, nil
+
+	case strings.Contains(query, "RETURNING workflow_id, type"):
+		// Cancel
+		cur := &fakeCursor{columns: []string{"workflow_id", "type"}}
+		if j := q.find(arg(args, 2).(int64)); j != nil && j.userID == arg(args, 3) && (j.status == arg(args, 4) || j.status == arg(args, 5)) {
+			j.status = arg(args, 1).(string)
+			cur.rows = [][]driver.Value{{nil, j.jobType}}
+		}
+		return cur, nil
+
+	case strings.Contains(query, "SELECT status FROM jobs"):
+		cur := &fakeCursor{columns: []string{"status"}}
+		if j := q.find(arg(args, 1).(int64)); j != nil && j.userID == arg(args, 2) {
+			cur.rows = [][]driver.Value{{j.status}}
+		}
+		return cur, nil
+	}
+	q.t.Errorf("fakequeue: unexpected query:\n%s", query)
+	return nil, fmt.Errorf("fakequeue: unexpected query")
+}
+
+func (c fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	q := c.q
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var n int64
+	switch {
+	case strings.Contains(query, "heartbeat_at < $3"):
+		// the reaper requeueing stale jobs
+		for _, j := range q.jobs {
+			if j.status == arg(args, 2) && j.heartbeat.Before(arg(args, 3).(time.Time)) {
+				j.status = arg(args, 1).(string)
+				n++
+			}
+		}
+
+	case strings.Contains(query, "error = $2"):
+		// fail
+		if j := q.find(arg(args, 3).(int64)); j != nil && j.status == arg(args, 4) {
+			j.status = arg(args, 1).(string)
+			j.err = arg(args, 2).(string)
+			n++
+		}
+
+	case strings.Contains(query, "SET progress = $1"):
+		// a sharded screening's progress
+		if j := q.find(arg(args, 2).(int64)); j != nil && j.status == arg(args, 3) {
+			j.progress = arg(args, 1).(int64)
+			n++
+		}
+
+	case strings.Contains(query, "progress = 100"):
+		// succeed
+		if j := q.find(arg(args, 4).(int64)); j != nil && j.status == arg(args, 5) {
+			j.status = arg(args, 1).(string)
+			n++
+		}
+
+	case strings.Contains(query, "GREATEST(attempts - 1, 0)"):
+		// requeue after shutdown
+		if j := q.find(arg(args, 2).(int64)); j != nil && j.status == arg(args, 3) {
+			j.status = arg(args, 1).(string)
+			if j.attempts > 0 {
+				j.attempts--
+			}
+			n++
+		}
+
+	case strings.Contains(query, "workflow_stage_results"), strings.Contains(query, "UPDATE workflows"),
+		strings.Contains(query, "UPDATE jobs SET compounds"):
+
+	default:
+		q.t.Errorf("fakequeue: unexpected exec:\n%s", query)
+		return nil, fmt.Errorf("fakequeue: unexpected exec")
+	}
+	return driver.RowsAffected(n), nil
+}
+
+// arg returns the value bound to $n.
+func arg(args []driver.NamedValue, n int) driver.Value {
+	return args[n-1].Value
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeCursor struct {
+	columns []string
+	rows    [][]driver.Value
+	next    int
+}
+
+func (r *fakeCursor) Columns() []string { return r.columns }
+func (r *fakeCursor) Close() error      { return nil }
+
+func (r *fakeCursor) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
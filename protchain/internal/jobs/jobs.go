@@ -0,0 +1,622 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"protchain/internal/bioapi"
+	"protchain/internal/events"
+	"protchain/internal/logging"
+	"protchain/internal/models"
+	"protchain/internal/quota"
+	"protchain/internal/results"
+	"protchain/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "protchain/internal/jobs"
+
+// endpoints maps each job type to the BioAPI endpoint that performs it.
+var endpoints = map[string]bioapi.Endpoint{
+	models.JobVirtualScreening:  bioapi.EndpointVirtualScreening,
+	models.JobVinaDocking:       bioapi.EndpointVinaDocking,
+	models.JobMolecularDynamics: bioapi.EndpointMolecularDynamics,
+	models.JobLeadOptimization:  bioapi.EndpointLeadOptimization,
+}
+
+// stages maps each job type to the pipeline stage its result belongs to.
+var stages = map[string]string{
+	models.JobVirtualScreening:  models.StageVirtualScreening,
+	models.JobVinaDocking:       models.StageMolecularDocking,
+	models.JobMolecularDynamics: models.StageMolecularDynamics,
+	models.JobLeadOptimization:  models.StageLeadOptimization,
+}
+
+// Cacheable reports whether jobs of jobType may reuse cached results.
+func Cacheable(jobType string) bool {
+	return endpoints[jobType].Cacheable
+}
+
+var (
+	ErrUnknownType    = errors.New("unknown job type")
+	ErrNotFound       = errors.New("job not found")
+	ErrNotCancellable = errors.New("job is already finished")
+)
+
+const (
+	pollInterval      = 5 * time.Second
+	heartbeatInterval = 30 * time.Second
+	// staleAfter is how long a running job may go without a heartbeat before
+	// it is assumed orphaned (e.g. the replica running it crashed) and requeued.
+	staleAfter = 3 * heartbeatInterval
+	// defaultMaxAttempts applies when NewManager is given no maximum.
+	defaultMaxAttempts = 3
+)
+
+// Manager persists jobs in the jobs table and runs them on a fixed pool of
+// workers. Jobs are claimed with FOR UPDATE SKIP LOCKED so several API
+// replicas can share one queue.
+type Manager struct {
+	db      *sql.DB
+	events  *events.Broker
+	bioapi  *bioapi.Client
+	workers int
+	timeout time.Duration
+	// maxAttempts is how many times a job may be claimed before a worker
+	// that stops responding fails it instead of requeueing it
+	maxAttempts int
+	shards      ShardConfig
+	quotas      *quota.Service
+
+	wake chan struct{}
+	wg   sync.WaitGroup
+
+	mu      sync.Mutex
+	running map[int]context.CancelFunc
+}
+
+// NewManager returns a manager running jobs on workers. Submissions are
+// checked against plan quotas unless quotas is nil.
+func NewManager(db *sql.DB, broker *events.Broker, client *bioapi.Client, workers int, timeout time.Duration, maxAttempts int, shards ShardConfig, quotas *quota.Service) *Manager {
+	if workers <= 0 {
+		workers = 1
+	}
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	return &Manager{
+		db:          db,
+		events:      broker,
+		bioapi:      client,
+		workers:     workers,
+		timeout:     timeout,
+		maxAttempts: maxAttempts,
+		shards:      shards,
+		quotas:      quotas,
+		wake:        make(chan struct{}, 1),
+		running:     make(map[int]context.CancelFunc),
+	}
+}
+
+// Start launches the worker pool. Workers exit when ctx is cancelled; call
+// Wait to block until they have all returned.
+func (m *Manager) Start(ctx context.Context) {
+	for i := 0; i < m.workers; i++ {
+		m.wg.Add(1)
+		go m.worker(ctx)
+	}
+	m.wg.Add(1)
+	go m.reaper(ctx)
+	slog.Info("job manager started", "workers", m.workers)
+}
+
+// Wait blocks until all workers have stopped.
+func (m *Manager) Wait() {
+	m.wg.Wait()
+}
+
+// Submit stores a new queued job and wakes a worker. orgID is the
+// organization the caller acts for, such as a service API key's, or nil.
+// With noCache the job always calls BioAPI rather than reusing a cached
+// result. A job that would exceed its account's quota is rejected with a
+// *quota.ExceededError.
+func (m *Manager) Submit(ctx context.Context, userID int, orgID, workflowID *int, jobType string, payload []byte, noCache bool) (*models.Job, error) {
+	if _, ok := endpoints[jobType]; !ok {
+		return nil, ErrUnknownType
+	}
+
+	job := &models.Job{
+		UserID:         userID,
+		OrganizationID: orgID,
+		WorkflowID:     workflowID,
+		Type:           jobType,
+		Status:         models.JobQueued,
+		Payload:        payload,
+		NoCache:        noCache,
+		RequestID:      logging.RequestID(ctx),
+		Traceparent:    tracing.Traceparent(ctx),
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if m.quotas != nil {
+		if err := m.quotas.Admit(ctx, tx, job); err != nil {
+			return nil, err
+		}
+	}
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO jobs (user_id, workflow_id, type, status, payload, no_cache, request_id, traceparent,
+		                  organization_id, compounds, md_ns, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''), $9, $10, $11, NOW(), NOW())
+		RETURNING id, created_at, updated_at
+	`, userID, workflowID, jobType, models.JobQueued, payload, noCache, job.RequestID, job.Traceparent,
+		job.OrganizationID, job.Compounds, job.MDNanoseconds).Scan(&job.ID, &job.CreatedAt, &job.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert job: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit job: %w", err)
+	}
+
+	m.publish(job.WorkflowID, events.TypeJobProgress, job.ID, job.Type, models.JobQueued, 0)
+	m.notify()
+	return job, nil
+}
+
+// Cancel marks a queued or running job as cancelled. A job running on this
+// replica is interrupted immediately; one running elsewhere notices at its
+// next heartbeat.
+func (m *Manager) Cancel(ctx context.Context, jobID, userID int) error {
+	var workflowID *int
+	var jobType string
+	err := m.db.QueryRowContext(ctx, `
+		UPDATE jobs SET status = $1, finished_at = NOW(), updated_at = NOW()
+		WHERE id = $2 AND user_id = $3 AND status IN ($4, $5)
+		RETURNING workflow_id, type
+	`, models.JobCancelled, jobID, userID, models.JobQueued, models.JobRunning).Scan(&workflowID, &jobType)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to cancel job: %w", err)
+	}
+
+	if err == sql.ErrNoRows {
+		var status string
+		err := m.db.QueryRowContext(ctx, `SELECT status FROM jobs WHERE id = $1 AND user_id = $2`, jobID, userID).Scan(&status)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to look up job: %w", err)
+		}
+		return ErrNotCancellable
+	}
+
+	m.mu.Lock()
+	if cancel, ok := m.running[jobID]; ok {
+		cancel()
+	}
+	m.mu.Unlock()
+
+	if err := results.FinishJob(ctx, m.db, jobID, models.ResultCancelled, nil, "", ""); err != nil {
+		slog.Error("jobs: failed to close stage run for cancelled job", "job_id", jobID, "error", err)
+	}
+
+	m.publish(workflowID, events.TypeJobProgress, jobID, jobType, models.JobCancelled, 0)
+	return nil
+}
+
+// QueueDepth returns the number of queued and running jobs across all
+// replicas.
+func (m *Manager) QueueDepth(ctx context.Context) (map[string]int, error) {
+	rows, err := m.db.QueryContext(ctx, `
+		SELECT status, COUNT(*) FROM jobs WHERE status IN ($1, $2) GROUP BY status
+	`, models.JobQueued, models.JobRunning)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	depth := map[string]int{models.JobQueued: 0, models.JobRunning: 0}
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, err
+		}
+		depth[status] = n
+	}
+	return depth, rows.Err()
+}
+
+func (m *Manager) notify() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (m *Manager) worker(ctx context.Context) {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Drain the queue before going back to sleep.
+		for ctx.Err() == nil {
+			job, err := m.claim(ctx)
+			if err != nil {
+				slog.Error("jobs: failed to claim job", "error", err)
+				break
+			}
+			if job == nil {
+				break
+			}
+			m.run(ctx, job)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// claim atomically moves the oldest queued job to running. It returns nil
+// when the queue is empty.
+func (m *Manager) claim(ctx context.Context) (*models.Job, error) {
+	var job models.Job
+	err := m.db.QueryRowContext(ctx, `
+		UPDATE jobs
+		SET status = $1, started_at = NOW(), heartbeat_at = NOW(), attempts = attempts + 1, updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE status = $2
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, user_id, workflow_id, type, payload, no_cache, COALESCE(request_id, ''), COALESCE(traceparent, '')
+	`, models.JobRunning, models.JobQueued).Scan(&job.ID, &job.UserID, &job.WorkflowID, &job.Type, &job.Payload, &job.NoCache,
+		&job.RequestID, &job.Traceparent)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	job.Status = models.JobRunning
+	return &job, nil
+}
+
+func (m *Manager) run(parent context.Context, job *models.Job) {
+	ctx, cancel := context.WithTimeout(parent, m.timeout)
+	defer cancel()
+	// BioAPI calls carry the ID and trace of the request that submitted
+	// the job
+	ctx = logging.WithRequestID(ctx, job.RequestID)
+	ctx = tracing.WithTraceparent(ctx, job.Traceparent)
+	ctx, span := tracing.Tracer(tracerName).Start(ctx, "job "+job.Type,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.Int("protchain.job_id", job.ID),
+			attribute.String("protchain.job_type", job.Type),
+		),
+	)
+	defer span.End()
+
+	m.mu.Lock()
+	m.running[job.ID] = cancel
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.running, job.ID)
+		m.mu.Unlock()
+	}()
+
+	stopHeartbeat := make(chan struct{})
+	defer close(stopHeartbeat)
+	go m.heartbeat(ctx, job.ID, cancel, stopHeartbeat)
+
+	m.logger(job).Info("jobs: running job")
+	m.publish(job.WorkflowID, events.TypeJobProgress, job.ID, job.Type, models.JobRunning, 0)
+	m.log(job, "Submitted to BioAPI")
+
+	if stage, ok := stages[job.Type]; ok && job.WorkflowID != nil {
+		if _, _, err := results.Start(ctx, m.db, *job.WorkflowID, stage, job.Payload, &job.ID); err != nil {
+			m.logger(job).Error("jobs: failed to record stage run", "error", err)
+		}
+	}
+
+	started := time.Now()
+	result, version, err := m.call(ctx, job)
+
+	// A shutdown interrupts the call but the job itself is still valid; put
+	// it back on the queue for the next process to pick up.
+	if parent.Err() != nil {
+		m.requeue(job.ID)
+		return
+	}
+
+	if err != nil {
+		m.logger(job).Error("jobs: job failed", "error", err, "bioapi_version", version)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		m.fail(job, err.Error(), version)
+		return
+	}
+
+	if job.CacheHit {
+		m.log(job, "Reused a cached BioAPI result")
+	} else {
+		m.log(job, fmt.Sprintf("BioAPI responded after %s", time.Since(started).Round(time.Second)))
+	}
+	m.succeed(job, result, version)
+}
+
+// call posts the job payload to BioAPI and returns the raw response body
+// and the BioAPI version that produced it. Large virtual screenings are
+// split across workers and merged.
+func (m *Manager) call(ctx context.Context, job *models.Job) ([]byte, string, error) {
+	if req, ok := m.shardable(job); ok {
+		return m.screenSharded(ctx, job, req)
+	}
+	if job.NoCache {
+		ctx = bioapi.WithoutCache(ctx)
+	}
+	resp, err := m.bioapi.Post(ctx, endpoints[job.Type], job.Payload)
+	if resp == nil {
+		return nil, "", err
+	}
+	if err != nil {
+		return nil, resp.Version, err
+	}
+	job.CacheHit = resp.Cached
+	return resp.Body, resp.Version, nil
+}
+
+// heartbeat keeps heartbeat_at fresh while a job runs and cancels the job
+// if another replica has marked it cancelled.
+func (m *Manager) heartbeat(ctx context.Context, jobID int, cancel context.CancelFunc, stop <-chan struct{}) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			var status string
+			err := m.db.QueryRowContext(ctx, `
+				UPDATE jobs SET heartbeat_at = NOW() WHERE id = $1 RETURNING status
+			`, jobID).Scan(&status)
+			if err != nil {
+				slog.Error("jobs: heartbeat failed", "job_id", jobID, "error", err)
+				continue
+			}
+			if status == models.JobCancelled {
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// reaper requeues running jobs whose owner stopped heartbeating, or fails
+// them once they have used up their attempts.
+func (m *Manager) reaper(ctx context.Context) {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.reap(ctx)
+		}
+	}
+}
+
+// reap handles the running jobs whose heartbeat is older than staleAfter.
+func (m *Manager) reap(ctx context.Context) {
+	cutoff := time.Now().Add(-staleAfter)
+	m.failExhausted(ctx, cutoff)
+	result, err := m.db.ExecContext(ctx, `
+		UPDATE jobs SET status = $1, updated_at = NOW()
+		WHERE status = $2 AND heartbeat_at < $3
+	`, models.JobQueued, models.JobRunning, cutoff)
+	if err != nil {
+		slog.Error("jobs: failed to requeue stale jobs", "error", err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		slog.Warn("jobs: requeued stale jobs", "count", n)
+		m.closeOrphanedRuns(ctx)
+		m.notify()
+	}
+}
+
+// failExhausted fails stale jobs that have been claimed maxAttempts times
+// already. A payload that crashes or exhausts the memory of every worker
+// that runs it would otherwise be requeued forever.
+func (m *Manager) failExhausted(ctx context.Context, cutoff time.Time) {
+	rows, err := m.db.QueryContext(ctx, `
+		SELECT id, workflow_id, type, COALESCE(request_id, ''), attempts FROM jobs
+		WHERE status = $1 AND heartbeat_at < $2 AND attempts >= $3
+	`, models.JobRunning, cutoff, m.maxAttempts)
+	if err != nil {
+		slog.Error("jobs: failed to find exhausted jobs", "error", err)
+		return
+	}
+	var exhausted []*models.Job
+	for rows.Next() {
+		var job models.Job
+		if err := rows.Scan(&job.ID, &job.WorkflowID, &job.Type, &job.RequestID, &job.Attempts); err != nil {
+			slog.Error("jobs: failed to read exhausted job", "error", err)
+			continue
+		}
+		exhausted = append(exhausted, &job)
+	}
+	rows.Close()
+
+	for _, job := range exhausted {
+		m.logger(job).Error("jobs: giving up on job", "attempts", job.Attempts)
+		m.fail(job, fmt.Sprintf("worker stopped responding on each of %d attempts", job.Attempts), "")
+	}
+}
+
+// The finishing updates only apply to jobs still marked running so that a
+// cancellation is never overwritten by a late result.
+
+func (m *Manager) succeed(job *models.Job, result []byte, version string) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		m.logger(job).Error("jobs: failed to start transaction", "error", err)
+		return
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		UPDATE jobs SET status = $1, progress = 100, result = $2, cache_hit = $3, finished_at = NOW(), updated_at = NOW()
+		WHERE id = $4 AND status = $5
+	`, models.JobSucceeded, result, job.CacheHit, job.ID, models.JobRunning)
+	if err != nil {
+		m.logger(job).Error("jobs: failed to store result", "error", err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return
+	}
+	// Bill what the job actually consumed rather than the estimate
+	if compounds, mdNs, ok := quota.Consumed(job.Type, result, job.CacheHit); ok {
+		if _, err := tx.Exec(`UPDATE jobs SET compounds = $1, md_ns = $2 WHERE id = $3`, compounds, mdNs, job.ID); err != nil {
+			m.logger(job).Error("jobs: failed to record usage", "error", err)
+			return
+		}
+	}
+
+	if err := results.FinishJob(context.Background(), tx, job.ID, models.ResultSucceeded, result, "", version); err != nil {
+		m.logger(job).Error("jobs: failed to record stage result", "error", err)
+		return
+	}
+	if job.WorkflowID != nil {
+		if _, err := tx.Exec(`UPDATE workflows SET updated_at = NOW() WHERE id = $1`, *job.WorkflowID); err != nil {
+			m.logger(job).Error("jobs: failed to touch workflow", "error", err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		m.logger(job).Error("jobs: failed to commit job", "error", err)
+		return
+	}
+	m.logger(job).Info("jobs: job succeeded", "cache_hit", job.CacheHit)
+	m.publish(job.WorkflowID, events.TypeCompleted, job.ID, job.Type, models.JobSucceeded, 100)
+}
+
+func (m *Manager) fail(job *models.Job, message, version string) {
+	res, err := m.db.Exec(`
+		UPDATE jobs SET status = $1, error = $2, finished_at = NOW(), updated_at = NOW()
+		WHERE id = $3 AND status = $4
+	`, models.JobFailed, message, job.ID, models.JobRunning)
+	if err != nil {
+		m.logger(job).Error("jobs: failed to mark job failed", "error", err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return
+	}
+	if err := results.FinishJob(context.Background(), m.db, job.ID, models.ResultFailed, nil, message, version); err != nil {
+		m.logger(job).Error("jobs: failed to record stage failure", "error", err)
+	}
+
+	if job.WorkflowID != nil {
+		m.events.Publish(*job.WorkflowID, events.TypeFailed, map[string]interface{}{
+			"job_id": job.ID,
+			"type":   job.Type,
+			"status": models.JobFailed,
+			"error":  message,
+		})
+	}
+}
+
+// requeue puts a job interrupted by shutdown back on the queue. The
+// shutdown is not the job's fault, so the attempt is not counted.
+func (m *Manager) requeue(jobID int) {
+	if _, err := m.db.Exec(`
+		UPDATE jobs SET status = $1, attempts = GREATEST(attempts - 1, 0), updated_at = NOW()
+		WHERE id = $2 AND status = $3
+	`, models.JobQueued, jobID, models.JobRunning); err != nil {
+		slog.Error("jobs: failed to requeue job", "job_id", jobID, "error", err)
+		return
+	}
+	if err := results.FinishJob(context.Background(), m.db, jobID, models.ResultFailed, nil, "interrupted by shutdown; job requeued", ""); err != nil {
+		slog.Error("jobs: failed to close stage run", "job_id", jobID, "error", err)
+	}
+}
+
+// closeOrphanedRuns fails stage runs whose job was requeued by the reaper.
+// The retry records a fresh run.
+func (m *Manager) closeOrphanedRuns(ctx context.Context) {
+	if _, err := m.db.ExecContext(ctx, `
+		UPDATE workflow_stage_results
+		SET status = $1, error = 'worker stopped responding; job requeued', finished_at = NOW()
+		WHERE status = $2 AND job_id IN (SELECT id FROM jobs WHERE status = $3)
+	`, models.ResultFailed, models.ResultRunning, models.JobQueued); err != nil {
+		slog.Error("jobs: failed to close orphaned stage runs", "error", err)
+	}
+}
+
+// publish reports a job state change on the owning workflow's stream.
+func (m *Manager) publish(workflowID *int, eventType string, jobID int, jobType, status string, progress int) {
+	if workflowID == nil {
+		return
+	}
+	m.events.Publish(*workflowID, eventType, map[string]interface{}{
+		"job_id":   jobID,
+		"type":     jobType,
+		"status":   status,
+		"progress": progress,
+	})
+}
+
+// logger returns a logger tagged with the job and the request that
+// submitted it.
+func (m *Manager) logger(job *models.Job) *slog.Logger {
+	l := slog.Default().With("job_id", job.ID, "job_type", job.Type)
+	if job.WorkflowID != nil {
+		l = l.With("workflow_id", *job.WorkflowID)
+	}
+	if job.RequestID != "" {
+		l = l.With("request_id", job.RequestID)
+	}
+	return l
+}
+
+func (m *Manager) log(job *models.Job, message string) {
+	if job.WorkflowID == nil {
+		return
+	}
+	m.events.Publish(*job.WorkflowID, events.TypeLog, map[string]interface{}{
+		"job_id":  job.ID,
+		"message": message,
+	})
+}
@@ -0,0 +1,176 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"protchain/internal/bioapi"
+	"protchain/internal/bioapi/bioapitest"
+	"protchain/internal/events"
+	"protchain/internal/models"
+)
+
+func TestClaim(t *testing.T) {
+	db, q := newFakeQueue(t)
+	m := NewManager(db, events.NewBroker(), nil, 1, time.Minute, 3, ShardConfig{}, nil)
+	first := q.add(models.JobQueued)
+	q.add(models.JobRunning)
+	second := q.add(models.JobQueued)
+
+	for _, want := range []*fakeJob{first, second} {
+		job, err := m.claim(context.Background())
+		if err != nil {
+			t.Fatalf("claim: %v", err)
+		}
+		if job == nil || int64(job.ID) != want.id {
+			t.Fatalf("claimed %+v, want job %d", job, want.id)
+		}
+		if row := q.get(want.id); row.status != models.JobRunning || row.attempts != 1 {
+			t.Errorf("job %d is %s after %d attempts, want running after 1", want.id, row.status, row.attempts)
+		}
+	}
+	if job, err := m.claim(context.Background()); job != nil || err != nil {
+		t.Errorf("claim on an empty queue = %+v, %v", job, err)
+	}
+}
+
+// TestConcurrentClaims checks that workers claiming at once never get the
+// same job.
+func TestConcurrentClaims(t *testing.T) {
+	db, q := newFakeQueue(t)
+	m := NewManager(db, events.NewBroker(), nil, 8, time.Minute, 3, ShardConfig{}, nil)
+	const n = 50
+	for i := 0; i < n; i++ {
+		q.add(models.JobQueued)
+	}
+
+	var mu sync.Mutex
+	var claimed []int
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				job, err := m.claim(context.Background())
+				if err != nil {
+					t.Errorf("claim: %v", err)
+					return
+				}
+				if job == nil {
+					return
+				}
+				mu.Lock()
+				claimed = append(claimed, job.ID)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	sort.Ints(claimed)
+	if len(claimed) != n {
+		t.Fatalf("claimed %d jobs, want %d", len(claimed), n)
+	}
+	for i, id := range claimed {
+		if id != i+1 {
+			t.Fatalf("claimed jobs %v, want each of 1..%d once", claimed, n)
+		}
+	}
+}
+
+func TestReap(t *testing.T) {
+	db, q := newFakeQueue(t)
+	m := NewManager(db, events.NewBroker(), nil, 1, time.Minute, 3, ShardConfig{}, nil)
+	stale := time.Now().Add(-staleAfter - time.Second)
+
+	alive := q.add(models.JobRunning)
+	alive.attempts = 3
+	orphaned := q.add(models.JobRunning)
+	orphaned.attempts, orphaned.heartbeat = 2, stale
+	exhausted := q.add(models.JobRunning)
+	exhausted.attempts, exhausted.heartbeat = 3, stale
+	finished := q.add(models.JobSucceeded)
+	finished.attempts, finished.heartbeat = 1, stale
+
+	m.reap(context.Background())
+
+	tests := []struct {
+		job    *fakeJob
+		status string
+		err    string
+	}{
+		{alive, models.JobRunning, ""},
+		{orphaned, models.JobQueued, ""},
+		{exhausted, models.JobFailed, "worker stopped responding on each of 3 attempts"},
+		{finished, models.JobSucceeded, ""},
+	}
+	for _, tt := range tests {
+		if row := q.get(tt.job.id); row.status != tt.status || row.err != tt.err {
+			t.Errorf("job %d after %d attempts: %s (%q), want %s (%q)", row.id, row.attempts, row.status, row.err, tt.status, tt.err)
+		}
+	}
+
+	// The requeued job is claimed again for its last attempt
+	job, err := m.claim(context.Background())
+	if err != nil || job == nil || int64(job.ID) != orphaned.id {
+		t.Fatalf("claim after reap = %+v, %v; want job %d", job, err, orphaned.id)
+	}
+	if row := q.get(orphaned.id); row.attempts != 3 {
+		t.Errorf("attempts = %d, want 3", row.attempts)
+	}
+}
+
+func TestCancelRunningJob(t *testing.T) {
+	srv := bioapitest.NewServer()
+	defer srv.Close()
+	started := make(chan struct{})
+	interrupted := make(chan struct{})
+	srv.Handle(bioapi.EndpointVinaDocking.Name, func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+		close(interrupted)
+	})
+
+	db, q := newFakeQueue(t)
+	m := NewManager(db, events.NewBroker(), srv.Client(bioapi.Config{}), 1, time.Minute, 3, ShardConfig{}, nil)
+	queued := q.add(models.JobQueued)
+	job, err := m.claim(context.Background())
+	if err != nil || job == nil {
+		t.Fatalf("claim = %+v, %v", job, err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		m.run(context.Background(), job)
+		close(done)
+	}()
+	<-started
+
+	if err := m.Cancel(context.Background(), job.ID, job.UserID); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	for name, ch := range map[string]chan struct{}{"BioAPI call": interrupted, "job": done} {
+		select {
+		case <-ch:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s still running after cancellation", name)
+		}
+	}
+
+	// The interrupted call's error must not overwrite the cancellation
+	if row := q.get(queued.id); row.status != models.JobCancelled || row.err != "" {
+		t.Errorf("job is %s (%q), want cancelled", row.status, row.err)
+	}
+	if err := m.Cancel(context.Background(), job.ID, job.UserID); !errors.Is(err, ErrNotCancellable) {
+		t.Errorf("second Cancel = %v, want ErrNotCancellable", err)
+	}
+	if err := m.Cancel(context.Background(), job.ID, job.UserID+1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Cancel by another user = %v, want ErrNotFound", err)
+	}
+}
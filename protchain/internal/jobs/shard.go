@@ -0,0 +1,303 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"protchain/internal/bioapi"
+	"protchain/internal/events"
+	"protchain/internal/models"
+)
+
+// ShardConfig controls how large virtual screening jobs are split across
+// BioAPI workers.
+type ShardConfig struct {
+	// Size is the most compounds sent to a worker in one call. Zero
+	// disables sharding.
+	Size int
+	// MaxParallel caps how many shards of one job run at once. Fewer run
+	// when fewer screening workers are available.
+	MaxParallel int
+	// Retries is the number of extra attempts for a failed shard
+	Retries int
+}
+
+// defaultMaxCompounds mirrors BioAPI's default hit list length.
+const defaultMaxCompounds = 50
+
+// shardRetryBackoff is multiplied by the attempt number between retries
+// of a shard.
+const shardRetryBackoff = 2 * time.Second
+
+// ShardStats summarises how a sharded screening ran.
+type ShardStats struct {
+	Count     int      `json:"count"`
+	Size      int      `json:"size"`
+	Parallel  int      `json:"parallel"`
+	Retries   int      `json:"retries"`
+	Versions  []string `json:"bioapi_versions"`
+	ElapsedMS int64    `json:"elapsed_ms"`
+}
+
+// shardedResult is the merged screening result. It keeps the shape of a
+// single BioAPI response so consumers need not know it was sharded.
+type shardedResult struct {
+	bioapi.ScreeningResult
+	Shards ShardStats `json:"shards"`
+}
+
+type shardOutcome struct {
+	result   *bioapi.ScreeningResult
+	version  string
+	attempts int
+}
+
+// shardable returns the decoded screening request if job is a virtual
+// screening whose custom library is larger than one shard.
+func (m *Manager) shardable(job *models.Job) (*bioapi.ScreeningRequest, bool) {
+	if job.Type != models.JobVirtualScreening || m.shards.Size <= 0 {
+		return nil, false
+	}
+	var req bioapi.ScreeningRequest
+	if err := json.Unmarshal(job.Payload, &req); err != nil {
+		// Let BioAPI report the malformed request
+		return nil, false
+	}
+	return &req, len(req.CustomCompounds) > m.shards.Size
+}
+
+// screenSharded splits the custom library of req into shards, screens
+// them in parallel on the available workers and merges the partial hit
+// lists. It returns the merged result in a BioAPI response envelope.
+func (m *Manager) screenSharded(ctx context.Context, job *models.Job, req *bioapi.ScreeningRequest) ([]byte, string, error) {
+	started := time.Now()
+	compounds := req.CustomCompounds
+	count := (len(compounds) + m.shards.Size - 1) / m.shards.Size
+	// Spread compounds evenly rather than leaving a small last shard
+	size := (len(compounds) + count - 1) / count
+
+	parallel := m.bioapi.Capacity(bioapi.EndpointVirtualScreening)
+	if parallel < 1 {
+		parallel = 1
+	}
+	if m.shards.MaxParallel > 0 && parallel > m.shards.MaxParallel {
+		parallel = m.shards.MaxParallel
+	}
+	if parallel > count {
+		parallel = count
+	}
+
+	m.log(job, fmt.Sprintf("Screening %d compounds in %d shards of up to %d, %d at a time", len(compounds), count, size, parallel))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		done     int
+		firstErr error
+		errVer   string
+	)
+	outcomes := make([]shardOutcome, count)
+	sem := make(chan struct{}, parallel)
+
+	for i := 0; i < count; i++ {
+		lo, hi := i*size, (i+1)*size
+		if hi > len(compounds) {
+			hi = len(compounds)
+		}
+		shardReq := *req
+		shardReq.CustomCompounds = compounds[lo:hi]
+
+		wg.Add(1)
+		go func(i int, shardReq bioapi.ScreeningRequest) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-sem }()
+
+			out, err := m.screenShard(ctx, job, i, count, shardReq)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("shard %d/%d: %w", i+1, count, err)
+					errVer = out.version
+					cancel()
+				}
+				return
+			}
+			outcomes[i] = out
+			done++
+			progress := done * 100 / count
+			if progress > 99 {
+				// 100 is reserved for the stored result
+				progress = 99
+			}
+			m.progress(job, progress)
+			m.publishShard(job, i, count, "succeeded", progress)
+			m.log(job, fmt.Sprintf("Shard %d/%d screened %d compounds, %d hits", i+1, count, out.result.CompoundsScreened, out.result.HitsFound))
+		}(i, shardReq)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, errVer, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+
+	merged := mergeShards(outcomes, req.MaxCompounds)
+	merged.Shards.Size = size
+	merged.Shards.Parallel = parallel
+	merged.Shards.ElapsedMS = time.Since(started).Milliseconds()
+
+	body, err := json.Marshal(map[string]interface{}{
+		"success": true,
+		"data":    merged,
+		"error":   nil,
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode merged result: %w", err)
+	}
+	return body, strings.Join(merged.Shards.Versions, ","), nil
+}
+
+// screenShard screens one shard, retrying failures that another attempt
+// or worker could fix. The outcome carries the BioAPI version of the last
+// attempt even on failure.
+func (m *Manager) screenShard(ctx context.Context, job *models.Job, i, count int, req bioapi.ScreeningRequest) (shardOutcome, error) {
+	var out shardOutcome
+	for {
+		out.attempts++
+		result, resp, err := m.bioapi.VirtualScreening(ctx, req)
+		if resp != nil {
+			out.version = resp.Version
+		}
+		if err == nil {
+			out.result = result
+			return out, nil
+		}
+		if ctx.Err() != nil || !retryShard(err) || out.attempts > m.shards.Retries {
+			return out, err
+		}
+
+		m.logger(job).Warn("jobs: shard failed", "shard", i+1, "shards", count, "attempt", out.attempts, "error", err)
+		m.publishShard(job, i, count, "retrying", -1)
+		m.log(job, fmt.Sprintf("Shard %d/%d failed, retrying: %v", i+1, count, err))
+
+		select {
+		case <-ctx.Done():
+			return out, ctx.Err()
+		case <-time.After(time.Duration(out.attempts) * shardRetryBackoff):
+		}
+	}
+}
+
+// retryShard reports whether a failed shard may succeed if sent again.
+// BioAPI rejecting the request itself will not change on another worker.
+func retryShard(err error) bool {
+	var apiErr *bioapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500
+	}
+	return true
+}
+
+// mergeShards combines the shard results into one hit list. Shards hold
+// contiguous slices of the library and each returns its own top
+// maxCompounds, so a stable sort of the concatenation ranks exactly as an
+// unsharded run would.
+func mergeShards(outcomes []shardOutcome, maxCompounds int) *shardedResult {
+	if maxCompounds <= 0 {
+		maxCompounds = defaultMaxCompounds
+	}
+
+	type ranked struct {
+		raw   json.RawMessage
+		score float64
+	}
+	var hits []ranked
+	merged := &shardedResult{}
+	versions := make(map[string]bool)
+	for i, out := range outcomes {
+		r := out.result
+		if i == 0 {
+			merged.Status = r.Status
+			merged.Method = r.Method
+			merged.BindingSiteUsed = r.BindingSiteUsed
+			merged.ScoringComponents = r.ScoringComponents
+		}
+		merged.CompoundsScreened += r.CompoundsScreened
+		merged.HitsFound += r.HitsFound
+		merged.Shards.Retries += out.attempts - 1
+		if out.version != "" && !versions[out.version] {
+			versions[out.version] = true
+			merged.Shards.Versions = append(merged.Shards.Versions, out.version)
+		}
+		for _, raw := range r.TopCompounds {
+			var c struct {
+				Score float64 `json:"score"`
+			}
+			// A compound without a readable score sorts last
+			_ = json.Unmarshal(raw, &c)
+			hits = append(hits, ranked{raw: raw, score: c.Score})
+		}
+	}
+	merged.Shards.Count = len(outcomes)
+	sort.Strings(merged.Shards.Versions)
+
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].score > hits[j].score })
+	if len(hits) > maxCompounds {
+		hits = hits[:maxCompounds]
+	}
+	merged.TopCompounds = make([]json.RawMessage, len(hits))
+	for i, h := range hits {
+		merged.TopCompounds[i] = h.raw
+	}
+	return merged
+}
+
+// progress stores a running job's progress.
+func (m *Manager) progress(job *models.Job, progress int) {
+	if _, err := m.db.Exec(`
+		UPDATE jobs SET progress = $1, updated_at = NOW() WHERE id = $2 AND status = $3
+	`, progress, job.ID, models.JobRunning); err != nil {
+		m.logger(job).Error("jobs: failed to store progress", "error", err)
+	}
+}
+
+// publishShard reports a shard state change on the owning workflow's
+// stream. A negative progress leaves the job's progress out.
+func (m *Manager) publishShard(job *models.Job, i, count int, status string, progress int) {
+	if job.WorkflowID == nil {
+		return
+	}
+	data := map[string]interface{}{
+		"job_id": job.ID,
+		"type":   job.Type,
+		"status": models.JobRunning,
+		"shard": map[string]interface{}{
+			"index":  i + 1,
+			"count":  count,
+			"status": status,
+		},
+	}
+	if progress >= 0 {
+		data["progress"] = progress
+	}
+	m.events.Publish(*job.WorkflowID, events.TypeJobProgress, data)
+}
@@ -0,0 +1,231 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"protchain/internal/bioapi"
+	"protchain/internal/bioapi/bioapitest"
+	"protchain/internal/events"
+	"protchain/internal/models"
+)
+
+type testCompound struct {
+	Name  string  `json:"name"`
+	Score float64 `json:"score"`
+}
+
+// screeningWorker is a fake BioAPI worker that screens a custom library
+// by reading back each compound's score, as BioAPI ranks it: best first,
+// cut to max_compounds.
+type screeningWorker struct {
+	*bioapitest.Server
+
+	mu     sync.Mutex
+	shards [][]string
+}
+
+func newScreeningWorker(t *testing.T, version string) *screeningWorker {
+	w := &screeningWorker{Server: bioapitest.NewServer()}
+	t.Cleanup(w.Close)
+	w.Handle(bioapi.EndpointVirtualScreening.Name, func(rw http.ResponseWriter, r *http.Request) {
+		var req bioapi.ScreeningRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("screening request: %v", err)
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var names []string
+		var hits []testCompound
+		for _, raw := range req.CustomCompounds {
+			var c testCompound
+			json.Unmarshal(raw, &c)
+			names = append(names, c.Name)
+			hits = append(hits, c)
+		}
+		w.mu.Lock()
+		w.shards = append(w.shards, names)
+		w.mu.Unlock()
+
+		sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+		if len(hits) > req.MaxCompounds {
+			hits = hits[:req.MaxCompounds]
+		}
+		rw.Header().Set(bioapi.VersionHeader, version)
+		rw.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(rw).Encode(map[string]interface{}{
+			"success": true,
+			"data": map[string]interface{}{
+				"status": "completed", "method": "custom_library", "top_compounds": hits,
+				"compounds_screened": len(names), "hits_found": len(names),
+			},
+			"error": nil,
+		})
+	})
+	return w
+}
+
+func TestScreenSharded(t *testing.T) {
+	a := newScreeningWorker(t, "2.0.0")
+	b := newScreeningWorker(t, "2.1.0")
+	pool := bioapi.NewPool(bioapi.PoolConfig{Static: []bioapi.WorkerSpec{
+		{ID: "a", URL: a.URL, Capabilities: []string{bioapi.CapabilityScreening}},
+		{ID: "b", URL: b.URL, Capabilities: []string{bioapi.CapabilityScreening}},
+	}})
+	db, q := newFakeQueue(t)
+	m := NewManager(db, events.NewBroker(), bioapi.New(bioapi.Config{Pool: pool}), 1, time.Minute, 3, ShardConfig{Size: 4}, nil)
+
+	// Scores are out of library order; higher is better, as in BioAPI
+	scores := []float64{0.5, 0.1, 0.8, 0.3, 0.6, 0.2, 0.9, 0.1, 0.7}
+	req := bioapi.ScreeningRequest{MaxCompounds: 4}
+	for i, s := range scores {
+		raw, _ := json.Marshal(testCompound{Name: fmt.Sprintf("c%d", i), Score: s})
+		req.CustomCompounds = append(req.CustomCompounds, raw)
+	}
+	payload, _ := json.Marshal(req)
+	row := q.add(models.JobRunning)
+	job := &models.Job{ID: int(row.id), Type: models.JobVirtualScreening, Payload: payload}
+
+	shardReq, ok := m.shardable(job)
+	if !ok {
+		t.Fatal("a library of 9 compounds with shards of 4 is not sharded")
+	}
+	body, version, err := m.screenSharded(context.Background(), job, shardReq)
+	if err != nil {
+		t.Fatalf("screenSharded: %v", err)
+	}
+
+	// Nine compounds need three shards of at most four, spread three each
+	// in library order, and both workers take a share
+	var shards [][]string
+	for _, w := range []*screeningWorker{a, b} {
+		if len(w.shards) == 0 {
+			t.Errorf("worker at %s screened no shards", w.URL)
+		}
+		shards = append(shards, w.shards...)
+	}
+	sort.Slice(shards, func(i, j int) bool { return shards[i][0] < shards[j][0] })
+	want := [][]string{{"c0", "c1", "c2"}, {"c3", "c4", "c5"}, {"c6", "c7", "c8"}}
+	if !reflect.DeepEqual(shards, want) {
+		t.Errorf("shards = %v, want %v", shards, want)
+	}
+
+	var resp struct {
+		Data struct {
+			TopCompounds      []testCompound `json:"top_compounds"`
+			CompoundsScreened int            `json:"compounds_screened"`
+			HitsFound         int            `json:"hits_found"`
+			Shards            ShardStats     `json:"shards"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("merged result: %v", err)
+	}
+	var top []string
+	for _, c := range resp.Data.TopCompounds {
+		top = append(top, c.Name)
+	}
+	if want := []string{"c6", "c2", "c8", "c4"}; !reflect.DeepEqual(top, want) {
+		t.Errorf("top compounds = %v, want %v", top, want)
+	}
+	if resp.Data.CompoundsScreened != 9 || resp.Data.HitsFound != 9 {
+		t.Errorf("screened %d compounds with %d hits, want 9 and 9", resp.Data.CompoundsScreened, resp.Data.HitsFound)
+	}
+	if s := resp.Data.Shards; s.Count != 3 || s.Size != 3 || s.Parallel != 2 || s.Retries != 0 {
+		t.Errorf("shard stats = %+v", s)
+	}
+	if version != "2.0.0,2.1.0" {
+		t.Errorf("version = %q, want both workers'", version)
+	}
+	if p := q.get(row.id).progress; p != 99 {
+		t.Errorf("progress = %d after every shard, want 99", p)
+	}
+}
+
+func TestShardable(t *testing.T) {
+	m := &Manager{shards: ShardConfig{Size: 4}}
+	library := func(n int) []byte {
+		req := bioapi.ScreeningRequest{}
+		for i := 0; i < n; i++ {
+			req.CustomCompounds = append(req.CustomCompounds, json.RawMessage(`{}`))
+		}
+		payload, _ := json.Marshal(req)
+		return payload
+	}
+	tests := []struct {
+		name string
+		job  models.Job
+		want bool
+	}{
+		{"larger than a shard", models.Job{Type: models.JobVirtualScreening, Payload: library(5)}, true},
+		{"one shard", models.Job{Type: models.JobVirtualScreening, Payload: library(4)}, false},
+		{"docking", models.Job{Type: models.JobVinaDocking, Payload: library(5)}, false},
+		{"malformed", models.Job{Type: models.JobVirtualScreening, Payload: []byte(`{`)}, false},
+	}
+	for _, tt := range tests {
+		if _, got := m.shardable(&tt.job); got != tt.want {
+			t.Errorf("%s: shardable = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	m.shards.Size = 0
+	if _, ok := m.shardable(&tests[0].job); ok {
+		t.Error("sharded with sharding disabled")
+	}
+}
+
+func TestMergeShards(t *testing.T) {
+	hit := func(name string, score float64) json.RawMessage {
+		raw, _ := json.Marshal(testCompound{Name: name, Score: score})
+		return raw
+	}
+	outcomes := []shardOutcome{
+		{
+			result: &bioapi.ScreeningResult{
+				Status: "completed", Method: "custom_library", CompoundsScreened: 3, HitsFound: 2,
+				TopCompounds: []json.RawMessage{hit("a", 0.4), hit("b", 0.7)},
+			},
+			version: "2.1.0", attempts: 1,
+		},
+		{
+			result: &bioapi.ScreeningResult{
+				Status: "completed", Method: "custom_library", CompoundsScreened: 3, HitsFound: 3,
+				TopCompounds: []json.RawMessage{hit("c", 0.4), hit("d", 0.9), json.RawMessage(`{"name":"e"}`)},
+			},
+			version: "2.0.0", attempts: 3,
+		},
+		{
+			result:  &bioapi.ScreeningResult{Status: "completed", CompoundsScreened: 2},
+			version: "2.1.0", attempts: 2,
+		},
+	}
+
+	merged := mergeShards(outcomes, 4)
+	var top []string
+	for _, raw := range merged.TopCompounds {
+		var c testCompound
+		json.Unmarshal(raw, &c)
+		top = append(top, c.Name)
+	}
+	// Ties keep library order, and e without a score ranks last
+	if want := []string{"d", "b", "a", "c"}; !reflect.DeepEqual(top, want) {
+		t.Errorf("top compounds = %v, want %v", top, want)
+	}
+	if merged.Status != "completed" || merged.Method != "custom_library" || merged.CompoundsScreened != 8 || merged.HitsFound != 5 {
+		t.Errorf("merged = %+v", merged.ScreeningResult)
+	}
+	if s := merged.Shards; s.Count != 3 || s.Retries != 3 || !reflect.DeepEqual(s.Versions, []string{"2.0.0", "2.1.0"}) {
+		t.Errorf("shard stats = %+v", s)
+	}
+
+	if got := mergeShards(outcomes, 0).TopCompounds; len(got) != 5 || string(got[4]) != `{"name":"e"}` {
+		t.Errorf("default hit list = %s, want all 5 compounds", got)
+	}
+}
@@ -0,0 +1,121 @@
+// Package merkle builds binary Merkle trees over Keccak-256 and the
+// inclusion proofs for their leaves.
+//
+// Leaves are hashed as H(0x00 || data) and inner nodes as
+// H(0x01 || left || right), so a leaf can never be passed off as an inner
+// node. A node without a sibling is carried up to the next level unchanged.
+package merkle
+
+import (
+	"golang.org/x/crypto/sha3"
+)
+
+// Algorithm describes the hashing scheme, for clients verifying proofs.
+const Algorithm = "keccak256; leaf = H(0x00 || data); node = H(0x01 || left || right); unpaired nodes are promoted"
+
+// Step is one sibling on the path from a leaf to the root. Left reports
+// whether the sibling is the left operand.
+type Step struct {
+	Hash [32]byte
+	Left bool
+}
+
+// Sibling locates a proof step in the tree. Level 0 holds the leaves.
+type Sibling struct {
+	Level    int
+	Position int
+	Left     bool
+}
+
+// Tree holds every level of a Merkle tree, leaves first.
+type Tree struct {
+	levels [][][32]byte
+}
+
+// LeafHash hashes leaf data.
+func LeafHash(data []byte) [32]byte {
+	return hash([]byte{0x00}, data)
+}
+
+// NodeHash hashes two children.
+func NodeHash(left, right [32]byte) [32]byte {
+	return hash([]byte{0x01}, left[:], right[:])
+}
+
+// New builds a tree over hashed leaves. It panics if there are none.
+func New(leaves [][32]byte) *Tree {
+	if len(leaves) == 0 {
+		panic("merkle: no leaves")
+	}
+	level := append([][32]byte(nil), leaves...)
+	t := &Tree{levels: [][][32]byte{level}}
+	for len(level) > 1 {
+		next := make([][32]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+			} else {
+				next = append(next, NodeHash(level[i], level[i+1]))
+			}
+		}
+		t.levels = append(t.levels, next)
+		level = next
+	}
+	return t
+}
+
+func (t *Tree) Root() [32]byte {
+	return t.levels[len(t.levels)-1][0]
+}
+
+// Levels returns the node hashes level by level, leaves first.
+func (t *Tree) Levels() [][][32]byte {
+	return t.levels
+}
+
+// Proof returns the inclusion proof for leaf i.
+func (t *Tree) Proof(i int) []Step {
+	var proof []Step
+	for _, s := range Siblings(i, len(t.levels[0])) {
+		proof = append(proof, Step{Hash: t.levels[s.Level][s.Position], Left: s.Left})
+	}
+	return proof
+}
+
+// Siblings returns where the proof steps of leaf index lie in a tree of
+// leafCount leaves, so a proof can be read from stored nodes without
+// rebuilding the tree.
+func Siblings(index, leafCount int) []Sibling {
+	var out []Sibling
+	for level, n := 0, leafCount; n > 1; level, n = level+1, (n+1)/2 {
+		sib := index ^ 1
+		if sib < n {
+			out = append(out, Sibling{Level: level, Position: sib, Left: sib < index})
+		}
+		index /= 2
+	}
+	return out
+}
+
+// Verify reports whether proof links leaf to root.
+func Verify(leaf [32]byte, proof []Step, root [32]byte) bool {
+	h := leaf
+	for _, s := range proof {
+		if s.Left {
+			h = NodeHash(s.Hash, h)
+		} else {
+			h = NodeHash(h, s.Hash)
+		}
+	}
+	return h == root
+}
+
+func hash(parts ...[]byte) [32]byte {
+	h := sha3.NewLegacyKeccak256()
+	for _, p := range parts {
+		h.Write(p)
+	}
+	var out [32]byte
+	h.Sum(out[:0])
+	return out
+}
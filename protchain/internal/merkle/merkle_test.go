@@ -0,0 +1,153 @@
+package merkle
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+// leaves hashes the single-letter leaves "a", "b", ... for a tree of n.
+func leaves(n int) [][32]byte {
+	out := make([][32]byte, n)
+	for i := range out {
+		out[i] = LeafHash([]byte{byte('a' + i)})
+	}
+	return out
+}
+
+func TestRoot(t *testing.T) {
+	// Computed with an independent Keccak-256 implementation following
+	// the scheme in Algorithm
+	tests := []struct {
+		n    int
+		root string
+	}{
+		{1, "9722201502e620d70d78ee63045f3493812c206b988cbbe76c28918a7364fdbd"},
+		{2, "00d25e3ecfd5a8430c58b5562d4a00f53ce3e76001e3683df8496c541fecb9da"},
+		{3, "3f6c2d6d0c2fcd67795ea50af0dc85c8e2df8832efe3c49e36d8fe2e71bcc07b"},
+		{5, "8adf6e11671205b27a07e5aa8c62e04a3f3251a731004db202d5e4907c7d88fd"},
+		{8, "6fdb633af2b5bd2407ac4f08a3acac44a3286991184fe0d94647d14accd03538"},
+	}
+	for _, tt := range tests {
+		root := New(leaves(tt.n)).Root()
+		if got := hex.EncodeToString(root[:]); got != tt.root {
+			t.Errorf("root of %d leaves = %s, want %s", tt.n, got, tt.root)
+		}
+	}
+}
+
+func TestHashesAreDomainSeparated(t *testing.T) {
+	l, r := LeafHash([]byte("a")), LeafHash([]byte("b"))
+	// An inner node's preimage passed off as leaf data must not collide
+	if LeafHash(append(l[:], r[:]...)) == NodeHash(l, r) {
+		t.Error("leaf and node hashes collide")
+	}
+	if NodeHash(l, r) == NodeHash(r, l) {
+		t.Error("node hash ignores child order")
+	}
+}
+
+func TestLevels(t *testing.T) {
+	ls := leaves(5)
+	levels := New(ls).Levels()
+
+	sizes := make([]int, len(levels))
+	for i, l := range levels {
+		sizes[i] = len(l)
+	}
+	if want := []int{5, 3, 2, 1}; !reflect.DeepEqual(sizes, want) {
+		t.Fatalf("level sizes = %v, want %v", sizes, want)
+	}
+	// The fifth leaf has no sibling and is carried up unchanged
+	if levels[1][2] != ls[4] {
+		t.Error("unpaired leaf was not promoted to level 1")
+	}
+	if levels[2][1] != ls[4] {
+		t.Error("unpaired node was not promoted to level 2")
+	}
+}
+
+func TestSiblings(t *testing.T) {
+	tests := []struct {
+		index, n int
+		want     []Sibling
+	}{
+		{0, 1, nil},
+		{0, 2, []Sibling{{Level: 0, Position: 1}}},
+		{1, 2, []Sibling{{Level: 0, Position: 0, Left: true}}},
+		{2, 3, []Sibling{{Level: 1, Position: 0, Left: true}}},
+		{3, 5, []Sibling{{Level: 0, Position: 2, Left: true}, {Level: 1, Position: 0, Left: true}, {Level: 2, Position: 1}}},
+		// Carried up twice: the only sibling is the root's left child
+		{4, 5, []Sibling{{Level: 2, Position: 0, Left: true}}},
+		{5, 8, []Sibling{{Level: 0, Position: 4, Left: true}, {Level: 1, Position: 3}, {Level: 2, Position: 0, Left: true}}},
+	}
+	for _, tt := range tests {
+		if got := Siblings(tt.index, tt.n); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Siblings(%d, %d) = %+v, want %+v", tt.index, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestProofRoundTrip(t *testing.T) {
+	for _, n := range []int{1, 2, 3, 5, 8} {
+		ls := leaves(n)
+		tree := New(ls)
+		root := tree.Root()
+		levels := tree.Levels()
+
+		for i, leaf := range ls {
+			proof := tree.Proof(i)
+			if !Verify(leaf, proof, root) {
+				t.Errorf("n=%d: proof of leaf %d does not verify", n, i)
+			}
+
+			// The proof is exactly the nodes Siblings points at, which is
+			// what proofs read from stored nodes rely on
+			siblings := Siblings(i, n)
+			if len(proof) != len(siblings) {
+				t.Fatalf("n=%d leaf %d: %d proof steps for %d siblings", n, i, len(proof), len(siblings))
+			}
+			for k, s := range siblings {
+				want := Step{Hash: levels[s.Level][s.Position], Left: s.Left}
+				if proof[k] != want {
+					t.Errorf("n=%d leaf %d step %d = %+v, want %+v", n, i, k, proof[k], want)
+				}
+			}
+
+			other := LeafHash([]byte("z"))
+			if Verify(other, proof, root) {
+				t.Errorf("n=%d: proof of leaf %d verifies a foreign leaf", n, i)
+			}
+			if len(proof) > 0 {
+				flipped := append([]Step(nil), proof...)
+				flipped[0].Left = !flipped[0].Left
+				if Verify(leaf, flipped, root) {
+					t.Errorf("n=%d: proof of leaf %d verifies with a step on the wrong side", n, i)
+				}
+				if Verify(leaf, proof[1:], root) {
+					t.Errorf("n=%d: proof of leaf %d verifies with a step missing", n, i)
+				}
+			}
+		}
+	}
+}
+
+func TestSingleLeaf(t *testing.T) {
+	leaf := LeafHash([]byte("a"))
+	tree := New([][32]byte{leaf})
+	if tree.Root() != leaf {
+		t.Error("root of a single leaf is not the leaf")
+	}
+	if p := tree.Proof(0); len(p) != 0 {
+		t.Errorf("proof of a single leaf has %d steps", len(p))
+	}
+}
+
+func TestNewPanicsWithoutLeaves(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("New did not panic on an empty leaf set")
+		}
+	}()
+	New(nil)
+}
@@ -0,0 +1,293 @@
+// Package metrics is a small Prometheus instrumentation library. Metrics
+// register themselves in a process-wide registry, which Handler serves in
+// the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets suit request latencies in seconds.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type collector interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+var registry = struct {
+	mu         sync.Mutex
+	collectors map[string]collector
+}{collectors: make(map[string]collector)}
+
+func register(c collector) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if _, ok := registry.collectors[c.name()]; ok {
+		panic("metrics: duplicate metric " + c.name())
+	}
+	registry.collectors[c.name()] = c
+}
+
+// Handler serves every registered metric.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		registry.mu.Lock()
+		collectors := make([]collector, 0, len(registry.collectors))
+		for _, c := range registry.collectors {
+			collectors = append(collectors, c)
+		}
+		registry.mu.Unlock()
+		sort.Slice(collectors, func(i, j int) bool { return collectors[i].name() < collectors[j].name() })
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		bw := bufio.NewWriter(w)
+		for _, c := range collectors {
+			c.write(bw)
+		}
+		bw.Flush()
+	})
+}
+
+type desc struct {
+	metric string
+	help   string
+	typ    string
+	labels []string
+}
+
+func (d *desc) name() string { return d.metric }
+
+func (d *desc) header(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.metric, helpEscaper.Replace(d.help), d.metric, d.typ)
+}
+
+// series writes one sample line. extra is an additional label pair such as
+// a histogram's le.
+func (d *desc) series(w *bufio.Writer, suffix string, values []string, extra string, v float64) {
+	w.WriteString(d.metric + suffix)
+	if len(values) > 0 || extra != "" {
+		w.WriteByte('{')
+		for i, l := range d.labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, `%s="%s"`, l, labelEscaper.Replace(values[i]))
+		}
+		if extra != "" {
+			if len(values) > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(extra)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	// Quotes need no escaping in help text
+	helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func key(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+func (d *desc) check(values []string) {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", d.metric, len(d.labels), len(values)))
+	}
+}
+
+// CounterVec is a counter partitioned by labels.
+type CounterVec struct {
+	desc
+	mu     sync.Mutex
+	values map[string]*counterSeries
+}
+
+type counterSeries struct {
+	labels []string
+	value  float64
+}
+
+// NewCounterVec registers a counter with the given label names.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		desc:   desc{metric: name, help: help, typ: "counter", labels: labels},
+		values: make(map[string]*counterSeries),
+	}
+	register(c)
+	return c
+}
+
+// Inc adds one to the series with the given label values.
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds v, which must not be negative, to the series with the given
+// label values.
+func (c *CounterVec) Add(v float64, values ...string) {
+	c.check(values)
+	k := key(values)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.values[k]
+	if !ok {
+		s = &counterSeries{labels: append([]string(nil), values...)}
+		c.values[k] = s
+	}
+	s.value += v
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.header(w)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, k := range sortedKeys(c.values) {
+		s := c.values[k]
+		c.series(w, "", s.labels, "", s.value)
+	}
+}
+
+// HistogramVec is a histogram partitioned by labels.
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labels []string
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// NewHistogramVec registers a histogram with the given upper bucket
+// bounds, in increasing order, and label names.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{
+		desc:    desc{metric: name, help: help, typ: "histogram", labels: labels},
+		buckets: buckets,
+		values:  make(map[string]*histogramSeries),
+	}
+	register(h)
+	return h
+}
+
+// Observe records v in the series with the given label values.
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	h.check(values)
+	k := key(values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.values[k]
+	if !ok {
+		s = &histogramSeries{labels: append([]string(nil), values...), counts: make([]uint64, len(h.buckets))}
+		h.values[k] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.header(w)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, k := range sortedKeys(h.values) {
+		s := h.values[k]
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += s.counts[i]
+			h.series(w, "_bucket", s.labels, fmt.Sprintf("le=%q", formatFloat(upper)), float64(cumulative))
+		}
+		h.series(w, "_bucket", s.labels, `le="+Inf"`, float64(s.count))
+		h.series(w, "_sum", s.labels, "", s.sum)
+		h.series(w, "_count", s.labels, "", float64(s.count))
+	}
+}
+
+// Func is a gauge or counter whose value is read at scrape time.
+type Func struct {
+	desc
+	fn func() float64
+}
+
+// NewGaugeFunc registers a gauge that reports fn.
+func NewGaugeFunc(name, help string, fn func() float64) *Func {
+	f := &Func{desc: desc{metric: name, help: help, typ: "gauge"}, fn: fn}
+	register(f)
+	return f
+}
+
+// NewCounterFunc registers a counter that reports fn, which must never
+// decrease.
+func NewCounterFunc(name, help string, fn func() float64) *Func {
+	f := &Func{desc: desc{metric: name, help: help, typ: "counter"}, fn: fn}
+	register(f)
+	return f
+}
+
+func (f *Func) write(w *bufio.Writer) {
+	f.header(w)
+	f.series(w, "", nil, "", f.fn())
+}
+
+// GaugeVecFunc is a gauge with one label whose series are read at scrape
+// time.
+type GaugeVecFunc struct {
+	desc
+	fn func() map[string]float64
+}
+
+// NewGaugeVecFunc registers a gauge whose series are the label values and
+// values fn returns. fn may return nil if the values are unavailable.
+func NewGaugeVecFunc(name, help, label string, fn func() map[string]float64) *GaugeVecFunc {
+	g := &GaugeVecFunc{desc: desc{metric: name, help: help, typ: "gauge", labels: []string{label}}, fn: fn}
+	register(g)
+	return g
+}
+
+func (g *GaugeVecFunc) write(w *bufio.Writer) {
+	values := g.fn()
+	g.header(w)
+	for _, k := range sortedKeys(values) {
+		g.series(w, "", []string{k}, "", values[k])
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,212 @@
+package metrics
+
+import (
+	"bufio"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// resetRegistry gives the test an empty registry, so metrics can be
+// registered again when tests are repeated.
+func resetRegistry(t *testing.T) {
+	registry.mu.Lock()
+	saved := registry.collectors
+	registry.collectors = make(map[string]collector)
+	registry.mu.Unlock()
+	t.Cleanup(func() {
+		registry.mu.Lock()
+		registry.collectors = saved
+		registry.mu.Unlock()
+	})
+}
+
+// exposition renders one collector as the handler would.
+func exposition(c collector) string {
+	var b strings.Builder
+	w := bufio.NewWriter(&b)
+	c.write(w)
+	w.Flush()
+	return b.String()
+}
+
+func checkGolden(t *testing.T, got, want string) {
+	t.Helper()
+	if got != want {
+		t.Errorf("exposition =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCounterVec(t *testing.T) {
+	resetRegistry(t)
+	c := NewCounterVec("test_requests_total", "Requests handled.", "method", "status")
+	c.Inc("POST", "500")
+	c.Inc("GET", "200")
+	c.Add(0.5, "POST", "500")
+	c.Inc("GET", "200")
+
+	checkGolden(t, exposition(c), `# HELP test_requests_total Requests handled.
+# TYPE test_requests_total counter
+test_requests_total{method="GET",status="200"} 2
+test_requests_total{method="POST",status="500"} 1.5
+`)
+}
+
+func TestCounterVecWithoutSeries(t *testing.T) {
+	resetRegistry(t)
+	c := NewCounterVec("test_unused_total", "Never incremented.", "reason")
+
+	checkGolden(t, exposition(c), `# HELP test_unused_total Never incremented.
+# TYPE test_unused_total counter
+`)
+}
+
+func TestHistogramVec(t *testing.T) {
+	resetRegistry(t)
+	h := NewHistogramVec("test_duration_seconds", "Request latency.", []float64{0.125, 1, 10}, "route")
+	// A value on a bound falls in that bucket; one past the last bound
+	// only counts towards +Inf
+	for _, v := range []float64{0.0625, 0.125, 4, 16} {
+		h.Observe(v, "/a")
+	}
+	h.Observe(1, "/b")
+
+	checkGolden(t, exposition(h), `# HELP test_duration_seconds Request latency.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{route="/a",le="0.125"} 2
+test_duration_seconds_bucket{route="/a",le="1"} 2
+test_duration_seconds_bucket{route="/a",le="10"} 3
+test_duration_seconds_bucket{route="/a",le="+Inf"} 4
+test_duration_seconds_sum{route="/a"} 20.1875
+test_duration_seconds_count{route="/a"} 4
+test_duration_seconds_bucket{route="/b",le="0.125"} 0
+test_duration_seconds_bucket{route="/b",le="1"} 1
+test_duration_seconds_bucket{route="/b",le="10"} 1
+test_duration_seconds_bucket{route="/b",le="+Inf"} 1
+test_duration_seconds_sum{route="/b"} 1
+test_duration_seconds_count{route="/b"} 1
+`)
+}
+
+func TestHistogramWithoutLabels(t *testing.T) {
+	resetRegistry(t)
+	h := NewHistogramVec("test_size_bytes", "Payload size.", []float64{1024, 1e6})
+	h.Observe(2048)
+
+	checkGolden(t, exposition(h), `# HELP test_size_bytes Payload size.
+# TYPE test_size_bytes histogram
+test_size_bytes_bucket{le="1024"} 0
+test_size_bytes_bucket{le="1e+06"} 1
+test_size_bytes_bucket{le="+Inf"} 1
+test_size_bytes_sum 2048
+test_size_bytes_count 1
+`)
+}
+
+func TestEscaping(t *testing.T) {
+	resetRegistry(t)
+	c := NewCounterVec("test_escaped_total", "Help with a \\ backslash, \"quotes\"\nand a newline.", "value")
+	c.Inc(`C:\tmp`)
+	c.Inc(`say "hi"`)
+	c.Inc("two\nlines")
+	c.Inc("µs ünïcode")
+
+	checkGolden(t, exposition(c), `# HELP test_escaped_total Help with a \\ backslash, "quotes"\nand a newline.
+# TYPE test_escaped_total counter
+test_escaped_total{value="C:\\tmp"} 1
+test_escaped_total{value="say \"hi\""} 1
+test_escaped_total{value="two\nlines"} 1
+test_escaped_total{value="µs ünïcode"} 1
+`)
+}
+
+func TestFuncs(t *testing.T) {
+	resetRegistry(t)
+	g := NewGaugeFunc("test_temperature", "Current temperature.", func() float64 { return -3.5 })
+	c := NewCounterFunc("test_waits_total", "Waits so far.", func() float64 { return 7 })
+	var values map[string]float64
+	v := NewGaugeVecFunc("test_jobs", "Jobs by status.", "status", func() map[string]float64 { return values })
+
+	checkGolden(t, exposition(g), `# HELP test_temperature Current temperature.
+# TYPE test_temperature gauge
+test_temperature -3.5
+`)
+	checkGolden(t, exposition(c), `# HELP test_waits_total Waits so far.
+# TYPE test_waits_total counter
+test_waits_total 7
+`)
+	// Unavailable values leave only the header
+	checkGolden(t, exposition(v), `# HELP test_jobs Jobs by status.
+# TYPE test_jobs gauge
+`)
+	values = map[string]float64{"running": 2, "queued": 5}
+	checkGolden(t, exposition(v), `# HELP test_jobs Jobs by status.
+# TYPE test_jobs gauge
+test_jobs{status="queued"} 5
+test_jobs{status="running"} 2
+`)
+}
+
+func TestFormatFloat(t *testing.T) {
+	tests := []struct {
+		v    float64
+		want string
+	}{
+		{0, "0"},
+		{42, "42"},
+		{0.005, "0.005"},
+		{1e6, "1e+06"},
+		{123456789, "1.23456789e+08"},
+		{math.Inf(1), "+Inf"},
+		{math.Inf(-1), "-Inf"},
+		{math.NaN(), "NaN"},
+	}
+	for _, tt := range tests {
+		if got := formatFloat(tt.v); got != tt.want {
+			t.Errorf("formatFloat(%v) = %s, want %s", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	resetRegistry(t)
+	NewGaugeFunc("test_b", "Second.", func() float64 { return 1 })
+	NewCounterVec("test_a_total", "First.", "kind").Inc("x")
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	// Metrics are served in name order
+	checkGolden(t, w.Body.String(), `# HELP test_a_total First.
+# TYPE test_a_total counter
+test_a_total{kind="x"} 1
+# HELP test_b Second.
+# TYPE test_b gauge
+test_b 1
+`)
+}
+
+func TestMisuse(t *testing.T) {
+	resetRegistry(t)
+	c := NewCounterVec("test_misuse_total", "Misused.", "a", "b")
+
+	tests := map[string]func(){
+		"duplicate name":  func() { NewGaugeFunc("test_misuse_total", "Again.", func() float64 { return 0 }) },
+		"too few labels":  func() { c.Inc("x") },
+		"too many labels": func() { c.Inc("x", "y", "z") },
+	}
+	for name, fn := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: did not panic", name)
+				}
+			}()
+			fn()
+		}()
+	}
+}
@@ -1,17 +1,26 @@
 package middleware
 
 import (
-	"log"
+	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 
+	"protchain/internal/apikeys"
 	"protchain/internal/dto"
+	"protchain/internal/logging"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
+// AuthMiddleware accepts either a JWT or an API key as the bearer token.
+// Both set user_id and email; API keys also set api_key_id and
+// api_key_scopes, which RequireScope checks, and service keys set
+// api_key_organization_id, which RequireKeyOrganization checks.
+func AuthMiddleware(jwtSecret string, db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 
@@ -28,6 +37,31 @@ func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 			return
 		}
 
+		if apikeys.IsKey(tokenString) {
+			key, err := apikeys.Authenticate(c.Request.Context(), db, tokenString)
+			if errors.Is(err, apikeys.ErrInvalid) {
+				c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Success: false, Error: "Invalid API key"})
+				c.Abort()
+				return
+			}
+			if err != nil {
+				logging.FromContext(c.Request.Context()).Error("AuthMiddleware: failed to look up API key", "error", err)
+				c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Success: false, Error: "Failed to verify API key"})
+				c.Abort()
+				return
+			}
+
+			c.Set("user_id", key.UserID)
+			c.Set("email", key.Email)
+			c.Set("api_key_id", key.ID)
+			c.Set("api_key_scopes", key.Scopes)
+			if key.OrganizationID != nil {
+				c.Set("api_key_organization_id", *key.OrganizationID)
+			}
+			c.Next()
+			return
+		}
+
 		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 				return nil, jwt.ErrSignatureInvalid
@@ -50,7 +84,7 @@ func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 
 		userIDFloat, ok := claims["user_id"].(float64)
 		if !ok {
-			log.Printf("AuthMiddleware: user_id claim is not a number")
+			logging.FromContext(c.Request.Context()).Warn("AuthMiddleware: user_id claim is not a number", "type", fmt.Sprintf("%T", claims["user_id"]))
 			c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Success: false, Error: "Invalid token: missing user_id"})
 			c.Abort()
 			return
@@ -58,7 +92,7 @@ func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 
 		email, ok := claims["email"].(string)
 		if !ok {
-			log.Printf("AuthMiddleware: email claim is not a string")
+			logging.FromContext(c.Request.Context()).Warn("AuthMiddleware: email claim is not a string", "user_id", int(userIDFloat))
 			c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Success: false, Error: "Invalid token: missing email"})
 			c.Abort()
 			return
@@ -69,3 +103,61 @@ func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// RequireScope limits API-key requests to keys holding read for GET and
+// HEAD, or write for anything else. An empty scope refuses API keys for
+// that method entirely. Requests authenticated with a JWT pass through.
+func RequireScope(read, write string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		v, ok := c.Get("api_key_scopes")
+		if !ok {
+			c.Next()
+			return
+		}
+		scopes, _ := v.([]string)
+
+		need := write
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			need = read
+		}
+		if need == "" {
+			c.JSON(http.StatusForbidden, dto.ErrorResponse{Success: false, Error: "This endpoint is not available to API keys"})
+			c.Abort()
+			return
+		}
+		for _, s := range scopes {
+			if s == need {
+				c.Next()
+				return
+			}
+		}
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Success: false, Error: "API key lacks required scope: " + need})
+		c.Abort()
+	}
+}
+
+// RequireSession refuses API keys, for endpoints such as key management
+// that only a signed-in user may call.
+func RequireSession() gin.HandlerFunc {
+	return RequireScope("", "")
+}
+
+// RequireKeyOrganization refuses service API keys on routes for any
+// organization other than the key's own, named by the param route
+// parameter. Routes without the parameter, personal keys and JWTs pass
+// through.
+func RequireKeyOrganization(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		v, ok := c.Get("api_key_organization_id")
+		if !ok || c.Param(param) == "" {
+			c.Next()
+			return
+		}
+		if orgID, _ := v.(int); c.Param(param) != strconv.Itoa(orgID) {
+			c.JSON(http.StatusForbidden, dto.ErrorResponse{Success: false, Error: "This API key is restricted to another organization"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"protchain/internal/apikeys"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	read := []string{apikeys.ScopeWorkflowsRead}
+	tests := []struct {
+		name    string
+		scopes  []string
+		method  string
+		handler gin.HandlerFunc
+		want    int
+	}{
+		{"session token", nil, http.MethodPost, RequireScope(apikeys.ScopeWorkflowsRead, apikeys.ScopeWorkflowsWrite), http.StatusOK},
+		{"read scope on GET", read, http.MethodGet, RequireScope(apikeys.ScopeWorkflowsRead, apikeys.ScopeWorkflowsWrite), http.StatusOK},
+		{"read scope on HEAD", read, http.MethodHead, RequireScope(apikeys.ScopeWorkflowsRead, apikeys.ScopeWorkflowsWrite), http.StatusOK},
+		{"read scope on POST", read, http.MethodPost, RequireScope(apikeys.ScopeWorkflowsRead, apikeys.ScopeWorkflowsWrite), http.StatusForbidden},
+		{"write scope on DELETE", []string{apikeys.ScopeWorkflowsWrite}, http.MethodDelete, RequireScope(apikeys.ScopeWorkflowsRead, apikeys.ScopeWorkflowsWrite), http.StatusOK},
+		{"other resource", []string{apikeys.ScopeJobsRead}, http.MethodGet, RequireScope(apikeys.ScopeWorkflowsRead, apikeys.ScopeWorkflowsWrite), http.StatusForbidden},
+		{"key without scopes", []string{}, http.MethodGet, RequireScope(apikeys.ScopeWorkflowsRead, apikeys.ScopeWorkflowsWrite), http.StatusForbidden},
+		{"session-only route", apikeys.Scopes, http.MethodGet, RequireSession(), http.StatusForbidden},
+		{"session-only route, session token", nil, http.MethodGet, RequireSession(), http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(func(c *gin.Context) {
+				if tt.scopes != nil {
+					c.Set("api_key_scopes", tt.scopes)
+				}
+			})
+			r.Handle(tt.method, "/workflows", tt.handler, func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(tt.method, "/workflows", nil))
+			if w.Code != tt.want {
+				t.Errorf("%s /workflows = %d, want %d", tt.method, w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireKeyOrganization(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		keyOrg interface{}
+		path   string
+		want   int
+	}{
+		{"session token", nil, "/organizations/7", http.StatusOK},
+		{"personal key", nil, "/organizations/9/teams", http.StatusOK},
+		{"own organization", 7, "/organizations/7", http.StatusOK},
+		{"own organization teams", 7, "/organizations/7/teams", http.StatusOK},
+		{"other organization", 7, "/organizations/9", http.StatusForbidden},
+		{"other organization teams", 7, "/organizations/9/teams", http.StatusForbidden},
+		{"non-canonical id", 7, "/organizations/07", http.StatusForbidden},
+		{"route without organization", 7, "/organizations", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(func(c *gin.Context) {
+				if tt.keyOrg != nil {
+					c.Set("api_key_organization_id", tt.keyOrg)
+				}
+			})
+			orgs := r.Group("/organizations", RequireKeyOrganization("id"))
+			ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+			orgs.GET("", ok)
+			orgs.GET("/:id", ok)
+			orgs.GET("/:id/teams", ok)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Code != tt.want {
+				t.Errorf("GET %s = %d, want %d", tt.path, w.Code, tt.want)
+			}
+		})
+	}
+}
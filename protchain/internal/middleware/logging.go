@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"log/slog"
+	"time"
+
+	"protchain/internal/logging"
+	"protchain/internal/tracing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestID adopts the client's X-Request-ID if it is well formed, or
+// assigns a new one. The ID is returned in the response and carried by the
+// request context to logs, audit entries, jobs and BioAPI calls.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(logging.RequestIDHeader)
+		if !logging.ValidRequestID(id) {
+			id = logging.NewRequestID()
+		}
+		c.Set("request_id", id)
+		c.Header(logging.RequestIDHeader, id)
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+// Logger writes one structured log line per request. It replaces gin's
+// text logger and must run after RequestID, and after Tracing for the
+// line to carry the trace ID.
+func Logger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		attrs := []slog.Attr{
+			slog.String("request_id", c.GetString("request_id")),
+			slog.String("method", c.Request.Method),
+			slog.String("route", c.FullPath()),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("client_ip", c.ClientIP()),
+			slog.Int("bytes", c.Writer.Size()),
+		}
+		if v, ok := c.Get("user_id"); ok {
+			attrs = append(attrs, slog.Any("user_id", v))
+		}
+		if v, ok := c.Get("workflow_id"); ok {
+			attrs = append(attrs, slog.Any("workflow_id", v))
+		}
+		if id := tracing.TraceID(c.Request.Context()); id != "" {
+			attrs = append(attrs, slog.String("trace_id", id))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+		slog.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
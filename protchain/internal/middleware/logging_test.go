@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"protchain/internal/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		header string
+		adopt  bool
+	}{
+		{"uuid", "0f8fad5b-d9cb-469f-a165-70867728950e", true},
+		{"proxy id", "1-67891233-abcdef01:2.a_b", true},
+		{"missing", "", false},
+		{"header injection", "abc\r\nSet-Cookie: x=1", false},
+		{"spaces", "abc def", false},
+		{"too long", strings.Repeat("a", 129), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fromContext string
+			r := gin.New()
+			r.Use(RequestID())
+			r.GET("/", func(c *gin.Context) {
+				fromContext = logging.RequestID(c.Request.Context())
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(logging.RequestIDHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			got := w.Header().Get(logging.RequestIDHeader)
+			if got == "" || got != fromContext {
+				t.Fatalf("response ID %q, context ID %q", got, fromContext)
+			}
+			if adopted := got == tt.header; adopted != tt.adopt {
+				t.Errorf("ID %q for header %q", got, tt.header)
+			}
+			if !tt.adopt && len(got) != 32 {
+				t.Errorf("generated ID %q", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"protchain/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	httpRequests = metrics.NewCounterVec("protchain_http_requests_total",
+		"HTTP requests by route template and status.", "method", "route", "status")
+	httpDuration = metrics.NewHistogramVec("protchain_http_request_duration_seconds",
+		"HTTP request latency by route template and status.", metrics.DefBuckets, "method", "route", "status")
+	rateLimitRejections = metrics.NewCounterVec("protchain_rate_limit_rejections_total",
+		"Requests rejected by rate limit policies, by policy and reason (rate or concurrency).", "policy", "reason")
+)
+
+// Metrics records the count and latency of every request. Routes are
+// labelled by their template, e.g. /api/v1/workflows/:id, so that IDs do
+// not multiply the series; unmatched paths share one label.
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		httpRequests.Inc(c.Request.Method, route, status)
+		httpDuration.Observe(time.Since(start).Seconds(), c.Request.Method, route, status)
+	}
+}
@@ -1,67 +1,99 @@
 package middleware
 
 import (
+	"fmt"
+	"math"
 	"net/http"
-	"sync"
+	"strconv"
+	"time"
+
+	"protchain/internal/dto"
+	"protchain/internal/logging"
+	"protchain/internal/ratelimit"
 
 	"github.com/gin-gonic/gin"
-	"golang.org/x/time/rate"
 )
 
-type rateLimiter struct {
-	visitors map[string]*rate.Limiter
-	mu       sync.RWMutex
-	rps      rate.Limit
-	burst    int
-}
-
-func newRateLimiter(rps float64, burst int) *rateLimiter {
-	return &rateLimiter{
-		visitors: make(map[string]*rate.Limiter),
-		rps:      rate.Limit(rps),
-		burst:    burst,
-	}
-}
-
-func (rl *rateLimiter) getLimiter(ip string) *rate.Limiter {
-	rl.mu.RLock()
-	limiter, exists := rl.visitors[ip]
-	rl.mu.RUnlock()
-
-	if exists {
-		return limiter
-	}
-
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-
-	// Double-check after write lock
-	if limiter, exists = rl.visitors[ip]; exists {
-		return limiter
-	}
-
-	limiter = rate.NewLimiter(rl.rps, rl.burst)
-	rl.visitors[ip] = limiter
-	return limiter
-}
-
-// RateLimitMiddleware returns a Gin middleware that enforces per-IP rate limiting.
-func RateLimitMiddleware(rps float64, burst int) gin.HandlerFunc {
-	rl := newRateLimiter(rps, burst)
+// RateLimit spends one request of the named policy for the caller and, if
+// the policy caps concurrency, holds one of the caller's slots until the
+// request completes. Callers are identified by API key or user when the
+// middleware runs after AuthMiddleware, and by IP before it.
+//
+// Responses carry RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset
+// and RateLimit-Policy headers for the most exhausted policy of the route.
+// If the store fails, requests are let through rather than rejected.
+func RateLimit(limiter *ratelimit.Limiter, policy string) gin.HandlerFunc {
+	p := limiter.Policy(policy)
 
 	return func(c *gin.Context) {
-		ip := c.ClientIP()
-		limiter := rl.getLimiter(ip)
+		caller := rateLimitCaller(c)
+
+		res, err := limiter.Take(c.Request.Context(), p, caller)
+		if err != nil {
+			logging.FromContext(c.Request.Context()).Warn("ratelimit: store failed, allowing request",
+				"policy", p.Name, "error", err)
+			c.Next()
+			return
+		}
+		setRateLimitHeaders(c, p, res)
+		if !res.Allowed {
+			rateLimitRejections.Inc(p.Name, "rate")
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+			c.JSON(http.StatusTooManyRequests, dto.ErrorResponse{Success: false, Error: "Rate limit exceeded. Please try again later."})
+			c.Abort()
+			return
+		}
 
-		if !limiter.Allow() {
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"success": false,
-				"error":   "Rate limit exceeded. Please try again later.",
+		release, ok, err := limiter.Acquire(c.Request.Context(), p, caller)
+		if err != nil {
+			logging.FromContext(c.Request.Context()).Warn("ratelimit: store failed, allowing request",
+				"policy", p.Name, "error", err)
+			c.Next()
+			return
+		}
+		if !ok {
+			rateLimitRejections.Inc(p.Name, "concurrency")
+			c.Header("Retry-After", "1")
+			c.JSON(http.StatusTooManyRequests, dto.ErrorResponse{
+				Success: false,
+				Error:   fmt.Sprintf("Too many concurrent requests; at most %d may run at once", p.Concurrency),
 			})
 			c.Abort()
 			return
 		}
+		defer release()
 
 		c.Next()
 	}
 }
+
+// rateLimitCaller identifies whose budget a request draws on.
+func rateLimitCaller(c *gin.Context) string {
+	if id, ok := c.Get("api_key_id"); ok {
+		return fmt.Sprintf("key:%v", id)
+	}
+	if id, ok := c.Get("user_id"); ok {
+		return fmt.Sprintf("user:%v", id)
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// setRateLimitHeaders reports res unless an earlier policy of the request
+// has less remaining.
+func setRateLimitHeaders(c *gin.Context, p ratelimit.Policy, res ratelimit.Result) {
+	if prev, ok := c.Get("ratelimit_remaining"); ok && prev.(int) <= res.Remaining {
+		return
+	}
+	c.Set("ratelimit_remaining", res.Remaining)
+
+	c.Header("RateLimit-Limit", strconv.Itoa(res.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+	window := ceilSeconds(p.Period)
+	quota := int(math.Round(p.Rate * float64(window)))
+	c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d;burst=%d", quota, window, p.Burst))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
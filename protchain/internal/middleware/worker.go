@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"protchain/internal/dto"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireWorkerToken admits BioAPI workers presenting the shared worker
+// token as a bearer token. With no token configured every request is
+// refused.
+func RequireWorkerToken(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			c.JSON(http.StatusForbidden, dto.ErrorResponse{Success: false, Error: "Worker registration is disabled"})
+			c.Abort()
+			return
+		}
+		got := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Success: false, Error: "Invalid worker token"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -13,12 +13,92 @@ const (
 	StatusPending            = "pending"
 	StatusRegistered         = "registered"
 	StatusStructureProcessed = "structure_processed"
+	StatusBindingSites       = "binding_sites_detected"
 	StatusCompleted          = "completed"
 )
 
+// Pipeline stages, in the order a workflow runs them.
+const (
+	StageStructurePreparation = "structure_preparation"
+	StageBindingSiteAnalysis  = "binding_site_analysis"
+	StageVirtualScreening     = "virtual_screening"
+	StageMolecularDocking     = "molecular_docking"
+	StageMolecularDynamics    = "molecular_dynamics"
+	StageLeadOptimization     = "lead_optimization"
+)
+
+// PipelineStages lists every stage in execution order.
+var PipelineStages = []string{
+	StageStructurePreparation,
+	StageBindingSiteAnalysis,
+	StageVirtualScreening,
+	StageMolecularDocking,
+	StageMolecularDynamics,
+	StageLeadOptimization,
+}
+
+// Workflow permission levels, lowest first. Owner is implied by
+// workflows.user_id and cannot be granted.
+const (
+	PermissionView  = "view"
+	PermissionEdit  = "edit"
+	PermissionAdmin = "admin"
+	PermissionOwner = "owner"
+)
+
 // Invitation statuses.
 const (
 	InvitationPending  = "pending"
 	InvitationAccepted = "accepted"
 	InvitationDeclined = "declined"
+	InvitationRevoked  = "revoked"
+	InvitationExpired  = "expired"
+)
+
+// Job types. Each maps to a long-running BioAPI endpoint.
+const (
+	JobVirtualScreening  = "virtual_screening"
+	JobVinaDocking       = "vina_docking"
+	JobMolecularDynamics = "molecular_dynamics"
+	JobLeadOptimization  = "lead_optimization"
 )
+
+// Job statuses.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// Stage result statuses.
+const (
+	ResultRunning   = "running"
+	ResultSucceeded = "succeeded"
+	ResultFailed    = "failed"
+	ResultCancelled = "cancelled"
+)
+
+// Blockchain commit statuses.
+const (
+	CommitPending   = "pending"
+	CommitConfirmed = "confirmed"
+	CommitFailed    = "failed"
+)
+
+// Artifact kinds.
+const (
+	ArtifactStructure          = "structure"
+	ArtifactProcessedStructure = "processed_structure"
+	ArtifactCompoundLibrary    = "compound_library"
+	ArtifactDockingPose        = "docking_pose"
+)
+
+// ArtifactKinds lists every accepted artifact kind.
+var ArtifactKinds = []string{
+	ArtifactStructure,
+	ArtifactProcessedStructure,
+	ArtifactCompoundLibrary,
+	ArtifactDockingPose,
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 )
 
@@ -26,9 +27,11 @@ type Workflow struct {
 	BlockchainTxHash     *string    `json:"blockchain_tx_hash" db:"blockchain_tx_hash"`
 	IPFSHash             *string    `json:"ipfs_hash" db:"ipfs_hash"`
 	BlockchainCommittedAt *time.Time `json:"blockchain_committed_at" db:"blockchain_committed_at"`
-	CreatedAt            time.Time  `json:"created_at" db:"created_at"`
-	UpdatedAt            time.Time  `json:"updated_at" db:"updated_at"`
-	TeamID               *int       `json:"team_id" db:"team_id"`
+	CreatedAt             time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at" db:"updated_at"`
+	TeamID                *int       `json:"team_id" db:"team_id"`
+	TemplateID            *int       `json:"template_id" db:"template_id"`
+	StagePlan             []byte     `json:"-" db:"stage_plan"`
 }
 
 // Organization represents an organization
@@ -107,8 +110,192 @@ type ActivityLog struct {
 	UserID         int       `json:"user_id" db:"user_id"`
 	OrganizationID *int      `json:"organization_id" db:"organization_id"`
 	TeamID         *int      `json:"team_id" db:"team_id"`
+	WorkflowID     *int      `json:"workflow_id" db:"workflow_id"`
 	Action         string    `json:"action" db:"action"`
-	Details        string    `json:"details" db:"details"`
+	TargetType     *string   `json:"target_type" db:"target_type"`
+	TargetID       *int      `json:"target_id" db:"target_id"`
+	BeforeState    []byte    `json:"-" db:"before_state"`
+	AfterState     []byte    `json:"-" db:"after_state"`
+	Details        *string   `json:"details" db:"details"`
+	RequestID      *string   `json:"request_id" db:"request_id"`
+	APIKeyID       *int      `json:"api_key_id" db:"api_key_id"`
 	CreatedAt      time.Time `json:"created_at" db:"created_at"`
 	User           *User     `json:"user,omitempty"`
 }
+
+// Job represents an asynchronous BioAPI computation
+type Job struct {
+	ID          int        `json:"id" db:"id"`
+	UserID      int        `json:"user_id" db:"user_id"`
+	WorkflowID  *int       `json:"workflow_id" db:"workflow_id"`
+	Type        string     `json:"type" db:"type"`
+	Status      string     `json:"status" db:"status"`
+	Progress    int        `json:"progress" db:"progress"`
+	Payload     []byte     `json:"-" db:"payload"`
+	Result      []byte     `json:"-" db:"result"`
+	Error       *string    `json:"error" db:"error"`
+	Attempts    int        `json:"attempts" db:"attempts"`
+	NoCache     bool       `json:"-" db:"no_cache"`
+	RequestID   string     `json:"-" db:"request_id"`
+	Traceparent string     `json:"-" db:"traceparent"`
+	CacheHit    bool       `json:"cache_hit" db:"cache_hit"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	StartedAt   *time.Time `json:"started_at" db:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at" db:"finished_at"`
+	HeartbeatAt *time.Time `json:"heartbeat_at" db:"heartbeat_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+
+	// Usage the job is billed for: the organization charged (nil charges
+	// the user) and the compounds and MD nanoseconds it consumes
+	OrganizationID *int    `json:"-" db:"organization_id"`
+	Compounds      int64   `json:"-" db:"compounds"`
+	MDNanoseconds  float64 `json:"-" db:"md_ns"`
+}
+
+// TemplateStage is one step of a workflow template with its default
+// BioAPI parameters
+type TemplateStage struct {
+	Stage      string          `json:"stage"`
+	Parameters json.RawMessage `json:"parameters"`
+}
+
+// WorkflowTemplate is a named, versioned pipeline definition. Built-in
+// templates have no organization.
+type WorkflowTemplate struct {
+	ID             int             `json:"id" db:"id"`
+	OrganizationID *int            `json:"organization_id" db:"organization_id"`
+	Name           string          `json:"name" db:"name"`
+	Version        int             `json:"version" db:"version"`
+	Description    string          `json:"description" db:"description"`
+	Stages         []TemplateStage `json:"stages" db:"stages"`
+	IsBuiltin      bool            `json:"is_builtin" db:"is_builtin"`
+	CreatedBy      *int            `json:"created_by" db:"created_by"`
+	CreatedAt      time.Time       `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at" db:"updated_at"`
+}
+
+// Vec3 is a point or extent in Cartesian space (Å)
+type Vec3 struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	Z float64 `json:"z"`
+}
+
+// BindingSiteResidue is a residue lining a detected pocket
+type BindingSiteResidue struct {
+	Chain         string  `json:"chain"`
+	ResidueNumber int     `json:"residue_number"`
+	ResidueName   string  `json:"residue_name"`
+	Distance      float64 `json:"distance"`
+}
+
+// BindingSite is a pocket detected on a workflow's structure
+type BindingSite struct {
+	ID                int                  `json:"id" db:"id"`
+	WorkflowID        int                  `json:"workflow_id" db:"workflow_id"`
+	SiteNumber        int                  `json:"site_number" db:"site_number"`
+	Center            Vec3                 `json:"center"`
+	Size              Vec3                 `json:"size"`
+	Volume            float64              `json:"volume" db:"volume"`
+	DruggabilityScore float64              `json:"druggability_score" db:"druggability_score"`
+	Hydrophobicity    *float64             `json:"hydrophobicity" db:"hydrophobicity"`
+	EnclosureScore    *float64             `json:"enclosure_score" db:"enclosure_score"`
+	Residues          []BindingSiteResidue `json:"residues" db:"residues"`
+	Method            string               `json:"method" db:"method"`
+	CreatedAt         time.Time            `json:"created_at" db:"created_at"`
+}
+
+// StageResult is one run of a pipeline stage for a workflow. Re-running a
+// stage adds a new run rather than replacing the previous one.
+type StageResult struct {
+	ID            int        `json:"id" db:"id"`
+	WorkflowID    int        `json:"workflow_id" db:"workflow_id"`
+	Stage         string     `json:"stage" db:"stage"`
+	RunNumber     int        `json:"run_number" db:"run_number"`
+	Status        string     `json:"status" db:"status"`
+	Parameters    []byte     `json:"-" db:"parameters"`
+	Result        []byte     `json:"-" db:"result"`
+	Error         *string    `json:"error" db:"error"`
+	BioAPIVersion *string    `json:"bioapi_version" db:"bioapi_version"`
+	JobID         *int       `json:"job_id" db:"job_id"`
+	StartedAt     time.Time  `json:"started_at" db:"started_at"`
+	FinishedAt    *time.Time `json:"finished_at" db:"finished_at"`
+}
+
+// Artifact links a stored file to a workflow. The content itself lives in
+// the artifact store under its SHA-256 digest.
+type Artifact struct {
+	ID          int       `json:"id" db:"id"`
+	WorkflowID  int       `json:"workflow_id" db:"workflow_id"`
+	Kind        string    `json:"kind" db:"kind"`
+	Filename    string    `json:"filename" db:"filename"`
+	ContentType string    `json:"content_type" db:"content_type"`
+	SHA256      string    `json:"sha256" db:"sha256"`
+	SizeBytes   int64     `json:"size_bytes" db:"size_bytes"`
+	UploadedBy  *int      `json:"uploaded_by" db:"uploaded_by"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// BlockchainCommit is one attempt to record a workflow's published bundle
+// on the DrugScreeningVerifier contract. NumericID and GasPrice are decimal
+// strings since they may exceed 64 bits.
+type BlockchainCommit struct {
+	ID               int        `json:"id" db:"id"`
+	WorkflowID       int        `json:"workflow_id" db:"workflow_id"`
+	Status           string     `json:"status" db:"status"`
+	ChainID          int64      `json:"chain_id" db:"chain_id"`
+	ContractAddress  string     `json:"contract_address" db:"contract_address"`
+	FromAddress      string     `json:"from_address" db:"from_address"`
+	IPFSHash         string     `json:"ipfs_hash" db:"ipfs_hash"`
+	ResultHash       string     `json:"result_hash" db:"result_hash"`
+	MoleculeDataHash string     `json:"molecule_data_hash" db:"molecule_data_hash"`
+	MoleculeID       string     `json:"molecule_id" db:"molecule_id"`
+	TxHash           *string    `json:"tx_hash" db:"tx_hash"`
+	BlockNumber      *int64     `json:"block_number" db:"block_number"`
+	BlockHash        *string    `json:"block_hash" db:"block_hash"`
+	NumericID        *string    `json:"numeric_id" db:"numeric_id"`
+	ResultID         *string    `json:"result_id" db:"result_id"`
+	GasUsed          *int64     `json:"gas_used" db:"gas_used"`
+	GasPrice         *string    `json:"gas_price" db:"gas_price"`
+	Error            *string    `json:"error" db:"error"`
+	CommittedBy      *int       `json:"committed_by" db:"committed_by"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+	ConfirmedAt      *time.Time `json:"confirmed_at" db:"confirmed_at"`
+}
+
+// HitBatch is a Merkle tree over the hits of one virtual screening run.
+// Only Root is recorded on chain.
+type HitBatch struct {
+	ID              int        `json:"id" db:"id"`
+	WorkflowID      int        `json:"workflow_id" db:"workflow_id"`
+	StageResultID   *int       `json:"stage_result_id" db:"stage_result_id"`
+	Root            string     `json:"root" db:"root"`
+	LeafCount       int        `json:"leaf_count" db:"leaf_count"`
+	Status          string     `json:"status" db:"status"`
+	ChainID         *int64     `json:"chain_id" db:"chain_id"`
+	ContractAddress *string    `json:"contract_address" db:"contract_address"`
+	TxHash          *string    `json:"tx_hash" db:"tx_hash"`
+	BlockNumber     *int64     `json:"block_number" db:"block_number"`
+	NumericID       *string    `json:"numeric_id" db:"numeric_id"`
+	GasUsed         *int64     `json:"gas_used" db:"gas_used"`
+	Error           *string    `json:"error" db:"error"`
+	CreatedBy       *int       `json:"created_by" db:"created_by"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+	AnchoredAt      *time.Time `json:"anchored_at" db:"anchored_at"`
+}
+
+// APIKey is a long-lived credential. Only the digest of the key is stored.
+// OrganizationID is set for service keys.
+type APIKey struct {
+	ID             int        `json:"id" db:"id"`
+	UserID         int        `json:"user_id" db:"user_id"`
+	OrganizationID *int       `json:"organization_id" db:"organization_id"`
+	Name           string     `json:"name" db:"name"`
+	Prefix         string     `json:"prefix" db:"prefix"`
+	KeyHash        string     `json:"-" db:"key_hash"`
+	Scopes         []string   `json:"scopes" db:"scopes"`
+	ExpiresAt      *time.Time `json:"expires_at" db:"expires_at"`
+	LastUsedAt     *time.Time `json:"last_used_at" db:"last_used_at"`
+	RevokedAt      *time.Time `json:"revoked_at" db:"revoked_at"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+}
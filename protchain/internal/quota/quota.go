@@ -0,0 +1,431 @@
+// Package quota meters compute usage and enforces the limits of each
+// organization's plan. Jobs are billed to the organization owning their
+// workflow. A job without one is billed to the organization the caller
+// acts for, or else the submitting user's organization if they belong to
+// just one, or else the user. Artifacts are billed to the workflow's
+// organization, or else its owner. Users billed for themselves get the
+// free plan. Monthly usage is summed from the job records, so there are no
+// counters to drift out of step.
+package quota
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"protchain/internal/bioapi"
+	"protchain/internal/models"
+)
+
+// DefaultPlan is the plan of personal accounts and of organizations whose
+// plan is not defined.
+const DefaultPlan = "free"
+
+// ErrWorkflowNotFound is returned when usage is billed to a workflow that
+// does not exist, such as one deleted while a job was being submitted.
+var ErrWorkflowNotFound = errors.New("quota: workflow not found")
+
+// Resources limited by a plan.
+const (
+	ResourceConcurrentJobs = "concurrent_jobs"
+	ResourceCompounds      = "compounds"
+	ResourceMDNanoseconds  = "md_nanoseconds"
+	ResourceStorageBytes   = "storage_bytes"
+)
+
+// Defaults BioAPI applies when a request leaves max_compounds out, and the
+// simulated time of one MD compound.
+const (
+	defaultDockingCompounds  = 50
+	defaultMDCompounds       = 10
+	defaultLeadCompounds     = 20
+	mdNanosecondsPerCompound = 0.25
+)
+
+// Plan is a row of the plans table. A nil limit is unlimited.
+type Plan struct {
+	Name                 string
+	MaxConcurrentJobs    *int64
+	MaxCompoundsPerMonth *int64
+	MaxMDNsPerMonth      *float64
+	MaxStorageBytes      *int64
+}
+
+// Usage is what an account has consumed. Compounds and MD nanoseconds
+// count jobs created this month that are queued, running or succeeded.
+type Usage struct {
+	ConcurrentJobs int64
+	Compounds      int64
+	MDNanoseconds  float64
+	StorageBytes   int64
+}
+
+// Report is an organization's usage against its plan in the current
+// billing period.
+type Report struct {
+	Plan        Plan
+	Usage       Usage
+	PeriodStart time.Time
+	PeriodEnd   time.Time
+}
+
+// ExceededError is returned when a submission would take an account past
+// one of its plan's limits.
+type ExceededError struct {
+	Resource  string
+	Plan      string
+	Limit     float64
+	Used      float64
+	Requested float64
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("%s quota of the %s plan exceeded: %g used of %g, %g requested",
+		e.Resource, e.Plan, e.Used, e.Limit, e.Requested)
+}
+
+// Transient reports whether the limit frees up by itself as running jobs
+// finish, as opposed to needing a new billing period or a bigger plan.
+func (e *ExceededError) Transient() bool {
+	return e.Resource == ResourceConcurrentJobs
+}
+
+// account is whom usage is billed to: an organization, or else a user.
+type account struct {
+	orgID  *int
+	userID int
+}
+
+func (a account) lockKey() string {
+	if a.orgID != nil {
+		return fmt.Sprintf("quota:org:%d", *a.orgID)
+	}
+	return fmt.Sprintf("quota:user:%d", a.userID)
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx.
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type Service struct {
+	db *sql.DB
+}
+
+func New(db *sql.DB) *Service {
+	return &Service{db: db}
+}
+
+// PeriodStart returns the start of the billing month containing t, in UTC.
+func PeriodStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// Admit checks that job fits its account's plan and fills in the account
+// and estimated consumption the job is stored with. A job without a
+// workflow may come with OrganizationID set to the organization the
+// caller acts for, which is then billed. It must run in the
+// transaction that inserts the job: it holds a lock on the account until
+// that transaction ends, so concurrent submissions cannot both squeeze
+// under a limit.
+func (s *Service) Admit(ctx context.Context, tx *sql.Tx, job *models.Job) error {
+	acct, err := accountOf(ctx, tx, job.UserID, job.WorkflowID, job.OrganizationID)
+	if err != nil {
+		return err
+	}
+	job.OrganizationID = acct.orgID
+	job.Compounds, job.MDNanoseconds = Estimate(job.Type, job.Payload)
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, acct.lockKey()); err != nil {
+		return fmt.Errorf("quota: failed to lock account: %w", err)
+	}
+	plan, err := planOf(ctx, tx, acct)
+	if err != nil {
+		return err
+	}
+	usage, err := jobUsage(ctx, tx, acct, PeriodStart(time.Now()))
+	if err != nil {
+		return err
+	}
+	return admit(plan, usage, job)
+}
+
+// admit checks a job with its estimates filled in against plan, given the
+// account's usage. Every job type screens compounds, so an exhausted
+// compound budget rejects any job, even one whose estimate is zero because
+// its size is only known once BioAPI runs it. Likewise for MD jobs and the
+// MD budget.
+func admit(plan Plan, usage Usage, job *models.Job) error {
+	if plan.MaxConcurrentJobs != nil && usage.ConcurrentJobs+1 > *plan.MaxConcurrentJobs {
+		return &ExceededError{Resource: ResourceConcurrentJobs, Plan: plan.Name,
+			Limit: float64(*plan.MaxConcurrentJobs), Used: float64(usage.ConcurrentJobs), Requested: 1}
+	}
+	if limit := plan.MaxCompoundsPerMonth; limit != nil &&
+		(usage.Compounds >= *limit || usage.Compounds+job.Compounds > *limit) {
+		return &ExceededError{Resource: ResourceCompounds, Plan: plan.Name,
+			Limit: float64(*limit), Used: float64(usage.Compounds), Requested: float64(job.Compounds)}
+	}
+	if limit := plan.MaxMDNsPerMonth; limit != nil && job.Type == models.JobMolecularDynamics &&
+		(usage.MDNanoseconds >= *limit || usage.MDNanoseconds+job.MDNanoseconds > *limit) {
+		return &ExceededError{Resource: ResourceMDNanoseconds, Plan: plan.Name,
+			Limit: *limit, Used: usage.MDNanoseconds, Requested: job.MDNanoseconds}
+	}
+	return nil
+}
+
+// CheckStorage returns an *ExceededError if adding size bytes of artifacts
+// to workflowID would take its account past the plan's storage limit.
+func (s *Service) CheckStorage(ctx context.Context, workflowID int, size int64) error {
+	acct, err := workflowAccount(ctx, s.db, workflowID)
+	if err != nil {
+		return err
+	}
+	plan, err := planOf(ctx, s.db, acct)
+	if err != nil {
+		return err
+	}
+	if plan.MaxStorageBytes == nil {
+		return nil
+	}
+	used, err := storageUsage(ctx, s.db, acct)
+	if err != nil {
+		return err
+	}
+	if used+size > *plan.MaxStorageBytes {
+		return &ExceededError{Resource: ResourceStorageBytes, Plan: plan.Name,
+			Limit: float64(*plan.MaxStorageBytes), Used: float64(used), Requested: float64(size)}
+	}
+	return nil
+}
+
+// Report returns the usage of organization orgID in the current month.
+func (s *Service) Report(ctx context.Context, orgID int) (*Report, error) {
+	acct := account{orgID: &orgID}
+	start := PeriodStart(time.Now())
+	plan, err := planOf(ctx, s.db, acct)
+	if err != nil {
+		return nil, err
+	}
+	usage, err := jobUsage(ctx, s.db, acct, start)
+	if err != nil {
+		return nil, err
+	}
+	if usage.StorageBytes, err = storageUsage(ctx, s.db, acct); err != nil {
+		return nil, err
+	}
+	return &Report{Plan: plan, Usage: usage, PeriodStart: start, PeriodEnd: start.AddDate(0, 1, 0)}, nil
+}
+
+// accountOf returns the account billed for a job of userID on workflowID:
+// the organization of the workflow's team, or else the user. A job
+// without a workflow is billed to orgID, the organization the caller acts
+// for, if set, and otherwise as userAccount decides.
+func accountOf(ctx context.Context, q querier, userID int, workflowID, orgID *int) (account, error) {
+	if workflowID != nil {
+		acct, err := workflowAccount(ctx, q, *workflowID)
+		acct.userID = userID
+		return acct, err
+	}
+	if orgID != nil {
+		return account{orgID: orgID, userID: userID}, nil
+	}
+	return userAccount(ctx, q, userID)
+}
+
+// userAccount returns the account billed for userID's own jobs: their
+// organization if they belong to exactly one, or else the user. A member
+// of several organizations picks one by filing the job under a workflow
+// or submitting it with the organization's API key.
+func userAccount(ctx context.Context, q querier, userID int) (account, error) {
+	acct := account{userID: userID}
+	var orgID int
+	err := q.QueryRowContext(ctx, `
+		SELECT MIN(organization_id) FROM organization_members
+		WHERE user_id = $1
+		HAVING COUNT(*) = 1
+	`, userID).Scan(&orgID)
+	if err == sql.ErrNoRows {
+		return acct, nil
+	}
+	if err != nil {
+		return acct, fmt.Errorf("quota: failed to resolve account: %w", err)
+	}
+	acct.orgID = &orgID
+	return acct, nil
+}
+
+// workflowAccount returns the account owning workflowID's artifacts: the
+// organization of the workflow's team, or else the workflow's owner.
+func workflowAccount(ctx context.Context, q querier, workflowID int) (account, error) {
+	var acct account
+	var orgID sql.NullInt64
+	err := q.QueryRowContext(ctx, `
+		SELECT w.user_id, t.organization_id FROM workflows w
+		LEFT JOIN teams t ON t.id = w.team_id
+		WHERE w.id = $1
+	`, workflowID).Scan(&acct.userID, &orgID)
+	if err == sql.ErrNoRows {
+		return acct, ErrWorkflowNotFound
+	}
+	if err != nil {
+		return acct, fmt.Errorf("quota: failed to resolve account: %w", err)
+	}
+	if orgID.Valid {
+		id := int(orgID.Int64)
+		acct.orgID = &id
+	}
+	return acct, nil
+}
+
+// planOf returns the plan of acct, falling back to DefaultPlan.
+func planOf(ctx context.Context, q querier, acct account) (Plan, error) {
+	var orgID interface{}
+	if acct.orgID != nil {
+		orgID = *acct.orgID
+	}
+	var p Plan
+	err := q.QueryRowContext(ctx, `
+		SELECT name, max_concurrent_jobs, max_compounds_per_month, max_md_ns_per_month, max_storage_bytes
+		FROM plans
+		WHERE name IN ($1, COALESCE((SELECT plan FROM organizations WHERE id = $2), $1))
+		ORDER BY name = $1
+		LIMIT 1
+	`, DefaultPlan, orgID).Scan(&p.Name, &p.MaxConcurrentJobs, &p.MaxCompoundsPerMonth, &p.MaxMDNsPerMonth, &p.MaxStorageBytes)
+	if err == sql.ErrNoRows {
+		// Without a plans row the default plan imposes no limits
+		return Plan{Name: DefaultPlan}, nil
+	}
+	if err != nil {
+		return Plan{}, fmt.Errorf("quota: failed to load plan: %w", err)
+	}
+	return p, nil
+}
+
+// jobUsage sums the jobs of acct; the monthly figures count jobs created
+// since start.
+func jobUsage(ctx context.Context, q querier, acct account, start time.Time) (Usage, error) {
+	cond, arg := `organization_id IS NULL AND user_id = $1`, interface{}(acct.userID)
+	if acct.orgID != nil {
+		cond, arg = `organization_id = $1`, *acct.orgID
+	}
+	var u Usage
+	err := q.QueryRowContext(ctx, `
+		SELECT COUNT(*) FILTER (WHERE status IN ($2, $3)),
+		       COALESCE(SUM(compounds) FILTER (WHERE created_at >= $5), 0),
+		       COALESCE(SUM(md_ns) FILTER (WHERE created_at >= $5), 0)
+		FROM jobs
+		WHERE `+cond+` AND status IN ($2, $3, $4)
+	`, arg, models.JobQueued, models.JobRunning, models.JobSucceeded, start).Scan(
+		&u.ConcurrentJobs, &u.Compounds, &u.MDNanoseconds)
+	if err != nil {
+		return Usage{}, fmt.Errorf("quota: failed to sum job usage: %w", err)
+	}
+	return u, nil
+}
+
+// storageUsage sums the artifacts of acct's workflows: those of the
+// organization's teams, or the user's own workflows outside any
+// organization.
+func storageUsage(ctx context.Context, q querier, acct account) (int64, error) {
+	cond, arg := `t.organization_id IS NULL AND w.user_id = $1`, interface{}(acct.userID)
+	if acct.orgID != nil {
+		cond, arg = `t.organization_id = $1`, *acct.orgID
+	}
+	var used int64
+	err := q.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(a.size_bytes), 0)
+		FROM artifacts a
+		JOIN workflows w ON w.id = a.workflow_id
+		LEFT JOIN teams t ON t.id = w.team_id
+		WHERE `+cond, arg).Scan(&used)
+	if err != nil {
+		return 0, fmt.Errorf("quota: failed to sum storage usage: %w", err)
+	}
+	return used, nil
+}
+
+// Estimate returns the compounds and MD nanoseconds a job will consume,
+// from the limits BioAPI applies to its payload. The size of a named
+// compound library is not known here, so a library screen is estimated at
+// nothing and metered once its result reports what it screened.
+func Estimate(jobType string, payload []byte) (compounds int64, mdNs float64) {
+	switch jobType {
+	case models.JobVirtualScreening:
+		var req bioapi.ScreeningRequest
+		if json.Unmarshal(payload, &req) == nil {
+			compounds = int64(len(req.CustomCompounds))
+		}
+	case models.JobVinaDocking:
+		var req bioapi.ScreeningRequest
+		if json.Unmarshal(payload, &req) == nil {
+			n := len(req.CustomCompounds)
+			if n == 0 {
+				// Docks the first max_compounds of the library
+				n = math.MaxInt32
+			}
+			compounds = capped(n, req.MaxCompounds, defaultDockingCompounds)
+		}
+	case models.JobMolecularDynamics:
+		var req bioapi.MDSimulationRequest
+		if json.Unmarshal(payload, &req) == nil {
+			compounds = capped(len(req.TopCompounds), req.MaxCompounds, defaultMDCompounds)
+			mdNs = float64(compounds) * mdNanosecondsPerCompound
+		}
+	case models.JobLeadOptimization:
+		var req bioapi.LeadOptimizationRequest
+		if json.Unmarshal(payload, &req) == nil {
+			compounds = capped(len(req.Compounds), req.MaxCompounds, defaultLeadCompounds)
+		}
+	}
+	return compounds, mdNs
+}
+
+// Consumed returns what a succeeded job actually consumed, read from its
+// BioAPI response. ok is false if the response does not report it, in
+// which case the estimate stands. Reused cached results consume nothing.
+func Consumed(jobType string, result []byte, cacheHit bool) (compounds int64, mdNs float64, ok bool) {
+	if cacheHit {
+		return 0, 0, true
+	}
+	var env struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if json.Unmarshal(result, &env) != nil || len(env.Data) == 0 {
+		return 0, 0, false
+	}
+	switch jobType {
+	case models.JobVirtualScreening, models.JobVinaDocking:
+		var r bioapi.ScreeningResult
+		if json.Unmarshal(env.Data, &r) != nil {
+			return 0, 0, false
+		}
+		if r.CompoundsDocked > 0 {
+			return int64(r.CompoundsDocked), 0, true
+		}
+		return int64(r.CompoundsScreened), 0, true
+	case models.JobMolecularDynamics:
+		var r bioapi.MDSimulationResult
+		if json.Unmarshal(env.Data, &r) != nil {
+			return 0, 0, false
+		}
+		// simulation_time_ns is per compound
+		return int64(r.CompoundsSimulated), r.SimulationTimeNS * float64(r.CompoundsSimulated), true
+	}
+	return 0, 0, false
+}
+
+// capped returns n limited to max, or to def when max is unset.
+func capped(n, max, def int) int64 {
+	if max <= 0 {
+		max = def
+	}
+	if n > max {
+		n = max
+	}
+	return int64(n)
+}
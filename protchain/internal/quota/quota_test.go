@@ -0,0 +1,231 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"protchain/internal/database/databasetest"
+	"protchain/internal/models"
+)
+
+func TestAdmit(t *testing.T) {
+	jobs, compounds, mdNs := int64(2), int64(100), 5.0
+	plan := Plan{Name: "free", MaxConcurrentJobs: &jobs, MaxCompoundsPerMonth: &compounds, MaxMDNsPerMonth: &mdNs}
+
+	tests := []struct {
+		name  string
+		usage Usage
+		job   models.Job
+		// want is the exceeded resource, or "" to admit
+		want string
+	}{
+		{"within every limit", Usage{ConcurrentJobs: 1, Compounds: 50}, models.Job{Type: models.JobVinaDocking, Compounds: 50}, ""},
+		{"too many jobs", Usage{ConcurrentJobs: 2}, models.Job{Type: models.JobVinaDocking, Compounds: 1}, ResourceConcurrentJobs},
+		{"estimate over the limit", Usage{Compounds: 60}, models.Job{Type: models.JobVinaDocking, Compounds: 41}, ResourceCompounds},
+		// A library screen is estimated at zero until BioAPI reports its size
+		{"zero estimate under the limit", Usage{Compounds: 99}, models.Job{Type: models.JobVirtualScreening}, ""},
+		{"zero estimate at the limit", Usage{Compounds: 100}, models.Job{Type: models.JobVirtualScreening}, ResourceCompounds},
+		{"zero estimate over the limit", Usage{Compounds: 250}, models.Job{Type: models.JobVirtualScreening}, ResourceCompounds},
+		{"MD within the limit", Usage{MDNanoseconds: 2.5}, models.Job{Type: models.JobMolecularDynamics, Compounds: 10, MDNanoseconds: 2.5}, ""},
+		{"MD estimate over the limit", Usage{MDNanoseconds: 3}, models.Job{Type: models.JobMolecularDynamics, Compounds: 10, MDNanoseconds: 2.5}, ResourceMDNanoseconds},
+		{"MD zero estimate at the limit", Usage{MDNanoseconds: 5}, models.Job{Type: models.JobMolecularDynamics}, ResourceMDNanoseconds},
+		// Only MD jobs spend MD time
+		{"screening with MD exhausted", Usage{MDNanoseconds: 5}, models.Job{Type: models.JobVinaDocking, Compounds: 10}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := admit(plan, tt.usage, &tt.job)
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("admit: %v", err)
+				}
+				return
+			}
+			var exceeded *ExceededError
+			if !errors.As(err, &exceeded) || exceeded.Resource != tt.want {
+				t.Fatalf("admit = %v, want %s exceeded", err, tt.want)
+			}
+			if exceeded.Plan != "free" {
+				t.Errorf("plan = %q", exceeded.Plan)
+			}
+		})
+	}
+}
+
+func TestAdmitUnlimited(t *testing.T) {
+	usage := Usage{ConcurrentJobs: 1000, Compounds: 1e9, MDNanoseconds: 1e6}
+	job := models.Job{Type: models.JobMolecularDynamics, Compounds: 10, MDNanoseconds: 2.5}
+	if err := admit(Plan{Name: "enterprise"}, usage, &job); err != nil {
+		t.Errorf("admit without limits: %v", err)
+	}
+}
+
+func TestAccountOf(t *testing.T) {
+	db := databasetest.Open(t)
+	ctx := context.Background()
+	insert := func(query string, args ...interface{}) int {
+		t.Helper()
+		var id int
+		if err := db.QueryRow(query+` RETURNING id`, args...).Scan(&id); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		return id
+	}
+	n := 0
+	user := func(orgs ...int) int {
+		n++
+		id := insert(`INSERT INTO users (email, password_hash) VALUES ($1, 'x')`, fmt.Sprintf("user%d@example.com", n))
+		for _, org := range orgs {
+			insert(`INSERT INTO organization_members (organization_id, user_id) VALUES ($1, $2)`, org, id)
+		}
+		return id
+	}
+
+	orgA := insert(`INSERT INTO organizations (name) VALUES ('A')`)
+	orgB := insert(`INSERT INTO organizations (name) VALUES ('B')`)
+	team := insert(`INSERT INTO teams (organization_id, name) VALUES ($1, 'a')`, orgA)
+	loner, member, twoOrgs := user(), user(orgA), user(orgA, orgB)
+	teamWorkflow := insert(`INSERT INTO workflows (user_id, team_id, name) VALUES ($1, $2, 'team')`, member, team)
+	personal := insert(`INSERT INTO workflows (user_id, name) VALUES ($1, 'personal')`, member)
+
+	tests := []struct {
+		name      string
+		user      int
+		workflow  *int
+		callerOrg *int
+		// want is the billed organization, or 0 for the user
+		want int
+	}{
+		{"team workflow", twoOrgs, &teamWorkflow, nil, orgA},
+		{"team workflow, caller acting for another organization", twoOrgs, &teamWorkflow, &orgB, orgA},
+		{"personal workflow", member, &personal, nil, 0},
+		{"no workflow, caller acting for an organization", loner, nil, &orgB, orgB},
+		{"no workflow, member of one organization", member, nil, nil, orgA},
+		{"no workflow, member of two organizations", twoOrgs, nil, nil, 0},
+		{"no workflow, no organization", loner, nil, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			acct, err := accountOf(ctx, db, tt.user, tt.workflow, tt.callerOrg)
+			if err != nil {
+				t.Fatalf("accountOf: %v", err)
+			}
+			if acct.userID != tt.user {
+				t.Errorf("user = %d, want %d", acct.userID, tt.user)
+			}
+			got := 0
+			if acct.orgID != nil {
+				got = *acct.orgID
+			}
+			if got != tt.want {
+				t.Errorf("billed organization = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	missing := personal + 100
+	if _, err := accountOf(ctx, db, member, &missing, nil); !errors.Is(err, ErrWorkflowNotFound) {
+		t.Errorf("accountOf for a missing workflow = %v, want ErrWorkflowNotFound", err)
+	}
+	if err := New(db).CheckStorage(ctx, missing, 1); !errors.Is(err, ErrWorkflowNotFound) {
+		t.Errorf("CheckStorage for a missing workflow = %v, want ErrWorkflowNotFound", err)
+	}
+}
+
+// TestAdmitBillsAccount checks the organization a job is stored with.
+func TestAdmitBillsAccount(t *testing.T) {
+	db := databasetest.Open(t)
+	ctx := context.Background()
+	var org, userID int
+	if err := db.QueryRow(`INSERT INTO organizations (name) VALUES ('A') RETURNING id`).Scan(&org); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow(`INSERT INTO users (email, password_hash) VALUES ('a@example.com', 'x') RETURNING id`).Scan(&userID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO organization_members (organization_id, user_id) VALUES ($1, $2)`, org, userID); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	job := &models.Job{UserID: userID, Type: models.JobVinaDocking, Payload: []byte(`{}`)}
+	if err := New(db).Admit(ctx, tx, job); err != nil {
+		t.Fatalf("Admit: %v", err)
+	}
+	if job.OrganizationID == nil || *job.OrganizationID != org || job.Compounds != defaultDockingCompounds {
+		t.Errorf("admitted job billed to %v for %d compounds, want organization %d for %d", job.OrganizationID, job.Compounds, org, defaultDockingCompounds)
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	tests := []struct {
+		name      string
+		jobType   string
+		payload   string
+		compounds int64
+		mdNs      float64
+	}{
+		{"custom screen", models.JobVirtualScreening, `{"custom_compounds":[{},{},{}]}`, 3, 0},
+		// Only known once BioAPI reports what it screened
+		{"library screen", models.JobVirtualScreening, `{"library":"zinc"}`, 0, 0},
+		{"library docking", models.JobVinaDocking, `{"max_compounds":30}`, 30, 0},
+		{"library docking, default cap", models.JobVinaDocking, `{}`, defaultDockingCompounds, 0},
+		{"custom docking under the cap", models.JobVinaDocking, `{"custom_compounds":[{},{}],"max_compounds":30}`, 2, 0},
+		{"MD", models.JobMolecularDynamics, `{"top_compounds":[{},{},{},{}]}`, 4, 1},
+		{"MD over the cap", models.JobMolecularDynamics, `{"top_compounds":[{},{},{},{}],"max_compounds":2}`, 2, 0.5},
+		{"lead optimization", models.JobLeadOptimization, `{"compounds":[{}]}`, 1, 0},
+		{"malformed payload", models.JobVinaDocking, `[`, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compounds, mdNs := Estimate(tt.jobType, []byte(tt.payload))
+			if compounds != tt.compounds || mdNs != tt.mdNs {
+				t.Errorf("Estimate = %d compounds, %g ns; want %d, %g", compounds, mdNs, tt.compounds, tt.mdNs)
+			}
+		})
+	}
+}
+
+func TestConsumed(t *testing.T) {
+	tests := []struct {
+		name      string
+		jobType   string
+		result    string
+		cacheHit  bool
+		compounds int64
+		mdNs      float64
+		ok        bool
+	}{
+		{"screening", models.JobVirtualScreening, `{"data":{"compounds_screened":1200}}`, false, 1200, 0, true},
+		{"docking", models.JobVinaDocking, `{"data":{"compounds_screened":1200,"compounds_docked":40}}`, false, 40, 0, true},
+		// simulation_time_ns is per compound
+		{"MD", models.JobMolecularDynamics, `{"data":{"compounds_simulated":4,"simulation_time_ns":0.5}}`, false, 4, 2, true},
+		{"cached result", models.JobVinaDocking, `{"data":{"compounds_docked":40}}`, true, 0, 0, true},
+		{"no data", models.JobVinaDocking, `{"success":false}`, false, 0, 0, false},
+		{"unmetered type", models.JobLeadOptimization, `{"data":{}}`, false, 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compounds, mdNs, ok := Consumed(tt.jobType, []byte(tt.result), tt.cacheHit)
+			if compounds != tt.compounds || mdNs != tt.mdNs || ok != tt.ok {
+				t.Errorf("Consumed = %d, %g, %v; want %d, %g, %v", compounds, mdNs, ok, tt.compounds, tt.mdNs, tt.ok)
+			}
+		})
+	}
+}
+
+func TestPeriodStart(t *testing.T) {
+	// Late on the last day of February in New York is March in UTC
+	ny := time.FixedZone("EST", -5*60*60)
+	got := PeriodStart(time.Date(2026, 2, 28, 22, 0, 0, 0, ny))
+	if want := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC); !got.Equal(want) || got.Location() != time.UTC {
+		t.Errorf("PeriodStart = %v, want %v", got, want)
+	}
+}
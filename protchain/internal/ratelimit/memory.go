@@ -0,0 +1,95 @@
+package ratelimit
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps budgets in process memory. Every replica enforces its
+// own budgets, so it suits a single API instance. At most maxKeys buckets
+// are kept; the least recently used are dropped first, and buckets that
+// have refilled completely are dropped as soon as they reach the back of
+// the list, since a full bucket is the same as none.
+type MemoryStore struct {
+	mu      sync.Mutex
+	maxKeys int
+	lru     *list.List // of *memoryBucket, most recently used first
+	buckets map[string]*list.Element
+	slots   map[string]int
+}
+
+type memoryBucket struct {
+	key string
+	tat int64
+}
+
+func NewMemoryStore(maxKeys int) *MemoryStore {
+	if maxKeys <= 0 {
+		maxKeys = 100000
+	}
+	return &MemoryStore{
+		maxKeys: maxKeys,
+		lru:     list.New(),
+		buckets: make(map[string]*list.Element),
+		slots:   make(map[string]int),
+	}
+}
+
+func (s *MemoryStore) Take(_ context.Context, key string, limit Limit) (Result, error) {
+	now := nowMicros()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.buckets[key]
+	if !ok {
+		el = s.lru.PushFront(&memoryBucket{key: key})
+		s.buckets[key] = el
+	} else {
+		s.lru.MoveToFront(el)
+	}
+	b := el.Value.(*memoryBucket)
+
+	newTAT, allowed := gcra(now, b.tat, limit)
+	if allowed {
+		b.tat = newTAT
+	}
+	s.evict(now)
+	return result(now, b.tat, limit, allowed), nil
+}
+
+// evict drops refilled buckets from the back of the list and any beyond
+// maxKeys.
+func (s *MemoryStore) evict(now int64) {
+	for s.lru.Len() > 1 {
+		el := s.lru.Back()
+		b := el.Value.(*memoryBucket)
+		if b.tat > now && s.lru.Len() <= s.maxKeys {
+			return
+		}
+		s.lru.Remove(el)
+		delete(s.buckets, b.key)
+	}
+}
+
+func (s *MemoryStore) Acquire(_ context.Context, key string, max int, _ time.Duration) (func(), bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.slots[key] >= max {
+		return nil, false, nil
+	}
+	s.slots[key]++
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.slots[key]--; s.slots[key] <= 0 {
+				delete(s.slots, key)
+			}
+		})
+	}
+	return release, true, nil
+}
@@ -0,0 +1,129 @@
+package ratelimit
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+)
+
+func (s *MemoryStore) keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for key := range s.buckets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestMemoryStoreBurst(t *testing.T) {
+	s := NewMemoryStore(0)
+	ctx := context.Background()
+	l := Limit{Rate: 1, Burst: 3}
+
+	for i, want := range []int{2, 1, 0} {
+		r, err := s.Take(ctx, "k", l)
+		if err != nil || !r.Allowed || r.Remaining != want {
+			t.Fatalf("request %d = %+v, %v; want allowed with %d remaining", i+1, r, err, want)
+		}
+	}
+	r, err := s.Take(ctx, "k", l)
+	if err != nil || r.Allowed {
+		t.Fatalf("request beyond the burst = %+v, %v", r, err)
+	}
+	// The next token is a second after the first request
+	if r.RetryAfter <= 900*time.Millisecond || r.RetryAfter > time.Second {
+		t.Errorf("RetryAfter = %v, want just under 1s", r.RetryAfter)
+	}
+	if r.Reset <= 2*time.Second || r.Reset > 3*time.Second {
+		t.Errorf("Reset = %v, want just under 3s", r.Reset)
+	}
+
+	// A denied request does not spend the budget
+	again, _ := s.Take(ctx, "k", l)
+	if again.Allowed || again.RetryAfter > r.RetryAfter {
+		t.Errorf("second denied request = %+v after %+v", again, r)
+	}
+	if other, _ := s.Take(ctx, "other", l); !other.Allowed || other.Remaining != 2 {
+		t.Errorf("another key = %+v, want a full bucket", other)
+	}
+}
+
+func TestMemoryStoreEviction(t *testing.T) {
+	s := NewMemoryStore(2)
+	ctx := context.Background()
+	slow := Limit{Rate: 1, Burst: 5}
+	take := func(key string) Result {
+		t.Helper()
+		r, err := s.Take(ctx, key, slow)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	take("a")
+	take("b")
+	take("a")
+	take("c")
+	// b was used least recently
+	if keys := s.keys(); len(keys) != 2 || keys[0] != "a" || keys[1] != "c" {
+		t.Fatalf("buckets = %v after a third key, want a and c", keys)
+	}
+	if r := take("b"); r.Remaining != 4 {
+		t.Errorf("evicted key = %+v, want a full bucket", r)
+	}
+	if r := take("c"); r.Remaining != 3 {
+		t.Errorf("kept key = %+v, want its spent budget", r)
+	}
+
+	// A refilled bucket is dropped once it is the least recently used,
+	// below maxKeys too
+	s = NewMemoryStore(10)
+	fast := Limit{Rate: 1e6, Burst: 1}
+	s.Take(ctx, "x", fast)
+	time.Sleep(time.Millisecond)
+	s.Take(ctx, "y", fast)
+	if keys := s.keys(); len(keys) != 1 || keys[0] != "y" {
+		t.Errorf("buckets = %v, want the refilled one dropped", keys)
+	}
+}
+
+func TestMemoryStoreConcurrency(t *testing.T) {
+	s := NewMemoryStore(0)
+	ctx := context.Background()
+
+	var releases []func()
+	for i := 0; i < 2; i++ {
+		release, ok, err := s.Acquire(ctx, "k", 2, time.Minute)
+		if !ok || err != nil {
+			t.Fatalf("slot %d = %v, %v", i+1, ok, err)
+		}
+		releases = append(releases, release)
+	}
+	if release, ok, _ := s.Acquire(ctx, "k", 2, time.Minute); ok || release != nil {
+		t.Fatal("third slot granted with a cap of 2")
+	}
+	if _, ok, _ := s.Acquire(ctx, "other", 2, time.Minute); !ok {
+		t.Error("another key's slot refused")
+	}
+
+	// Releasing twice frees one slot only
+	releases[0]()
+	releases[0]()
+	release, ok, _ := s.Acquire(ctx, "k", 2, time.Minute)
+	if !ok {
+		t.Fatal("slot refused after a release")
+	}
+	if _, ok, _ := s.Acquire(ctx, "k", 2, time.Minute); ok {
+		t.Error("a double release freed two slots")
+	}
+
+	release()
+	releases[1]()
+	if n, ok := s.slots["k"]; ok {
+		t.Errorf("%d slots of k held after every release", n)
+	}
+}
@@ -0,0 +1,115 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"log/slog"
+	"time"
+)
+
+// PostgresStore keeps budgets in the rate_limit_buckets and
+// rate_limit_leases tables, shared by every replica. It costs a round trip
+// per request, so it suits deployments without a Redis-protocol server.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := nowMicros()
+	emission, tolerance := limit.interval()
+
+	// The update only happens, and only returns a row, if the request fits
+	var tat int64
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO rate_limit_buckets (key, tat, expires_at)
+		VALUES ($1, $2::bigint + $3::bigint, NOW() + $3::bigint * INTERVAL '1 microsecond')
+		ON CONFLICT (key) DO UPDATE
+		SET tat = GREATEST(rate_limit_buckets.tat, $2::bigint) + $3::bigint,
+			expires_at = NOW() + (GREATEST(rate_limit_buckets.tat, $2::bigint) + $3::bigint - $2::bigint) * INTERVAL '1 microsecond'
+		WHERE GREATEST(rate_limit_buckets.tat, $2::bigint) + $3::bigint - $4::bigint <= $2::bigint
+		RETURNING tat
+	`, key, now, emission, tolerance).Scan(&tat)
+	if err == nil {
+		return result(now, tat, limit, true), nil
+	}
+	if err != sql.ErrNoRows {
+		return Result{}, err
+	}
+
+	if err := s.db.QueryRowContext(ctx, `SELECT tat FROM rate_limit_buckets WHERE key = $1`, key).Scan(&tat); err != nil {
+		return Result{}, err
+	}
+	return result(now, tat, limit, false), nil
+}
+
+func (s *PostgresStore) Acquire(ctx context.Context, key string, max int, ttl time.Duration) (func(), bool, error) {
+	id, err := leaseID()
+	if err != nil {
+		return nil, false, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	// Serialise acquisitions of one key so the count cannot be raced
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, key); err != nil {
+		return nil, false, err
+	}
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO rate_limit_leases (key, id, expires_at)
+		SELECT $1, $2, NOW() + $4 * INTERVAL '1 millisecond'
+		WHERE (SELECT COUNT(*) FROM rate_limit_leases WHERE key = $1 AND expires_at > NOW()) < $3
+	`, key, id, max, ttl.Milliseconds())
+	if err != nil {
+		return nil, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, false, nil
+	}
+
+	release := func() {
+		if _, err := s.db.Exec(`DELETE FROM rate_limit_leases WHERE key = $1 AND id = $2`, key, id); err != nil {
+			slog.Error("ratelimit: failed to release lease", "key", key, "error", err)
+		}
+	}
+	return release, true, nil
+}
+
+// Run deletes refilled buckets and expired leases until ctx is cancelled.
+func (s *PostgresStore) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := s.db.ExecContext(ctx, `DELETE FROM rate_limit_buckets WHERE expires_at <= NOW()`); err != nil && ctx.Err() == nil {
+			slog.Error("ratelimit: failed to sweep buckets", "error", err)
+		}
+		if _, err := s.db.ExecContext(ctx, `DELETE FROM rate_limit_leases WHERE expires_at <= NOW()`); err != nil && ctx.Err() == nil {
+			slog.Error("ratelimit: failed to sweep leases", "error", err)
+		}
+	}
+}
+
+func leaseID() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
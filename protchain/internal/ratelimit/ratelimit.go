@@ -0,0 +1,234 @@
+// Package ratelimit enforces request budgets shared by every API replica.
+// Budgets are token buckets kept by the generic cell rate algorithm
+// (GCRA), which stores a single timestamp per key, so the same arithmetic
+// runs in process memory, in Postgres and in a Redis-protocol server.
+// Policies may also cap how many requests of a key run at once.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit is a token bucket: Burst requests at once, refilled at Rate per
+// second.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Policy is the named budget of a group of routes.
+type Policy struct {
+	Name string
+	Limit
+	// Concurrency caps the requests of one key in flight at once. Zero
+	// means no cap. It only bounds work done within the request, not jobs
+	// a request queues.
+	Concurrency int
+	// Period is the window the policy was written in, reported in the
+	// RateLimit-Policy header.
+	Period time.Duration
+}
+
+// Result is the outcome of spending one request of a budget.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is how long until a denied request would be allowed
+	RetryAfter time.Duration
+}
+
+// Store keeps budgets and concurrency slots.
+type Store interface {
+	// Take spends one request of key's budget under limit.
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+	// Acquire takes one of max concurrent slots of key. The slot is held
+	// until release is called or ttl elapses, whichever comes first, so a
+	// crashed replica cannot hold slots forever.
+	Acquire(ctx context.Context, key string, max int, ttl time.Duration) (release func(), ok bool, err error)
+}
+
+// interval returns the time between two requests of limit and its burst
+// tolerance, both in microseconds.
+func (l Limit) interval() (emission, tolerance int64) {
+	emission = int64(math.Ceil(1e6 / l.Rate))
+	if emission < 1 {
+		emission = 1
+	}
+	return emission, emission * int64(l.Burst)
+}
+
+// gcra spends one request given the stored theoretical arrival time tat
+// (zero for a new key). It returns the tat to store if the request is
+// allowed. All times are microseconds since the Unix epoch.
+func gcra(now, tat int64, l Limit) (newTAT int64, allowed bool) {
+	emission, tolerance := l.interval()
+	if tat < now {
+		tat = now
+	}
+	newTAT = tat + emission
+	return newTAT, newTAT-tolerance <= now
+}
+
+// result describes a decision. tat is the stored value after it: the new
+// tat if the request was allowed, the unchanged one otherwise.
+func result(now, tat int64, l Limit, allowed bool) Result {
+	emission, tolerance := l.interval()
+	if tat < now {
+		tat = now
+	}
+	r := Result{Allowed: allowed, Limit: l.Burst, Reset: micros(tat - now)}
+	if allowed {
+		r.Remaining = int((tolerance - (tat - now)) / emission)
+	} else {
+		r.RetryAfter = micros(tat + emission - tolerance - now)
+	}
+	return r
+}
+
+func micros(us int64) time.Duration {
+	if us < 0 {
+		return 0
+	}
+	return time.Duration(us) * time.Microsecond
+}
+
+func nowMicros() int64 {
+	return time.Now().UnixMicro()
+}
+
+// ParsePolicies reads policies written as
+//
+//	name=count/period[:burst[:concurrency]]
+//
+// separated by commas, e.g. "auth=10/1m,screening=30/1m:10". Burst
+// defaults to count. Policies in spec replace those of the same name in
+// defaults; the others are kept.
+func ParsePolicies(spec string, defaults []Policy) (map[string]Policy, error) {
+	policies := make(map[string]Policy, len(defaults))
+	for _, p := range defaults {
+		policies[p.Name] = p
+	}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		p, err := parsePolicy(entry)
+		if err != nil {
+			return nil, err
+		}
+		policies[p.Name] = p
+	}
+	return policies, nil
+}
+
+func parsePolicy(entry string) (Policy, error) {
+	name, rest, ok := strings.Cut(entry, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return Policy{}, fmt.Errorf("ratelimit: policy %q is not name=count/period", entry)
+	}
+	fields := strings.Split(rest, ":")
+	if len(fields) > 3 {
+		return Policy{}, fmt.Errorf("ratelimit: policy %q has too many fields", entry)
+	}
+
+	countStr, periodStr, ok := strings.Cut(fields[0], "/")
+	count, err := strconv.Atoi(strings.TrimSpace(countStr))
+	if !ok || err != nil || count < 1 {
+		return Policy{}, fmt.Errorf("ratelimit: policy %q needs a positive count/period", entry)
+	}
+	period, err := time.ParseDuration(strings.TrimSpace(periodStr))
+	if err != nil || period <= 0 {
+		return Policy{}, fmt.Errorf("ratelimit: policy %q has an invalid period", entry)
+	}
+	p := NewPolicy(name, count, period)
+
+	if len(fields) > 1 && strings.TrimSpace(fields[1]) != "" {
+		if p.Burst, err = strconv.Atoi(strings.TrimSpace(fields[1])); err != nil || p.Burst < 1 {
+			return Policy{}, fmt.Errorf("ratelimit: policy %q has an invalid burst", entry)
+		}
+	}
+	if len(fields) > 2 {
+		if p.Concurrency, err = strconv.Atoi(strings.TrimSpace(fields[2])); err != nil || p.Concurrency < 0 {
+			return Policy{}, fmt.Errorf("ratelimit: policy %q has an invalid concurrency", entry)
+		}
+	}
+	return p, nil
+}
+
+// NewPolicy returns a policy allowing count requests per period, all of
+// which may arrive at once.
+func NewPolicy(name string, count int, period time.Duration) Policy {
+	return Policy{
+		Name:   name,
+		Limit:  Limit{Rate: float64(count) / period.Seconds(), Burst: count},
+		Period: period,
+	}
+}
+
+// Describe formats policies for logging, sorted by name.
+func Describe(policies map[string]Policy) string {
+	names := make([]string, 0, len(policies))
+	for name := range policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		p := policies[name]
+		parts[i] = fmt.Sprintf("%s=%.4g/s burst %d", name, p.Rate, p.Burst)
+		if p.Concurrency > 0 {
+			parts[i] += fmt.Sprintf(" concurrency %d", p.Concurrency)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Limiter applies named policies against a store. Budgets are kept per
+// policy and caller, so a caller's login attempts and screening runs draw
+// on separate buckets.
+type Limiter struct {
+	store    Store
+	policies map[string]Policy
+	leaseTTL time.Duration
+}
+
+// NewLimiter returns a limiter for policies. Concurrency slots are
+// reclaimed after leaseTTL, which should exceed the longest request.
+func NewLimiter(store Store, policies map[string]Policy, leaseTTL time.Duration) *Limiter {
+	return &Limiter{store: store, policies: policies, leaseTTL: leaseTTL}
+}
+
+// Policy returns the named policy. Routes name their policies in code, so
+// an unknown name is a programming error.
+func (l *Limiter) Policy(name string) Policy {
+	p, ok := l.policies[name]
+	if !ok {
+		panic("ratelimit: unknown policy " + name)
+	}
+	return p
+}
+
+// Take spends one request of caller's budget under p.
+func (l *Limiter) Take(ctx context.Context, p Policy, caller string) (Result, error) {
+	return l.store.Take(ctx, "rl:"+p.Name+":"+caller, p.Limit)
+}
+
+// Acquire takes one of caller's concurrency slots under p. It always
+// succeeds if p has no concurrency cap.
+func (l *Limiter) Acquire(ctx context.Context, p Policy, caller string) (func(), bool, error) {
+	if p.Concurrency <= 0 {
+		return func() {}, true, nil
+	}
+	return l.store.Acquire(ctx, "rlc:"+p.Name+":"+caller, p.Concurrency, l.leaseTTL)
+}
@@ -0,0 +1,196 @@
+package ratelimit
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGCRA(t *testing.T) {
+	// 10 per second with a burst of 3: a request every 100ms, three early
+	l := Limit{Rate: 10, Burst: 3}
+	const now = int64(1_000_000_000)
+
+	tat := int64(0)
+	for i, wantRemaining := range []int{2, 1, 0} {
+		newTAT, allowed := gcra(now, tat, l)
+		if !allowed {
+			t.Fatalf("request %d of the burst denied", i+1)
+		}
+		tat = newTAT
+		r := result(now, tat, l, true)
+		if r.Remaining != wantRemaining || r.Limit != 3 || r.Reset != time.Duration(i+1)*100*time.Millisecond {
+			t.Errorf("request %d: %+v", i+1, r)
+		}
+	}
+	if tat != now+300_000 {
+		t.Errorf("tat = now+%dus after the burst, want now+300000us", tat-now)
+	}
+
+	newTAT, allowed := gcra(now, tat, l)
+	if allowed {
+		t.Fatal("request beyond the burst allowed")
+	}
+	r := result(now, tat, l, false)
+	if r.Allowed || r.Remaining != 0 || r.RetryAfter != 100*time.Millisecond || r.Reset != 300*time.Millisecond {
+		t.Errorf("denied request: %+v", r)
+	}
+	if newTAT <= tat {
+		t.Errorf("gcra returned tat %d for a denied request", newTAT)
+	}
+
+	// One emission interval later exactly one more request fits
+	later := now + 100_000
+	if tat, allowed = gcra(later, tat, l); !allowed {
+		t.Fatal("request after RetryAfter denied")
+	}
+	if r := result(later, tat, l, true); r.Remaining != 0 {
+		t.Errorf("request after RetryAfter: %+v", r)
+	}
+	if _, allowed := gcra(later, tat, l); allowed {
+		t.Error("second request after RetryAfter allowed")
+	}
+
+	// A bucket left alone refills completely, and no further
+	idle := later + time.Hour.Microseconds()
+	if r := result(idle, tat, l, false); r.Reset != 0 || r.RetryAfter != 0 {
+		t.Errorf("refilled bucket: %+v", r)
+	}
+	tat, _ = gcra(idle, tat, l)
+	if r := result(idle, tat, l, true); r.Remaining != 2 {
+		t.Errorf("first request after idling: %+v, want 2 remaining", r)
+	}
+}
+
+func TestLimitInterval(t *testing.T) {
+	tests := []struct {
+		limit               Limit
+		emission, tolerance int64
+	}{
+		{Limit{Rate: 1, Burst: 5}, 1_000_000, 5_000_000},
+		{Limit{Rate: 10.0 / 60, Burst: 10}, 6_000_000, 60_000_000},
+		{Limit{Rate: 3, Burst: 1}, 333_334, 333_334},
+		// Rates above one per microsecond are capped there
+		{Limit{Rate: 1e9, Burst: 2}, 1, 2},
+	}
+	for _, tt := range tests {
+		emission, tolerance := tt.limit.interval()
+		if emission != tt.emission || tolerance != tt.tolerance {
+			t.Errorf("%+v: interval = %d, %d; want %d, %d", tt.limit, emission, tolerance, tt.emission, tt.tolerance)
+		}
+	}
+}
+
+func TestParsePolicies(t *testing.T) {
+	defaults := []Policy{
+		NewPolicy("auth", 10, time.Minute),
+		{Name: "user", Limit: Limit{Rate: 20, Burst: 40}, Period: time.Second},
+	}
+	policies, err := ParsePolicies(" auth=5/1m , screening=30/1h:10:2,,md=6/1m::3", defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]Policy{
+		"auth":      {Name: "auth", Limit: Limit{Rate: 5.0 / 60, Burst: 5}, Period: time.Minute},
+		"screening": {Name: "screening", Limit: Limit{Rate: 30.0 / 3600, Burst: 10}, Concurrency: 2, Period: time.Hour},
+		"md":        {Name: "md", Limit: Limit{Rate: 0.1, Burst: 6}, Concurrency: 3, Period: time.Minute},
+		"user":      defaults[1],
+	}
+	if len(policies) != len(want) {
+		t.Errorf("policies = %v", policies)
+	}
+	for name, w := range want {
+		if p := policies[name]; p != w {
+			t.Errorf("%s = %+v, want %+v", name, p, w)
+		}
+	}
+
+	if policies, err := ParsePolicies("", defaults); err != nil || len(policies) != 2 || policies["auth"] != defaults[0] {
+		t.Errorf("empty spec = %v, %v; want the defaults", policies, err)
+	}
+}
+
+func TestParsePoliciesMalformed(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"auth", "is not name=count/period"},
+		{"=10/1m", "is not name=count/period"},
+		{"auth=10", "needs a positive count/period"},
+		{"auth=0/1m", "needs a positive count/period"},
+		{"auth=ten/1m", "needs a positive count/period"},
+		{"auth=10/0s", "has an invalid period"},
+		{"auth=10/soon", "has an invalid period"},
+		{"auth=10/-1m", "has an invalid period"},
+		{"auth=10/1m:0", "has an invalid burst"},
+		{"auth=10/1m:many", "has an invalid burst"},
+		{"auth=10/1m:5:-1", "has an invalid concurrency"},
+		{"auth=10/1m:5:1:2", "has too many fields"},
+		{"user=1/1s,auth=10/1m:x", `policy "auth=10/1m:x" has an invalid burst`},
+	}
+	for _, tt := range tests {
+		policies, err := ParsePolicies(tt.spec, nil)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParsePolicies(%q) = %v, %v; want error %q", tt.spec, policies, err, tt.want)
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	got := Describe(map[string]Policy{
+		"user":      {Name: "user", Limit: Limit{Rate: 20, Burst: 40}},
+		"screening": {Name: "screening", Limit: Limit{Rate: 0.5, Burst: 10}, Concurrency: 2},
+	})
+	if want := "screening=0.5/s burst 10 concurrency 2, user=20/s burst 40"; got != want {
+		t.Errorf("Describe = %q, want %q", got, want)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	store := NewMemoryStore(0)
+	auth := NewPolicy("auth", 1, time.Minute)
+	uncapped := NewPolicy("user", 100, time.Second)
+	l := NewLimiter(store, map[string]Policy{"auth": auth, "user": uncapped}, time.Minute)
+	ctx := context.Background()
+
+	if l.Policy("auth") != auth {
+		t.Errorf("Policy(auth) = %+v", l.Policy("auth"))
+	}
+	// Each policy and caller has a bucket of its own
+	for _, take := range []struct {
+		p      Policy
+		caller string
+		want   bool
+	}{
+		{auth, "ip:1", true},
+		{auth, "ip:1", false},
+		{auth, "ip:2", true},
+		{uncapped, "ip:1", true},
+	} {
+		r, err := l.Take(ctx, take.p, take.caller)
+		if err != nil || r.Allowed != take.want {
+			t.Errorf("Take(%s, %s) = %+v, %v; want allowed %v", take.p.Name, take.caller, r, err, take.want)
+		}
+	}
+
+	// Without a concurrency cap no slot is held
+	for i := 0; i < 3; i++ {
+		release, ok, err := l.Acquire(ctx, uncapped, "ip:1")
+		if !ok || err != nil {
+			t.Fatalf("Acquire without a cap = %v, %v", ok, err)
+		}
+		release()
+	}
+	if len(store.slots) != 0 {
+		t.Errorf("uncapped policy held slots: %v", store.slots)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Policy of an unknown name did not panic")
+		}
+	}()
+	l.Policy("missing")
+}
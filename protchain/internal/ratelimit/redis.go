@@ -0,0 +1,292 @@
+package ratelimit
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RedisStore keeps budgets in a server speaking the Redis protocol, such
+// as Redis, Valkey or KeyDB. Each decision is one atomic Lua script, so
+// replicas share budgets without locks.
+type RedisStore struct {
+	addr     string
+	tls      bool
+	username string
+	password string
+	db       int
+	timeout  time.Duration
+	conns    chan *redisConn
+}
+
+// takeScript applies gcra to the tat stored at KEYS[1]. ARGV holds now,
+// the emission interval and the burst tolerance in microseconds. It
+// returns whether the request was allowed and the stored tat. Times are
+// formatted with %.0f because tostring would round them to 14 digits.
+const takeScript = `
+local now = tonumber(ARGV[1])
+local tat = tonumber(redis.call('GET', KEYS[1]) or ARGV[1])
+if tat < now then tat = now end
+local new = tat + tonumber(ARGV[2])
+if new - tonumber(ARGV[3]) > now then
+	return {0, string.format('%.0f', tat)}
+end
+redis.call('SET', KEYS[1], string.format('%.0f', new), 'PX', math.ceil((new - now) / 1000))
+return {1, string.format('%.0f', new)}
+`
+
+// acquireScript adds lease ARGV[3] to the sorted set KEYS[1], scored by
+// its expiry, unless ARGV[2] unexpired leases are already held. ARGV[1] is
+// now and ARGV[4] the TTL, both in milliseconds.
+const acquireScript = `
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+if redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call('ZADD', KEYS[1], tonumber(ARGV[1]) + tonumber(ARGV[4]), ARGV[3])
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+return 1
+`
+
+// redisIdleConns is how many connections are kept open between requests.
+// More are dialled under load and closed again afterwards.
+const redisIdleConns = 16
+
+// NewRedisStore connects to rawURL, written as
+// redis://[user:password@]host:port[/db]; rediss:// uses TLS.
+func NewRedisStore(rawURL string) (*RedisStore, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("ratelimit: invalid Redis URL: %w", err)
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("ratelimit: Redis URL must start with redis:// or rediss://")
+	}
+	s := &RedisStore{
+		addr:    u.Host,
+		tls:     u.Scheme == "rediss",
+		timeout: 2 * time.Second,
+		conns:   make(chan *redisConn, redisIdleConns),
+	}
+	if u.Port() == "" {
+		s.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		s.username = u.User.Username()
+		s.password, _ = u.User.Password()
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if s.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("ratelimit: invalid Redis database %q", db)
+		}
+	}
+
+	// Fail at startup rather than on the first request
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	if _, err := s.do(ctx, "PING"); err != nil {
+		return nil, fmt.Errorf("ratelimit: failed to reach Redis at %s: %w", s.addr, err)
+	}
+	return s, nil
+}
+
+func (s *RedisStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := nowMicros()
+	emission, tolerance := limit.interval()
+	reply, err := s.do(ctx, "EVAL", takeScript, "1", key,
+		strconv.FormatInt(now, 10), strconv.FormatInt(emission, 10), strconv.FormatInt(tolerance, 10))
+	if err != nil {
+		return Result{}, err
+	}
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 2 {
+		return Result{}, fmt.Errorf("ratelimit: unexpected reply %v", reply)
+	}
+	allowed, _ := values[0].(int64)
+	tatStr, _ := values[1].(string)
+	tat, err := strconv.ParseInt(tatStr, 10, 64)
+	if err != nil {
+		return Result{}, fmt.Errorf("ratelimit: unexpected tat %q", tatStr)
+	}
+	return result(now, tat, limit, allowed == 1), nil
+}
+
+func (s *RedisStore) Acquire(ctx context.Context, key string, max int, ttl time.Duration) (func(), bool, error) {
+	id, err := leaseID()
+	if err != nil {
+		return nil, false, err
+	}
+	reply, err := s.do(ctx, "EVAL", acquireScript, "1", key,
+		strconv.FormatInt(time.Now().UnixMilli(), 10), strconv.Itoa(max), id, strconv.FormatInt(ttl.Milliseconds(), 10))
+	if err != nil {
+		return nil, false, err
+	}
+	if n, _ := reply.(int64); n != 1 {
+		return nil, false, nil
+	}
+
+	release := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+		defer cancel()
+		if _, err := s.do(ctx, "ZREM", key, id); err != nil {
+			slog.Error("ratelimit: failed to release lease", "key", key, "error", err)
+		}
+	}
+	return release, true, nil
+}
+
+// redisError is an error reply from the server. The connection stays
+// usable after one.
+type redisError string
+
+func (e redisError) Error() string { return "ratelimit: redis: " + string(e) }
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// do sends one command on a pooled connection and reads its reply.
+func (s *RedisStore) do(ctx context.Context, args ...string) (interface{}, error) {
+	conn, err := s.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(s.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	reply, err := conn.roundTrip(args...)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		// The stream may be out of step; start over on a new connection
+		conn.Close()
+		return nil, err
+	}
+	s.put(conn)
+	return reply, err
+}
+
+func (s *RedisStore) get(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn := <-s.conns:
+		return conn, nil
+	default:
+	}
+
+	dialer := &net.Dialer{Timeout: s.timeout}
+	var nc net.Conn
+	var err error
+	if s.tls {
+		host, _, _ := net.SplitHostPort(s.addr)
+		nc, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: host}}).DialContext(ctx, "tcp", s.addr)
+	} else {
+		nc, err = dialer.DialContext(ctx, "tcp", s.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+	conn.SetDeadline(time.Now().Add(s.timeout))
+
+	if s.password != "" {
+		auth := []string{"AUTH", s.password}
+		if s.username != "" {
+			auth = []string{"AUTH", s.username, s.password}
+		}
+		if _, err := conn.roundTrip(auth...); err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+	if s.db != 0 {
+		if _, err := conn.roundTrip("SELECT", strconv.Itoa(s.db)); err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (s *RedisStore) put(conn *redisConn) {
+	select {
+	case s.conns <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+func (c *redisConn) roundTrip(args ...string) (interface{}, error) {
+	fmt.Fprintf(c.w, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+// read parses one RESP2 reply. Bulk strings become strings, integers
+// int64 and arrays []interface{}; a nil bulk string or array is nil.
+func (c *redisConn) read() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("ratelimit: empty Redis reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		// Read every element even past an error reply, to stay in step
+		values := make([]interface{}, n)
+		var replyErr error
+		for i := range values {
+			values[i], err = c.read()
+			if _, ok := err.(redisError); ok {
+				replyErr = err
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		if replyErr != nil {
+			return nil, replyErr
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("ratelimit: unexpected Redis reply %q", line)
+}
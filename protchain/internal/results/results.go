@@ -0,0 +1,96 @@
+// Package results records the output of each pipeline stage run in
+// workflow_stage_results. Every run of a stage gets its own row, numbered
+// per (workflow, stage), so earlier output is never overwritten.
+package results
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"protchain/internal/models"
+)
+
+// Execer is satisfied by both *sql.DB and *sql.Tx so a stage can be
+// finished inside the caller's transaction.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Start records a new running run of stage and returns its row ID and run
+// number. parameters is the request sent to BioAPI; jobID links the run to
+// an async job, if any.
+func Start(ctx context.Context, db *sql.DB, workflowID int, stage string, parameters []byte, jobID *int) (int, int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	// Serialise run numbering per workflow
+	if _, err := tx.ExecContext(ctx, `SELECT id FROM workflows WHERE id = $1 FOR UPDATE`, workflowID); err != nil {
+		return 0, 0, fmt.Errorf("failed to lock workflow %d: %w", workflowID, err)
+	}
+
+	var id, runNumber int
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO workflow_stage_results (workflow_id, stage, run_number, status, parameters, job_id, started_at)
+		SELECT $1, $2, COALESCE(MAX(run_number), 0) + 1, $3, $4, $5, NOW()
+		FROM workflow_stage_results
+		WHERE workflow_id = $1 AND stage = $2
+		RETURNING id, run_number
+	`, workflowID, stage, models.ResultRunning, nullJSON(parameters), jobID).Scan(&id, &runNumber)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to record %s run: %w", stage, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+	return id, runNumber, nil
+}
+
+// Finish completes a running run with the given status. result is the
+// BioAPI response body and is stored only for succeeded runs.
+func Finish(ctx context.Context, q Execer, id int, status string, result []byte, errMsg, version string) error {
+	_, err := q.ExecContext(ctx, `
+		UPDATE workflow_stage_results
+		SET status = $1, result = $2, error = NULLIF($3, ''), bioapi_version = NULLIF($4, ''), finished_at = NOW()
+		WHERE id = $5 AND status = $6
+	`, status, nullJSON(result), errMsg, version, id, models.ResultRunning)
+	return err
+}
+
+// FinishJob completes the running run started for an async job.
+func FinishJob(ctx context.Context, q Execer, jobID int, status string, result []byte, errMsg, version string) error {
+	_, err := q.ExecContext(ctx, `
+		UPDATE workflow_stage_results
+		SET status = $1, result = $2, error = NULLIF($3, ''), bioapi_version = NULLIF($4, ''), finished_at = NOW()
+		WHERE job_id = $5 AND status = $6
+	`, status, nullJSON(result), errMsg, version, jobID, models.ResultRunning)
+	return err
+}
+
+// Latest returns the result of the most recent successful run of stage, or
+// nil if the stage has never succeeded.
+func Latest(ctx context.Context, db *sql.DB, workflowID int, stage string) ([]byte, error) {
+	var result []byte
+	err := db.QueryRowContext(ctx, `
+		SELECT result FROM workflow_stage_results
+		WHERE workflow_id = $1 AND stage = $2 AND status = $3
+		ORDER BY run_number DESC
+		LIMIT 1
+	`, workflowID, stage, models.ResultSucceeded).Scan(&result)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return result, err
+}
+
+// nullJSON maps an empty body to SQL NULL so JSONB columns accept it.
+func nullJSON(b []byte) interface{} {
+	if len(b) == 0 {
+		return nil
+	}
+	return string(b)
+}
@@ -0,0 +1,137 @@
+// Package tracing configures OpenTelemetry. Spans of API routes, SQL
+// queries, jobs and BioAPI calls go to the process-wide tracer provider,
+// which Setup points at an OTLP collector; trace context crosses process
+// boundaries as W3C traceparent headers.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Config configures Setup.
+type Config struct {
+	// Endpoint is the OTLP/HTTP traces URL of the collector, such as
+	// http://collector:4318/v1/traces. The path defaults to /v1/traces.
+	Endpoint string
+	// SampleRatio is the fraction of new traces recorded. Requests that
+	// arrive with a sampled traceparent are always recorded.
+	SampleRatio float64
+	// ServiceName identifies this process in the trace backend
+	ServiceName string
+	// Exporter replaces the OTLP exporter, as with
+	// tracetest.NewInMemoryExporter in tests. Its spans are exported
+	// synchronously as they end.
+	Exporter sdktrace.SpanExporter
+}
+
+// Setup installs the global tracer provider and the W3C trace context
+// propagator. Tracing stays a no-op unless cfg has an Endpoint or an
+// Exporter. The returned function flushes pending spans and must be
+// called before the process exits.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+
+	var export sdktrace.TracerProviderOption
+	switch {
+	case cfg.Exporter != nil:
+		export = sdktrace.WithSyncer(cfg.Exporter)
+	case cfg.Endpoint != "":
+		u, err := url.Parse(cfg.Endpoint)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("tracing: invalid OTLP endpoint %q", cfg.Endpoint)
+		}
+		if u.Path == "" || u.Path == "/" {
+			u.Path = "/v1/traces"
+		}
+		exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(u.String()))
+		if err != nil {
+			return nil, fmt.Errorf("tracing: failed to create OTLP exporter: %w", err)
+		}
+		export = sdktrace.WithBatcher(exporter)
+	default:
+		return func(context.Context) error { return nil }, nil
+	}
+
+	ratio := cfg.SampleRatio
+	if ratio < 0 {
+		ratio = 0
+	}
+	if ratio > 1 {
+		ratio = 1
+	}
+	name := cfg.ServiceName
+	if name == "" {
+		name = "protchain-api"
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(name),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("tracing: failed to build resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		export,
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the named tracer of the global provider. Tracers obtained
+// before Setup forward to the provider it installs.
+func Tracer(name string) trace.Tracer {
+	return otel.Tracer(name)
+}
+
+// Inject writes the trace context of ctx into outgoing HTTP headers.
+func Inject(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// Extract returns ctx with the trace context of incoming HTTP headers.
+func Extract(ctx context.Context, header http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// TraceID returns the ID of the trace ctx belongs to, or "" outside a
+// sampled trace.
+func TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsSampled() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
+
+// Traceparent returns the W3C traceparent of the span in ctx, or "" if
+// there is none. It lets work queued in the database continue the trace of
+// the request that queued it.
+func Traceparent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+// WithTraceparent returns ctx continuing the trace of a stored
+// traceparent. An empty or malformed traceparent leaves ctx unchanged.
+func WithTraceparent(ctx context.Context, traceparent string) context.Context {
+	if traceparent == "" {
+		return ctx
+	}
+	return propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier{"traceparent": traceparent})
+}
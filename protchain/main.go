@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -11,10 +12,24 @@ import (
 
 	"github.com/joho/godotenv"
 
+	"protchain/internal/apikeys"
+	"protchain/internal/artifacts"
+	"protchain/internal/authz"
+	"protchain/internal/bioapi"
+	"protchain/internal/chain"
 	"protchain/internal/config"
 	"protchain/internal/database"
+	"protchain/internal/events"
 	"protchain/internal/handlers"
+	"protchain/internal/invitations"
+	"protchain/internal/ipfs"
+	"protchain/internal/jobs"
+	"protchain/internal/logging"
+	"protchain/internal/metrics"
 	"protchain/internal/middleware"
+	"protchain/internal/quota"
+	"protchain/internal/ratelimit"
+	"protchain/internal/tracing"
 
 	"github.com/gin-gonic/gin"
 )
@@ -22,13 +37,29 @@ import (
 func main() {
 	// Load .env file
 	err := godotenv.Load()
+
+	// Structured JSON logs; the standard logger writes through them too
+	logging.Setup(os.Getenv("LOG_LEVEL"))
 	if err != nil {
-		log.Println("Warning: .env file not found, using environment variables")
+		slog.Warn(".env file not found, using environment variables")
 	}
 
 	// Load configuration
 	cfg := config.Load()
 
+	// OpenTelemetry tracing; a no-op unless an OTLP endpoint is set
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Endpoint:    cfg.TracingEndpoint,
+		SampleRatio: cfg.TracingSampleRatio,
+		ServiceName: cfg.TracingServiceName,
+	})
+	if err != nil {
+		log.Fatal("Failed to initialize tracing:", err)
+	}
+	if cfg.TracingEndpoint != "" {
+		slog.Info("Exporting traces", "endpoint", cfg.TracingEndpoint, "sample_ratio", cfg.TracingSampleRatio)
+	}
+
 	// Initialize database with connection pool settings
 	db, err := database.Initialize(cfg.DatabaseURL, cfg.DBMaxOpenConns, cfg.DBMaxIdleConns, cfg.DBConnMaxLifetimeSec)
 	if err != nil {
@@ -36,18 +67,158 @@ func main() {
 	}
 	defer db.Close()
 
-	// Run migrations
+	// `protchain migrate up|down|status` manages the schema and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		code := runMigrate(db, os.Args[2:])
+		db.Close()
+		os.Exit(code)
+	}
+
+	// Apply pending migrations
 	if err := database.RunMigrations(db); err != nil {
 		log.Fatal("Failed to run migrations:", err)
 	}
 
+	// In-process pub/sub backing the workflow event streams
+	broker := events.NewBroker()
+
+	// BioAPI worker pool shared by handlers and job workers. Static workers
+	// come from config; others register themselves.
+	staticWorkers := []bioapi.WorkerSpec{{ID: "static-1", URL: cfg.BioapiURL, Capabilities: []string{bioapi.CapabilityAll}}}
+	if cfg.BioapiWorkers != "" {
+		if staticWorkers, err = bioapi.ParseWorkers(cfg.BioapiWorkers); err != nil {
+			log.Fatal("Invalid BIOAPI_WORKERS:", err)
+		}
+	}
+	workerRegistry := bioapi.NewRegistry(db, time.Duration(cfg.BioapiWorkerTTLSec)*time.Second)
+	workerPool := bioapi.NewPool(bioapi.PoolConfig{
+		Static:           staticWorkers,
+		BreakerThreshold: cfg.BioapiBreakerThreshold,
+		BreakerCooldown:  time.Duration(cfg.BioapiBreakerCooldownSec) * time.Second,
+		ProbeInterval:    time.Duration(cfg.BioapiHealthCheckSec) * time.Second,
+		Registered:       workerRegistry.Load,
+	})
+
+	// Results of deterministic BioAPI calls are reused across replicas
+	var resultCache *bioapi.Cache
+	if cfg.BioapiCacheTTLSec > 0 {
+		resultCache = bioapi.NewCache(db, bioapi.CacheConfig{
+			TTL:           time.Duration(cfg.BioapiCacheTTLSec) * time.Second,
+			MaxEntryBytes: cfg.BioapiCacheMaxEntryKB << 10,
+			MaxTotalBytes: int64(cfg.BioapiCacheMaxMB) << 20,
+		})
+	}
+	bioapiClient := bioapi.New(bioapi.Config{Pool: workerPool, MaxRetries: cfg.BioapiMaxRetries, Cache: resultCache})
+
+	// Plan quotas, metered from job records and artifacts
+	quotaService := quota.New(db)
+
+	// Start async job workers
+	jobCtx, stopJobs := context.WithCancel(context.Background())
+	jobManager := jobs.NewManager(db, broker, bioapiClient, cfg.JobWorkers, time.Duration(cfg.JobTimeoutSec)*time.Second, cfg.JobMaxAttempts, jobs.ShardConfig{
+		Size:        cfg.ScreeningShardSize,
+		MaxParallel: cfg.ScreeningShardParallel,
+		Retries:     cfg.ScreeningShardRetries,
+	}, quotaService)
+	jobManager.Start(jobCtx)
+	go workerPool.Run(jobCtx)
+	if resultCache != nil {
+		go resultCache.Run(jobCtx)
+	}
+	go invitations.Run(jobCtx, db, time.Duration(cfg.InvitationSweepIntervalMin)*time.Minute)
+
+	// Rate limit budgets, shared by replicas unless kept in memory
+	var rateStore ratelimit.Store
+	switch cfg.RateLimitBackend {
+	case "memory":
+		rateStore = ratelimit.NewMemoryStore(cfg.RateLimitMaxKeys)
+	case "postgres":
+		pgStore := ratelimit.NewPostgresStore(db)
+		go pgStore.Run(jobCtx, time.Minute)
+		rateStore = pgStore
+	case "redis":
+		rateStore, err = ratelimit.NewRedisStore(cfg.RateLimitRedisURL)
+		if err != nil {
+			log.Fatal("Failed to initialize rate limit store:", err)
+		}
+	default:
+		log.Fatalf("Unknown RATE_LIMIT_BACKEND %q: use memory, postgres or redis", cfg.RateLimitBackend)
+	}
+	if cfg.RateLimitRPS <= 0 || cfg.RateLimitBurst < 1 {
+		log.Fatal("RATE_LIMIT_RPS and RATE_LIMIT_BURST must be positive")
+	}
+	ratePolicies, err := ratelimit.ParsePolicies(cfg.RateLimitPolicies, []ratelimit.Policy{
+		{Name: "global", Limit: ratelimit.Limit{Rate: cfg.RateLimitRPS, Burst: cfg.RateLimitBurst}, Period: time.Second},
+		{Name: "user", Limit: ratelimit.Limit{Rate: 20, Burst: 40}, Period: time.Second},
+		ratelimit.NewPolicy("auth", 10, time.Minute),
+		// Analysis routes only queue a job, so a concurrency cap here
+		// would not limit running analyses; the plan's concurrent jobs
+		// quota does that when the job is admitted.
+		{Name: "screening", Limit: ratelimit.Limit{Rate: 0.5, Burst: 10}, Period: time.Minute},
+		{Name: "simulation", Limit: ratelimit.Limit{Rate: 0.1, Burst: 3}, Period: time.Minute},
+		{Name: "optimization", Limit: ratelimit.Limit{Rate: 0.5, Burst: 10}, Period: time.Minute},
+	})
+	if err != nil {
+		log.Fatal("Invalid RATE_LIMIT_POLICIES:", err)
+	}
+	// A request cannot hold a concurrency slot longer than it may run
+	limiter := ratelimit.NewLimiter(rateStore, ratePolicies, time.Duration(cfg.HTTPWriteTimeout)*time.Second)
+	slog.Info("Rate limiting enabled", "backend", cfg.RateLimitBackend, "policies", ratelimit.Describe(ratePolicies))
+
+	// Metrics read at scrape time
+	metrics.RegisterDBStats(db)
+	metrics.NewGaugeVecFunc("protchain_jobs", "Jobs waiting or running, by status.", "status", func() map[string]float64 {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		depth, err := jobManager.QueueDepth(ctx)
+		if err != nil {
+			slog.Error("metrics: failed to read job queue depth", "error", err)
+			return nil
+		}
+		out := make(map[string]float64, len(depth))
+		for status, n := range depth {
+			out[status] = float64(n)
+		}
+		return out
+	})
+
+	// Content-addressed storage for workflow files
+	artifactStore, err := artifacts.New(cfg)
+	if err != nil {
+		log.Fatal("Failed to initialize artifact store:", err)
+	}
+
+	// DrugScreeningVerifier client. Verification only needs the contract
+	// address; commits also need the signing key.
+	var chainClient *chain.Client
+	if cfg.VerifierContractAddress != "" {
+		chainClient, err = chain.New(chain.Config{
+			RPCURL:        cfg.BlockchainRPC,
+			Contract:      cfg.VerifierContractAddress,
+			SigningKey:    cfg.BlockchainSignerKey,
+			Confirmations: cfg.BlockchainConfirmations,
+			Timeout:       30 * time.Second,
+		})
+		if err != nil {
+			log.Fatal("Failed to initialize blockchain client:", err)
+		}
+		if chainClient.CanSign() {
+			slog.Info("Blockchain commits enabled", "contract", chainClient.Contract(), "sender", chainClient.From())
+		} else {
+			slog.Info("Blockchain verification enabled; set BLOCKCHAIN_SIGNER_KEY to enable commits", "contract", chainClient.Contract())
+		}
+	} else {
+		slog.Info("Blockchain commits disabled: set VERIFIER_CONTRACT_ADDRESS and BLOCKCHAIN_SIGNER_KEY to enable")
+	}
+
 	// Set Gin mode
 	if cfg.Environment == "production" {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
 	// Create router
-	router := gin.Default()
+	router := gin.New()
+	router.Use(middleware.RequestID(), middleware.Tracing(), middleware.Logger(), gin.Recovery(), middleware.Metrics())
 
 	// CORS middleware — origins driven by config
 	router.Use(func(c *gin.Context) {
@@ -66,7 +237,8 @@ func main() {
 		}
 
 		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-Source, X-Request-ID")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, Cache-Control, X-Request-Source, X-Request-ID, traceparent, tracestate")
+		c.Header("Access-Control-Expose-Headers", "X-Cache, X-Request-ID, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, RateLimit-Policy, Retry-After")
 		c.Header("Access-Control-Allow-Credentials", "true")
 
 		if c.Request.Method == "OPTIONS" {
@@ -77,8 +249,24 @@ func main() {
 		c.Next()
 	})
 
-	// Rate limiting middleware
-	router.Use(middleware.RateLimitMiddleware(cfg.RateLimitRPS, cfg.RateLimitBurst))
+	// Per-IP budget of every request; routes add their own policies below
+	router.Use(middleware.RateLimit(limiter, "global"))
+
+	// Prometheus metrics, on their own listener if one is configured
+	var metricsSrv *http.Server
+	if cfg.MetricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		metricsSrv = &http.Server{Addr: cfg.MetricsAddr, Handler: mux, ReadTimeout: 10 * time.Second, WriteTimeout: 30 * time.Second}
+		go func() {
+			slog.Info("Serving metrics", "addr", cfg.MetricsAddr)
+			if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Failed to start metrics server: %v", err)
+			}
+		}()
+	} else if cfg.MetricsEnabled {
+		router.GET("/metrics", gin.WrapH(metrics.Handler()))
+	}
 
 	// Health check with DB probe
 	router.GET("/health", func(c *gin.Context) {
@@ -86,7 +274,7 @@ func main() {
 		defer cancel()
 
 		if err := db.PingContext(ctx); err != nil {
-			log.Printf("Health check failed: DB ping error: %v", err)
+			slog.Error("Health check failed: database ping failed", "error", err)
 			c.JSON(http.StatusServiceUnavailable, gin.H{
 				"status":  "unhealthy",
 				"service": "protchain-api",
@@ -105,80 +293,141 @@ func main() {
 	api := router.Group("/api/v1")
 
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(db, cfg.JWTSecret)
-	workflowHandler := handlers.NewWorkflowHandler(db)
-	teamHandler := handlers.NewTeamHandler(db)
+	// Resolves workflow access through ownership, grants, teams and orgs
+	authzService := authz.New(db)
+
+	authHandler := handlers.NewAuthHandler(db, cfg.JWTSecret,
+		time.Duration(cfg.AccessTokenTTLMin)*time.Minute,
+		time.Duration(cfg.RefreshTokenTTLDays)*24*time.Hour)
+	workflowHandler := handlers.NewWorkflowHandler(db, jobManager, bioapiClient, broker, authzService)
+	jobHandler := handlers.NewJobHandler(db, jobManager)
+	teamHandler := handlers.NewTeamHandler(db, broker, authzService, quotaService,
+		time.Duration(cfg.InvitationTTLHours)*time.Hour)
 	userHandler := handlers.NewUserHandler(db)
-
-	// Auth routes (no middleware)
-	auth := api.Group("/auth")
+	apiKeyHandler := handlers.NewAPIKeyHandler(db)
+	workerHandler := handlers.NewWorkerHandler(workerRegistry, workerPool)
+	artifactHandler := handlers.NewArtifactHandler(db, artifactStore, authzService, quotaService, int64(cfg.ArtifactMaxUploadMB)<<20)
+	ipfsClient := ipfs.New(cfg.IPFSEndpoint, time.Duration(cfg.IPFSTimeoutSec)*time.Second)
+	provenanceHandler := handlers.NewProvenanceHandler(db, ipfsClient, chainClient, authzService,
+		int64(cfg.IPFSMaxBundleMB)<<20, time.Duration(cfg.BlockchainConfirmTimeoutSec)*time.Second)
+
+	// Auth routes, limited per IP to slow down credential guessing
+	auth := api.Group("/auth", middleware.RateLimit(limiter, "auth"))
 	{
 		auth.POST("/register", authHandler.Register)
 		auth.POST("/login", authHandler.Login)
 		auth.POST("/refresh", authHandler.RefreshToken)
+		auth.POST("/logout", authHandler.Logout)
+	}
+
+	// BioAPI worker registry, authenticated with the shared worker token
+	workers := api.Group("/bioapi/workers", middleware.RequireWorkerToken(cfg.BioapiWorkerToken))
+	{
+		workers.GET("", workerHandler.ListWorkers)
+		workers.POST("", workerHandler.RegisterWorker)
+		workers.POST("/:id/heartbeat", workerHandler.WorkerHeartbeat)
+		workers.DELETE("/:id", workerHandler.DeregisterWorker)
 	}
 
 	// Protected routes
 	protected := api.Group("/")
-	protected.Use(middleware.AuthMiddleware(cfg.JWTSecret))
+	protected.Use(middleware.AuthMiddleware(cfg.JWTSecret, db), middleware.RateLimit(limiter, "user"))
 	{
 		// User routes
-		protected.GET("/users/me", userHandler.GetProfile)
-		protected.PUT("/users/me", userHandler.UpdateProfile)
-		protected.GET("/users/stats", userHandler.GetStats)
+		users := protected.Group("/users", middleware.RequireScope(apikeys.ScopeProfileRead, apikeys.ScopeProfileWrite))
+		{
+			users.GET("/me", userHandler.GetProfile)
+			users.PUT("/me", userHandler.UpdateProfile)
+			users.GET("/stats", userHandler.GetStats)
+		}
+
+		// API key management, only from a signed-in session
+		apiKeys := users.Group("/me/api-keys", middleware.RequireSession())
+		{
+			apiKeys.GET("", apiKeyHandler.ListAPIKeys)
+			apiKeys.POST("", apiKeyHandler.CreateAPIKey)
+			apiKeys.DELETE("/:keyId", apiKeyHandler.RevokeAPIKey)
+		}
 
 		// Workflow routes
-		workflows := protected.Group("/workflows")
+		workflows := protected.Group("/workflows", middleware.RequireScope(apikeys.ScopeWorkflowsRead, apikeys.ScopeWorkflowsWrite))
 		{
 			workflows.GET("", workflowHandler.ListWorkflows)
 			workflows.POST("", workflowHandler.CreateWorkflow)
+			workflows.GET("/shared", workflowHandler.ListSharedWorkflows)
+			workflows.GET("/templates", workflowHandler.GetWorkflowTemplates)
+			workflows.POST("/templates", workflowHandler.CreateWorkflowTemplate)
+			workflows.GET("/templates/:templateId", workflowHandler.GetWorkflowTemplate)
+			workflows.PUT("/templates/:templateId", workflowHandler.UpdateWorkflowTemplate)
+			workflows.DELETE("/templates/:templateId", workflowHandler.DeleteWorkflowTemplate)
 			workflows.GET("/:id", workflowHandler.GetWorkflow)
 			workflows.PUT("/:id", workflowHandler.UpdateWorkflow)
 			workflows.DELETE("/:id", workflowHandler.DeleteWorkflow)
 			workflows.PUT("/:id/blockchain", workflowHandler.UpdateWorkflowBlockchainInfo)
-			workflows.GET("/:id/pdb", workflowHandler.GetWorkflowPDB)
+			workflows.POST("/:id/ipfs", provenanceHandler.PublishWorkflowBundle)
+			workflows.GET("/:id/ipfs", provenanceHandler.GetWorkflowIPFS)
+			workflows.POST("/:id/commit", provenanceHandler.CommitWorkflow)
+			workflows.GET("/:id/verify", provenanceHandler.VerifyWorkflow)
+			workflows.POST("/:id/hits/anchor", provenanceHandler.AnchorHits)
+			workflows.GET("/:id/hits/:compound/proof", provenanceHandler.GetHitProof)
+			workflows.GET("/:id/pdb", artifactHandler.GetWorkflowPDB)
+			workflows.GET("/:id/artifacts", artifactHandler.ListArtifacts)
+			workflows.POST("/:id/artifacts", artifactHandler.UploadArtifact)
+			workflows.GET("/:id/artifacts/:artifactId", artifactHandler.DownloadArtifact)
 
 			workflows.GET("/:id/status", workflowHandler.GetWorkflowStatus)
+			workflows.GET("/:id/events", workflowHandler.StreamWorkflowEvents)
 			workflows.GET("/:id/results", workflowHandler.GetWorkflowResults)
+			workflows.GET("/:id/results/:stage", workflowHandler.GetWorkflowStageResults)
+			workflows.GET("/:id/activity", workflowHandler.GetWorkflowActivity)
 			workflows.POST("/:id/register", workflowHandler.RegisterWorkflow)
 			workflows.GET("/:id/binding-sites", workflowHandler.GetWorkflowBindingSites)
 			workflows.POST("/:id/binding-site-analysis", workflowHandler.StartBindingSiteAnalysis)
 			workflows.POST("/:id/structure", workflowHandler.ProcessStructure)
-			workflows.GET("/templates", workflowHandler.GetWorkflowTemplates)
+		}
+
+		// Async job routes
+		jobRoutes := protected.Group("/jobs", middleware.RequireScope(apikeys.ScopeJobsRead, apikeys.ScopeJobsWrite))
+		{
+			jobRoutes.GET("", jobHandler.ListJobs)
+			jobRoutes.GET("/:id", jobHandler.GetJob)
+			jobRoutes.DELETE("/:id", jobHandler.CancelJob)
 		}
 
 		// Bioinformatics processing routes
-		screening := protected.Group("/screening")
+		runScope := middleware.RequireScope(apikeys.ScopeScreeningRun, apikeys.ScopeScreeningRun)
+		screening := protected.Group("/screening", runScope, middleware.RateLimit(limiter, "screening"))
 		{
 			screening.POST("/virtual-screening", workflowHandler.VirtualScreening)
 			screening.POST("/vina-docking", workflowHandler.VinaDocking)
 		}
 
-		simulation := protected.Group("/simulation")
+		simulation := protected.Group("/simulation", runScope, middleware.RateLimit(limiter, "simulation"))
 		{
 			simulation.POST("/molecular-dynamics", workflowHandler.MolecularDynamics)
 		}
 
-		optimization := protected.Group("/optimization")
+		optimization := protected.Group("/optimization", runScope, middleware.RateLimit(limiter, "optimization"))
 		{
 			optimization.POST("/lead-optimization", workflowHandler.LeadOptimization)
 		}
 
-		binding := protected.Group("/binding")
+		binding := protected.Group("/binding", runScope)
 		{
 			binding.POST("/direct-binding-analysis", workflowHandler.DirectBindingAnalysis)
 			binding.POST("/ai-druggability-score", workflowHandler.AIDruggabilityScore)
 		}
 
-		literature := protected.Group("/literature")
+		literature := protected.Group("/literature", runScope)
 		{
 			literature.POST("/search", workflowHandler.LiteratureSearch)
 		}
 
 		// Team management routes
-		teams := protected.Group("/teams")
+		teams := protected.Group("/teams", middleware.RequireScope(apikeys.ScopeTeamsRead, apikeys.ScopeTeamsWrite))
 		{
-			orgs := teams.Group("/organizations")
+			// Service API keys only reach their own organization
+			orgs := teams.Group("/organizations", middleware.RequireKeyOrganization("id"))
 			{
 				orgs.GET("", teamHandler.ListOrganizations)
 				orgs.POST("", teamHandler.CreateOrganization)
@@ -188,9 +437,14 @@ func main() {
 				orgs.POST("/:id/invite", teamHandler.InviteToOrganization)
 				orgs.GET("/:id/members", teamHandler.ListOrganizationMembers)
 				orgs.DELETE("/:id/members/:userId", teamHandler.RemoveOrganizationMember)
+				orgs.GET("/:id/activity", teamHandler.GetOrganizationActivity)
+				orgs.GET("/:id/usage", teamHandler.GetOrganizationUsage)
+				orgs.GET("/:id/invitations", teamHandler.ListOrganizationInvitations)
+				orgs.DELETE("/:id/invitations/:invitationId", teamHandler.RevokeInvitation)
+				orgs.POST("/:id/invitations/:invitationId/resend", teamHandler.ResendInvitation)
 			}
 
-			orgTeams := teams.Group("/organizations/:id/teams")
+			orgTeams := teams.Group("/organizations/:id/teams", middleware.RequireKeyOrganization("id"))
 			{
 				orgTeams.GET("", teamHandler.ListTeams)
 				orgTeams.POST("", teamHandler.CreateTeam)
@@ -199,6 +453,7 @@ func main() {
 				orgTeams.DELETE("/:teamId", teamHandler.DeleteTeam)
 				orgTeams.POST("/:teamId/members", teamHandler.AddTeamMember)
 				orgTeams.DELETE("/:teamId/members/:userId", teamHandler.RemoveTeamMember)
+				orgTeams.POST("/:teamId/invite", teamHandler.InviteToTeam)
 			}
 
 			invitations := teams.Group("/invitations")
@@ -231,14 +486,14 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
 	go func() {
-		log.Printf("Starting ProtChain API server on port %s", cfg.Port)
+		slog.Info("Starting ProtChain API server", "port", cfg.Port)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Failed to start server: %v", err)
 		}
 	}()
 
 	<-quit
-	log.Println("Shutting down server...")
+	slog.Info("Shutting down server")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -246,6 +501,20 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
+	if metricsSrv != nil {
+		metricsSrv.Shutdown(ctx)
+	}
+
+	// Stop job workers; any job interrupted mid-run is requeued
+	stopJobs()
+	jobManager.Wait()
+
+	// Flush spans of the requests and jobs that just finished
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Error("Failed to flush traces", "error", err)
+	}
 
-	log.Println("Server exited cleanly")
+	slog.Info("Server exited cleanly")
 }
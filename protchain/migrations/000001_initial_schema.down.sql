@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS activity_log;
+DROP TABLE IF EXISTS workflow_permissions;
+DROP TABLE IF EXISTS invitations;
+DROP TABLE IF EXISTS team_members;
+DROP TABLE IF EXISTS organization_members;
+DROP TABLE IF EXISTS workflows;
+DROP TABLE IF EXISTS teams;
+DROP TABLE IF EXISTS organizations;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,3 @@
+ALTER TABLE workflows DROP COLUMN IF EXISTS stage_plan;
+ALTER TABLE workflows DROP COLUMN IF EXISTS template_id;
+DROP TABLE IF EXISTS workflow_templates;
@@ -0,0 +1,54 @@
+-- Workflow templates. Built-in templates have no organization.
+CREATE TABLE IF NOT EXISTS workflow_templates (
+    id SERIAL PRIMARY KEY,
+    organization_id INTEGER REFERENCES organizations(id),
+    name TEXT NOT NULL,
+    version INTEGER NOT NULL DEFAULT 1,
+    description TEXT,
+    stages JSONB NOT NULL,
+    is_builtin BOOLEAN NOT NULL DEFAULT FALSE,
+    created_by INTEGER REFERENCES users(id),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_workflow_templates_org_name_version ON workflow_templates (COALESCE(organization_id, 0), name, version);
+
+-- Template the workflow was created from and its instantiated stage plan
+ALTER TABLE workflows ADD COLUMN IF NOT EXISTS template_id INTEGER REFERENCES workflow_templates(id);
+ALTER TABLE workflows ADD COLUMN IF NOT EXISTS stage_plan JSONB;
+
+-- Built-in templates
+INSERT INTO workflow_templates (name, version, description, stages, is_builtin)
+VALUES ('Full drug discovery pipeline', 1,
+    'Structure preparation through lead optimization with default parameters for every stage.',
+    '[
+        {"stage": "structure_preparation", "parameters": {}},
+        {"stage": "binding_site_analysis", "parameters": {"method": "geometric_cavity_detection"}},
+        {"stage": "virtual_screening", "parameters": {"compound_library": "fda_approved", "max_compounds": 50}},
+        {"stage": "molecular_docking", "parameters": {"compound_library": "fda_approved", "max_compounds": 50}},
+        {"stage": "molecular_dynamics", "parameters": {"temperature": 300.0, "n_steps": 5000, "max_compounds": 10}},
+        {"stage": "lead_optimization", "parameters": {"max_compounds": 20, "enable_mmp": true, "enable_rgroup": true, "enable_bioisosteres": true, "enable_pareto": true, "enable_analogs": true, "enable_pharmacophore": true}}
+    ]', TRUE)
+ON CONFLICT DO NOTHING;
+
+INSERT INTO workflow_templates (name, version, description, stages, is_builtin)
+VALUES ('Rapid virtual screen', 1,
+    'Fast triage: prepare the structure, find pockets and screen a large library without docking.',
+    '[
+        {"stage": "structure_preparation", "parameters": {}},
+        {"stage": "binding_site_analysis", "parameters": {"method": "geometric_cavity_detection"}},
+        {"stage": "virtual_screening", "parameters": {"compound_library": "fda_approved", "max_compounds": 500}}
+    ]', TRUE)
+ON CONFLICT DO NOTHING;
+
+INSERT INTO workflow_templates (name, version, description, stages, is_builtin)
+VALUES ('Docking and MD validation', 1,
+    'Dock a focused library with Vina and confirm pose stability with molecular dynamics.',
+    '[
+        {"stage": "structure_preparation", "parameters": {}},
+        {"stage": "binding_site_analysis", "parameters": {"method": "geometric_cavity_detection"}},
+        {"stage": "molecular_docking", "parameters": {"compound_library": "fda_approved", "max_compounds": 25}},
+        {"stage": "molecular_dynamics", "parameters": {"temperature": 300.0, "n_steps": 10000, "max_compounds": 5}}
+    ]', TRUE)
+ON CONFLICT DO NOTHING;
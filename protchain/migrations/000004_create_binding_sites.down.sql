@@ -0,0 +1 @@
+DROP TABLE IF EXISTS binding_sites;
@@ -0,0 +1,22 @@
+-- Binding pockets detected on a workflow's structure
+CREATE TABLE IF NOT EXISTS binding_sites (
+    id SERIAL PRIMARY KEY,
+    workflow_id INTEGER NOT NULL REFERENCES workflows(id) ON DELETE CASCADE,
+    site_number INTEGER NOT NULL,
+    center_x DOUBLE PRECISION NOT NULL,
+    center_y DOUBLE PRECISION NOT NULL,
+    center_z DOUBLE PRECISION NOT NULL,
+    size_x DOUBLE PRECISION NOT NULL,
+    size_y DOUBLE PRECISION NOT NULL,
+    size_z DOUBLE PRECISION NOT NULL,
+    volume DOUBLE PRECISION NOT NULL,
+    druggability_score DOUBLE PRECISION NOT NULL,
+    hydrophobicity DOUBLE PRECISION,
+    enclosure_score DOUBLE PRECISION,
+    residues JSONB NOT NULL DEFAULT '[]',
+    method TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(workflow_id, site_number)
+);
+
+CREATE INDEX IF NOT EXISTS idx_binding_sites_workflow_id ON binding_sites (workflow_id);
@@ -0,0 +1,18 @@
+-- Output of each run of each pipeline stage
+CREATE TABLE IF NOT EXISTS workflow_stage_results (
+    id SERIAL PRIMARY KEY,
+    workflow_id INTEGER NOT NULL REFERENCES workflows(id) ON DELETE CASCADE,
+    stage VARCHAR(100) NOT NULL,
+    run_number INTEGER NOT NULL,
+    status VARCHAR(50) NOT NULL DEFAULT 'running',
+    parameters JSONB,
+    result JSONB,
+    error TEXT,
+    bioapi_version VARCHAR(50),
+    job_id INTEGER REFERENCES jobs(id) ON DELETE SET NULL,
+    started_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP WITH TIME ZONE,
+    UNIQUE(workflow_id, stage, run_number)
+);
+
+CREATE INDEX IF NOT EXISTS idx_workflow_stage_results_job_id ON workflow_stage_results (job_id);
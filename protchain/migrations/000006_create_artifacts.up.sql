@@ -0,0 +1,16 @@
+-- Files attached to workflows, stored by content digest
+CREATE TABLE IF NOT EXISTS artifacts (
+    id SERIAL PRIMARY KEY,
+    workflow_id INTEGER NOT NULL REFERENCES workflows(id) ON DELETE CASCADE,
+    kind VARCHAR(50) NOT NULL,
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(255) NOT NULL DEFAULT 'application/octet-stream',
+    sha256 CHAR(64) NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    uploaded_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(workflow_id, kind, sha256)
+);
+
+CREATE INDEX IF NOT EXISTS idx_artifacts_workflow_id ON artifacts (workflow_id);
+CREATE INDEX IF NOT EXISTS idx_artifacts_sha256 ON artifacts (sha256);
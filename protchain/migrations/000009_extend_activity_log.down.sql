@@ -0,0 +1,14 @@
+-- NOT VALID: entries about deleted organizations and teams may remain.
+ALTER TABLE activity_log ADD CONSTRAINT activity_log_team_id_fkey
+    FOREIGN KEY (team_id) REFERENCES teams(id) NOT VALID;
+ALTER TABLE activity_log ADD CONSTRAINT activity_log_organization_id_fkey
+    FOREIGN KEY (organization_id) REFERENCES organizations(id) NOT VALID;
+
+DROP INDEX IF EXISTS idx_activity_log_workflow_id;
+ALTER TABLE activity_log DROP COLUMN IF EXISTS api_key_id;
+ALTER TABLE activity_log DROP COLUMN IF EXISTS request_id;
+ALTER TABLE activity_log DROP COLUMN IF EXISTS after_state;
+ALTER TABLE activity_log DROP COLUMN IF EXISTS before_state;
+ALTER TABLE activity_log DROP COLUMN IF EXISTS target_id;
+ALTER TABLE activity_log DROP COLUMN IF EXISTS target_type;
+ALTER TABLE activity_log DROP COLUMN IF EXISTS workflow_id;
@@ -0,0 +1,12 @@
+-- Audit trail detail. Entries must outlive the organizations and
+-- teams they describe, so those references are not foreign keys.
+ALTER TABLE activity_log ADD COLUMN IF NOT EXISTS workflow_id INTEGER;
+ALTER TABLE activity_log ADD COLUMN IF NOT EXISTS target_type TEXT;
+ALTER TABLE activity_log ADD COLUMN IF NOT EXISTS target_id INTEGER;
+ALTER TABLE activity_log ADD COLUMN IF NOT EXISTS before_state JSONB;
+ALTER TABLE activity_log ADD COLUMN IF NOT EXISTS after_state JSONB;
+ALTER TABLE activity_log ADD COLUMN IF NOT EXISTS request_id TEXT;
+ALTER TABLE activity_log ADD COLUMN IF NOT EXISTS api_key_id INTEGER;
+ALTER TABLE activity_log DROP CONSTRAINT IF EXISTS activity_log_organization_id_fkey;
+ALTER TABLE activity_log DROP CONSTRAINT IF EXISTS activity_log_team_id_fkey;
+CREATE INDEX IF NOT EXISTS idx_activity_log_workflow_id ON activity_log (workflow_id);
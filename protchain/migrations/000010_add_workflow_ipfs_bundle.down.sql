@@ -0,0 +1,2 @@
+ALTER TABLE workflows DROP COLUMN IF EXISTS ipfs_pinned_at;
+ALTER TABLE workflows DROP COLUMN IF EXISTS ipfs_bundle_sha256;
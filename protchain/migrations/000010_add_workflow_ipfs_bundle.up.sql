@@ -0,0 +1,3 @@
+-- Digest of the bundle the server published to IPFS under ipfs_hash
+ALTER TABLE workflows ADD COLUMN IF NOT EXISTS ipfs_bundle_sha256 CHAR(64);
+ALTER TABLE workflows ADD COLUMN IF NOT EXISTS ipfs_pinned_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,29 @@
+-- Server-side commits of published workflow bundles to the
+-- DrugScreeningVerifier contract, one row per transaction attempt
+CREATE TABLE IF NOT EXISTS blockchain_commits (
+    id SERIAL PRIMARY KEY,
+    workflow_id INTEGER NOT NULL REFERENCES workflows(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    chain_id BIGINT NOT NULL,
+    contract_address VARCHAR(42) NOT NULL,
+    from_address VARCHAR(42) NOT NULL,
+    ipfs_hash VARCHAR(255) NOT NULL,
+    result_hash CHAR(66) NOT NULL,
+    molecule_data_hash CHAR(66) NOT NULL,
+    molecule_id TEXT NOT NULL,
+    tx_hash VARCHAR(66) UNIQUE,
+    block_number BIGINT,
+    block_hash VARCHAR(66),
+    numeric_id NUMERIC(78, 0),
+    result_id VARCHAR(66),
+    gas_used BIGINT,
+    gas_price NUMERIC(78, 0),
+    error TEXT,
+    committed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    confirmed_at TIMESTAMP WITH TIME ZONE
+);
+
+-- At most one commit in flight per workflow
+CREATE UNIQUE INDEX IF NOT EXISTS idx_blockchain_commits_pending ON blockchain_commits (workflow_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_blockchain_commits_workflow_id ON blockchain_commits (workflow_id, created_at DESC);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS hit_tree_nodes;
+DROP TABLE IF EXISTS hit_leaves;
+DROP TABLE IF EXISTS hit_batches;
@@ -0,0 +1,40 @@
+-- Merkle trees over the hits of a virtual screen. Only the root of each
+-- batch is anchored on chain; proofs are served from the stored nodes.
+CREATE TABLE IF NOT EXISTS hit_batches (
+    id SERIAL PRIMARY KEY,
+    workflow_id INTEGER NOT NULL REFERENCES workflows(id) ON DELETE CASCADE,
+    stage_result_id INTEGER REFERENCES workflow_stage_results(id) ON DELETE SET NULL,
+    root CHAR(66) NOT NULL,
+    leaf_count INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    chain_id BIGINT,
+    contract_address VARCHAR(42),
+    tx_hash VARCHAR(66) UNIQUE,
+    block_number BIGINT,
+    numeric_id NUMERIC(78, 0),
+    gas_used BIGINT,
+    error TEXT,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    anchored_at TIMESTAMP WITH TIME ZONE,
+    UNIQUE (workflow_id, root)
+);
+
+-- data holds the exact bytes hashed into the leaf
+CREATE TABLE IF NOT EXISTS hit_leaves (
+    batch_id INTEGER NOT NULL REFERENCES hit_batches(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    compound_id TEXT NOT NULL,
+    data TEXT NOT NULL,
+    PRIMARY KEY (batch_id, position),
+    UNIQUE (batch_id, compound_id)
+);
+
+-- Level 0 holds the leaf hashes
+CREATE TABLE IF NOT EXISTS hit_tree_nodes (
+    batch_id INTEGER NOT NULL REFERENCES hit_batches(id) ON DELETE CASCADE,
+    level INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    hash BYTEA NOT NULL,
+    PRIMARY KEY (batch_id, level, position)
+);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS bioapi_workers;
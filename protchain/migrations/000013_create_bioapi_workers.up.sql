@@ -0,0 +1,11 @@
+-- BioAPI workers that registered themselves with the API. Registrations
+-- expire unless renewed by heartbeats; static workers come from config.
+CREATE TABLE IF NOT EXISTS bioapi_workers (
+    id SERIAL PRIMARY KEY,
+    url TEXT NOT NULL UNIQUE,
+    capabilities TEXT[] NOT NULL DEFAULT '{}',
+    registered_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_heartbeat_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_bioapi_workers_heartbeat ON bioapi_workers (last_heartbeat_at);
@@ -0,0 +1,3 @@
+ALTER TABLE jobs DROP COLUMN IF EXISTS cache_hit;
+ALTER TABLE jobs DROP COLUMN IF EXISTS no_cache;
+DROP TABLE IF EXISTS bioapi_cache;
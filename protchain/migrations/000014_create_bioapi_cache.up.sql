@@ -0,0 +1,21 @@
+-- Responses of deterministic BioAPI computations, keyed by a hash of the
+-- request and the BioAPI version that produced them.
+CREATE TABLE IF NOT EXISTS bioapi_cache (
+    key TEXT PRIMARY KEY,
+    endpoint TEXT NOT NULL,
+    version TEXT NOT NULL,
+    body BYTEA NOT NULL,
+    size INTEGER NOT NULL,
+    hits INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_bioapi_cache_expires_at ON bioapi_cache (expires_at);
+CREATE INDEX IF NOT EXISTS idx_bioapi_cache_last_used_at ON bioapi_cache (last_used_at);
+
+-- Jobs submitted with Cache-Control: no-cache skip the cache lookup;
+-- cache_hit records whether a result was reused.
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS no_cache BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS cache_hit BOOLEAN NOT NULL DEFAULT FALSE;
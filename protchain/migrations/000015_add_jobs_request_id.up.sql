@@ -0,0 +1,3 @@
+-- ID of the API request that submitted a job, forwarded to BioAPI so a
+-- job can be traced across services.
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS request_id TEXT;
@@ -0,0 +1,3 @@
+-- W3C traceparent of the request that submitted a job, so the job's spans
+-- join that request's trace.
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS traceparent TEXT;
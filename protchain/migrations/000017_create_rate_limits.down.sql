@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS rate_limit_leases;
+DROP TABLE IF EXISTS rate_limit_buckets;
@@ -0,0 +1,22 @@
+-- Rate limit state shared by API replicas using the Postgres backend. The
+-- tables are unlogged: losing them in a crash only resets the budgets.
+
+-- GCRA buckets; tat is the theoretical arrival time of the next request in
+-- microseconds since the Unix epoch. A bucket past expires_at is full.
+CREATE UNLOGGED TABLE IF NOT EXISTS rate_limit_buckets (
+    key TEXT PRIMARY KEY,
+    tat BIGINT NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_rate_limit_buckets_expires_at ON rate_limit_buckets (expires_at);
+
+-- Concurrency slots held by requests in flight
+CREATE UNLOGGED TABLE IF NOT EXISTS rate_limit_leases (
+    key TEXT NOT NULL,
+    id TEXT NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (key, id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_rate_limit_leases_expires_at ON rate_limit_leases (expires_at);
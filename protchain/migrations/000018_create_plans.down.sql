@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_jobs_organization_id_created_at;
+ALTER TABLE jobs DROP COLUMN IF EXISTS md_ns;
+ALTER TABLE jobs DROP COLUMN IF EXISTS compounds;
+ALTER TABLE jobs DROP COLUMN IF EXISTS organization_id;
+DROP TABLE IF EXISTS plans;
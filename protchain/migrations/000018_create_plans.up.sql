@@ -0,0 +1,27 @@
+-- Compute quotas of each organization plan. A NULL limit is unlimited.
+-- Organizations whose plan has no row here, and users working outside an
+-- organization, get the free plan.
+CREATE TABLE IF NOT EXISTS plans (
+    name TEXT PRIMARY KEY,
+    max_concurrent_jobs INTEGER,
+    max_compounds_per_month BIGINT,
+    max_md_ns_per_month DOUBLE PRECISION,
+    max_storage_bytes BIGINT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO plans (name, max_concurrent_jobs, max_compounds_per_month, max_md_ns_per_month, max_storage_bytes) VALUES
+    ('free', 2, 10000, 5, 1073741824),
+    ('pro', 10, 1000000, 200, 107374182400),
+    ('enterprise', NULL, NULL, NULL, NULL)
+ON CONFLICT (name) DO NOTHING;
+
+-- Usage metering: the organization a job is billed to (NULL bills the
+-- submitting user) and the compounds and MD nanoseconds it consumes,
+-- estimated at submission and replaced by the actual figures on success.
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS organization_id INTEGER;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS compounds BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS md_ns DOUBLE PRECISION NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_jobs_organization_id_created_at ON jobs (organization_id, created_at);
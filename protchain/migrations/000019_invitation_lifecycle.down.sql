@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_invitations_pending_expires_at;
+DROP INDEX IF EXISTS idx_invitations_organization_id;
+DROP INDEX IF EXISTS idx_invitations_lower_email;
+CREATE INDEX IF NOT EXISTS idx_invitations_email ON invitations (email);
+DROP INDEX IF EXISTS idx_invitations_pending_email;
+ALTER TABLE invitations DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE invitations DROP COLUMN IF EXISTS send_count;
+ALTER TABLE invitations DROP COLUMN IF EXISTS sent_at;
@@ -0,0 +1,34 @@
+-- Invitation lifecycle. Admins resend and revoke invitations, a sweeper
+-- marks lapsed ones expired, and an email has at most one pending
+-- invitation per organization and team.
+ALTER TABLE invitations ADD COLUMN IF NOT EXISTS sent_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE invitations ADD COLUMN IF NOT EXISTS send_count INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE invitations ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP;
+UPDATE invitations SET sent_at = created_at WHERE sent_at IS NULL;
+
+-- Team invitations also name the team's organization, so they are listed
+-- and deleted with it
+UPDATE invitations i SET organization_id = t.organization_id
+FROM teams t
+WHERE i.team_id = t.id AND i.organization_id IS NULL;
+
+-- Lapsed and duplicate pending invitations would block the unique index;
+-- only the newest of each set of duplicates stays pending
+UPDATE invitations SET status = 'expired' WHERE status = 'pending' AND expires_at <= NOW();
+UPDATE invitations i SET status = 'revoked'
+WHERE i.status = 'pending' AND EXISTS (
+    SELECT 1 FROM invitations n
+    WHERE n.status = 'pending' AND n.id > i.id
+      AND n.organization_id IS NOT DISTINCT FROM i.organization_id
+      AND n.team_id IS NOT DISTINCT FROM i.team_id
+      AND lower(n.email) = lower(i.email)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_invitations_pending_email
+    ON invitations (COALESCE(organization_id, 0), COALESCE(team_id, 0), lower(email))
+    WHERE status = 'pending';
+-- Emails are matched case-insensitively
+DROP INDEX IF EXISTS idx_invitations_email;
+CREATE INDEX IF NOT EXISTS idx_invitations_lower_email ON invitations (lower(email));
+CREATE INDEX IF NOT EXISTS idx_invitations_organization_id ON invitations (organization_id);
+CREATE INDEX IF NOT EXISTS idx_invitations_pending_expires_at ON invitations (expires_at) WHERE status = 'pending';
@@ -0,0 +1,9 @@
+// Package migrations holds the versioned schema migrations, embedded into
+// the binary. Files are named NNNNNN_description.up.sql and
+// NNNNNN_description.down.sql; each pair is applied in one transaction.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS